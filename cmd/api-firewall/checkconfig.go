@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/wallarm/api-firewall/cmd/api-firewall/internal/handlers"
+	"github.com/wallarm/api-firewall/internal/config"
+	"github.com/wallarm/api-firewall/internal/platform/basicauth"
+	"github.com/wallarm/api-firewall/internal/platform/loader"
+	woauth2 "github.com/wallarm/api-firewall/internal/platform/oauth2"
+	wvalidator "github.com/wallarm/api-firewall/internal/platform/validator"
+	"github.com/wallarm/api-firewall/internal/platform/web"
+)
+
+// checkTimeout is the timeout of the network checks
+const checkTimeout = 5 * time.Second
+
+type checkResult struct {
+	Check   string `json:"check"`
+	Message string `json:"message"`
+}
+
+type checkReport struct {
+	Valid    bool          `json:"valid"`
+	Errors   []checkResult `json:"errors"`
+	Warnings []checkResult `json:"warnings"`
+}
+
+func (r *checkReport) error(check string, err error) {
+	r.Errors = append(r.Errors, checkResult{Check: check, Message: err.Error()})
+}
+
+func (r *checkReport) warning(check, format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, checkResult{Check: check, Message: fmt.Sprintf(format, args...)})
+}
+
+// checkConfig loads the configuration and the API Specs, checks the referenced files and endpoints
+// and writes the JSON report to out. The error is returned if the report contains errors
+func checkConfig(cfg *config.APIFWConfiguration, logger *logrus.Logger, out io.Writer) error {
+
+	// the report is the only output of the command
+	logger.SetLevel(logrus.ErrorLevel)
+
+	report := checkReport{
+		Errors:   []checkResult{},
+		Warnings: []checkResult{},
+	}
+
+	if err := validateConfig(cfg); err != nil {
+		report.error("config", err)
+	}
+
+	checkSpecs(cfg, logger, &report)
+	checkUpstream(cfg, &report)
+	checkTLS(cfg, &report)
+	checkOauth(cfg, logger, &report)
+
+	files := []struct {
+		check string
+		file  string
+	}{
+		{"denylist.tokens", cfg.Denylist.Tokens.File},
+		{"denylist.jti", cfg.Denylist.JTI.File},
+	}
+	for _, crl := range cfg.TLS.Revocation.CRLFiles {
+		files = append(files, struct {
+			check string
+			file  string
+		}{"tls.revocation.crl", crl})
+	}
+	for _, f := range files {
+		if f.file == "" {
+			continue
+		}
+		if _, err := os.ReadFile(f.file); err != nil {
+			report.error(f.check, err)
+		}
+	}
+
+	// the malformed entries of the htpasswd file are reported
+	if cfg.BasicAuth.HtpasswdFile != "" {
+		if _, err := basicauth.NewHtpasswd(cfg.BasicAuth.HtpasswdFile, logger); err != nil {
+			report.error("basic_auth.htpasswd", err)
+		}
+	}
+
+	if cfg.RequestValidation == web.ValidationDisable && cfg.ResponseValidation == web.ValidationDisable {
+		report.warning("config", "request and response validation are disabled")
+	}
+
+	if cfg.AdminAPIHost != "" && cfg.AdminAPIToken == "" && loopbackAddress(cfg.AdminAPIHost) {
+		report.warning("admin", "admin API is enabled without the token")
+	}
+
+	report.Valid = len(report.Errors) == 0
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "generating check report")
+	}
+	fmt.Fprintln(out, string(data))
+
+	if !report.Valid {
+		return errors.Errorf("configuration check failed: %d error(s)", len(report.Errors))
+	}
+
+	return nil
+}
+
+// checkSpecs loads the API Spec, the API Spec versions and the protobuf descriptors
+func checkSpecs(cfg *config.APIFWConfiguration, logger *logrus.Logger, report *checkReport) {
+
+	if cfg.APISpecsGit.Repository != "" {
+		gitSpecs := loader.NewGit(&cfg.APISpecsGit, logger)
+		if _, err := gitSpecs.Fetch(context.Background()); err != nil {
+			report.error("api_specs.git", err)
+			return
+		}
+		cfg.APISpecs = gitSpecs.SpecPath()
+	}
+
+	if _, err := loadSwagger(cfg.APISpecs, cfg, logger); err != nil {
+		report.error("api_specs", err)
+	}
+
+	versionSpecs, err := handlers.ParseVersionSpecs(cfg.APIVersions.Specs)
+	if err != nil {
+		report.error("api_versions", err)
+	}
+
+	for version, apiSpecs := range versionSpecs {
+		if _, err := loadSwagger(apiSpecs, cfg, logger); err != nil {
+			report.error("api_versions."+version, err)
+		}
+	}
+
+	if cfg.BodyDecoders.ProtobufDescriptors != "" {
+		if err := wvalidator.LoadProtobufDescriptors(cfg.BodyDecoders.ProtobufDescriptors); err != nil {
+			report.error("body_decoders.protobuf", err)
+		}
+	}
+}
+
+// checkUpstream resolves the host of the upstream and checks that it accepts connections
+func checkUpstream(cfg *config.APIFWConfiguration, report *checkReport) {
+
+	serverUrl, err := url.ParseRequestURI(cfg.Server.URL)
+	if err != nil {
+		report.error("server.url", err)
+		return
+	}
+
+	if cfg.Server.RootCA != "" {
+		checkCertPool("server.root_ca", cfg.Server.RootCA, report)
+	}
+
+	checkEndpoint("server.url", serverUrl, report)
+}
+
+// checkTLS checks the certificate and the key of the API host and the CA of the client certificates
+func checkTLS(cfg *config.APIFWConfiguration, report *checkReport) {
+
+	apiHost, err := url.ParseRequestURI(cfg.APIHost)
+	if err != nil || apiHost.Scheme != "https" {
+		return
+	}
+
+	if _, err := tls.LoadX509KeyPair(path.Join(cfg.TLS.CertsPath, cfg.TLS.CertFile), path.Join(cfg.TLS.CertsPath, cfg.TLS.CertKey)); err != nil {
+		report.error("tls.cert", err)
+	}
+
+	if cfg.TLS.ClientAuth != web.ClientAuthNone {
+		checkCertPool("tls.client_ca", path.Join(cfg.TLS.CertsPath, cfg.TLS.ClientCA), report)
+	}
+}
+
+// checkOauth checks the public key of the JWT validation and the OAuth endpoints
+func checkOauth(cfg *config.APIFWConfiguration, logger *logrus.Logger, report *checkReport) {
+
+	oauth := &cfg.Server.Oauth
+
+	switch strings.ToLower(oauth.ValidationType) {
+	case "jwt":
+		if strings.HasPrefix(strings.ToLower(oauth.JWT.SignatureAlgorithm), "rs") && oauth.JWT.PubCertFile != "" {
+			verifyBytes, err := os.ReadFile(oauth.JWT.PubCertFile)
+			if err != nil {
+				report.error("oauth.jwt.pub_cert_file", err)
+				break
+			}
+			if _, err := jwt.ParseRSAPublicKeyFromPEM(verifyBytes); err != nil {
+				report.error("oauth.jwt.pub_cert_file", err)
+			}
+		}
+	case "introspection":
+		if oauth.Introspection.Endpoint != "" {
+			endpoint, err := url.ParseRequestURI(oauth.Introspection.Endpoint)
+			if err != nil {
+				report.error("oauth.introspection.endpoint", err)
+				break
+			}
+			checkEndpoint("oauth.introspection.endpoint", endpoint, report)
+		}
+	}
+
+	if oauth.OIDC.Issuer != "" {
+		if _, err := woauth2.NewOIDC(oauth, logger); err != nil {
+			report.error("oauth.oidc.issuer", err)
+		}
+	}
+}
+
+// checkEndpoint reports the error if the host of the endpoint is not resolved and
+// the warning if the endpoint doesn't accept connections
+func checkEndpoint(check string, endpoint *url.URL, report *checkReport) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+	defer cancel()
+
+	if _, err := net.DefaultResolver.LookupHost(ctx, endpoint.Hostname()); err != nil {
+		report.error(check, err)
+		return
+	}
+
+	port := endpoint.Port()
+	if port == "" {
+		port = "80"
+		if endpoint.Scheme == "https" {
+			port = "443"
+		}
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(endpoint.Hostname(), port), checkTimeout)
+	if err != nil {
+		report.warning(check, "%s is not reachable: %s", endpoint.Host, err)
+		return
+	}
+	conn.Close()
+}
+
+// checkCertPool reports the error if the file doesn't contain the PEM encoded certificates
+func checkCertPool(check, file string, report *checkReport) {
+
+	certs, err := os.ReadFile(file)
+	if err != nil {
+		report.error(check, err)
+		return
+	}
+
+	if ok := x509.NewCertPool().AppendCertsFromPEM(certs); !ok {
+		report.error(check, errors.Errorf("no certificates found in %s", file))
+	}
+}
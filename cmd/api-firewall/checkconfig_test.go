@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/ardanlabs/conf"
+	"github.com/sirupsen/logrus"
+	"github.com/wallarm/api-firewall/internal/config"
+)
+
+// testCheckConfig returns the configuration with the default values, the bundled API Spec and the reachable upstream
+func testCheckConfig(t *testing.T) *config.APIFWConfiguration {
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	var cfg config.APIFWConfiguration
+	if err := conf.Parse([]string{"--request-validation=BLOCK", "--response-validation=BLOCK"}, namespace, &cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.APISpecs = "../../resources/test/specs/bundle/openapi.yaml"
+	cfg.Server.URL = "http://" + ln.Addr().String()
+
+	return &cfg
+}
+
+func runCheckConfig(t *testing.T, cfg *config.APIFWConfiguration) (checkReport, error) {
+
+	var out bytes.Buffer
+	err := checkConfig(cfg, logrus.New(), &out)
+
+	var report checkReport
+	if jsonErr := json.Unmarshal(out.Bytes(), &report); jsonErr != nil {
+		t.Fatalf("decoding check report %q: %s", out.String(), jsonErr)
+	}
+
+	return report, err
+}
+
+func reportChecks(results []checkResult) map[string]bool {
+	checks := make(map[string]bool, len(results))
+	for _, result := range results {
+		checks[result.Check] = true
+	}
+	return checks
+}
+
+func TestCheckConfigValid(t *testing.T) {
+
+	report, err := runCheckConfig(t, testCheckConfig(t))
+	if err != nil {
+		t.Errorf("Unexpected check error: %s", err)
+	}
+
+	if !report.Valid || len(report.Errors) != 0 || len(report.Warnings) != 0 {
+		t.Errorf("Incorrect check report. Expected: valid without errors and warnings and got %+v", report)
+	}
+}
+
+func TestCheckConfigWarnings(t *testing.T) {
+
+	cfg := testCheckConfig(t)
+	cfg.RequestValidation = "DISABLE"
+	cfg.ResponseValidation = "DISABLE"
+
+	report, err := runCheckConfig(t, cfg)
+	if err != nil {
+		t.Errorf("Unexpected check error: %s", err)
+	}
+
+	if !report.Valid || len(report.Errors) != 0 || !reportChecks(report.Warnings)["config"] {
+		t.Errorf("Incorrect check report. Expected: valid with the config warning and got %+v", report)
+	}
+}
+
+func TestCheckConfigErrors(t *testing.T) {
+
+	dir := t.TempDir()
+
+	invalidSpec := path.Join(dir, "openapi.yaml")
+	if err := os.WriteFile(invalidSpec, []byte("openapi: 3.0.1\npaths: [\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := testCheckConfig(t)
+	cfg.APISpecs = invalidSpec
+	cfg.APIHost = "https://127.0.0.1:8282"
+	cfg.TLS.CertsPath = dir
+
+	report, err := runCheckConfig(t, cfg)
+	if err == nil {
+		t.Errorf("Expected check error of the invalid configuration")
+	}
+
+	checks := reportChecks(report.Errors)
+	if report.Valid || !checks["api_specs"] || !checks["tls.cert"] {
+		t.Errorf("Incorrect check report. Expected: invalid with the api_specs and tls.cert errors and got %+v", report)
+	}
+}
+
+func TestCheckConfigHtpasswd(t *testing.T) {
+
+	testCases := []struct {
+		htpasswd string
+		valid    bool
+	}{
+		{"# users\nbcryptuser:$2a$10$xjGuvDgWautRcQLm64itguPKp5Ec2xiKhdDOBFZA7If8H3eYNf7/G\n\nshauser:{SHA}mamh5vD9jAq5fh8xZWlDJf7+2js=\n", true},
+		// the line without the separator
+		{"bcryptuser:$2a$10$xjGuvDgWautRcQLm64itguPKp5Ec2xiKhdDOBFZA7If8H3eYNf7/G\nshauser\n", false},
+		{":{SHA}mamh5vD9jAq5fh8xZWlDJf7+2js=\n", false},
+		// the plain text password
+		{"plainuser:secret\n", false},
+	}
+
+	for i, tc := range testCases {
+		htpasswdFile := path.Join(t.TempDir(), "test.htpasswd")
+		if err := os.WriteFile(htpasswdFile, []byte(tc.htpasswd), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		cfg := testCheckConfig(t)
+		cfg.BasicAuth.HtpasswdFile = htpasswdFile
+
+		if err := validateConfig(cfg); (err == nil) != tc.valid {
+			t.Errorf("Incorrect validation result of the htpasswd file %d. Expected valid: %t and got error: %v", i, tc.valid, err)
+		}
+
+		report, _ := runCheckConfig(t, cfg)
+		if checks := reportChecks(report.Errors); checks["basic_auth.htpasswd"] == tc.valid {
+			t.Errorf("Incorrect check report of the htpasswd file %d. Expected valid: %t and got %+v", i, tc.valid, report)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/wallarm/api-firewall/cmd/api-firewall/internal/handlers"
+	"github.com/wallarm/api-firewall/internal/config"
+	"github.com/wallarm/api-firewall/internal/platform/loader"
+	"github.com/wallarm/api-firewall/internal/platform/maintenance"
+	"github.com/wallarm/api-firewall/internal/platform/modes"
+)
+
+const (
+	// kvSpecKey is the key of the API Spec under the watched prefix
+	kvSpecKey = "spec"
+
+	// kvSettingsKey is the key of the JSON encoded runtime settings under the watched prefix
+	kvSettingsKey = "settings"
+)
+
+// kvSettings are the runtime settings shared by the APIFW instances
+type kvSettings struct {
+	Validation  *modes.Status       `json:"validation"`
+	Maintenance *maintenance.Status `json:"maintenance"`
+}
+
+// configWatcher applies the API Spec and the settings stored in the key-value store. The malformed
+// values are not applied and the last known good API Spec and settings are kept
+type configWatcher struct {
+	cfg         *config.APIFWConfiguration
+	kv          *loader.KV
+	logger      *logrus.Logger
+	specs       *handlers.Specs
+	maintenance *maintenance.Mode
+	modes       *modes.Overrides
+
+	specHash     [sha256.Size]byte
+	settingsHash [sha256.Size]byte
+}
+
+// run watches the key-value store until the process is stopped
+func (w *configWatcher) run() {
+	for {
+		values, changed, err := w.kv.Fetch()
+		if err != nil {
+			w.logger.Errorf("%s: watching %s%s: %s", logPrefix, w.kv.Cfg.Address, w.kv.Cfg.Prefix, err.Error())
+			time.Sleep(w.kv.Cfg.PollInterval)
+			continue
+		}
+
+		if changed {
+			w.apply(values)
+		}
+
+		time.Sleep(w.kv.Wait())
+	}
+}
+
+// apply loads the changed API Spec and settings. The removed keys don't change the current values
+func (w *configWatcher) apply(values map[string][]byte) {
+
+	if spec, ok := values[kvSpecKey]; ok {
+		if hash := sha256.Sum256(spec); hash != w.specHash {
+			w.specHash = hash
+			if err := w.applySpec(spec); err != nil {
+				w.logger.Errorf("%s: applying API Spec from %s: %s: the last known good API Spec is kept", logPrefix, w.kv.Cfg.Provider, err.Error())
+			} else {
+				w.logger.Infof("%s: API Spec applied from %s", logPrefix, w.kv.Cfg.Provider)
+			}
+		}
+	}
+
+	if settings, ok := values[kvSettingsKey]; ok {
+		if hash := sha256.Sum256(settings); hash != w.settingsHash {
+			w.settingsHash = hash
+			if err := w.applySettings(settings); err != nil {
+				w.logger.Errorf("%s: applying settings from %s: %s: the last known good settings are kept", logPrefix, w.kv.Cfg.Provider, err.Error())
+			} else {
+				w.logger.Infof("%s: settings applied from %s", logPrefix, w.kv.Cfg.Provider)
+			}
+		}
+	}
+}
+
+// applySpec loads the API Spec the same way as the API Spec loaded at startup
+func (w *configWatcher) applySpec(spec []byte) error {
+
+	swagRouter, err := loadSwaggerData(spec, "", w.cfg)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.specs.Load(swagRouter)
+
+	return err
+}
+
+// applySettings decodes and validates the settings before applying, so the malformed settings are not applied partially
+func (w *configWatcher) applySettings(data []byte) error {
+
+	var settings kvSettings
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&settings); err != nil {
+		return errors.Wrap(err, "decoding settings")
+	}
+
+	if settings.Validation != nil {
+		if err := w.modes.Load(*settings.Validation); err != nil {
+			return err
+		}
+	}
+
+	if settings.Maintenance != nil {
+		w.maintenance.Set(*settings.Maintenance)
+	}
+
+	return nil
+}
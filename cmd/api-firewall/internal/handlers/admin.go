@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/config"
+	"github.com/wallarm/api-firewall/internal/platform/classification"
+	"github.com/wallarm/api-firewall/internal/platform/denylist"
+	"github.com/wallarm/api-firewall/internal/platform/learning"
+	"github.com/wallarm/api-firewall/internal/platform/maintenance"
+	"github.com/wallarm/api-firewall/internal/platform/modes"
+	"github.com/wallarm/api-firewall/internal/platform/pii"
+	"github.com/wallarm/api-firewall/internal/platform/proxy"
+	"github.com/wallarm/api-firewall/internal/platform/replay"
+	"github.com/wallarm/api-firewall/internal/platform/router"
+	"github.com/wallarm/api-firewall/internal/platform/web"
+)
+
+type Admin struct {
+	Token        string
+	Logger       *logrus.Logger
+	Config       *config.APIFWConfiguration
+	Specs        *Specs
+	Pool         proxy.Pool
+	Maintenance  *maintenance.Mode
+	Modes        *modes.Overrides
+	DeniedTokens *denylist.DeniedTokens
+}
+
+// Authorized checks the bearer token of the admin API request. Only the requests from the loopback
+// address are allowed if the token is not configured
+func (a Admin) Authorized(ctx *fasthttp.RequestCtx) bool {
+	if a.Token == "" {
+		return ctx.RemoteIP().IsLoopback()
+	}
+
+	return subtle.ConstantTimeCompare(ctx.Request.Header.Peek(fasthttp.HeaderAuthorization), []byte("Bearer "+a.Token)) == 1
+}
+
+// UploadSpec loads the API Spec from the request body and responds with the
+// changes of the enforced operations and schemas
+func (a Admin) UploadSpec(ctx *fasthttp.RequestCtx) error {
+
+	swagger, err := openapi3.NewLoader().LoadFromData(ctx.Request.Body())
+	if err != nil {
+		return web.Respond(ctx, web.ErrorResponse{Error: fmt.Sprintf("loading API Spec: %s", err)}, fasthttp.StatusBadRequest)
+	}
+
+	swagRouter, err := router.NewRouter(swagger)
+	if err != nil {
+		return web.Respond(ctx, web.ErrorResponse{Error: fmt.Sprintf("parsing API Spec: %s", err)}, fasthttp.StatusBadRequest)
+	}
+
+	diff, err := a.Specs.Load(swagRouter)
+	if err != nil {
+		return web.Respond(ctx, web.ErrorResponse{Error: fmt.Sprintf("loading API Spec: %s", err)}, fasthttp.StatusUnprocessableEntity)
+	}
+
+	return web.Respond(ctx, diff, fasthttp.StatusOK)
+}
+
+// Spec responds with the enforced API Spec. The referenced files are bundled into the single document
+func (a Admin) Spec(ctx *fasthttp.RequestCtx) error {
+	return web.Respond(ctx, a.Specs.Router().Spec, fasthttp.StatusOK)
+}
+
+// EffectiveConfig responds with the effective configuration with the secrets redacted and the metadata of the enforced API Spec
+func (a Admin) EffectiveConfig(ctx *fasthttp.RequestCtx) error {
+
+	data := struct {
+		Config interface{}         `json:"config"`
+		Spec   router.SpecMetadata `json:"spec"`
+	}{
+		Config: config.Redacted(a.Config),
+		Spec:   a.Specs.Router().Metadata(),
+	}
+
+	return web.Respond(ctx, data, fasthttp.StatusOK)
+}
+
+// SpecDiff responds with the changes made by the last API Spec load
+func (a Admin) SpecDiff(ctx *fasthttp.RequestCtx) error {
+
+	diff := a.Specs.LastDiff()
+	if diff == nil {
+		return web.Respond(ctx, web.ErrorResponse{Error: "API Spec has not been reloaded"}, fasthttp.StatusNotFound)
+	}
+
+	return web.Respond(ctx, diff, fasthttp.StatusOK)
+}
+
+// PoolStats responds with the usage statistics of the proxy pool
+func (a Admin) PoolStats(ctx *fasthttp.RequestCtx) error {
+	return web.Respond(ctx, a.Pool.Stats(), fasthttp.StatusOK)
+}
+
+// ResizePool changes the capacity of the proxy pool and responds with the pool statistics
+func (a Admin) ResizePool(ctx *fasthttp.RequestCtx) error {
+
+	var request struct {
+		Capacity int `json:"capacity"`
+	}
+
+	if err := json.Unmarshal(ctx.Request.Body(), &request); err != nil {
+		return web.Respond(ctx, web.ErrorResponse{Error: fmt.Sprintf("parsing request: %s", err)}, fasthttp.StatusBadRequest)
+	}
+
+	if err := a.Pool.Resize(request.Capacity); err != nil {
+		return web.Respond(ctx, web.ErrorResponse{Error: fmt.Sprintf("resizing pool: %s", err)}, fasthttp.StatusBadRequest)
+	}
+
+	a.Logger.Infof("Proxy pool resized to %d clients", request.Capacity)
+
+	return web.Respond(ctx, a.Pool.Stats(), fasthttp.StatusOK)
+}
+
+// MaintenanceStatus responds with the state of the maintenance mode
+func (a Admin) MaintenanceStatus(ctx *fasthttp.RequestCtx) error {
+	return web.Respond(ctx, a.Maintenance.Status(), fasthttp.StatusOK)
+}
+
+// SetMaintenance enables or disables the maintenance mode globally or for the operations
+// and responds with the state of the maintenance mode
+func (a Admin) SetMaintenance(ctx *fasthttp.RequestCtx) error {
+
+	var status maintenance.Status
+	if err := json.Unmarshal(ctx.Request.Body(), &status); err != nil {
+		return web.Respond(ctx, web.ErrorResponse{Error: fmt.Sprintf("parsing request: %s", err)}, fasthttp.StatusBadRequest)
+	}
+
+	a.Maintenance.Set(status)
+
+	a.Logger.WithFields(logrus.Fields{
+		"enabled":    status.Enabled,
+		"operations": status.Operations,
+	}).Info("Maintenance mode changed")
+
+	return web.Respond(ctx, a.Maintenance.Status(), fasthttp.StatusOK)
+}
+
+// ValidationModes responds with the validation modes overridden at runtime
+func (a Admin) ValidationModes(ctx *fasthttp.RequestCtx) error {
+	return web.Respond(ctx, a.Modes.Status(), fasthttp.StatusOK)
+}
+
+// SetValidationMode overrides the request and the response validation modes globally or for the operation
+// selected by operationId or by the method and the path. The empty modes reset the overrides.
+// The change is logged with the previous modes and the client address
+func (a Admin) SetValidationMode(ctx *fasthttp.RequestCtx) error {
+
+	var request struct {
+		Operation string `json:"operation"`
+		modes.Mode
+	}
+
+	if err := json.Unmarshal(ctx.Request.Body(), &request); err != nil {
+		return web.Respond(ctx, web.ErrorResponse{Error: fmt.Sprintf("parsing request: %s", err)}, fasthttp.StatusBadRequest)
+	}
+
+	previous, err := a.Modes.Set(request.Operation, request.Mode)
+	if err != nil {
+		return web.Respond(ctx, web.ErrorResponse{Error: err.Error()}, fasthttp.StatusBadRequest)
+	}
+
+	a.Logger.WithFields(logrus.Fields{
+		"operation":                    request.Operation,
+		"request_validation":           request.Request,
+		"response_validation":          request.Response,
+		"previous_request_validation":  previous.Request,
+		"previous_response_validation": previous.Response,
+		"client_address":               ctx.RemoteAddr(),
+	}).Warn("Validation mode changed")
+
+	return web.Respond(ctx, a.Modes.Status(), fasthttp.StatusOK)
+}
+
+// PIIReport responds with the number of the PII matches found in the responses by endpoint and type
+func (a Admin) PIIReport(ctx *fasthttp.RequestCtx) error {
+	return web.Respond(ctx, pii.Detections.Snapshot(), fasthttp.StatusOK)
+}
+
+// DataClassification responds with the number of the responses with the classified fields by endpoint, classification and field
+func (a Admin) DataClassification(ctx *fasthttp.RequestCtx) error {
+	return web.Respond(ctx, classification.Flows.Snapshot(), fasthttp.StatusOK)
+}
+
+// SchemaSuggestions responds with the schema updates suggested by the request bodies observed
+// in the LOG_ONLY validation mode by operation
+func (a Admin) SchemaSuggestions(ctx *fasthttp.RequestCtx) error {
+	return web.Respond(ctx, learning.Suggestions.Snapshot(), fasthttp.StatusOK)
+}
+
+// ResetSchemaSuggestions removes the suggestions of the operation set by the operation query
+// parameter or all suggestions
+func (a Admin) ResetSchemaSuggestions(ctx *fasthttp.RequestCtx) error {
+
+	operation := string(ctx.QueryArgs().Peek("operation"))
+	learning.Suggestions.Reset(operation)
+
+	a.Logger.WithFields(logrus.Fields{
+		"operation":      operation,
+		"client_address": ctx.RemoteAddr(),
+	}).Info("Schema suggestions reset")
+
+	return web.Respond(ctx, nil, fasthttp.StatusNoContent)
+}
+
+// DeniedRequests responds with the stored requests blocked by the request validation
+func (a Admin) DeniedRequests(ctx *fasthttp.RequestCtx) error {
+	return web.Respond(ctx, replay.Denied.List(), fasthttp.StatusOK)
+}
+
+// RemoveDeniedRequests removes the stored requests with the IDs
+func (a Admin) RemoveDeniedRequests(ctx *fasthttp.RequestCtx) error {
+
+	var request struct {
+		IDs []string `json:"ids"`
+	}
+
+	if err := json.Unmarshal(ctx.Request.Body(), &request); err != nil {
+		return web.Respond(ctx, web.ErrorResponse{Error: fmt.Sprintf("parsing request: %s", err)}, fasthttp.StatusBadRequest)
+	}
+
+	replay.Denied.Remove(request.IDs)
+
+	return web.Respond(ctx, nil, fasthttp.StatusNoContent)
+}
+
+// ReplayDeniedRequests validates the stored requests with the IDs (all stored requests if the IDs are not set)
+// by the enforced API Spec and responds with the results
+func (a Admin) ReplayDeniedRequests(ctx *fasthttp.RequestCtx) error {
+
+	var request struct {
+		IDs []string `json:"ids"`
+	}
+
+	if len(ctx.Request.Body()) > 0 {
+		if err := json.Unmarshal(ctx.Request.Body(), &request); err != nil {
+			return web.Respond(ctx, web.ErrorResponse{Error: fmt.Sprintf("parsing request: %s", err)}, fasthttp.StatusBadRequest)
+		}
+	}
+
+	swagRouter := a.Specs.Router()
+
+	results := []ReplayResult{}
+	for _, envelope := range replay.Denied.Get(request.IDs) {
+		results = append(results, Revalidate(a.Config, swagRouter, envelope))
+	}
+
+	return web.Respond(ctx, results, fasthttp.StatusOK)
+}
+
+// Bans responds with the client addresses and the hashes of the tokens denied at runtime
+func (a Admin) Bans(ctx *fasthttp.RequestCtx) error {
+
+	if a.DeniedTokens == nil {
+		return web.Respond(ctx, []denylist.Ban{}, fasthttp.StatusOK)
+	}
+
+	bans, err := a.DeniedTokens.Bans(context.Background())
+	if err != nil {
+		return web.Respond(ctx, web.ErrorResponse{Error: err.Error()}, fasthttp.StatusServiceUnavailable)
+	}
+
+	return web.Respond(ctx, bans, fasthttp.StatusOK)
+}
+
+// LiftBan removes the client address or the token from the denylist
+func (a Admin) LiftBan(ctx *fasthttp.RequestCtx) error {
+
+	var request struct {
+		Kind  string `json:"kind"`
+		Value string `json:"value"`
+	}
+
+	if err := json.Unmarshal(ctx.Request.Body(), &request); err != nil {
+		return web.Respond(ctx, web.ErrorResponse{Error: fmt.Sprintf("parsing request: %s", err)}, fasthttp.StatusBadRequest)
+	}
+
+	if request.Kind != denylist.KindAddress && request.Kind != denylist.KindToken {
+		return web.Respond(ctx, web.ErrorResponse{Error: fmt.Sprintf("unsupported kind: %q", request.Kind)}, fasthttp.StatusBadRequest)
+	}
+
+	if a.DeniedTokens == nil {
+		return web.Respond(ctx, web.ErrorResponse{Error: "ban not found"}, fasthttp.StatusNotFound)
+	}
+
+	lifted, err := a.DeniedTokens.Lift(context.Background(), request.Kind, request.Value)
+	if err != nil {
+		return web.Respond(ctx, web.ErrorResponse{Error: err.Error()}, fasthttp.StatusServiceUnavailable)
+	}
+	if !lifted {
+		return web.Respond(ctx, web.ErrorResponse{Error: "ban not found"}, fasthttp.StatusNotFound)
+	}
+
+	a.Logger.WithFields(logrus.Fields{
+		"kind":           request.Kind,
+		"client_address": ctx.RemoteAddr(),
+	}).Warn("Ban lifted")
+
+	return web.Respond(ctx, nil, fasthttp.StatusNoContent)
+}
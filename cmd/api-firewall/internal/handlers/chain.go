@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fastjson"
+	"github.com/wallarm/api-firewall/internal/platform/oauth2"
+	"github.com/wallarm/api-firewall/internal/platform/proxy"
+	"github.com/wallarm/api-firewall/internal/platform/web"
+)
+
+// Stage is the step of the request handling. The middlewares registered for the stage
+// are executed before the built-in step of the stage and may stop the chain by not calling the next handler
+type Stage int
+
+const (
+	// StageRequestValidation authenticates and validates the request by the API Spec
+	StageRequestValidation Stage = iota
+	// StageProxy sends the request to the upstream
+	StageProxy
+	// StageResponseValidation validates the response and the response headers by the API Spec
+	StageResponseValidation
+	// StageResponseInspection reports the PII and the classified data of the response
+	StageResponseInspection
+
+	stagesCount
+)
+
+// exchangeKey is the key of the exchange in the user values of the request
+const exchangeKey = "apifw.exchange"
+
+var registered [stagesCount][]web.Middleware
+
+// RegisterMiddleware adds the middleware to the stage of the request handling. The middlewares
+// of the stage are executed in the order of the registration. The function is not safe for the concurrent
+// use and has to be called before the handlers are created by OpenapiProxy
+func RegisterMiddleware(stage Stage, mw web.Middleware) {
+	if stage < 0 || stage >= stagesCount {
+		panic("handlers: unknown stage")
+	}
+	registered[stage] = append(registered[stage], mw)
+}
+
+// exchange is the state of the request shared by the stages
+type exchange struct {
+	client             proxy.HTTPClient
+	requestValidation  string
+	responseValidation string
+	verdict            *web.Verdict
+	jsonParser         *fastjson.Parser
+	requestInput       *openapi3filter.RequestValidationInput
+	responseInput      *openapi3filter.ResponseValidationInput
+
+	// claims of the validated token
+	tokenClaims oauth2.Claims
+	// token of the request validated once by the consumer identification, the security requirements and the access policies
+	token *requestToken
+}
+
+// requestToken is the result of the token validation without the scopes. The scopes
+// of the security requirements and the access policies are checked by the claims of the token
+type requestToken struct {
+	validated bool
+	claims    oauth2.Claims
+	err       error
+}
+
+func exchangeOf(ctx *fasthttp.RequestCtx) *exchange {
+	return ctx.UserValue(exchangeKey).(*exchange)
+}
+
+// buildChain wraps the built-in steps of the stages by the registered middlewares
+func (s *openapiWaf) buildChain() web.Handler {
+
+	steps := [stagesCount]web.Middleware{
+		StageRequestValidation:  s.requestValidationStep,
+		StageProxy:              s.proxyStep,
+		StageResponseValidation: s.responseValidationStep,
+		StageResponseInspection: s.responseInspectionStep,
+	}
+
+	var mw []web.Middleware
+	for stage := Stage(0); stage < stagesCount; stage++ {
+		mw = append(mw, registered[stage]...)
+
+		// the responses of the validated requests are replayed by the idempotency key and
+		// the identical validated requests wait for the response of the first request
+		if stage == StageProxy && s.idempotency != nil {
+			mw = append(mw, s.idempotency)
+		}
+		if stage == StageProxy && s.coalescing != nil {
+			mw = append(mw, s.coalescing)
+		}
+		mw = append(mw, steps[stage])
+	}
+
+	var handler web.Handler = func(ctx *fasthttp.RequestCtx) error {
+		return nil
+	}
+
+	// Loop backwards through the middleware, so the first middleware is the first to be executed
+	for i := len(mw) - 1; i >= 0; i-- {
+		handler = mw[i](handler)
+	}
+
+	return handler
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/config"
+	"github.com/wallarm/api-firewall/internal/platform/experiment"
+	"github.com/wallarm/api-firewall/internal/platform/grpcweb"
+	"github.com/wallarm/api-firewall/internal/platform/modes"
+	"github.com/wallarm/api-firewall/internal/platform/proxy"
+	"github.com/wallarm/api-firewall/internal/platform/validator"
+	"github.com/wallarm/api-firewall/internal/platform/web"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// grpcWebMethod translates the gRPC-Web requests of the protobuf service method to the native gRPC
+// requests. The messages of the method are validated by the protobuf descriptors
+type grpcWebMethod struct {
+	cfg           *config.APIFWConfiguration
+	logger        *logrus.Logger
+	proxyPool     proxy.Pool
+	method        protoreflect.MethodDescriptor
+	operationKeys []string
+	modes         *modes.Overrides
+}
+
+// validateMessages validates the data messages of the frames by the descriptor
+func validateMessages(frames []byte, desc protoreflect.MessageDescriptor) error {
+	messages, _, err := grpcweb.Messages(frames)
+	if err != nil {
+		return err
+	}
+
+	for _, message := range messages {
+		if err := validator.ValidateProtobufMessage(desc, message); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (g *grpcWebMethod) grpcWebHandler(ctx *fasthttp.RequestCtx) error {
+
+	requestValidation, responseValidation := experiment.Modes(ctx, g.cfg.RequestValidation, g.cfg.ResponseValidation)
+	requestValidation, responseValidation = g.modes.Effective(g.operationKeys, requestValidation, responseValidation)
+
+	verdict := &web.Verdict{Decision: web.VerdictSkipped, Operation: g.operationKeys[0]}
+	web.SetVerdict(ctx, verdict)
+
+	contentType := strings.Split(string(ctx.Request.Header.ContentType()), ";")[0]
+
+	isGRPCWeb, text := grpcweb.Mode(contentType)
+	if !isGRPCWeb {
+		verdict.Decision = web.VerdictBlocked
+		verdict.Rule = "request-content-type"
+		verdict.Subject = contentType
+		return web.RespondError(ctx, fasthttp.StatusUnsupportedMediaType, nil)
+	}
+
+	frames, err := grpcweb.Frames(ctx.Request.Body(), text)
+	if err != nil {
+		g.logger.WithFields(logrus.Fields{
+			"error":      err,
+			"request_id": fmt.Sprintf("#%016X", ctx.ID()),
+		}).Error("error while decoding gRPC-Web request")
+
+		verdict.Decision = web.VerdictBlocked
+		verdict.Rule = "request-body-" + contentType
+		verdict.Reason = err.Error()
+		grpcweb.Error(&ctx.Response, grpcweb.StatusInvalidArgument, "request decoding error", text)
+		return nil
+	}
+
+	if requestValidation != web.ValidationDisable {
+		verdict.Decision = web.VerdictPassed
+
+		if err := validateMessages(frames, g.method.Input()); err != nil {
+			g.logger.WithFields(logrus.Fields{
+				"error":      err,
+				"method":     string(g.method.FullName()),
+				"request_id": fmt.Sprintf("#%016X", ctx.ID()),
+			}).Error("request validation error")
+
+			verdict.Decision = web.VerdictFailed
+			verdict.Rule = "request-body-" + contentType
+			verdict.Reason = err.Error()
+			verdict.Subject = "request-body"
+
+			if requestValidation == web.ValidationBlock {
+				verdict.Decision = web.VerdictBlocked
+				grpcweb.Error(&ctx.Response, grpcweb.StatusInvalidArgument, "request validation error", text)
+				return nil
+			}
+		}
+	}
+
+	grpcweb.Request(&ctx.Request, frames)
+
+	client, err := g.proxyPool.Get()
+	if err != nil {
+		g.logger.WithFields(logrus.Fields{
+			"error":      err,
+			"request_id": fmt.Sprintf("#%016X", ctx.ID()),
+		}).Error("error while proxying request")
+		return web.RespondError(ctx, fasthttp.StatusServiceUnavailable, nil)
+	}
+	defer g.proxyPool.Put(client)
+
+	if err := performProxy(ctx, g.logger, client); err != nil {
+		return err
+	}
+
+	// the upstream errors are returned to the client as is
+	if ctx.Response.StatusCode() != fasthttp.StatusOK {
+		return nil
+	}
+
+	if responseValidation != web.ValidationDisable {
+		if err := validateMessages(ctx.Response.Body(), g.method.Output()); err != nil {
+			g.logger.WithFields(logrus.Fields{
+				"error":      err,
+				"method":     string(g.method.FullName()),
+				"request_id": fmt.Sprintf("#%016X", ctx.ID()),
+			}).Error("response validation error")
+
+			if verdict.Decision != web.VerdictFailed {
+				verdict.Decision = web.VerdictFailed
+				verdict.Rule = "response-body-" + grpcweb.ContentTypeGRPC
+				verdict.Reason = err.Error()
+				verdict.Subject = "response"
+			}
+
+			if responseValidation == web.ValidationBlock {
+				verdict.Decision = web.VerdictBlocked
+				grpcweb.Error(&ctx.Response, grpcweb.StatusInternal, "response validation error", text)
+				return nil
+			}
+		}
+	}
+
+	grpcweb.Response(&ctx.Response, text)
+
+	return nil
+}
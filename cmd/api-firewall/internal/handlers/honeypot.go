@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/config"
+	"github.com/wallarm/api-firewall/internal/mid"
+	"github.com/wallarm/api-firewall/internal/platform/denylist"
+)
+
+// honeypot serves the decoy routes which are not in the API Spec. The callers of the decoy
+// routes are flagged and their tokens, and the addresses if enabled, are added to the denylist
+type honeypot struct {
+	cfg          *config.APIFWConfiguration
+	logger       *logrus.Logger
+	deniedTokens *denylist.DeniedTokens
+}
+
+func (h *honeypot) honeypotHandler(ctx *fasthttp.RequestCtx) error {
+
+	tokens := mid.DenylistTokens(h.cfg, ctx)
+
+	h.logger.WithFields(logrus.Fields{
+		"request_id":     fmt.Sprintf("#%016X", ctx.ID()),
+		"method":         string(ctx.Method()),
+		"path":           string(ctx.Path()),
+		"client_address": ctx.RemoteAddr(),
+		"user_agent":     string(ctx.UserAgent()),
+	}).Warning("honeypot route requested")
+
+	if h.deniedTokens != nil {
+		if h.cfg.Honeypot.DenyAddresses {
+			if err := h.deniedTokens.Deny(context.Background(), denylist.KindAddress, ctx.RemoteIP().String(), h.cfg.Honeypot.DenyTTL); err != nil {
+				h.logger.Errorf("honeypot: %s", err)
+			}
+		}
+		for _, token := range tokens {
+			if err := h.deniedTokens.Deny(context.Background(), denylist.KindToken, token, h.cfg.Honeypot.DenyTTL); err != nil {
+				h.logger.Errorf("honeypot: %s", err)
+			}
+		}
+	}
+
+	ctx.SetStatusCode(h.cfg.Honeypot.StatusCode)
+	ctx.SetContentType(h.cfg.Honeypot.ContentType)
+	ctx.SetBodyString(h.cfg.Honeypot.Body)
+
+	return nil
+}
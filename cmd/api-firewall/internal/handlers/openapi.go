@@ -6,8 +6,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/getkin/kin-openapi/openapi3filter"
@@ -18,92 +21,137 @@ import (
 	"github.com/valyala/fasthttp/fasthttpadaptor"
 	"github.com/valyala/fastjson"
 	"github.com/wallarm/api-firewall/internal/config"
+	"github.com/wallarm/api-firewall/internal/platform/access"
+	"github.com/wallarm/api-firewall/internal/platform/basicauth"
+	"github.com/wallarm/api-firewall/internal/platform/classification"
+	"github.com/wallarm/api-firewall/internal/platform/consumers"
+	"github.com/wallarm/api-firewall/internal/platform/experiment"
+	"github.com/wallarm/api-firewall/internal/platform/learning"
+	"github.com/wallarm/api-firewall/internal/platform/modes"
 	"github.com/wallarm/api-firewall/internal/platform/oauth2"
+	"github.com/wallarm/api-firewall/internal/platform/pii"
+	"github.com/wallarm/api-firewall/internal/platform/pools"
 	"github.com/wallarm/api-firewall/internal/platform/proxy"
+	"github.com/wallarm/api-firewall/internal/platform/replay"
+	"github.com/wallarm/api-firewall/internal/platform/responsediff"
+	"github.com/wallarm/api-firewall/internal/platform/scoring"
 	"github.com/wallarm/api-firewall/internal/platform/shadowAPI"
+	"github.com/wallarm/api-firewall/internal/platform/transform"
 	"github.com/wallarm/api-firewall/internal/platform/validator"
+	"github.com/wallarm/api-firewall/internal/platform/verdict"
+	"github.com/wallarm/api-firewall/internal/platform/verdictcache"
 	"github.com/wallarm/api-firewall/internal/platform/web"
 )
 
+// requestPool reuses the net/http requests converted from the fasthttp requests
+var requestPool = sync.Pool{
+	New: func() interface{} {
+		return new(http.Request)
+	},
+}
+
+// releaseRequest closes the body of the converted request and returns the request to the pool.
+// The headers map is kept to be reused by the next conversion
+func releaseRequest(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	*req = http.Request{Header: req.Header}
+	requestPool.Put(req)
+}
+
 type openapiWaf struct {
 	route           *routers.Route
 	proxyPool       proxy.Pool
 	logger          *logrus.Logger
 	cfg             *config.APIFWConfiguration
 	pathParamLength int
-	parserPool      *fastjson.ParserPool
+	parserPool      *pools.ParserPool
 	oauthValidator  oauth2.OAuth2
 	shadowAPI       shadowAPI.Checker
+	roles           []string
+	basicAuth       basicauth.Authenticator
+	strictHeaders   map[string]struct{}
+	modes           *modes.Overrides
+	pii             *pii.Detector
+	classified      []classification.Field
+	comparer        *responsediff.Comparer
+	operationKeys   []string
+	bodyLimits      validator.BodyLimits
+	accessPolicies  []access.Policy
+	consumers       *consumers.Profiles
+	scorer          *scoring.Scorer
+	verdictCache    *verdictcache.Cache
+	statusMode      string
+	negotiation     string
+	excludeRespBody bool
+	transform       *transform.Rules
+	respTransform   *transform.ResponseRules
+	coalescing      web.Middleware
+	idempotency     web.Middleware
+	chain           web.Handler
 }
 
-// EXPERIMENTAL feature
-// returns APIFW-Validation-Status header value
-func getValidationHeader(ctx *fasthttp.RequestCtx, err error) *string {
-	var reason = "unknown"
+// setValidationError sets the rule, the reason and the subject of the verdict by the validation error.
+// The rule is not set if the error is not classified, so the validation status header is not added
+func setValidationError(ctx *fasthttp.RequestCtx, verdict *web.Verdict, err error) {
+	verdict.Reason = err.Error()
 
-	switch err.(type) {
+	switch err := err.(type) {
 
 	case *openapi3filter.ResponseError:
-		responseError, ok := err.(*openapi3filter.ResponseError)
-
-		if ok && responseError.Reason != "" {
-			reason = responseError.Reason
+		verdict.Reason = "unknown"
+		if err.Reason != "" {
+			verdict.Reason = err.Reason
 		}
 
-		id := fmt.Sprintf("response-%d-%s", ctx.Response.StatusCode(), strings.Split(string(ctx.Response.Header.ContentType()), ";")[0])
-		value := fmt.Sprintf("%s:%s:response", id, reason)
-		return &value
+		verdict.Rule = fmt.Sprintf("response-%d-%s", ctx.Response.StatusCode(), strings.Split(string(ctx.Response.Header.ContentType()), ";")[0])
+		verdict.Subject = "response"
 
 	case *openapi3filter.RequestError:
-
-		requestError, ok := err.(*openapi3filter.RequestError)
-		if !ok {
-			return nil
+		verdict.Reason = "unknown"
+		if err.Reason != "" {
+			verdict.Reason = err.Reason
 		}
 
-		if requestError.Reason != "" {
-			reason = requestError.Reason
-		}
+		switch {
+		case errors.Is(err.Err, validator.ErrContentTypeNotAllowed):
+			verdict.Rule = "request-content-type"
+			verdict.Subject = strings.Split(string(ctx.Request.Header.ContentType()), ";")[0]
+		case err.Parameter != nil:
+			verdict.Rule = "request-parameter"
+			verdict.Subject = "request-parameter"
 
-		if requestError.Parameter != nil {
-			paramName := "request-parameter"
-
-			if requestError.Reason == "" {
-				schemaError, ok := requestError.Err.(*openapi3.SchemaError)
+			if err.Reason == "" {
+				schemaError, ok := err.Err.(*openapi3.SchemaError)
 				if ok && schemaError.Reason != "" {
-					reason = schemaError.Reason
+					verdict.Reason = schemaError.Reason
 				}
-				paramName = requestError.Parameter.Name
+				verdict.Subject = err.Parameter.Name
 			}
-
-			value := fmt.Sprintf("request-parameter:%s:%s", reason, paramName)
-			return &value
+		case err.RequestBody != nil:
+			verdict.Rule = fmt.Sprintf("request-body-%s", strings.Split(string(ctx.Request.Header.ContentType()), ";")[0])
+			verdict.Subject = "request-body"
 		}
 
-		if requestError.RequestBody != nil {
-			id := fmt.Sprintf("request-body-%s", strings.Split(string(ctx.Request.Header.ContentType()), ";")[0])
-			value := fmt.Sprintf("%s:%s:request-body", id, reason)
-			return &value
-		}
 	case *openapi3filter.SecurityRequirementsError:
 
 		secSchemeName := ""
-		for _, scheme := range err.(*openapi3filter.SecurityRequirementsError).SecurityRequirements {
+		for _, scheme := range err.SecurityRequirements {
 			for key := range scheme {
 				secSchemeName += key + ","
 			}
 		}
 
 		secErrors := ""
-		for _, secError := range err.(*openapi3filter.SecurityRequirementsError).Errors {
+		for _, secError := range err.Errors {
 			secErrors += secError.Error() + ","
 		}
 
-		value := fmt.Sprintf("security-requirements-%s:%s:%s", strings.TrimSuffix(secSchemeName, ","), strings.TrimSuffix(secErrors, ","), strings.TrimSuffix(secSchemeName, ","))
-		return &value
+		verdict.Rule = "security-requirements-" + strings.TrimSuffix(secSchemeName, ",")
+		verdict.Reason = strings.TrimSuffix(secErrors, ",")
+		verdict.Subject = strings.TrimSuffix(secSchemeName, ",")
 	}
-
-	return nil
 }
 
 // Proxy request
@@ -126,8 +174,145 @@ func performProxy(ctx *fasthttp.RequestCtx, logger *logrus.Logger, client proxy.
 	return nil
 }
 
+// performProxy proxies the request to the upstream and sets the upstream time of the verdict. The copy of
+// the request is sent to the comparison upstream if the response diff mode is enabled
+func (s *openapiWaf) performProxy(ctx *fasthttp.RequestCtx, client proxy.HTTPClient) error {
+	start := time.Now()
+	defer func() {
+		if verdict := web.GetVerdict(ctx); verdict != nil {
+			verdict.UpstreamTime = time.Since(start)
+		}
+	}()
+
+	if s.comparer == nil || !s.comparer.Sampled() {
+		return performProxy(ctx, s.logger, client)
+	}
+
+	req := fasthttp.AcquireRequest()
+	ctx.Request.CopyTo(req)
+
+	if err := performProxy(ctx, s.logger, client); err != nil {
+		fasthttp.ReleaseRequest(req)
+		return err
+	}
+
+	// the primary response is compared as is, so the upstream errors are reported as the status difference
+	s.comparer.Compare(ctx.ID(), req, &ctx.Response)
+
+	return nil
+}
+
+// transformRequest applies the transformation rules of the operation. The request is proxied as is
+// if the transformation fails
+func (s *openapiWaf) transformRequest(ctx *fasthttp.RequestCtx) {
+	if s.transform == nil {
+		return
+	}
+
+	if err := s.transform.Apply(&ctx.Request, s.route); err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"error":      err,
+			"request_id": fmt.Sprintf("#%016X", ctx.ID()),
+		}).Error("request transformation error")
+	}
+}
+
+// validateRequest validates the request by the spec and rejects the undocumented headers in the strict headers mode.
+// The size of the body is checked before the body is parsed
+func (s *openapiWaf) validateRequest(ctx context.Context, input *openapi3filter.RequestValidationInput, jsonParser *fastjson.Parser) error {
+	if limit := s.bodyLimits.Request; limit > 0 && input.Request.ContentLength > limit {
+		requestError := &openapi3filter.RequestError{
+			Input:  input,
+			Reason: fmt.Sprintf("request body is larger than %d bytes", limit),
+			Err:    validator.ErrBodyTooLarge,
+		}
+		if s.route.Operation.RequestBody != nil {
+			requestError.RequestBody = s.route.Operation.RequestBody.Value
+		}
+		return requestError
+	}
+
+	if err := validator.ValidateRequest(ctx, input, jsonParser); err != nil {
+		return err
+	}
+
+	if s.cfg.StrictContentType.Request {
+		if err := validator.ValidateRequestContentType(input); err != nil {
+			return err
+		}
+	}
+
+	if s.strictHeaders != nil {
+		return validator.ValidateUndocumentedHeaders(input, s.cfg.StrictHeaders.Prefix, s.strictHeaders)
+	}
+
+	return nil
+}
+
+// validateResponse validates the response by the spec and rejects the undeclared Content-Type in the strict content type mode.
+// The size of the body is checked before the body is parsed
+func (s *openapiWaf) validateResponse(ctx *fasthttp.RequestCtx, input *openapi3filter.ResponseValidationInput, jsonParser *fastjson.Parser) error {
+	if limit := s.bodyLimits.Response(input.Status); limit > 0 && int64(len(ctx.Response.Body())) > limit {
+		return &openapi3filter.ResponseError{
+			Input:  input,
+			Reason: fmt.Sprintf("response body is larger than %d bytes", limit),
+			Err:    validator.ErrBodyTooLarge,
+		}
+	}
+
+	if s.cfg.StrictContentType.Response {
+		if err := validator.ValidateResponseContentType(input, len(ctx.Response.Body())); err != nil {
+			return err
+		}
+	}
+
+	return validator.ValidateResponse(ctx, input, jsonParser)
+}
+
+// setVerdict passes the request validation verdict signed by the shared secret to the upstream
+// if the verdict signing is enabled. The verdict headers sent by the client are replaced
+func (s *openapiWaf) setVerdict(ctx *fasthttp.RequestCtx, v *web.Verdict) {
+	if s.cfg.VerdictSigning.Secret == "" {
+		return
+	}
+
+	var status string
+	if validationStatus := v.ValidationStatus(); validationStatus != nil {
+		status = *validationStatus
+		ctx.Request.Header.Set(web.ValidationStatus, status)
+	} else {
+		ctx.Request.Header.Del(web.ValidationStatus)
+	}
+
+	ctx.Request.Header.Set(web.VerdictHeader, v.Decision)
+	ctx.Request.Header.Set(web.VerdictSignatureHeader, verdict.Sign([]byte(s.cfg.VerdictSigning.Secret), time.Now(),
+		fmt.Sprintf("%016X", ctx.ID()), string(ctx.Method()), string(ctx.RequestURI()), v.Decision, status))
+}
+
+// block responds by the block status code. The validation status header is added to the response if enabled
+func (s *openapiWaf) block(ctx *fasthttp.RequestCtx, verdict *web.Verdict) error {
+	verdict.Decision = web.VerdictBlocked
+
+	if s.cfg.AddValidationStatusHeader {
+		if vh := verdict.ValidationStatus(); vh != nil {
+			s.logger.WithFields(logrus.Fields{
+				"request_id": fmt.Sprintf("#%016X", ctx.ID()),
+			}).Errorf("add header %s: %s", web.ValidationStatus, *vh)
+			return web.RespondError(ctx, s.cfg.CustomBlockStatusCode, vh)
+		}
+	}
+
+	return web.RespondError(ctx, s.cfg.CustomBlockStatusCode, nil)
+}
+
 func (s *openapiWaf) openapiWafHandler(ctx *fasthttp.RequestCtx) error {
 
+	// the time spent in the routing and the middlewares before the handler
+	var routingTime time.Duration
+	if !ctx.Time().IsZero() {
+		routingTime = time.Since(ctx.Time())
+	}
+
 	client, err := s.proxyPool.Get()
 	if err != nil {
 		s.logger.WithFields(logrus.Fields{
@@ -138,25 +323,121 @@ func (s *openapiWaf) openapiWafHandler(ctx *fasthttp.RequestCtx) error {
 	}
 	defer s.proxyPool.Put(client)
 
+	// the claims headers are set by APIFW only
+	for header := range s.cfg.Server.Oauth.ClaimsHeaders {
+		ctx.Request.Header.Del(header)
+	}
+
+	// the validation modes of the experiment cohort can be overridden at runtime by the admin API
+	requestValidation, responseValidation := experiment.Modes(ctx, s.cfg.RequestValidation, s.cfg.ResponseValidation)
+	requestValidation, responseValidation = s.modes.Effective(s.operationKeys, requestValidation, responseValidation)
+
+	// the verdict is used by the middlewares after the request is handled
+	verdict := &web.Verdict{Decision: web.VerdictSkipped, RoutingTime: routingTime}
+	if len(s.operationKeys) > 0 {
+		verdict.Operation = s.operationKeys[0]
+	}
+	web.SetVerdict(ctx, verdict)
+
+	// the timing breakdown is added to the response after the request is handled
+	if s.cfg.AddTimingHeader {
+		defer func() {
+			ctx.Response.Header.Set(web.TimingHeader, verdict.ServerTiming())
+		}()
+	}
+
+	// the token is validated once by the consumer identification and the authentication
+	token := &requestToken{}
+
+	// the consumer profile restricts the operations, limits the rate and the simultaneous requests and overrides the validation modes
+	if s.consumers != nil {
+		if profile := s.consumer(ctx, token); profile != nil {
+			if s.route != nil && !profile.Allows(s.operationKeys, s.route.Operation.Tags) {
+				s.logger.WithFields(logrus.Fields{
+					"consumer":   profile.Name,
+					"operation":  verdict.Operation,
+					"request_id": fmt.Sprintf("#%016X", ctx.ID()),
+				}).Error("operation is not allowed for the consumer")
+
+				verdict.Rule = "consumer"
+				verdict.Reason = "operation is not allowed"
+				verdict.Subject = profile.Name
+				return s.block(ctx, verdict)
+			}
+
+			if limiter := profile.Limiter(); limiter != nil && !limiter.Allow(profile.Name) {
+				s.logger.WithFields(logrus.Fields{
+					"consumer":   profile.Name,
+					"operation":  verdict.Operation,
+					"request_id": fmt.Sprintf("#%016X", ctx.ID()),
+				}).Info("request blocked: consumer rate limit exceeded")
+
+				verdict.Decision = web.VerdictBlocked
+				verdict.Rule = "ratelimit"
+				verdict.Subject = profile.Name
+				err := web.RespondError(ctx, fasthttp.StatusTooManyRequests, nil)
+				ctx.Response.Header.Set(fasthttp.HeaderRetryAfter, fmt.Sprint(math.Ceil(limiter.RetryAfter().Seconds())))
+				return err
+			}
+
+			if limiter := profile.ConcurrencyLimiter(); limiter != nil {
+				if !limiter.Acquire(profile.Name) {
+					s.logger.WithFields(logrus.Fields{
+						"consumer":       profile.Name,
+						"operation":      verdict.Operation,
+						"max_concurrent": limiter.Max(),
+						"request_id":     fmt.Sprintf("#%016X", ctx.ID()),
+					}).Info("request blocked: consumer concurrency limit exceeded")
+
+					verdict.Decision = web.VerdictBlocked
+					verdict.Rule = "concurrency"
+					verdict.Subject = profile.Name
+					return web.RespondError(ctx, fasthttp.StatusTooManyRequests, nil)
+				}
+				defer limiter.Release(profile.Name)
+			}
+
+			if profile.Validation.Request != "" {
+				requestValidation = profile.Validation.Request
+			}
+			if profile.Validation.Response != "" {
+				responseValidation = profile.Validation.Response
+			}
+		}
+	}
+
 	// Proxy request if APIFW is disabled
-	if s.cfg.RequestValidation == web.ValidationDisable && s.cfg.ResponseValidation == web.ValidationDisable {
-		return performProxy(ctx, s.logger, client)
+	if requestValidation == web.ValidationDisable && responseValidation == web.ValidationDisable &&
+		(s.cfg.ResponseHeadersValidation == "" || s.cfg.ResponseHeadersValidation == web.ValidationDisable) &&
+		(s.statusMode == "" || s.statusMode == web.ValidationDisable) &&
+		(s.negotiation == "" || s.negotiation == web.ValidationDisable) {
+		proxyRequest := func(ctx *fasthttp.RequestCtx) error {
+			s.transformRequest(ctx)
+			s.setVerdict(ctx, verdict)
+			return s.performProxy(ctx, client)
+		}
+		if s.coalescing != nil {
+			proxyRequest = s.coalescing(proxyRequest)
+		}
+		if s.idempotency != nil {
+			proxyRequest = s.idempotency(proxyRequest)
+		}
+		return proxyRequest(ctx)
 	}
 
 	// If Validation is BLOCK for request and response then respond by CustomBlockStatusCode
 	if s.route == nil {
-		if s.cfg.RequestValidation == web.ValidationBlock || s.cfg.ResponseValidation == web.ValidationBlock {
-			if s.cfg.AddValidationStatusHeader {
-				vh := "request: route not found"
-				return web.RespondError(ctx, s.cfg.CustomBlockStatusCode, &vh)
-			}
-			return web.RespondError(ctx, s.cfg.CustomBlockStatusCode, nil)
+		if requestValidation == web.ValidationBlock || responseValidation == web.ValidationBlock {
+			verdict.Rule = "request"
+			verdict.Reason = "route not found"
+			return s.block(ctx, verdict)
 		}
 
 		// Check shadow api if path or method are not found and validation mode is LOG_ONLY
-		if s.cfg.RequestValidation == web.ValidationLog || s.cfg.ResponseValidation == web.ValidationLog {
+		if requestValidation == web.ValidationLog || responseValidation == web.ValidationLog {
 			// Check Shadow API endpoints
-			err := performProxy(ctx, s.logger, client)
+			s.setVerdict(ctx, verdict)
+			err := s.performProxy(ctx, client)
 			if sErr := s.shadowAPI.Check(ctx); sErr != nil {
 				s.logger.WithFields(logrus.Fields{
 					"error":      err,
@@ -173,14 +454,17 @@ func (s *openapiWaf) openapiWafHandler(ctx *fasthttp.RequestCtx) error {
 		pathParams = make(map[string]string, s.pathParamLength)
 
 		ctx.VisitUserValues(func(key []byte, value interface{}) {
-			keyStr := strconv.B2S(key)
-			pathParams[keyStr] = value.(string)
+			if param, ok := value.(string); ok {
+				pathParams[strconv.B2S(key)] = param
+			}
 		})
 	}
 
 	// Convert fasthttp request to net/http request
-	req := http.Request{}
-	if err := fasthttpadaptor.ConvertRequest(ctx, &req, false); err != nil {
+	req := requestPool.Get().(*http.Request)
+	defer releaseRequest(req)
+
+	if err := fasthttpadaptor.ConvertRequest(ctx, req, false); err != nil {
 		s.logger.WithFields(logrus.Fields{
 			"error":      err,
 			"request_id": fmt.Sprintf("#%016X", ctx.ID()),
@@ -188,144 +472,561 @@ func (s *openapiWaf) openapiWafHandler(ctx *fasthttp.RequestCtx) error {
 		return web.RespondError(ctx, fasthttp.StatusBadRequest, nil)
 	}
 
-	// Validate request
-	requestValidationInput := &openapi3filter.RequestValidationInput{
-		Request:    &req,
+	// Get fastjson parser
+	jsonParser := s.parserPool.Get()
+	defer s.parserPool.Put(jsonParser)
+
+	x := &exchange{
+		client:             client,
+		requestValidation:  requestValidation,
+		responseValidation: responseValidation,
+		verdict:            verdict,
+		jsonParser:         jsonParser,
+		token:              token,
+	}
+
+	x.requestInput = &openapi3filter.RequestValidationInput{
+		Request:    req,
 		PathParams: pathParams,
 		Route:      s.route,
 		Options: &openapi3filter.Options{
-			AuthenticationFunc: func(ctx context.Context, input *openapi3filter.AuthenticationInput) error {
-				switch input.SecurityScheme.Type {
-				case "http":
-					switch input.SecurityScheme.Scheme {
-					case "basic":
-						bHeader := input.RequestValidationInput.Request.Header.Get("Authorization")
-						if bHeader == "" || !strings.HasPrefix(strings.ToLower(bHeader), "basic ") {
-							return errors.New("missing basic authorization header")
-						}
-					case "bearer":
-						bHeader := input.RequestValidationInput.Request.Header.Get("Authorization")
-						if bHeader == "" || !strings.HasPrefix(strings.ToLower(bHeader), "bearer ") {
-							return errors.New("missing bearer authorization header")
-						}
+			AuthenticationFunc: s.authenticate(x),
+		},
+	}
+
+	ctx.SetUserValue(exchangeKey, x)
+
+	// the buffer of the response body read by the response validation is reused by the next requests
+	defer func() {
+		if x.responseInput != nil && x.responseInput.Body != nil {
+			x.responseInput.Body.Close()
+		}
+	}()
+
+	return s.chain(ctx)
+}
+
+// consumer identifies the consumer by the API key, the common name of the verified client certificate
+// or the subject of the validated token
+func (s *openapiWaf) consumer(ctx *fasthttp.RequestCtx, token *requestToken) *consumers.Profile {
+
+	if apiKey := ctx.Request.Header.Peek(s.cfg.Consumers.APIKeyHeader); len(apiKey) > 0 {
+		if profile := s.consumers.Find(consumers.KindAPIKey, string(apiKey)); profile != nil {
+			return profile
+		}
+	}
+
+	if state := ctx.TLSConnectionState(); state != nil && len(state.VerifiedChains) > 0 && len(state.VerifiedChains[0]) > 0 {
+		if profile := s.consumers.Find(consumers.KindCommonName, state.VerifiedChains[0][0].Subject.CommonName); profile != nil {
+			return profile
+		}
+	}
+
+	if s.oauthValidator != nil {
+		if authHeader := ctx.Request.Header.Peek(fasthttp.HeaderAuthorization); len(authHeader) > 0 {
+			claims, err := s.validateToken(ctx, token, string(authHeader), nil)
+			if err != nil {
+				return nil
+			}
+			if subject, ok := claims.Value(s.cfg.Consumers.SubjectClaim); ok {
+				return s.consumers.Find(consumers.KindSubject, subject)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateToken validates the token of the request on the first call and checks the scopes by the claims of the validated token
+func (s *openapiWaf) validateToken(ctx context.Context, token *requestToken, tokenWithBearer string, scopes []string) (oauth2.Claims, error) {
+
+	if !token.validated {
+		token.claims, token.err = s.oauthValidator.Validate(ctx, tokenWithBearer, nil)
+		token.validated = true
+	}
+
+	if token.err != nil {
+		return nil, token.err
+	}
+
+	if err := s.oauthValidator.CheckScopes(token.claims, scopes); err != nil {
+		return nil, err
+	}
+
+	return token.claims, nil
+}
+
+// authenticate returns the authentication function of the security schemes of the spec.
+// The claims of the validated token are stored in the exchange
+func (s *openapiWaf) authenticate(x *exchange) openapi3filter.AuthenticationFunc {
+	return func(ctx context.Context, input *openapi3filter.AuthenticationInput) error {
+		switch input.SecurityScheme.Type {
+		case "http":
+			switch input.SecurityScheme.Scheme {
+			case "basic":
+				bHeader := input.RequestValidationInput.Request.Header.Get("Authorization")
+				if bHeader == "" || !strings.HasPrefix(strings.ToLower(bHeader), "basic ") {
+					return errors.New("missing basic authorization header")
+				}
+				if s.basicAuth != nil {
+					username, password, ok := input.RequestValidationInput.Request.BasicAuth()
+					if !ok {
+						return errors.New("invalid basic authorization header")
 					}
-				case "oauth2", "openIdConnect":
-					if s.oauthValidator == nil {
-						return errors.New("oauth2 validator not configured")
+					if err := s.basicAuth.Authenticate(ctx, username, password); err != nil {
+						return fmt.Errorf("basic auth error: %s", err)
 					}
-					if err := s.oauthValidator.Validate(ctx, input.RequestValidationInput.Request.Header.Get("Authorization"), input.Scopes); err != nil {
-						return fmt.Errorf("oauth2 error: %s", err)
+				}
+			case "bearer":
+				bHeader := input.RequestValidationInput.Request.Header.Get("Authorization")
+				if bHeader == "" || !strings.HasPrefix(strings.ToLower(bHeader), "bearer ") {
+					return errors.New("missing bearer authorization header")
+				}
+			}
+		case "oauth2", "openIdConnect":
+			if s.oauthValidator == nil {
+				return errors.New("oauth2 validator not configured")
+			}
+			claims, err := s.validateToken(ctx, x.token, input.RequestValidationInput.Request.Header.Get("Authorization"), input.Scopes)
+			if err != nil {
+				return fmt.Errorf("oauth2 error: %s", err)
+			}
+			if err := oauth2.ValidateRoles(claims, s.cfg.Server.Oauth.Roles.ClaimName, s.roles); err != nil {
+				return fmt.Errorf("oauth2 error: %s", err)
+			}
+			x.tokenClaims = claims
+
+		case "apiKey":
+			switch input.SecurityScheme.In {
+			case "header":
+				if input.RequestValidationInput.Request.Header.Get(input.SecurityScheme.Name) == "" {
+					return fmt.Errorf("missing %s header", input.SecurityScheme.Name)
+				}
+			case "query":
+				if input.RequestValidationInput.Request.URL.Query().Get(input.SecurityScheme.Name) == "" {
+					return fmt.Errorf("missing %s query parameter", input.SecurityScheme.Name)
+				}
+			case "cookie":
+				_, err := input.RequestValidationInput.Request.Cookie(input.SecurityScheme.Name)
+				if err != nil {
+					return fmt.Errorf("missing %s cookie", input.SecurityScheme.Name)
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// requestValidationStep validates the request and passes the claims of the validated token to the upstream
+func (s *openapiWaf) requestValidationStep(next web.Handler) web.Handler {
+	return func(ctx *fasthttp.RequestCtx) error {
+		x := exchangeOf(ctx)
+
+		if x.requestValidation == web.ValidationBlock || x.requestValidation == web.ValidationLog {
+			x.verdict.Decision = web.VerdictPassed
+
+			// the identical request failed the validation recently is blocked by the cached verdict
+			var cacheKey string
+			if s.verdictCache != nil && x.requestValidation == web.ValidationBlock && s.scorer == nil {
+				cacheKey = s.verdictCache.Key(ctx, x.verdict.Operation)
+				if entry := s.verdictCache.Get(cacheKey); entry != nil {
+					return s.blockCached(ctx, x, entry)
+				}
+			}
+
+			start := time.Now()
+			err := s.validateRequest(ctx, x.requestInput, x.jsonParser)
+			x.verdict.RequestValidationTime = time.Since(start)
+
+			if err != nil {
+				s.logger.WithFields(logrus.Fields{
+					"error":      err,
+					"request_id": fmt.Sprintf("#%016X", ctx.ID()),
+				}).Error("request validation error")
+
+				x.verdict.Decision = web.VerdictFailed
+				setValidationError(ctx, x.verdict, err)
+
+				if x.requestValidation == web.ValidationBlock && s.scorer == nil {
+					// the security requirements errors depend on the state of the tokens, so they are not cached
+					if _, ok := err.(*openapi3filter.RequestError); ok && cacheKey != "" {
+						s.verdictCache.Set(cacheKey, &verdictcache.Entry{
+							Rule:    x.verdict.Rule,
+							Reason:  x.verdict.Reason,
+							Subject: x.verdict.Subject,
+							Error:   err.Error(),
+						})
 					}
 
-				case "apiKey":
-					switch input.SecurityScheme.In {
-					case "header":
-						if input.RequestValidationInput.Request.Header.Get(input.SecurityScheme.Name) == "" {
-							return fmt.Errorf("missing %s header", input.SecurityScheme.Name)
-						}
-					case "query":
-						if input.RequestValidationInput.Request.URL.Query().Get(input.SecurityScheme.Name) == "" {
-							return fmt.Errorf("missing %s query parameter", input.SecurityScheme.Name)
-						}
-					case "cookie":
-						_, err := input.RequestValidationInput.Request.Cookie(input.SecurityScheme.Name)
-						if err != nil {
-							return fmt.Errorf("missing %s cookie", input.SecurityScheme.Name)
-						}
+					// the request is stored to be validated again after the API Spec is fixed
+					if s.cfg.DeniedRequests.Store {
+						replay.Denied.Add(ctx, x.verdict.Operation, err.Error())
 					}
+					return s.block(ctx, x.verdict)
 				}
-				return nil
-			},
-		},
-	}
+			}
+		}
 
-	// Get fastjson parser
-	jsonParser := s.parserPool.Get()
-	defer s.parserPool.Put(jsonParser)
+		// the signals are accumulated into the score of the request in the scoring mode
+		if s.scorer != nil && (x.requestValidation == web.ValidationBlock || x.requestValidation == web.ValidationLog) {
+			if blocked, err := s.score(ctx, x); blocked {
+				return err
+			}
+		}
 
-	switch s.cfg.RequestValidation {
-	case web.ValidationBlock:
-		if err := validator.ValidateRequest(ctx, requestValidationInput, jsonParser); err != nil {
-			s.logger.WithFields(logrus.Fields{
-				"error":      err,
-				"request_id": fmt.Sprintf("#%016X", ctx.ID()),
-			}).Error("request validation error")
-			if s.cfg.AddValidationStatusHeader {
-				if vh := getValidationHeader(ctx, err); vh != nil {
-					s.logger.WithFields(logrus.Fields{
-						"error":      err,
-						"request_id": fmt.Sprintf("#%016X", ctx.ID()),
-					}).Errorf("add header %s: %s", web.ValidationStatus, *vh)
-					ctx.Request.Header.Add(web.ValidationStatus, *vh)
-					return web.RespondError(ctx, s.cfg.CustomBlockStatusCode, vh)
+		// the request bodies are compared with the schemas in the LOG_ONLY mode
+		if s.cfg.SchemaLearning.Enabled && x.requestValidation == web.ValidationLog {
+			s.learn(ctx, x)
+		}
+
+		// the access policies of the operation tags are checked in the request validation mode
+		if len(s.accessPolicies) > 0 && (x.requestValidation == web.ValidationBlock || x.requestValidation == web.ValidationLog) {
+			if err := s.checkAccess(ctx, x); err != nil {
+				s.logger.WithFields(logrus.Fields{
+					"error":      err,
+					"operation":  x.verdict.Operation,
+					"request_id": fmt.Sprintf("#%016X", ctx.ID()),
+				}).Error("access denied by tag policy")
+
+				x.verdict.Decision = web.VerdictFailed
+				x.verdict.Rule = "access"
+				x.verdict.Reason = err.Error()
+
+				if x.requestValidation == web.ValidationBlock {
+					return s.block(ctx, x.verdict)
 				}
 			}
-			return web.RespondError(ctx, s.cfg.CustomBlockStatusCode, nil)
 		}
-	case web.ValidationLog:
-		if err := validator.ValidateRequest(ctx, requestValidationInput, jsonParser); err != nil {
-			s.logger.WithFields(logrus.Fields{
-				"error":      err,
-				"request_id": fmt.Sprintf("#%016X", ctx.ID()),
-			}).Error("request validation error")
+
+		// the Accept header is checked against the content types of the successful responses
+		if s.negotiation == web.ValidationBlock || s.negotiation == web.ValidationLog {
+			if err := validator.ValidateAccept(x.requestInput); err != nil {
+				s.logger.WithFields(logrus.Fields{
+					"error":      err,
+					"request_id": fmt.Sprintf("#%016X", ctx.ID()),
+				}).Error("content negotiation error")
+
+				x.verdict.Decision = web.VerdictFailed
+				x.verdict.Rule = "content-negotiation"
+				x.verdict.Reason = err.Error()
+				x.verdict.Subject = fasthttp.HeaderAccept
+
+				if s.negotiation == web.ValidationBlock {
+					x.verdict.Decision = web.VerdictBlocked
+					return web.RespondError(ctx, fasthttp.StatusNotAcceptable, nil)
+				}
+			}
+		}
+
+		// pass the claims of the validated token to the upstream
+		for header, claim := range s.cfg.Server.Oauth.ClaimsHeaders {
+			if value, ok := x.tokenClaims.Value(claim); ok {
+				ctx.Request.Header.Set(header, value)
+			}
 		}
+
+		return next(ctx)
 	}
+}
 
-	if err := performProxy(ctx, s.logger, client); err != nil {
-		return err
+// blockCached blocks the request by the cached verdict of the identical request without the validation
+func (s *openapiWaf) blockCached(ctx *fasthttp.RequestCtx, x *exchange, entry *verdictcache.Entry) error {
+	s.logger.WithFields(logrus.Fields{
+		"error":      entry.Error,
+		"cached":     true,
+		"request_id": fmt.Sprintf("#%016X", ctx.ID()),
+	}).Error("request validation error")
+
+	x.verdict.Decision = web.VerdictFailed
+	x.verdict.Rule = entry.Rule
+	x.verdict.Reason = entry.Reason
+	x.verdict.Subject = entry.Subject
+
+	if s.cfg.DeniedRequests.Store {
+		replay.Denied.Add(ctx, x.verdict.Operation, entry.Error)
+	}
+
+	return s.block(ctx, x.verdict)
+}
+
+// score selects the action by the score of the request validation error, the heuristic and the velocity signals.
+// The request is only logged in the LOG_ONLY mode. It returns true if the request is blocked or challenged
+func (s *openapiWaf) score(ctx *fasthttp.RequestCtx, x *exchange) (bool, error) {
+
+	signals := s.scorer.Signals(ctx)
+	if x.verdict.Decision == web.VerdictFailed {
+		signals = append(signals, scoring.Signal{Name: scoring.SignalSchema, Weight: s.cfg.Scoring.SchemaWeight})
+	}
+
+	x.verdict.Score = scoring.Score(signals)
+	action := s.scorer.Action(x.verdict.Score)
+
+	// the client which passed the challenge is not challenged again until the clearance expires
+	if action == scoring.ActionChallenge && s.scorer.Cleared(ctx) {
+		action = scoring.ActionLog
+	}
+
+	if action == scoring.ActionPass {
+		return false, nil
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"score":      x.verdict.Score,
+		"signals":    signals,
+		"action":     action,
+		"operation":  x.verdict.Operation,
+		"request_id": fmt.Sprintf("#%016X", ctx.ID()),
+	}).Warning("anomaly score threshold reached")
+
+	if x.requestValidation != web.ValidationBlock {
+		return false, nil
+	}
+
+	if x.verdict.Rule == "" {
+		x.verdict.Rule = "score"
+		x.verdict.Reason = fmt.Sprintf("anomaly score %d", x.verdict.Score)
+	}
+
+	switch action {
+	case scoring.ActionChallenge:
+		x.verdict.Decision = web.VerdictBlocked
+		if challengeURL := s.scorer.ChallengeURL(ctx); challengeURL != "" {
+			ctx.Response.Reset()
+			ctx.Response.Header.Set(fasthttp.HeaderLocation, challengeURL)
+			ctx.SetStatusCode(fasthttp.StatusFound)
+			return true, nil
+		}
+		return true, web.RespondError(ctx, s.cfg.Scoring.ChallengeStatusCode, nil)
+	case scoring.ActionBlock:
+		if s.cfg.DeniedRequests.Store {
+			replay.Denied.Add(ctx, x.verdict.Operation, x.verdict.Reason)
+		}
+		return true, s.block(ctx, x.verdict)
 	}
 
-	// Prepare http response headers
-	respHeader := http.Header{}
-	ctx.Request.Header.VisitAll(func(k, v []byte) {
-		sk := string(k)
-		sv := string(v)
+	return false, nil
+}
+
+// learn adds the suggestions of the request body fields and the enum values which are not described by the schema
+func (s *openapiWaf) learn(ctx *fasthttp.RequestCtx, x *exchange) {
+
+	if s.route == nil || s.route.Operation.RequestBody == nil || s.route.Operation.RequestBody.Value == nil {
+		return
+	}
+
+	contentType := string(ctx.Request.Header.ContentType())
+	if !strings.Contains(contentType, "json") {
+		return
+	}
 
-		respHeader.Set(sk, sv)
+	mediaType := validator.MatchContent(s.route.Operation.RequestBody.Value.Content, contentType)
+	if mediaType == nil || mediaType.Schema == nil {
+		return
+	}
+
+	body, err := x.jsonParser.ParseBytes(ctx.Request.Body())
+	if err != nil {
+		return
+	}
+
+	learning.Observe(mediaType.Schema.Value, body, "", func(kind, path, valueType, value string) {
+		learning.Suggestions.Add(s.operationKeys[0], kind, path, valueType, value)
 	})
+}
 
-	responseValidationInput := &openapi3filter.ResponseValidationInput{
-		RequestValidationInput: requestValidationInput,
-		Status:                 ctx.Response.StatusCode(),
-		Header:                 respHeader,
-		Body:                   io.NopCloser(bytes.NewReader(ctx.Response.Body())),
-		Options: &openapi3filter.Options{
-			ExcludeRequestBody:    false,
-			ExcludeResponseBody:   false,
-			IncludeResponseStatus: true,
-			MultiError:            false,
-			AuthenticationFunc:    nil,
-		},
+// checkAccess checks the client address and the token scopes required by the policies of the operation tags
+func (s *openapiWaf) checkAccess(ctx *fasthttp.RequestCtx, x *exchange) error {
+
+	var scopes []string
+
+	for _, policy := range s.accessPolicies {
+		if !policy.AllowsAddress(ctx.RemoteIP()) {
+			return fmt.Errorf("tag %s: address %s is not allowed", policy.Tag, ctx.RemoteIP())
+		}
+		scopes = append(scopes, policy.Scopes...)
 	}
 
-	// Validate response
-	switch s.cfg.ResponseValidation {
-	case web.ValidationBlock:
-		if err := validator.ValidateResponse(ctx, responseValidationInput, jsonParser); err != nil {
-			s.logger.WithFields(logrus.Fields{
-				"error":      err,
-				"request_id": fmt.Sprintf("#%016X", ctx.ID()),
-			}).Error("response validation error")
-			if s.cfg.AddValidationStatusHeader {
-				if vh := getValidationHeader(ctx, err); vh != nil {
-					s.logger.WithFields(logrus.Fields{
-						"error":      err,
-						"request_id": fmt.Sprintf("#%016X", ctx.ID()),
-					}).Errorf("add header %s: %s", web.ValidationStatus, *vh)
-					ctx.Response.Header.Add(web.ValidationStatus, *vh)
-					return web.RespondError(ctx, s.cfg.CustomBlockStatusCode, vh)
+	if len(scopes) == 0 {
+		return nil
+	}
+
+	if s.oauthValidator == nil {
+		return errors.New("oauth2 validator not configured")
+	}
+
+	claims, err := s.validateToken(ctx, x.token, string(ctx.Request.Header.Peek(fasthttp.HeaderAuthorization)), scopes)
+	if err != nil {
+		return fmt.Errorf("oauth2 error: %s", err)
+	}
+
+	if x.tokenClaims == nil {
+		x.tokenClaims = claims
+	}
+
+	return nil
+}
+
+// proxyStep proxies the request to the upstream and prepares the response validation input
+func (s *openapiWaf) proxyStep(next web.Handler) web.Handler {
+	return func(ctx *fasthttp.RequestCtx) error {
+		x := exchangeOf(ctx)
+
+		s.transformRequest(ctx)
+		s.setVerdict(ctx, x.verdict)
+
+		if err := s.performProxy(ctx, x.client); err != nil {
+			return err
+		}
+
+		// Prepare http response headers
+		respHeader := http.Header{}
+		ctx.Response.Header.VisitAll(func(k, v []byte) {
+			sk := string(k)
+			sv := string(v)
+
+			respHeader.Set(sk, sv)
+		})
+
+		// the bodies of the binary responses are proxied without the validation
+		excludeResponseBody := s.excludeRespBody ||
+			validator.IsPassthrough(string(ctx.Response.Header.ContentType()), s.cfg.ResponsePassthrough.ContentTypes)
+
+		x.responseInput = &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: x.requestInput,
+			Status:                 ctx.Response.StatusCode(),
+			Header:                 respHeader,
+			Body:                   io.NopCloser(bytes.NewReader(ctx.Response.Body())),
+			Options: &openapi3filter.Options{
+				ExcludeRequestBody:    false,
+				ExcludeResponseBody:   excludeResponseBody,
+				IncludeResponseStatus: true,
+				MultiError:            false,
+				AuthenticationFunc:    nil,
+			},
+		}
+
+		return next(ctx)
+	}
+}
+
+// responseValidationStep validates the response body and the response headers
+func (s *openapiWaf) responseValidationStep(next web.Handler) web.Handler {
+	return func(ctx *fasthttp.RequestCtx) error {
+		x := exchangeOf(ctx)
+
+		// Validate response
+		if x.responseValidation == web.ValidationBlock || x.responseValidation == web.ValidationLog {
+			start := time.Now()
+			err := s.validateResponse(ctx, x.responseInput, x.jsonParser)
+			x.verdict.ResponseValidationTime = time.Since(start)
+
+			if err != nil {
+				s.logger.WithFields(logrus.Fields{
+					"error":      err,
+					"request_id": fmt.Sprintf("#%016X", ctx.ID()),
+				}).Error("response validation error")
+
+				if x.responseValidation == web.ValidationBlock {
+					setValidationError(ctx, x.verdict, err)
+					return s.block(ctx, x.verdict)
 				}
 			}
-			return web.RespondError(ctx, s.cfg.CustomBlockStatusCode, nil)
 		}
-	case web.ValidationLog:
-		if err := validator.ValidateResponse(ctx, responseValidationInput, jsonParser); err != nil {
-			s.logger.WithFields(logrus.Fields{
-				"error":      err,
-				"request_id": fmt.Sprintf("#%016X", ctx.ID()),
-			}).Error("response validation error")
+
+		if s.route == nil {
+			return nil
+		}
+
+		// Validate response status code
+		switch s.statusMode {
+		case web.ValidationBlock:
+			if err := validator.ValidateResponseStatus(x.responseInput); err != nil {
+				s.logger.WithFields(logrus.Fields{
+					"error":      err,
+					"request_id": fmt.Sprintf("#%016X", ctx.ID()),
+				}).Error("response status validation error")
+				setValidationError(ctx, x.verdict, err)
+				return s.block(ctx, x.verdict)
+			}
+		case web.ValidationLog:
+			if err := validator.ValidateResponseStatus(x.responseInput); err != nil {
+				s.logger.WithFields(logrus.Fields{
+					"error":      err,
+					"request_id": fmt.Sprintf("#%016X", ctx.ID()),
+				}).Error("response status validation error")
+			}
+		}
+
+		// Validate response headers
+		switch s.cfg.ResponseHeadersValidation {
+		case web.ValidationBlock:
+			if err := validator.ValidateResponseHeaders(ctx, x.responseInput); err != nil {
+				s.logger.WithFields(logrus.Fields{
+					"error":      err,
+					"request_id": fmt.Sprintf("#%016X", ctx.ID()),
+				}).Error("response headers validation error")
+				setValidationError(ctx, x.verdict, err)
+				return s.block(ctx, x.verdict)
+			}
+		case web.ValidationLog:
+			if err := validator.ValidateResponseHeaders(ctx, x.responseInput); err != nil {
+				s.logger.WithFields(logrus.Fields{
+					"error":      err,
+					"request_id": fmt.Sprintf("#%016X", ctx.ID()),
+				}).Error("response headers validation error")
+			}
+		}
+
+		// the validated response is transformed to the published contract
+		if s.respTransform != nil {
+			if err := s.respTransform.Apply(&ctx.Response); err != nil {
+				s.logger.WithFields(logrus.Fields{
+					"error":      err,
+					"request_id": fmt.Sprintf("#%016X", ctx.ID()),
+				}).Error("response transformation error")
+			}
 		}
+
+		return next(ctx)
 	}
+}
 
-	return nil
+// responseInspectionStep reports the PII and the classified fields of the validated response without blocking
+func (s *openapiWaf) responseInspectionStep(next web.Handler) web.Handler {
+	return func(ctx *fasthttp.RequestCtx) error {
+		x := exchangeOf(ctx)
+
+		// PII found in the validated response is reported without blocking
+		if s.pii != nil && pii.Scannable(string(ctx.Response.Header.ContentType()), string(ctx.Response.Header.Peek(fasthttp.HeaderContentEncoding))) {
+			if found := s.pii.Scan(ctx.Response.Body()); len(found) > 0 {
+				pii.Detections.Add(s.operationKeys[0], found)
+				s.logger.WithFields(logrus.Fields{
+					"pii":        found,
+					"operation":  s.operationKeys[0],
+					"request_id": fmt.Sprintf("#%016X", ctx.ID()),
+				}).Warning("PII detected in response")
+			}
+		}
+
+		// classified fields served by the endpoint are reported for the compliance
+		if len(s.classified) > 0 && strings.Contains(string(ctx.Response.Header.ContentType()), "json") {
+			if body, err := x.jsonParser.ParseBytes(ctx.Response.Body()); err == nil {
+				if flowing := classification.Flowing(body, s.classified); len(flowing) > 0 {
+					classification.Flows.Add(s.operationKeys[0], flowing)
+
+					fields := make(map[string][]string)
+					for _, field := range flowing {
+						fields[field.Classification] = append(fields[field.Classification], field.Name())
+					}
+					s.logger.WithFields(logrus.Fields{
+						"classified_fields": fields,
+						"operation":         s.operationKeys[0],
+						"request_id":        fmt.Sprintf("#%016X", ctx.ID()),
+					}).Info("classified data in response")
+				}
+			}
+		}
+
+		return next(ctx)
+	}
 }
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/fasthttp/router"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/savsgio/gotils/strconv"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttpadaptor"
+	"github.com/valyala/fastjson"
+	"github.com/wallarm/api-firewall/internal/config"
+	"github.com/wallarm/api-firewall/internal/platform/replay"
+	wrouter "github.com/wallarm/api-firewall/internal/platform/router"
+	"github.com/wallarm/api-firewall/internal/platform/validator"
+)
+
+// ReplayResult is the result of the validation of the stored request by the enforced API Spec
+type ReplayResult struct {
+	ID        string `json:"id"`
+	Operation string `json:"operation,omitempty"`
+	Valid     bool   `json:"valid"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Revalidate validates the stored request by the parameters and the request body schemas of the API Spec.
+// The security requirements are not checked because the credentials are not stored
+func Revalidate(cfg *config.APIFWConfiguration, swagRouter *wrouter.Router, envelope replay.Envelope) ReplayResult {
+
+	result := ReplayResult{ID: envelope.ID}
+
+	serverUrl, err := url.ParseRequestURI(cfg.Server.URL)
+	if err != nil {
+		serverUrl = &url.URL{}
+	}
+
+	// the route is selected the same way as by the API handler
+	var matched *wrouter.Route
+	routes := router.New()
+	for i := range swagRouter.Routes {
+		route := &swagRouter.Routes[i]
+		routes.Handle(route.Method, path.Join(serverUrl.Path, route.Path), func(ctx *fasthttp.RequestCtx) {
+			matched = route
+		})
+	}
+
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	envelope.Request(req)
+
+	ctx := fasthttp.RequestCtx{}
+	ctx.Init(req, nil, nil)
+
+	routes.Handler(&ctx)
+	if matched == nil {
+		result.Error = "route not found"
+		return result
+	}
+
+	result.Operation = matched.Method + " " + matched.Path
+
+	pathParams := make(map[string]string)
+	ctx.VisitUserValues(func(key []byte, value interface{}) {
+		if param, ok := value.(string); ok {
+			pathParams[strconv.B2S(key)] = param
+		}
+	})
+
+	httpReq := http.Request{}
+	if err := fasthttpadaptor.ConvertRequest(&ctx, &httpReq, false); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer httpReq.Body.Close()
+
+	input := &openapi3filter.RequestValidationInput{
+		Request:    &httpReq,
+		PathParams: pathParams,
+		Route:      matched.Route,
+		Options: &openapi3filter.Options{
+			AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+		},
+	}
+
+	var jsonParser fastjson.Parser
+	if err := validator.ValidateRequest(context.Background(), input, &jsonParser); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Valid = true
+
+	return result
+}
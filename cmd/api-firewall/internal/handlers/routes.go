@@ -2,31 +2,83 @@ package handlers
 
 import (
 	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
 	"net/url"
 	"os"
 	"path"
+	"regexp"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/routers"
 	"github.com/golang-jwt/jwt"
 	"github.com/karlseguin/ccache/v2"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/valyala/fasthttp"
-	"github.com/valyala/fastjson"
 	"github.com/wallarm/api-firewall/internal/config"
 	"github.com/wallarm/api-firewall/internal/mid"
+	"github.com/wallarm/api-firewall/internal/platform/access"
+	"github.com/wallarm/api-firewall/internal/platform/basicauth"
+	"github.com/wallarm/api-firewall/internal/platform/classification"
+	"github.com/wallarm/api-firewall/internal/platform/coalescing"
+	"github.com/wallarm/api-firewall/internal/platform/concurrency"
+	"github.com/wallarm/api-firewall/internal/platform/consumers"
 	"github.com/wallarm/api-firewall/internal/platform/denylist"
+	"github.com/wallarm/api-firewall/internal/platform/graphql"
+	"github.com/wallarm/api-firewall/internal/platform/idempotency"
+	"github.com/wallarm/api-firewall/internal/platform/maintenance"
+	"github.com/wallarm/api-firewall/internal/platform/modes"
 	woauth2 "github.com/wallarm/api-firewall/internal/platform/oauth2"
+	"github.com/wallarm/api-firewall/internal/platform/pii"
+	"github.com/wallarm/api-firewall/internal/platform/pools"
 	"github.com/wallarm/api-firewall/internal/platform/proxy"
+	"github.com/wallarm/api-firewall/internal/platform/ratelimit"
+	"github.com/wallarm/api-firewall/internal/platform/responsediff"
 	"github.com/wallarm/api-firewall/internal/platform/router"
+	"github.com/wallarm/api-firewall/internal/platform/scoring"
 	"github.com/wallarm/api-firewall/internal/platform/shadowAPI"
+	"github.com/wallarm/api-firewall/internal/platform/slo"
+	"github.com/wallarm/api-firewall/internal/platform/soap"
+	"github.com/wallarm/api-firewall/internal/platform/state"
+	"github.com/wallarm/api-firewall/internal/platform/transform"
+	"github.com/wallarm/api-firewall/internal/platform/validator"
+	"github.com/wallarm/api-firewall/internal/platform/verdictcache"
 	"github.com/wallarm/api-firewall/internal/platform/web"
 )
 
-func OpenapiProxy(cfg *config.APIFWConfiguration, serverUrl *url.URL, shutdown chan os.Signal, logger *logrus.Logger, proxy proxy.Pool, swagRouter *router.Router, deniedTokens *denylist.DeniedTokens, shadowAPI shadowAPI.Checker) fasthttp.RequestHandler {
+const (
+	xWallarmRoles = "x-wallarm-roles"
+	xSunset       = "x-sunset"
 
-	// define FastJSON parsers pool
-	var parserPool fastjson.ParserPool
+	xWallarmStrictHeaders = "x-wallarm-strict-headers"
+	xWallarmRateLimit     = "x-wallarm-ratelimit"
+	xWallarmConcurrency   = "x-wallarm-concurrency"
+	xWallarmStub          = "x-wallarm-stub"
+	xWallarmMaxBodySize   = "x-wallarm-max-body-size"
+	xWallarmTransform     = "x-wallarm-transform"
+	xWallarmUpstreamSLO   = "x-wallarm-upstream-slo"
+
+	xWallarmResponseTransform = "x-wallarm-response-transform"
+
+	xWallarmResponseStatusValidation = "x-wallarm-response-status-validation"
+	xWallarmContentNegotiation       = "x-wallarm-content-negotiation"
+	xWallarmExcludeResponseBody      = "x-wallarm-exclude-response-body"
+)
+
+// clusterSelector selects the pool of the upstream cluster of the operation
+type clusterSelector interface {
+	Select(path string, tags []string) proxy.Pool
+}
+
+// OpenapiProxy builds the handler of the API Spec. The error is returned if the settings enforced by the handler
+// can't be loaded, so the API Spec is not enforced without them. The OpenID provider discovered at startup
+// is shared by the handlers of the API Specs
+func OpenapiProxy(cfg *config.APIFWConfiguration, serverUrl *url.URL, shutdown chan os.Signal, logger *logrus.Logger, proxy proxy.Pool, swagRouter *router.Router, deniedTokens *denylist.DeniedTokens, shadowAPI shadowAPI.Checker, maintenanceMode *maintenance.Mode, validationModes *modes.Overrides, oidcProvider *woauth2.OIDC) (fasthttp.RequestHandler, error) {
 
 	// Init OAuth validator
 	var oauthValidator woauth2.OAuth2
@@ -50,23 +102,131 @@ func OpenapiProxy(cfg *config.APIFWConfiguration, serverUrl *url.URL, shutdown c
 			logger.Infof("OAuth2: public certificate successfully loaded")
 		}
 
-		oauthValidator = &woauth2.JWT{
+		jwtValidator := &woauth2.JWT{
 			Cfg:       &cfg.Server.Oauth,
 			Logger:    logger,
 			PubKey:    key,
 			SecretKey: []byte(cfg.Server.Oauth.JWT.SecretKey),
 		}
 
+		revokedTokens, err := denylist.NewRevokedJTI(cfg, logger)
+		switch {
+		case err != nil:
+			logger.Errorf("Error loading revoked JWT IDs: %s", err)
+			jwtValidator.RevokedTokens = denylist.UnavailableJTI{Err: err}
+		case revokedTokens != nil:
+			jwtValidator.RevokedTokens = revokedTokens
+		}
+
+		switch {
+		case oidcProvider != nil:
+			jwtValidator.KeySet = oidcProvider
+			jwtValidator.Issuer = oidcProvider.Metadata().Issuer
+		case cfg.Server.Oauth.OIDC.Issuer != "":
+			jwtValidator.KeySet = woauth2.UnavailableKeySet{Err: errors.New("OpenID provider configuration is not discovered")}
+			jwtValidator.Issuer = cfg.Server.Oauth.OIDC.Issuer
+		}
+
+		oauthValidator = jwtValidator
+
 	case "introspection":
 		oauthValidator = &woauth2.Introspection{
 			Cfg:    &cfg.Server.Oauth,
 			Logger: logger,
 			Cache:  ccache.New(ccache.Configure()),
+			OIDC:   oidcProvider,
+		}
+	}
+
+	// Init basic auth credentials verifier
+	var basicAuthenticator basicauth.Authenticator
+
+	switch {
+	case cfg.BasicAuth.HtpasswdFile != "":
+		htpasswd, err := basicauth.NewHtpasswd(cfg.BasicAuth.HtpasswdFile, logger)
+		if err != nil {
+			logger.Errorf("Error loading htpasswd file: %s", err)
+			basicAuthenticator = basicauth.Unavailable{Err: err}
+		} else {
+			basicAuthenticator = htpasswd
 		}
+	case cfg.BasicAuth.LDAP.URL != "":
+		basicAuthenticator = basicauth.NewLDAP(&cfg.BasicAuth.LDAP, logger)
 	}
 
 	// Construct the web.App which holds all routes as well as common Middleware.
-	app := web.NewApp(shutdown, cfg, logger, mid.Logger(logger), mid.Errors(logger), mid.Panics(logger), mid.Proxy(cfg, serverUrl), mid.Denylist(cfg, deniedTokens, logger))
+	app := web.NewApp(shutdown, cfg, logger, mid.Logger(logger), mid.Errors(logger), mid.Panics(logger), mid.ClientCert(cfg, logger), mid.TLSFingerprint(cfg, logger), mid.Proxy(cfg, serverUrl), mid.Experiment(cfg), mid.Analyzer(cfg), mid.EventSink(cfg), mid.Denylist(cfg, deniedTokens, logger))
+	app.ValidationModes = func() (string, string) {
+		return validationModes.Effective(nil, cfg.RequestValidation, cfg.ResponseValidation)
+	}
+
+	// the negative verdicts are shared by the operations and dropped with the handlers when the API Spec is reloaded
+	verdictCache := verdictcache.New(&cfg.VerdictCache)
+
+	// responses of the POST requests are replayed by the idempotency key
+	var idempotencyStore *idempotency.Store
+	var idempotencyKeyPattern *regexp.Regexp
+	if cfg.Idempotency.Enabled {
+		keyPattern, err := regexp.Compile(cfg.Idempotency.KeyPattern)
+		if err != nil {
+			logger.Errorf("Error compiling idempotency key pattern: %s", err)
+		} else {
+			idempotencyStore = idempotency.New(cfg.Idempotency.TTL)
+			idempotencyKeyPattern = keyPattern
+		}
+	}
+
+	// identical concurrent GET requests are collapsed to the single request to the upstream
+	var coalescingGroup *coalescing.Group
+	if cfg.Coalescing.Enabled {
+		coalescingGroup = coalescing.New()
+	}
+
+	// only the persisted queries are allowed by the GraphQL operations
+	persistedQueries, err := graphql.New(&cfg.GraphQL)
+	if err != nil {
+		return nil, errors.Wrap(err, "loading GraphQL persisted queries")
+	}
+
+	// the requests are sent to the comparison upstream in the response diff mode
+	var comparer *responsediff.Comparer
+	if cfg.ResponseDiff.Enabled {
+		c, err := responsediff.New(&cfg.ResponseDiff, logger)
+		if err != nil {
+			logger.Errorf("Error initializing response diff mode: %s", err)
+		} else {
+			comparer = c
+		}
+	}
+
+	// responses are scanned for PII after the validation
+	var piiDetector *pii.Detector
+	if cfg.PIIDetection.Enabled {
+		detector, err := pii.New(&cfg.PIIDetection)
+		if err != nil {
+			logger.Errorf("Error initializing PII detector: %s", err)
+		} else {
+			piiDetector = detector
+		}
+	}
+
+	// the consumer profiles are reloaded from the file
+	consumerProfiles, err := consumers.New(&cfg.Consumers, logger)
+	if err != nil {
+		return nil, errors.Wrap(err, "loading consumer profiles")
+	}
+
+	// the weak signals of the requests are accumulated into the score
+	scorer, err := scoring.New(&cfg.Scoring)
+	if err != nil {
+		return nil, errors.Wrap(err, "initializing scoring mode")
+	}
+
+	// access control policies of the operations with the tags
+	tagPolicies, err := access.ParsePolicies(cfg.AccessControl.TagPolicies)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing tag policies")
+	}
 
 	for _, route := range swagRouter.Routes {
 		pathParamLength := 0
@@ -87,21 +247,358 @@ func OpenapiProxy(cfg *config.APIFWConfiguration, serverUrl *url.URL, shutdown c
 			}
 		}
 
+		// required roles: configured mapping by operationId has priority over the x-wallarm-roles extension
+		var roles []string
+		if rolesList, ok := cfg.Server.Oauth.Roles.Operations[route.Route.Operation.OperationID]; ok && route.Route.Operation.OperationID != "" {
+			roles = strings.Split(rolesList, ",")
+		} else if _, err := router.GetExtension(route.Route.Operation.Extensions, xWallarmRoles, &roles); err != nil {
+			logger.Errorf("handler: %s - %s: %s", route.Method, route.Path, err)
+		}
+
+		// the roles are the claims of the OAuth2 token, so they are checked only for the oauth2 and
+		// openIdConnect security schemes. The operations secured by other schemes don't require the roles
+		if len(roles) > 0 && !oauthSecured(route.Route) {
+			logger.Warnf("handler: %s - %s: required roles are ignored: the operation isn't secured by oauth2 or openIdConnect scheme", route.Method, route.Path)
+		}
+
+		// access control policies of the operation tags
+		accessPolicies := access.Operation(tagPolicies, route.Route.Operation.Tags)
+
+		// strict headers mode: the x-wallarm-strict-headers extension has priority over the global setting
+		strictHeadersEnabled := cfg.StrictHeaders.Enabled
+		if _, err := router.GetExtension(route.Route.Operation.Extensions, xWallarmStrictHeaders, &strictHeadersEnabled); err != nil {
+			logger.Errorf("handler: %s - %s: %s", route.Method, route.Path, err)
+		}
+
+		var strictHeaders map[string]struct{}
+		if strictHeadersEnabled {
+			// the headers set by APIFW itself are always allowed
+			allowedHeaders := append([]string{"X-Forwarded-For"}, cfg.StrictHeaders.Allowed...)
+			if cfg.TLS.ClientAuth != web.ClientAuthNone {
+				allowedHeaders = append(allowedHeaders, cfg.TLS.ClientCertHeader)
+			}
+			strictHeaders = validator.DocumentedHeaders(route.Route, allowedHeaders)
+		}
+
+		// undocumented response status codes: the x-wallarm-response-status-validation extension has priority over the global setting
+		responseStatusValidation := cfg.ResponseStatusValidation
+		if _, err := router.GetExtension(route.Route.Operation.Extensions, xWallarmResponseStatusValidation, &responseStatusValidation); err != nil {
+			logger.Errorf("handler: %s - %s: %s", route.Method, route.Path, err)
+		}
+		switch responseStatusValidation {
+		case "", web.ValidationDisable, web.ValidationBlock, web.ValidationLog:
+		default:
+			logger.Errorf("handler: %s - %s: invalid %s value: %q", route.Method, route.Path, xWallarmResponseStatusValidation, responseStatusValidation)
+			responseStatusValidation = cfg.ResponseStatusValidation
+		}
+
+		// Accept header: the x-wallarm-content-negotiation extension has priority over the global setting
+		contentNegotiation := cfg.ContentNegotiation
+		if _, err := router.GetExtension(route.Route.Operation.Extensions, xWallarmContentNegotiation, &contentNegotiation); err != nil {
+			logger.Errorf("handler: %s - %s: %s", route.Method, route.Path, err)
+		}
+		switch contentNegotiation {
+		case "", web.ValidationDisable, web.ValidationBlock, web.ValidationLog:
+		default:
+			logger.Errorf("handler: %s - %s: invalid %s value: %q", route.Method, route.Path, xWallarmContentNegotiation, contentNegotiation)
+			contentNegotiation = cfg.ContentNegotiation
+		}
+
+		// response properties are classified by the x-data-classification extension
+		classified, err := classification.Fields(route.Route.Operation)
+		if err != nil {
+			logger.Errorf("handler: %s - %s: %s", route.Method, route.Path, err)
+		}
+
+		// body size limits are set by the x-wallarm-max-body-size extension or derived from the schemas
+		bodyLimits := operationBodyLimits(cfg, route.Route.Operation, func(err error) {
+			logger.Errorf("handler: %s - %s: %s", route.Method, route.Path, err)
+		})
+
+		// the operation is selected by operationId or by the method and the path in the maintenance mode
+		// and the validation modes overrides
+		operationKeys := []string{route.Method + " " + route.Path}
+		if route.Route.Operation.OperationID != "" {
+			operationKeys = append(operationKeys, route.Route.Operation.OperationID)
+		}
+
+		// response body validation: the x-wallarm-exclude-response-body extension has priority over the operations
+		// excluded by operationId or by the method and the path in the configuration
+		excludeResponseBody := false
+		for _, operation := range cfg.ExcludeResponseBody {
+			if (operation == route.Route.Operation.OperationID && operation != "") || operation == route.Method+" "+route.Path {
+				excludeResponseBody = true
+				break
+			}
+		}
+		if _, err := router.GetExtension(route.Route.Operation.Extensions, xWallarmExcludeResponseBody, &excludeResponseBody); err != nil {
+			logger.Errorf("handler: %s - %s: %s", route.Method, route.Path, err)
+		}
+
+		// the request is transformed after the validation by the rules of the x-wallarm-transform extension
+		var transformRules *transform.Rules
+		var rules transform.Rules
+		if found, err := router.GetExtension(route.Route.Operation.Extensions, xWallarmTransform, &rules); err != nil {
+			logger.Errorf("handler: %s - %s: %s", route.Method, route.Path, err)
+		} else if found {
+			if err := rules.Validate(); err != nil {
+				logger.Errorf("handler: %s - %s: invalid %s extension: %s", route.Method, route.Path, xWallarmTransform, err)
+			} else {
+				transformRules = &rules
+			}
+		}
+
+		// the response is transformed after the validation by the rules of the x-wallarm-response-transform extension
+		var responseTransformRules *transform.ResponseRules
+		var responseRules transform.ResponseRules
+		if found, err := router.GetExtension(route.Route.Operation.Extensions, xWallarmResponseTransform, &responseRules); err != nil {
+			logger.Errorf("handler: %s - %s: %s", route.Method, route.Path, err)
+		} else if found {
+			if err := responseRules.Validate(); err != nil {
+				logger.Errorf("handler: %s - %s: invalid %s extension: %s", route.Method, route.Path, xWallarmResponseTransform, err)
+			} else {
+				responseTransformRules = &responseRules
+			}
+		}
+
+		// the operation is proxied to the upstream cluster selected by the path prefix or the tag
+		routePool := proxy
+		if clusters, ok := proxy.(clusterSelector); ok {
+			routePool = clusters.Select(route.Path, route.Route.Operation.Tags)
+		}
+
 		s := openapiWaf{
 			route:           route.Route,
-			proxyPool:       proxy,
+			proxyPool:       routePool,
 			pathParamLength: pathParamLength,
 			logger:          logger,
 			cfg:             cfg,
-			parserPool:      &parserPool,
+			parserPool:      pools.Parsers,
 			oauthValidator:  oauthValidator,
 			shadowAPI:       shadowAPI,
+			roles:           roles,
+			basicAuth:       basicAuthenticator,
+			strictHeaders:   strictHeaders,
+			modes:           validationModes,
+			operationKeys:   operationKeys,
+			pii:             piiDetector,
+			classified:      classified,
+			comparer:        comparer,
+			bodyLimits:      bodyLimits,
+			accessPolicies:  accessPolicies,
+			consumers:       consumerProfiles,
+			scorer:          scorer,
+			verdictCache:    verdictCache,
+			statusMode:      responseStatusValidation,
+			negotiation:     contentNegotiation,
+			excludeRespBody: excludeResponseBody,
+			transform:       transformRules,
+			respTransform:   responseTransformRules,
 		}
 		updRoutePath := path.Join(serverUrl.Path, route.Path)
 
+		// the identical requests are coalesced after the validation. The responses of the secured operations
+		// are never shared: the credentials of the waiting requests aren't checked by the upstream
+		if coalescingGroup != nil && route.Method == fasthttp.MethodGet && !secured(route.Route) {
+			s.coalescing = mid.Coalescing(cfg, route.Method+" "+updRoutePath, coalescingGroup, logger)
+		}
+
+		// the responses are replayed after the validation and the authentication of the request. The responses
+		// of the operations secured by the schemes without the header, query or cookie credentials aren't stored
+		if idempotencyStore != nil && route.Method == fasthttp.MethodPost {
+			if credentials, ok := securityCredentials(route.Route); ok {
+				s.idempotency = mid.Idempotency(cfg, route.Method+" "+updRoutePath, credentials, idempotencyStore, idempotencyKeyPattern, logger)
+			} else {
+				logger.Warnf("handler: %s - %s: idempotency keys are disabled for the security schemes of the operation", route.Method, updRoutePath)
+			}
+		}
+		s.chain = s.buildChain()
+
 		s.logger.Debugf("handler: Loaded path : %s - %s", route.Method, updRoutePath)
 
-		app.Handle(route.Method, updRoutePath, s.openapiWafHandler)
+		var routeMw []web.Middleware
+
+		routeMw = append(routeMw, mid.Maintenance(cfg, maintenanceMode, operationKeys, logger))
+
+		// deprecated operations: the sunset date is set by the x-sunset extension
+		var sunsetValue string
+		var sunset *time.Time
+
+		if _, err := router.GetExtension(route.Route.Operation.Extensions, xSunset, &sunsetValue); err != nil {
+			logger.Errorf("handler: %s - %s: %s", route.Method, route.Path, err)
+		}
+		if sunsetValue != "" {
+			sunsetDate, err := parseSunset(sunsetValue)
+			if err != nil {
+				logger.Errorf("handler: %s - %s: %s", route.Method, route.Path, err)
+			} else {
+				sunset = &sunsetDate
+			}
+		}
+
+		if route.Route.Operation.Deprecated || sunset != nil {
+			routeMw = append(routeMw, mid.Deprecation(cfg, route.Method+" "+updRoutePath, route.Route.Operation.Deprecated, sunset))
+		}
+
+		// rate limit of the operation is set by the x-wallarm-ratelimit extension
+		var rateLimitPolicy ratelimit.Policy
+		if found, err := router.GetExtension(route.Route.Operation.Extensions, xWallarmRateLimit, &rateLimitPolicy); err != nil {
+			logger.Errorf("handler: %s - %s: %s", route.Method, route.Path, err)
+		} else if found {
+			limiter, err := ratelimit.New(rateLimitPolicy)
+			if err != nil {
+				logger.Errorf("handler: %s - %s: %s", route.Method, route.Path, err)
+			} else {
+				// the buckets are shared by the APIFW instances with the redis state backend
+				if cfg.StateBackend == state.BackendRedis {
+					if client, err := state.Redis(&cfg.Redis); err != nil {
+						logger.Errorf("handler: %s - %s: shared rate limit: %s", route.Method, route.Path, err)
+					} else {
+						limiter.Shared(client, state.Key(&cfg.Redis, "ratelimit", route.Method, updRoutePath), logger)
+					}
+				}
+				routeMw = append(routeMw, mid.RateLimit(route.Method+" "+updRoutePath, limiter, logger))
+			}
+		}
+
+		// simultaneous in-flight requests of the operation are limited by the x-wallarm-concurrency extension
+		var concurrencyPolicy concurrency.Policy
+		if found, err := router.GetExtension(route.Route.Operation.Extensions, xWallarmConcurrency, &concurrencyPolicy); err != nil {
+			logger.Errorf("handler: %s - %s: %s", route.Method, route.Path, err)
+		} else if found {
+			limiter, err := concurrency.New(concurrencyPolicy)
+			if err != nil {
+				logger.Errorf("handler: %s - %s: %s", route.Method, route.Path, err)
+			} else {
+				routeMw = append(routeMw, mid.ConcurrencyLimit(cfg, route.Method+" "+updRoutePath, limiter, logger))
+			}
+		}
+
+		// upstream response time objective of the operation is set by the x-wallarm-upstream-slo extension.
+		// The fields which are not set by the extension are taken from the default objective
+		sloPolicy := slo.Policy{ThresholdMs: cfg.UpstreamSLO.Threshold.Milliseconds(), Objective: cfg.UpstreamSLO.Objective}
+		if found, err := router.GetExtension(route.Route.Operation.Extensions, xWallarmUpstreamSLO, &sloPolicy); err != nil {
+			logger.Errorf("handler: %s - %s: %s", route.Method, route.Path, err)
+		} else if found || sloPolicy.ThresholdMs > 0 {
+			tracker, err := slo.New(route.Method+" "+updRoutePath, sloPolicy, cfg.UpstreamSLO.Window, cfg.UpstreamSLO.MinRequests)
+			if err != nil {
+				logger.Errorf("handler: %s - %s: %s", route.Method, route.Path, err)
+			} else {
+				routeMw = append(routeMw, mid.UpstreamSLO(route.Method+" "+updRoutePath, tracker, logger))
+			}
+		}
+
+		if cfg.ParameterPollution.Policy != "" && cfg.ParameterPollution.Policy != web.ParameterPollutionAllow {
+			routeMw = append(routeMw, mid.ParameterPollution(cfg, multiValuedParams(route.Route), logger))
+		}
+
+		// the GraphQL operations are selected by operationId or by the method and the path
+		if persistedQueries != nil {
+			for _, operation := range cfg.GraphQL.Operations {
+				if (operation == route.Route.Operation.OperationID && operation != "") || operation == route.Method+" "+route.Path {
+					routeMw = append(routeMw, mid.PersistedQueries(cfg, route.Method+" "+updRoutePath, persistedQueries, logger))
+					break
+				}
+			}
+		}
+
+		// the operation is served by APIFW without the upstream if the x-wallarm-stub extension is set
+		var stub stubResponse
+		if found, err := router.GetExtension(route.Route.Operation.Extensions, xWallarmStub, &stub); err != nil {
+			logger.Errorf("handler: %s - %s: %s", route.Method, route.Path, err)
+		} else if found {
+			stubResponse, err := stub.response()
+			if err != nil {
+				logger.Errorf("handler: %s - %s: %s", route.Method, route.Path, err)
+			} else {
+				routeMw = append(routeMw, mid.Stub(route.Method+" "+updRoutePath, stubResponse, logger))
+			}
+		}
+
+		// faults are injected into the operations selected by operationId or by the method and the path
+		if cfg.FaultInjection.Enabled {
+			for _, operation := range cfg.FaultInjection.Operations {
+				if (operation == route.Route.Operation.OperationID && operation != "") || operation == route.Method+" "+route.Path {
+					routeMw = append(routeMw, mid.FaultInjection(cfg, route.Method+" "+updRoutePath, logger))
+					break
+				}
+			}
+		}
+
+		app.Handle(route.Method, updRoutePath, s.openapiWafHandler, routeMw...)
+	}
+
+	// decoy routes are served by the honeypot handler if they are not in the API Spec
+	specRoutes := make(map[string]struct{}, len(swagRouter.Routes))
+	for _, route := range swagRouter.Routes {
+		specRoutes[route.Method+" "+route.Path] = struct{}{}
+	}
+
+	decoy := honeypot{cfg: cfg, logger: logger, deniedTokens: deniedTokens}
+	for _, route := range cfg.Honeypot.Routes {
+		method, routePath, ok := strings.Cut(strings.TrimSpace(route), " ")
+		if !ok || !strings.HasPrefix(routePath, "/") {
+			logger.Errorf("honeypot: invalid route %q: should be the method and the path", route)
+			continue
+		}
+		method = strings.ToUpper(method)
+		if _, found := specRoutes[method+" "+routePath]; found {
+			logger.Errorf("honeypot: route %s %s is in the API Spec", method, routePath)
+			continue
+		}
+
+		logger.Debugf("handler: Loaded honeypot path : %s - %s", method, path.Join(serverUrl.Path, routePath))
+		app.Handle(method, path.Join(serverUrl.Path, routePath), decoy.honeypotHandler)
+	}
+
+	// gRPC-Web requests of the protobuf service methods are translated to the native gRPC requests
+	if cfg.GRPCWeb.Enabled {
+		for _, method := range validator.ProtobufMethods() {
+			routePath := "/" + string(method.Parent().FullName()) + "/" + string(method.Name())
+			if method.IsStreamingClient() {
+				logger.Errorf("grpc-web: method %s: client streaming is not supported", method.FullName())
+				continue
+			}
+			if _, found := specRoutes[fasthttp.MethodPost+" "+routePath]; found {
+				logger.Errorf("grpc-web: method %s is in the API Spec", method.FullName())
+				continue
+			}
+
+			m := grpcWebMethod{
+				cfg:           cfg,
+				logger:        logger,
+				proxyPool:     proxy,
+				method:        method,
+				operationKeys: []string{fasthttp.MethodPost + " " + routePath},
+				modes:         validationModes,
+			}
+
+			logger.Debugf("handler: Loaded gRPC-Web path : %s - %s", fasthttp.MethodPost, path.Join(serverUrl.Path, routePath))
+			app.Handle(fasthttp.MethodPost, path.Join(serverUrl.Path, routePath), m.grpcWebHandler)
+		}
+	}
+
+	// SOAP envelopes of the legacy services are validated by the WSDL
+	soapService, err := soap.New(&cfg.SOAP, cfg.BodyDecoders.MaxDepth)
+	if err != nil {
+		logger.Errorf("Error loading WSDL: %s", err)
+	}
+
+	if soapService != nil {
+		if _, found := specRoutes[fasthttp.MethodPost+" "+soapService.Path]; found {
+			logger.Errorf("soap: path %s is in the API Spec", soapService.Path)
+		} else {
+			endpoint := soapEndpoint{
+				cfg:       cfg,
+				logger:    logger,
+				proxyPool: proxy,
+				service:   soapService,
+				modes:     validationModes,
+			}
+
+			logger.Debugf("handler: Loaded SOAP path : %s - %s", fasthttp.MethodPost, path.Join(serverUrl.Path, soapService.Path))
+			app.Handle(fasthttp.MethodPost, path.Join(serverUrl.Path, soapService.Path), endpoint.soapHandler)
+		}
 	}
 
 	// set handler for default behavior (404, 405)
@@ -111,10 +608,216 @@ func OpenapiProxy(cfg *config.APIFWConfiguration, serverUrl *url.URL, shutdown c
 		pathParamLength: 0,
 		logger:          logger,
 		cfg:             cfg,
-		parserPool:      &parserPool,
+		parserPool:      pools.Parsers,
 		shadowAPI:       shadowAPI,
+		modes:           validationModes,
+		comparer:        comparer,
+		consumers:       consumerProfiles,
 	}
+	s.chain = s.buildChain()
 	app.SetDefaultBehavior(s.openapiWafHandler)
 
-	return app.Router.Handler
+	// the request is checked before routing because the router redirects and normalizes the path
+	return app.RouterHandler(mid.RequestSmuggling(cfg, logger), mid.Maintenance(cfg, maintenanceMode, nil, logger), mid.URINormalization(cfg, logger), mid.MethodOverride(cfg, logger)), nil
+}
+
+// stubResponse is the value of the x-wallarm-stub extension. The body is
+// either a string or a JSON value which is sent as is
+type stubResponse struct {
+	Status      int               `json:"status"`
+	ContentType string            `json:"content_type"`
+	Headers     map[string]string `json:"headers"`
+	Body        interface{}       `json:"body"`
+}
+
+func (s stubResponse) response() (mid.StubResponse, error) {
+	response := mid.StubResponse{
+		StatusCode:  s.Status,
+		ContentType: s.ContentType,
+		Headers:     s.Headers,
+	}
+
+	if response.StatusCode == 0 {
+		response.StatusCode = fasthttp.StatusOK
+	}
+	if response.StatusCode < 100 || response.StatusCode > 599 {
+		return response, fmt.Errorf("invalid status code of the %s extension: %d", xWallarmStub, response.StatusCode)
+	}
+
+	switch body := s.Body.(type) {
+	case nil:
+	case string:
+		response.Body = []byte(body)
+	default:
+		data, err := json.Marshal(body)
+		if err != nil {
+			return response, fmt.Errorf("invalid body of the %s extension: %v", xWallarmStub, err)
+		}
+		response.Body = data
+		if response.ContentType == "" {
+			response.ContentType = "application/json"
+		}
+	}
+
+	return response, nil
+}
+
+// operationBodyLimits returns the limits of the request body and of the response bodies of the operation.
+// The x-wallarm-max-body-size extension of the operation and of the responses has priority over the limits
+// derived from the schemas if the derivation is enabled
+func operationBodyLimits(cfg *config.APIFWConfiguration, operation *openapi3.Operation, logError func(error)) validator.BodyLimits {
+
+	limits := validator.BodyLimits{Responses: make(map[string]int64)}
+
+	factor := int64(cfg.BodyLimits.SchemaFactor)
+	if factor < 1 {
+		factor = 1
+	}
+
+	if _, err := router.GetExtension(operation.Extensions, xWallarmMaxBodySize, &limits.Request); err != nil {
+		logError(err)
+	}
+	if limits.Request == 0 && cfg.BodyLimits.DeriveFromSchema && operation.RequestBody != nil && operation.RequestBody.Value != nil {
+		if size, ok := validator.MaxBodySize(operation.RequestBody.Value.Content); ok {
+			limits.Request = size * factor
+		}
+	}
+
+	for status, response := range operation.Responses {
+		if response.Value == nil {
+			continue
+		}
+
+		var limit int64
+		if _, err := router.GetExtension(response.Value.Extensions, xWallarmMaxBodySize, &limit); err != nil {
+			logError(err)
+		}
+		if limit == 0 && cfg.BodyLimits.DeriveFromSchema {
+			if size, ok := validator.MaxBodySize(response.Value.Content); ok {
+				limit = size * factor
+			}
+		}
+		if limit > 0 {
+			limits.Responses[strings.ToUpper(status)] = limit
+		}
+	}
+
+	return limits
+}
+
+// secured returns true if the operation or the whole API Spec has the security requirements
+func secured(route *routers.Route) bool {
+	if route.Operation.Security != nil {
+		return len(*route.Operation.Security) > 0
+	}
+	return route.Spec != nil && len(route.Spec.Security) > 0
+}
+
+// oauthSecured returns true if any security requirement of the operation or the whole API Spec
+// includes the oauth2 or openIdConnect scheme
+func oauthSecured(route *routers.Route) bool {
+	requirements := route.Operation.Security
+	if requirements == nil && route.Spec != nil {
+		requirements = &route.Spec.Security
+	}
+	if requirements == nil || route.Spec == nil {
+		return false
+	}
+
+	for _, requirement := range *requirements {
+		for name := range requirement {
+			scheme := route.Spec.Components.SecuritySchemes[name]
+			if scheme != nil && scheme.Value != nil && (scheme.Value.Type == "oauth2" || scheme.Value.Type == "openIdConnect") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// securityCredentials returns the credentials of the security schemes of the operation or the whole API Spec.
+// It returns false if the credential of the scheme can't be found in the request
+func securityCredentials(route *routers.Route) ([]mid.Credential, bool) {
+	requirements := route.Operation.Security
+	if requirements == nil && route.Spec != nil {
+		requirements = &route.Spec.Security
+	}
+	if requirements == nil {
+		return nil, true
+	}
+
+	var credentials []mid.Credential
+	for _, requirement := range *requirements {
+		for name := range requirement {
+			if route.Spec == nil || route.Spec.Components.SecuritySchemes[name] == nil || route.Spec.Components.SecuritySchemes[name].Value == nil {
+				return nil, false
+			}
+
+			scheme := route.Spec.Components.SecuritySchemes[name].Value
+			switch scheme.Type {
+			case "http", "oauth2", "openIdConnect":
+				// the Authorization header is always in the scope
+			case "apiKey":
+				switch scheme.In {
+				case "header", "query", "cookie":
+					credentials = append(credentials, mid.Credential{In: scheme.In, Name: scheme.Name})
+				default:
+					return nil, false
+				}
+			default:
+				return nil, false
+			}
+		}
+	}
+
+	// the same credentials give the same scope regardless of the order of the requirements
+	sort.Slice(credentials, func(i, j int) bool {
+		if credentials[i].In != credentials[j].In {
+			return credentials[i].In < credentials[j].In
+		}
+		return credentials[i].Name < credentials[j].Name
+	})
+
+	return credentials, true
+}
+
+// multiValuedParams returns the names of the query parameters and the urlencoded form fields
+// documented as arrays, so they are allowed to be passed several times
+func multiValuedParams(route *routers.Route) map[string]struct{} {
+	names := make(map[string]struct{})
+
+	var params openapi3.Parameters
+	params = append(params, route.PathItem.Parameters...)
+	params = append(params, route.Operation.Parameters...)
+	for _, param := range params {
+		if param.Value == nil || param.Value.In != openapi3.ParameterInQuery || param.Value.Schema == nil {
+			continue
+		}
+		if param.Value.Schema.Value != nil && param.Value.Schema.Value.Type == openapi3.TypeArray {
+			names[param.Value.Name] = struct{}{}
+		}
+	}
+
+	if route.Operation.RequestBody != nil && route.Operation.RequestBody.Value != nil {
+		if mediaType := route.Operation.RequestBody.Value.Content.Get("application/x-www-form-urlencoded"); mediaType != nil && mediaType.Schema != nil && mediaType.Schema.Value != nil {
+			for name, prop := range mediaType.Schema.Value.Properties {
+				if prop.Value != nil && prop.Value.Type == openapi3.TypeArray {
+					names[name] = struct{}{}
+				}
+			}
+		}
+	}
+
+	return names
+}
+
+// parseSunset parses the sunset date in the RFC 3339, HTTP-date or YYYY-MM-DD formats
+func parseSunset(value string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, http.TimeFormat, "2006-01-02"} {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid %s date: %s", xSunset, value)
 }
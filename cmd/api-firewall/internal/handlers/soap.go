@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/config"
+	"github.com/wallarm/api-firewall/internal/platform/experiment"
+	"github.com/wallarm/api-firewall/internal/platform/modes"
+	"github.com/wallarm/api-firewall/internal/platform/proxy"
+	"github.com/wallarm/api-firewall/internal/platform/soap"
+	"github.com/wallarm/api-firewall/internal/platform/web"
+)
+
+// soapEndpoint validates the SOAP envelopes of the legacy services by the WSDL. The operation
+// is selected by the SOAP action, the name of the operation is used to override the validation modes
+type soapEndpoint struct {
+	cfg       *config.APIFWConfiguration
+	logger    *logrus.Logger
+	proxyPool proxy.Pool
+	service   *soap.Service
+	modes     *modes.Overrides
+}
+
+// block responds by the block status code with the SOAP fault of the version of the request
+func (e *soapEndpoint) block(ctx *fasthttp.RequestCtx, verdict *web.Verdict, server bool, reason string) error {
+	verdict.Decision = web.VerdictBlocked
+
+	contentType, body := soap.Fault(string(ctx.Request.Header.ContentType()), server, reason)
+
+	ctx.Response.Reset()
+	ctx.SetStatusCode(e.cfg.CustomBlockStatusCode)
+	ctx.SetContentType(contentType)
+	ctx.SetBody(body)
+
+	return nil
+}
+
+func (e *soapEndpoint) soapHandler(ctx *fasthttp.RequestCtx) error {
+
+	verdict := &web.Verdict{Decision: web.VerdictSkipped}
+	web.SetVerdict(ctx, verdict)
+
+	op, reqErr := e.service.ValidateRequest(string(ctx.Request.Header.ContentType()), string(ctx.Request.Header.Peek("SOAPAction")), ctx.Request.Body())
+
+	var operationKeys []string
+	if op != nil {
+		operationKeys = []string{op.Name}
+		verdict.Operation = op.Name
+	}
+
+	requestValidation, responseValidation := experiment.Modes(ctx, e.cfg.RequestValidation, e.cfg.ResponseValidation)
+	requestValidation, responseValidation = e.modes.Effective(operationKeys, requestValidation, responseValidation)
+
+	if requestValidation != web.ValidationDisable {
+		verdict.Decision = web.VerdictPassed
+
+		if reqErr != nil {
+			e.logger.WithFields(logrus.Fields{
+				"error":      reqErr,
+				"operation":  verdict.Operation,
+				"request_id": fmt.Sprintf("#%016X", ctx.ID()),
+			}).Error("request validation error")
+
+			verdict.Decision = web.VerdictFailed
+			verdict.Rule = "request-body-" + strings.Split(string(ctx.Request.Header.ContentType()), ";")[0]
+			verdict.Reason = reqErr.Error()
+			verdict.Subject = "request-body"
+
+			if requestValidation == web.ValidationBlock {
+				return e.block(ctx, verdict, false, "request validation error")
+			}
+		}
+	}
+
+	client, err := e.proxyPool.Get()
+	if err != nil {
+		e.logger.WithFields(logrus.Fields{
+			"error":      err,
+			"request_id": fmt.Sprintf("#%016X", ctx.ID()),
+		}).Error("error while proxying request")
+		return web.RespondError(ctx, fasthttp.StatusServiceUnavailable, nil)
+	}
+	defer e.proxyPool.Put(client)
+
+	if err := performProxy(ctx, e.logger, client); err != nil {
+		return err
+	}
+
+	// the response of the unknown operation can't be validated
+	if op == nil || responseValidation == web.ValidationDisable {
+		return nil
+	}
+
+	if err := e.service.ValidateResponse(op, string(ctx.Response.Header.ContentType()), ctx.Response.Body()); err != nil {
+		e.logger.WithFields(logrus.Fields{
+			"error":      err,
+			"operation":  verdict.Operation,
+			"request_id": fmt.Sprintf("#%016X", ctx.ID()),
+		}).Error("response validation error")
+
+		if verdict.Decision != web.VerdictFailed {
+			verdict.Decision = web.VerdictFailed
+			verdict.Rule = fmt.Sprintf("response-%d-%s", ctx.Response.StatusCode(), strings.Split(string(ctx.Response.Header.ContentType()), ";")[0])
+			verdict.Reason = err.Error()
+			verdict.Subject = "response"
+		}
+
+		if responseValidation == web.ValidationBlock {
+			return e.block(ctx, verdict, true, "response validation error")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/platform/router"
+)
+
+// Specs holds the enforced API Spec and the handler built from it. The API Spec
+// can be replaced at runtime without restarting the listener
+type Specs struct {
+	Build  func(swagRouter *router.Router) (fasthttp.RequestHandler, error)
+	Logger *logrus.Logger
+
+	mu       sync.RWMutex
+	router   *router.Router
+	handler  fasthttp.RequestHandler
+	lastDiff *router.SpecDiff
+}
+
+// NewSpecs creates the holder of the API Spec and builds the handler
+func NewSpecs(swagRouter *router.Router, logger *logrus.Logger, build func(swagRouter *router.Router) (fasthttp.RequestHandler, error)) (*Specs, error) {
+	handler, err := build(swagRouter)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Specs{
+		Build:   build,
+		Logger:  logger,
+		router:  swagRouter,
+		handler: handler,
+	}, nil
+}
+
+// Handler passes the request to the handler of the enforced API Spec
+func (s *Specs) Handler(ctx *fasthttp.RequestCtx) {
+	s.mu.RLock()
+	handler := s.handler
+	s.mu.RUnlock()
+
+	handler(ctx)
+}
+
+// Load replaces the enforced API Spec and returns the changes of the operations and schemas.
+// The previous API Spec is enforced if the handler of the new one can't be built
+func (s *Specs) Load(swagRouter *router.Router) (*router.SpecDiff, error) {
+	handler, err := s.Build(swagRouter)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	diff := router.Diff(s.router, swagRouter)
+	s.router = swagRouter
+	s.handler = handler
+	s.lastDiff = diff
+	s.mu.Unlock()
+
+	s.Logger.WithFields(logrus.Fields{
+		"added_operations":   diff.AddedOperations,
+		"removed_operations": diff.RemovedOperations,
+		"changed_operations": diff.ChangedOperations,
+		"added_schemas":      diff.AddedSchemas,
+		"removed_schemas":    diff.RemovedSchemas,
+		"changed_schemas":    diff.ChangedSchemas,
+	}).Info("API Spec loaded")
+
+	return diff, nil
+}
+
+// Router returns the router of the enforced API Spec
+func (s *Specs) Router() *router.Router {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.router
+}
+
+// LastDiff returns the changes made by the last API Spec load
+func (s *Specs) LastDiff() *router.SpecDiff {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.lastDiff
+}
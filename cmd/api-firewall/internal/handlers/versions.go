@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/config"
+	"github.com/wallarm/api-firewall/internal/platform/experiment"
+	"github.com/wallarm/api-firewall/internal/platform/modes"
+	"github.com/wallarm/api-firewall/internal/platform/web"
+)
+
+// ParseVersionSpecs parses the API Specs of the versions in the version=spec format
+func ParseVersionSpecs(specs []string) (map[string]string, error) {
+	parsed := make(map[string]string, len(specs))
+	for _, spec := range specs {
+		parts := strings.SplitN(spec, "=", 2)
+		version, apiSpecs := strings.TrimSpace(parts[0]), ""
+		if len(parts) == 2 {
+			apiSpecs = strings.TrimSpace(parts[1])
+		}
+		if version == "" || apiSpecs == "" {
+			return nil, fmt.Errorf("API version spec %q should be in the version=spec format", spec)
+		}
+		if _, ok := parsed[version]; ok {
+			return nil, fmt.Errorf("API version %s is configured more than once", version)
+		}
+		parsed[version] = apiSpecs
+	}
+	return parsed, nil
+}
+
+// VersionedProxy dispatches the request to the handler of the API Spec version
+// requested by the client. Requests without the version are handled by the default handler. The requests
+// of the unknown versions are blocked by the effective request validation mode
+func VersionedProxy(cfg *config.APIFWConfiguration, logger *logrus.Logger, versions map[string]fasthttp.RequestHandler, defaultHandler fasthttp.RequestHandler, validationModes *modes.Overrides) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+
+		version := requestedVersion(ctx, &cfg.APIVersions)
+		if version == "" {
+			defaultHandler(ctx)
+			return
+		}
+
+		handler, ok := versions[version]
+		if !ok {
+			logger.WithFields(logrus.Fields{
+				"request_id":     fmt.Sprintf("#%016X", ctx.ID()),
+				"version":        version,
+				"method":         fmt.Sprintf("%s", ctx.Request.Header.Method()),
+				"path":           fmt.Sprintf("%s", ctx.Path()),
+				"client_address": ctx.RemoteAddr(),
+			}).Error("unknown API version requested")
+
+			// the validation modes of the experiment cohort and the overridden modes are used as by the API Spec handlers
+			requestValidation, responseValidation := experiment.Modes(ctx, cfg.RequestValidation, cfg.ResponseValidation)
+			requestValidation, _ = validationModes.Effective(nil, requestValidation, responseValidation)
+
+			if requestValidation == web.ValidationBlock {
+				ctx.Error("", cfg.CustomBlockStatusCode)
+				return
+			}
+
+			defaultHandler(ctx)
+			return
+		}
+
+		handler(ctx)
+	}
+}
+
+// requestedVersion returns the API version from the version header or
+// from the version parameter of the media types listed in the Accept header
+func requestedVersion(ctx *fasthttp.RequestCtx, cfg *config.APIVersions) string {
+
+	if cfg.Header != "" {
+		if version := strings.TrimSpace(string(ctx.Request.Header.Peek(cfg.Header))); version != "" {
+			return version
+		}
+	}
+
+	if cfg.MediaTypeParam == "" {
+		return ""
+	}
+
+	for _, mediaType := range strings.Split(string(ctx.Request.Header.Peek(fasthttp.HeaderAccept)), ",") {
+		_, params, err := mime.ParseMediaType(strings.TrimSpace(mediaType))
+		if err != nil {
+			continue
+		}
+		if version, ok := params[cfg.MediaTypeParam]; ok && version != "" {
+			return version
+		}
+	}
+
+	return ""
+}
@@ -1,15 +1,21 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"expvar" // Register the expvar handlers
 	"fmt"
 	"mime"
+	"net"
 	"net/url"
 	"os"
 	"os/signal"
 	"path"
+	"regexp"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/ardanlabs/conf"
 	"github.com/getkin/kin-openapi/openapi3"
@@ -19,10 +25,43 @@ import (
 	"github.com/valyala/fasthttp"
 	"github.com/wallarm/api-firewall/cmd/api-firewall/internal/handlers"
 	"github.com/wallarm/api-firewall/internal/config"
+	"github.com/wallarm/api-firewall/internal/platform/access"
+	"github.com/wallarm/api-firewall/internal/platform/analyzer"
+	"github.com/wallarm/api-firewall/internal/platform/backendauth"
+	"github.com/wallarm/api-firewall/internal/platform/basicauth"
+	"github.com/wallarm/api-firewall/internal/platform/classification"
+	"github.com/wallarm/api-firewall/internal/platform/coalescing"
+	"github.com/wallarm/api-firewall/internal/platform/consumers"
 	"github.com/wallarm/api-firewall/internal/platform/denylist"
+	"github.com/wallarm/api-firewall/internal/platform/experiment"
+	"github.com/wallarm/api-firewall/internal/platform/geoip"
+	"github.com/wallarm/api-firewall/internal/platform/graphql"
+	"github.com/wallarm/api-firewall/internal/platform/learning"
+	"github.com/wallarm/api-firewall/internal/platform/loader"
+	"github.com/wallarm/api-firewall/internal/platform/maintenance"
+	"github.com/wallarm/api-firewall/internal/platform/modes"
+	woauth2 "github.com/wallarm/api-firewall/internal/platform/oauth2"
+	"github.com/wallarm/api-firewall/internal/platform/passthrough"
+	"github.com/wallarm/api-firewall/internal/platform/pii"
+	"github.com/wallarm/api-firewall/internal/platform/pools"
 	"github.com/wallarm/api-firewall/internal/platform/proxy"
+	"github.com/wallarm/api-firewall/internal/platform/replay"
+	"github.com/wallarm/api-firewall/internal/platform/responsediff"
+	"github.com/wallarm/api-firewall/internal/platform/revocation"
 	"github.com/wallarm/api-firewall/internal/platform/router"
+	"github.com/wallarm/api-firewall/internal/platform/scoring"
 	"github.com/wallarm/api-firewall/internal/platform/shadowAPI"
+	"github.com/wallarm/api-firewall/internal/platform/siem"
+	"github.com/wallarm/api-firewall/internal/platform/sink"
+	"github.com/wallarm/api-firewall/internal/platform/slo"
+	"github.com/wallarm/api-firewall/internal/platform/soap"
+	"github.com/wallarm/api-firewall/internal/platform/state"
+	"github.com/wallarm/api-firewall/internal/platform/systemd"
+	"github.com/wallarm/api-firewall/internal/platform/tlsfp"
+	"github.com/wallarm/api-firewall/internal/platform/useragent"
+	wvalidator "github.com/wallarm/api-firewall/internal/platform/validator"
+	"github.com/wallarm/api-firewall/internal/platform/verdictcache"
+	"github.com/wallarm/api-firewall/internal/platform/web"
 )
 
 var build = "develop"
@@ -77,41 +116,25 @@ func run(logger *logrus.Logger) error {
 		return errors.Wrap(err, "parsing config")
 	}
 
-	// validate
-	validate := validator.New()
-
-	if err := validate.RegisterValidation("HttpStatusCodes", config.ValidateStatusList); err != nil {
-		return errors.Errorf("configuration validation error: %s", err.Error())
-	}
-
-	if err := validate.Struct(cfg); err != nil {
-
-		for _, err := range err.(validator.ValidationErrors) {
-			switch err.Tag() {
-			case "gt":
-				return errors.Errorf("configuration validation error: parameter %s should be > %s. Actual value: %d", err.Field(), err.Param(), err.Value())
-			case "url":
-				return errors.Errorf("configuration validation error: parameter %s should be a string in URL format. Example: http://localhost:8080/; actual value: %s", err.Field(), err.Value())
-			case "oneof":
-				return errors.Errorf("configuration validation error: parameter %s should have one of the following value: %s; actual value: %s", err.Field(), err.Param(), err.Value())
-			}
-		}
-		return errors.Wrap(err, "configuration validation error")
+	// check the configuration and the API Spec without starting the service
+	if cfg.Args.Num(0) == "check-config" {
+		return checkConfig(&cfg, logger, os.Stdout)
 	}
 
-	// oauth introspection endpoint: validate format of configured content-type
-	if cfg.Server.Oauth.Introspection.ContentType != "" {
-		_, _, err := mime.ParseMediaType(cfg.Server.Oauth.Introspection.ContentType)
-		if err != nil {
-			return errors.Wrap(err, "configuration validation error")
-		}
+	if err := validateConfig(&cfg); err != nil {
+		return err
 	}
 
 	// =========================================================================
 	// Init Logger
 
-	if strings.ToLower(cfg.LogFormat) == "json" {
+	switch strings.ToLower(cfg.LogFormat) {
+	case "json":
 		logger.SetFormatter(&logrus.JSONFormatter{})
+	case "cef":
+		logger.SetFormatter(&siem.CEFFormatter{Version: build})
+	case "leef":
+		logger.SetFormatter(&siem.LEEFFormatter{Version: build})
 	}
 
 	switch strings.ToLower(cfg.LogLevel) {
@@ -145,29 +168,100 @@ func run(logger *logrus.Logger) error {
 	// =========================================================================
 	// Init Swagger
 
-	var swagger *openapi3.T
+	// API Spec from the Git repository
+	var gitSpecs *loader.Git
 
-	apiSpecUrl, err := url.ParseRequestURI(cfg.APISpecs)
-	if err != nil {
-		logger.Debugf("%s: Trying to parse API Spec value as URL : %v\n", logPrefix, err.Error())
+	if cfg.APISpecsGit.Repository != "" {
+		gitSpecs = loader.NewGit(&cfg.APISpecsGit, logger)
+
+		if _, err := gitSpecs.Fetch(context.Background()); err != nil {
+			return errors.Wrap(err, "loading API Spec from git")
+		}
+
+		cfg.APISpecs = gitSpecs.SpecPath()
 	}
 
-	switch apiSpecUrl {
-	case nil:
-		swagger, err = openapi3.NewLoader().LoadFromFile(cfg.APISpecs)
-		if err != nil {
-			return errors.Wrap(err, "loading swagwaf file")
+	// API Spec from the blob storage polled for the changes
+	var blobSpecs *loader.Blob
+
+	if blobURL, err := url.ParseRequestURI(cfg.APISpecs); err == nil && loader.IsBlobURL(blobURL) && cfg.APISpecsBlob.PollInterval > 0 {
+		blobSpecs = loader.NewBlob(&cfg.APISpecsBlob, blobURL)
+	}
+
+	var swagRouter *router.Router
+
+	if blobSpecs != nil {
+		if _, err := blobSpecs.Fetch(); err != nil {
+			return errors.Wrap(err, "loading swagwaf from blob storage")
 		}
-	default:
-		swagger, err = openapi3.NewLoader().LoadFromURI(apiSpecUrl)
-		if err != nil {
-			return errors.Wrap(err, "loading swagwaf url")
+		swagRouter, err = loadSwaggerData(blobSpecs.Data(), cfg.APISpecs, &cfg)
+	} else {
+		swagRouter, err = loadSwagger(cfg.APISpecs, &cfg, logger)
+	}
+	if err != nil {
+		return err
+	}
+
+	// limits of the YAML, CBOR and MessagePack bodies
+	if err := wvalidator.SetDecoderLimits(cfg.BodyDecoders.MaxSize, cfg.BodyDecoders.MaxDepth); err != nil {
+		return errors.Wrap(err, "configuration validation error")
+	}
+
+	// structural limits of the JSON bodies
+	if err := wvalidator.SetJSONLimits(cfg.JSONLimits.MaxDepth, cfg.JSONLimits.MaxKeys, cfg.JSONLimits.MaxArrayLength, cfg.JSONLimits.MaxStringLength); err != nil {
+		return errors.Wrap(err, "configuration validation error")
+	}
+
+	// duplicate keys of the JSON objects
+	wvalidator.SetRejectDuplicateKeys(cfg.JSONLimits.RejectDuplicateKeys)
+
+	// structural scan of the JSON bodies before the parsing
+	wvalidator.SetJSONPrefilter(cfg.JSONLimits.Prefilter)
+
+	// charsets of the responses and the transcoding of the legacy charsets to UTF-8
+	wvalidator.SetResponseCharsets(cfg.ResponseCharset.Allowed, cfg.ResponseCharset.Transcode)
+
+	// matching of the Content-Type with the media types declared in the API Spec
+	if err := wvalidator.SetContentTypeMatching(cfg.ContentTypeMatching.Mode); err != nil {
+		return errors.Wrap(err, "configuration validation error")
+	}
+
+	// decoding of the big integers and the numbers which lose precision as float64
+	if err := wvalidator.SetJSONNumbers(cfg.JSONNumbers.BigIntegers, cfg.JSONNumbers.RejectPrecisionLoss); err != nil {
+		return errors.Wrap(err, "configuration validation error")
+	}
+
+	// request bodies validated concurrently with the parameters
+	if err := wvalidator.SetParallelValidation(cfg.ParallelValidation.Workers, cfg.ParallelValidation.MinBodySize); err != nil {
+		return errors.Wrap(err, "configuration validation error")
+	}
+
+	// parsers and body buffers pools sizes
+	if err := pools.Configure(&cfg.Pools); err != nil {
+		return errors.Wrap(err, "configuration validation error")
+	}
+
+	// protobuf messages descriptors for the request and response bodies
+	if cfg.BodyDecoders.ProtobufDescriptors != "" {
+		if err := wvalidator.LoadProtobufDescriptors(cfg.BodyDecoders.ProtobufDescriptors); err != nil {
+			return errors.Wrap(err, "loading protobuf descriptors")
 		}
+		logger.Infof("%s: Loaded protobuf descriptors from %s", logPrefix, cfg.BodyDecoders.ProtobufDescriptors)
 	}
 
-	swagRouter, err := router.NewRouter(swagger)
+	// additional API Spec versions selected by the client
+	versionSpecs, err := handlers.ParseVersionSpecs(cfg.APIVersions.Specs)
 	if err != nil {
-		return errors.Wrap(err, "parsing swagwaf file")
+		return errors.Wrap(err, "configuration validation error")
+	}
+
+	versionRouters := make(map[string]*router.Router)
+	for version, apiSpecs := range versionSpecs {
+		versionRouters[version], err = loadSwagger(apiSpecs, &cfg, logger)
+		if err != nil {
+			return errors.Wrapf(err, "API version %s", version)
+		}
+		logger.Infof("%s: Loaded API Spec version %s from %s", logPrefix, version, apiSpecs)
 	}
 
 	// =========================================================================
@@ -193,11 +287,99 @@ func run(logger *logrus.Logger) error {
 		initialCap = 1
 	}
 
-	pool, err := proxy.NewChanPool(initialCap, cfg.Server.ClientPoolCapacity, host, &cfg.Server)
+	backendAuth, err := backendauth.New(&cfg.Server.BackendAuth, logger)
+	if err != nil {
+		return errors.Wrap(err, "backend auth init")
+	}
+
+	// the pool of each upstream is limited by the adaptive concurrency limit
+	newPool := func(addr string) (proxy.Pool, error) {
+		pool, err := proxy.NewChanPool(initialCap, cfg.Server.ClientPoolCapacity, addr, &cfg.Server, backendAuth)
+		if err != nil || !cfg.Server.Concurrency.Enabled {
+			return pool, err
+		}
+		return proxy.NewAdaptivePool(pool, &cfg.Server.Concurrency)
+	}
+
+	pool, err := newPool(host)
 	if err != nil {
 		return errors.Wrap(err, "proxy pool init")
 	}
 
+	// the operations are proxied to the upstream clusters selected by the routes
+	upstreamRoutes, err := proxy.ParseRoutes(cfg.Server.Upstream.Routes)
+	if err != nil {
+		return errors.Wrap(err, "proxy pool init")
+	}
+
+	if len(upstreamRoutes) > 0 {
+		pool, err = proxy.NewClusters(pool, upstreamRoutes, func(route proxy.Route) (proxy.Pool, error) {
+			logger.Infof("%s : upstream cluster %s", logPrefix, route.URL.Redacted())
+			return newPool(route.Addr)
+		})
+		if err != nil {
+			return errors.Wrap(err, "proxy pool init")
+		}
+	}
+
+	expvar.Publish("proxy_pool", expvar.Func(func() interface{} { return pool.Stats() }))
+	expvar.Publish("pii_detections", expvar.Func(func() interface{} { return pii.Detections.Snapshot() }))
+	expvar.Publish("data_classification", expvar.Func(func() interface{} { return classification.Flows.Snapshot() }))
+	expvar.Publish("response_diff", expvar.Func(func() interface{} { return responsediff.Totals() }))
+	expvar.Publish("coalescing", expvar.Func(func() interface{} { return coalescing.Totals() }))
+	expvar.Publish("upstream_slo", expvar.Func(func() interface{} { return slo.Snapshot() }))
+	expvar.Publish("experiment", expvar.Func(func() interface{} { return experiment.Snapshot() }))
+	expvar.Publish("verdicts", expvar.Func(func() interface{} { return web.Verdicts.Snapshot() }))
+	expvar.Publish("json_prefilter", expvar.Func(func() interface{} { return wvalidator.PrefilterTotals() }))
+	expvar.Publish("parallel_validation", expvar.Func(func() interface{} { return wvalidator.ParallelTotals() }))
+	expvar.Publish("verdict_cache", expvar.Func(func() interface{} { return verdictcache.Totals() }))
+	expvar.Publish("client_types", expvar.Func(func() interface{} { return useragent.Totals() }))
+	expvar.Publish("body_sizes", expvar.Func(func() interface{} { return web.BodySizes.Snapshot() }))
+	expvar.Publish("pools", expvar.Func(func() interface{} { return pools.Totals() }))
+
+	if cfg.Pools.WarnInterval > 0 {
+		stopWatch := pools.Watch(logger, cfg.Pools.WarnInterval, cfg.Pools.WarnThreshold)
+		defer stopWatch()
+	}
+
+	learning.Suggestions.SetLimit(cfg.SchemaLearning.MaxSuggestions)
+
+	// Logs and events are enriched with the location of the client
+	if cfg.GeoIP.CityDatabase != "" || cfg.GeoIP.ASNDatabase != "" {
+		if err := geoip.Default.Load(&cfg.GeoIP); err != nil {
+			return errors.Wrap(err, "loading GeoIP databases")
+		}
+		logger.AddHook(&geoip.Hook{Enricher: geoip.Default})
+
+		logger.Infof("%s: Enriching logs and events with the client location (city database: %q, ASN database: %q)", logPrefix, cfg.GeoIP.CityDatabase, cfg.GeoIP.ASNDatabase)
+	}
+
+	// Copies of the requests with the verdicts are forwarded to the external analysis endpoint
+	if cfg.Analyzer.URL != "" {
+		if err := analyzer.Default.Start(&cfg.Analyzer, logger); err != nil {
+			return errors.Wrap(err, "starting analyzer forwarding")
+		}
+		defer analyzer.Default.Stop()
+
+		expvar.Publish("analyzer", expvar.Func(func() interface{} { return analyzer.Default.Stats() }))
+		logger.Infof("%s: Forwarding requests to the analyzer %s (%s)", logPrefix, cfg.Analyzer.URL, strings.Join(cfg.Analyzer.Decisions, ", "))
+	}
+
+	// Verdicts of all requests are stored in ClickHouse or Elasticsearch
+	if cfg.EventSink.Type != "" {
+		if err := sink.Default.Start(&cfg.EventSink, logger); err != nil {
+			return errors.Wrap(err, "starting event sink")
+		}
+		defer sink.Default.Stop()
+
+		expvar.Publish("event_sink", expvar.Func(func() interface{} { return sink.Default.Stats() }))
+		logger.Infof("%s: Storing verdicts in %s (%s)", logPrefix, cfg.EventSink.Type, cfg.EventSink.URL)
+	}
+
+	if cfg.DeniedRequests.Store {
+		replay.Denied.Configure(cfg.DeniedRequests.Capacity, cfg.DeniedRequests.MaxBodySize, cfg.DeniedRequests.RedactHeaders)
+	}
+
 	// =========================================================================
 	// Init ShadowAPI checker
 
@@ -220,6 +402,28 @@ func run(logger *logrus.Logger) error {
 		logger.Infof("%s: Loaded %d tokens to the cache", logPrefix, deniedTokens.ElementsNum)
 	}
 
+	if deniedTokens != nil && deniedTokens.Feeds != nil {
+		logger.Infof("%s: Fetching %d threat intelligence feed(s) every %s", logPrefix, len(cfg.ThreatIntel.Feeds), cfg.ThreatIntel.RefreshInterval)
+		expvar.Publish("threat_intel", expvar.Func(func() interface{} { return deniedTokens.Feeds.Stats() }))
+		go deniedTokens.Feeds.Run()
+	}
+
+	// =========================================================================
+	// Init OpenID provider
+
+	// the provider configuration and the keys are discovered once and refreshed in the background for all API Specs
+	var oidcProvider *woauth2.OIDC
+	if cfg.Server.Oauth.OIDC.Issuer != "" {
+		oidcProvider, err = woauth2.NewOIDC(&cfg.Server.Oauth, logger)
+		if err != nil {
+			return errors.Wrap(err, "discovering OpenID provider configuration")
+		}
+
+		metadata := oidcProvider.Metadata()
+		logger.Infof("%s: OAuth2: discovered OpenID provider %s (jwks_uri: %s, introspection endpoint: %s, token endpoint: %s)",
+			logPrefix, metadata.Issuer, metadata.JwksURI, metadata.IntrospectionEndpoint, metadata.TokenEndpoint)
+	}
+
 	// =========================================================================
 	// Start API Service
 
@@ -239,17 +443,119 @@ func run(logger *logrus.Logger) error {
 		isTLS = true
 	}
 
+	// Sockets passed by systemd socket activation are used instead of binding the configured hosts
+	listeners, err := systemd.Listeners()
+	if err != nil {
+		return errors.Wrap(err, "systemd socket activation")
+	}
+
 	// Make a channel to listen for an interrupt or terminate signal from the OS.
 	// Use a buffered channel because the signal package requires it.
 	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
 
-	api := fasthttp.Server{
-		Handler:               handlers.OpenapiProxy(&cfg, serverUrl, shutdown, logger, pool, swagRouter, deniedTokens, shadowAPI),
-		ReadTimeout:           cfg.ReadTimeout,
-		WriteTimeout:          cfg.WriteTimeout,
-		Logger:                logger,
-		NoDefaultServerHeader: true,
+	// Maintenance mode can be changed at runtime by the admin API
+	maintenanceMode := maintenance.New(cfg.Maintenance.Enabled, cfg.Maintenance.Operations)
+
+	// Validation modes can be overridden at runtime by the admin API
+	validationModes := modes.New()
+
+	// Validation modes and rate limits are changed by the scheduled windows
+	scheduler, err := config.NewScheduler(&cfg.Schedule)
+	if err != nil {
+		return errors.Wrap(err, "loading schedule")
+	}
+	if scheduler != nil {
+		go scheduler.Run(func(active []*config.ScheduleWindow) {
+			applySchedule(active, validationModes, logger)
+		})
+	}
+
+	// API Spec can be replaced at runtime by SIGHUP or by the admin API
+	specs, err := handlers.NewSpecs(swagRouter, logger, func(swagRouter *router.Router) (fasthttp.RequestHandler, error) {
+		return handlers.OpenapiProxy(&cfg, serverUrl, shutdown, logger, pool, swagRouter, deniedTokens, shadowAPI, maintenanceMode, validationModes, oidcProvider)
+	})
+	if err != nil {
+		return errors.Wrap(err, "building API Spec handler")
+	}
+
+	apiHandler := specs.Handler
+
+	if len(versionRouters) > 0 {
+		versionHandlers := make(map[string]fasthttp.RequestHandler, len(versionRouters))
+		for version, versionRouter := range versionRouters {
+			versionHandler, err := handlers.OpenapiProxy(&cfg, serverUrl, shutdown, logger, pool, versionRouter, deniedTokens, shadowAPI, maintenanceMode, validationModes, oidcProvider)
+			if err != nil {
+				return errors.Wrapf(err, "building API Spec handler of version %s", version)
+			}
+			versionHandlers[version] = versionHandler
+		}
+		apiHandler = handlers.VersionedProxy(&cfg, logger, versionHandlers, apiHandler, validationModes)
+	}
+
+	api := newAPIServer(&cfg, apiHandler, logger)
+
+	// Client certificates verification
+	if isTLS && cfg.TLS.ClientAuth != web.ClientAuthNone {
+		clientCAs := x509.NewCertPool()
+
+		caCerts, err := os.ReadFile(path.Join(cfg.TLS.CertsPath, cfg.TLS.ClientCA))
+		if err != nil {
+			return errors.Wrap(err, "loading client CA")
+		}
+
+		if ok := clientCAs.AppendCertsFromPEM(caCerts); !ok {
+			return errors.New("loading client CA: no certs appended")
+		}
+
+		api.TLSConfig = &tls.Config{
+			ClientCAs:  clientCAs,
+			ClientAuth: tls.VerifyClientCertIfGiven,
+		}
+
+		if cfg.TLS.ClientAuth == web.ClientAuthRequire {
+			api.TLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+
+		// the handshake with the revoked client certificate is rejected
+		revocationChecker, err := revocation.New(&cfg.TLS.Revocation, logger)
+		if err != nil {
+			return errors.Wrap(err, "client certificates revocation")
+		}
+
+		if revocationChecker != nil {
+			api.TLSConfig.VerifyConnection = func(state tls.ConnectionState) error {
+				if len(state.VerifiedChains) == 0 {
+					return nil
+				}
+				if err := revocationChecker.Check(state.VerifiedChains[0]); err != nil {
+					logger.WithFields(logrus.Fields{
+						"error":               err,
+						"client_cert_subject": state.VerifiedChains[0][0].Subject.String(),
+					}).Error("client certificate rejected")
+					return err
+				}
+				return nil
+			}
+
+			if len(cfg.TLS.Revocation.CRLFiles) > 0 {
+				go revocationChecker.Run()
+			}
+
+			logger.Infof("%s: Client certificates revocation check enabled (OCSP: %t, CRLs: %d, %s)", logPrefix,
+				cfg.TLS.Revocation.OCSP, len(cfg.TLS.Revocation.CRLFiles), cfg.TLS.Revocation.FailurePolicy)
+		}
+
+		logger.Infof("%s: Client certificates verification enabled (%s)", logPrefix, cfg.TLS.ClientAuth)
+	}
+
+	var passthroughRoutes passthrough.Routes
+	if len(cfg.Passthrough.Routes) > 0 {
+		// the routes are checked by validateConfig
+		passthroughRoutes, _ = passthrough.ParseRoutes(cfg.Passthrough.Routes)
+		expvar.Publish("passthrough", expvar.Func(func() interface{} { return passthrough.Totals() }))
+
+		logger.Infof("%s: TLS passthrough enabled (%d routes)", logPrefix, len(passthroughRoutes))
 	}
 
 	// Make a channel to listen for errors coming from the listener. Use a
@@ -258,12 +564,38 @@ func run(logger *logrus.Logger) error {
 
 	// Start the service listening for requests.
 	go func() {
-		logger.Infof("%s: API listening on %s", logPrefix, cfg.APIHost)
+		ln := activatedListener(listeners, "api")
+		if ln != nil {
+			logger.Infof("%s: API listening on systemd socket %s", logPrefix, ln.Addr())
+		} else {
+			var err error
+			if ln, err = net.Listen("tcp4", apiHost.Host); err != nil {
+				serverErrors <- err
+				return
+			}
+			logger.Infof("%s: API listening on %s", logPrefix, cfg.APIHost)
+		}
+
+		// the TLS connections of the passthrough server names are passed to the upstreams without the validation
+		if passthroughRoutes != nil {
+			ln = passthrough.Listener(ln, &cfg.Passthrough, passthroughRoutes, logger)
+		}
+
+		// the client hello of the TLS connections is captured to compute the fingerprints
+		if isTLS && cfg.TLS.Fingerprint.Enabled {
+			ln = tlsfp.Listener(ln)
+		}
+
+		// the clients reading the responses slower than the minimum transfer rate are disconnected
+		if cfg.HTTPServer.MinTransferRate > 0 {
+			ln = web.MinRateListener(ln, cfg.HTTPServer.MinTransferRate, cfg.HTTPServer.MinTransferRateGrace)
+		}
+
 		switch isTLS {
 		case false:
-			serverErrors <- api.ListenAndServe(apiHost.Host)
+			serverErrors <- api.Serve(ln)
 		case true:
-			serverErrors <- api.ListenAndServeTLS(apiHost.Host, path.Join(cfg.TLS.CertsPath, cfg.TLS.CertFile),
+			serverErrors <- api.ServeTLS(ln, path.Join(cfg.TLS.CertsPath, cfg.TLS.CertFile),
 				path.Join(cfg.TLS.CertsPath, cfg.TLS.CertKey))
 		}
 	}()
@@ -303,10 +635,303 @@ func run(logger *logrus.Logger) error {
 
 	// Start the service listening for requests.
 	go func() {
+		if ln := activatedListener(listeners, "health"); ln != nil {
+			logger.Infof("%s: Health API listening on systemd socket %s", logPrefix, ln.Addr())
+			serverErrors <- healthApi.Serve(ln)
+			return
+		}
+
 		logger.Infof("%s: Health API listening on %s", logPrefix, cfg.HealthAPIHost)
 		serverErrors <- healthApi.ListenAndServe(cfg.HealthAPIHost)
 	}()
 
+	// =========================================================================
+	// Start Admin API Service
+
+	if cfg.AdminAPIHost != "" {
+		adminData := handlers.Admin{
+			Token:        cfg.AdminAPIToken,
+			Logger:       logger,
+			Config:       &cfg,
+			Specs:        specs,
+			Pool:         pool,
+			Maintenance:  maintenanceMode,
+			Modes:        validationModes,
+			DeniedTokens: deniedTokens,
+		}
+
+		// admin service handler
+		adminHandler := func(ctx *fasthttp.RequestCtx) {
+			if !adminData.Authorized(ctx) {
+				ctx.Error("Unauthorized", fasthttp.StatusUnauthorized)
+				return
+			}
+
+			switch string(ctx.Path()) {
+			case "/v1/specs":
+				switch {
+				case ctx.IsGet():
+					if err := adminData.Spec(ctx); err != nil {
+						adminData.Logger.Errorf("%s: spec: %s", logPrefix, err.Error())
+					}
+				case ctx.IsPost():
+					if err := adminData.UploadSpec(ctx); err != nil {
+						adminData.Logger.Errorf("%s: upload spec: %s", logPrefix, err.Error())
+					}
+				default:
+					ctx.Error("Method not allowed", fasthttp.StatusMethodNotAllowed)
+				}
+			case "/v1/config":
+				if err := adminData.EffectiveConfig(ctx); err != nil {
+					adminData.Logger.Errorf("%s: config: %s", logPrefix, err.Error())
+				}
+			case "/v1/pii":
+				if err := adminData.PIIReport(ctx); err != nil {
+					adminData.Logger.Errorf("%s: pii report: %s", logPrefix, err.Error())
+				}
+			case "/v1/classification":
+				if err := adminData.DataClassification(ctx); err != nil {
+					adminData.Logger.Errorf("%s: data classification: %s", logPrefix, err.Error())
+				}
+			case "/v1/specs/diff":
+				if err := adminData.SpecDiff(ctx); err != nil {
+					adminData.Logger.Errorf("%s: spec diff: %s", logPrefix, err.Error())
+				}
+			case "/v1/pool":
+				switch {
+				case ctx.IsGet():
+					if err := adminData.PoolStats(ctx); err != nil {
+						adminData.Logger.Errorf("%s: pool stats: %s", logPrefix, err.Error())
+					}
+				case ctx.IsPut():
+					if err := adminData.ResizePool(ctx); err != nil {
+						adminData.Logger.Errorf("%s: resize pool: %s", logPrefix, err.Error())
+					}
+				default:
+					ctx.Error("Method not allowed", fasthttp.StatusMethodNotAllowed)
+				}
+			case "/v1/validation":
+				switch {
+				case ctx.IsGet():
+					if err := adminData.ValidationModes(ctx); err != nil {
+						adminData.Logger.Errorf("%s: validation modes: %s", logPrefix, err.Error())
+					}
+				case ctx.IsPut():
+					if err := adminData.SetValidationMode(ctx); err != nil {
+						adminData.Logger.Errorf("%s: set validation mode: %s", logPrefix, err.Error())
+					}
+				default:
+					ctx.Error("Method not allowed", fasthttp.StatusMethodNotAllowed)
+				}
+			case "/v1/bans":
+				switch {
+				case ctx.IsGet():
+					if err := adminData.Bans(ctx); err != nil {
+						adminData.Logger.Errorf("%s: bans: %s", logPrefix, err.Error())
+					}
+				case ctx.IsDelete():
+					if err := adminData.LiftBan(ctx); err != nil {
+						adminData.Logger.Errorf("%s: lift ban: %s", logPrefix, err.Error())
+					}
+				default:
+					ctx.Error("Method not allowed", fasthttp.StatusMethodNotAllowed)
+				}
+			case "/v1/learning":
+				switch {
+				case ctx.IsGet():
+					if err := adminData.SchemaSuggestions(ctx); err != nil {
+						adminData.Logger.Errorf("%s: schema suggestions: %s", logPrefix, err.Error())
+					}
+				case ctx.IsDelete():
+					if err := adminData.ResetSchemaSuggestions(ctx); err != nil {
+						adminData.Logger.Errorf("%s: reset schema suggestions: %s", logPrefix, err.Error())
+					}
+				default:
+					ctx.Error("Method not allowed", fasthttp.StatusMethodNotAllowed)
+				}
+			case "/v1/denied":
+				switch {
+				case ctx.IsGet():
+					if err := adminData.DeniedRequests(ctx); err != nil {
+						adminData.Logger.Errorf("%s: denied requests: %s", logPrefix, err.Error())
+					}
+				case ctx.IsDelete():
+					if err := adminData.RemoveDeniedRequests(ctx); err != nil {
+						adminData.Logger.Errorf("%s: remove denied requests: %s", logPrefix, err.Error())
+					}
+				default:
+					ctx.Error("Method not allowed", fasthttp.StatusMethodNotAllowed)
+				}
+			case "/v1/denied/replay":
+				if !ctx.IsPost() {
+					ctx.Error("Method not allowed", fasthttp.StatusMethodNotAllowed)
+					break
+				}
+				if err := adminData.ReplayDeniedRequests(ctx); err != nil {
+					adminData.Logger.Errorf("%s: replay denied requests: %s", logPrefix, err.Error())
+				}
+			case "/v1/maintenance":
+				switch {
+				case ctx.IsGet():
+					if err := adminData.MaintenanceStatus(ctx); err != nil {
+						adminData.Logger.Errorf("%s: maintenance status: %s", logPrefix, err.Error())
+					}
+				case ctx.IsPut():
+					if err := adminData.SetMaintenance(ctx); err != nil {
+						adminData.Logger.Errorf("%s: set maintenance: %s", logPrefix, err.Error())
+					}
+				default:
+					ctx.Error("Method not allowed", fasthttp.StatusMethodNotAllowed)
+				}
+			default:
+				ctx.Error("Unsupported path", fasthttp.StatusNotFound)
+			}
+		}
+
+		adminApi := fasthttp.Server{
+			Handler:               adminHandler,
+			ReadTimeout:           cfg.ReadTimeout,
+			WriteTimeout:          cfg.WriteTimeout,
+			Logger:                logger,
+			NoDefaultServerHeader: true,
+		}
+
+		// Start the service listening for requests.
+		go func() {
+			if ln := activatedListener(listeners, "admin"); ln != nil {
+				logger.Infof("%s: Admin API listening on systemd socket %s", logPrefix, ln.Addr())
+				serverErrors <- adminApi.Serve(ln)
+				return
+			}
+
+			logger.Infof("%s: Admin API listening on %s", logPrefix, cfg.AdminAPIHost)
+			serverErrors <- adminApi.ListenAndServe(cfg.AdminAPIHost)
+		}()
+	}
+
+	// =========================================================================
+	// Reload API Spec
+
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+
+	go func() {
+		for range reload {
+			logger.Infof("%s: Reloading API Spec from %s", logPrefix, cfg.APISpecs)
+
+			notifySystemd(logger, systemd.StateReloading)
+
+			swagRouter, err := loadSwagger(cfg.APISpecs, &cfg, logger)
+			if err != nil {
+				logger.Errorf("%s: reloading API Spec: %s", logPrefix, err.Error())
+				notifySystemd(logger, systemd.StateReady)
+				continue
+			}
+
+			// the previous API Spec is enforced if the handler of the new one can't be built
+			if _, err := specs.Load(swagRouter); err != nil {
+				logger.Errorf("%s: reloading API Spec: %s", logPrefix, err.Error())
+			}
+			notifySystemd(logger, systemd.StateReady)
+		}
+	}()
+
+	// Poll the blob storage for the API Spec changes
+	if blobSpecs != nil {
+		go func() {
+			ticker := time.NewTicker(cfg.APISpecsBlob.PollInterval)
+			defer ticker.Stop()
+
+			for range ticker.C {
+				changed, err := blobSpecs.Fetch()
+				if err != nil {
+					logger.Errorf("%s: fetching API Spec from blob storage: %s", logPrefix, err.Error())
+					continue
+				}
+				if !changed {
+					continue
+				}
+
+				swagRouter, err := loadSwaggerData(blobSpecs.Data(), cfg.APISpecs, &cfg)
+				if err != nil {
+					logger.Errorf("%s: reloading API Spec: %s", logPrefix, err.Error())
+					continue
+				}
+
+				if _, err := specs.Load(swagRouter); err != nil {
+					logger.Errorf("%s: reloading API Spec: %s", logPrefix, err.Error())
+					continue
+				}
+
+				logger.Infof("%s: API Spec reloaded from blob storage (sha256 %s)", logPrefix, blobSpecs.Checksum())
+			}
+		}()
+	}
+
+	// Poll the Git repository for the API Spec changes
+	if gitSpecs != nil && cfg.APISpecsGit.PollInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(cfg.APISpecsGit.PollInterval)
+			defer ticker.Stop()
+
+			for range ticker.C {
+				changed, err := gitSpecs.Fetch(context.Background())
+				if err != nil {
+					logger.Errorf("%s: fetching API Spec from git: %s", logPrefix, err.Error())
+					continue
+				}
+				if !changed {
+					continue
+				}
+
+				swagRouter, err := loadSwagger(cfg.APISpecs, &cfg, logger)
+				if err != nil {
+					logger.Errorf("%s: reloading API Spec: %s", logPrefix, err.Error())
+					continue
+				}
+
+				if _, err := specs.Load(swagRouter); err != nil {
+					logger.Errorf("%s: reloading API Spec: %s", logPrefix, err.Error())
+				}
+			}
+		}()
+	}
+
+	// Watch the key-value store for the API Spec and the settings shared by the APIFW instances
+	if cfg.ConfigWatch.Provider != "" {
+		watcher := configWatcher{
+			cfg:         &cfg,
+			kv:          loader.NewKV(&cfg.ConfigWatch, logger),
+			logger:      logger,
+			specs:       specs,
+			maintenance: maintenanceMode,
+			modes:       validationModes,
+		}
+
+		logger.Infof("%s: Watching %s%s (%s)", logPrefix, cfg.ConfigWatch.Address, cfg.ConfigWatch.Prefix, cfg.ConfigWatch.Provider)
+		go watcher.run()
+	}
+
+	// =========================================================================
+	// Notify systemd
+
+	notifySystemd(logger, systemd.StateReady)
+
+	watchdogInterval, err := systemd.WatchdogInterval()
+	if err != nil {
+		logger.Errorf("%s: systemd watchdog: %s", logPrefix, err.Error())
+	}
+	if watchdogInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(watchdogInterval)
+			defer ticker.Stop()
+
+			for range ticker.C {
+				notifySystemd(logger, systemd.StateWatchdog)
+			}
+		}()
+	}
+
 	// =========================================================================
 	// Shutdown
 
@@ -317,6 +942,7 @@ func run(logger *logrus.Logger) error {
 
 	case sig := <-shutdown:
 		logger.Infof("%s: %v: Start shutdown", logPrefix, sig)
+		notifySystemd(logger, systemd.StateStopping)
 
 		// Asking listener to shutdown and shed load.
 		if err := api.Shutdown(); err != nil {
@@ -330,3 +956,330 @@ func run(logger *logrus.Logger) error {
 
 	return nil
 }
+
+// newAPIServer returns the server of the API listener configured by the HTTPServer settings
+func newAPIServer(cfg *config.APIFWConfiguration, handler fasthttp.RequestHandler, logger *logrus.Logger) *fasthttp.Server {
+
+	api := &fasthttp.Server{
+		Handler:               handler,
+		ReadTimeout:           cfg.ReadTimeout,
+		WriteTimeout:          cfg.WriteTimeout,
+		IdleTimeout:           cfg.HTTPServer.IdleTimeout,
+		ReadBufferSize:        cfg.HTTPServer.ReadBufferSize,
+		WriteBufferSize:       cfg.HTTPServer.WriteBufferSize,
+		MaxRequestBodySize:    cfg.HTTPServer.MaxRequestBodySize,
+		Concurrency:           cfg.HTTPServer.Concurrency,
+		MaxConnsPerIP:         cfg.HTTPServer.MaxConnsPerIP,
+		MaxRequestsPerConn:    cfg.HTTPServer.MaxRequestsPerConn,
+		TCPKeepalive:          cfg.HTTPServer.TCPKeepalive,
+		TCPKeepalivePeriod:    cfg.HTTPServer.TCPKeepalivePeriod,
+		Logger:                logger,
+		NoDefaultServerHeader: true,
+	}
+
+	// the headers of the request are read by the header read timeout, then the body is read by the read timeout
+	// shortened by the minimum transfer rate. The idle keep-alive connections are still closed by the read timeout
+	if cfg.HTTPServer.HeaderReadTimeout > 0 || cfg.HTTPServer.MinTransferRate > 0 {
+		if cfg.HTTPServer.HeaderReadTimeout > 0 {
+			if api.IdleTimeout == 0 {
+				api.IdleTimeout = cfg.ReadTimeout
+			}
+			api.ReadTimeout = cfg.HTTPServer.HeaderReadTimeout
+		}
+		api.HeaderReceived = func(header *fasthttp.RequestHeader) fasthttp.RequestConfig {
+			return fasthttp.RequestConfig{
+				ReadTimeout: web.BodyReadTimeout(header.ContentLength(), cfg.ReadTimeout, cfg.HTTPServer.MinTransferRate, cfg.HTTPServer.MinTransferRateGrace),
+			}
+		}
+	}
+
+	return api
+}
+
+// validateConfig validates the configuration values
+func validateConfig(cfg *config.APIFWConfiguration) error {
+	validate := validator.New()
+
+	if err := validate.RegisterValidation("HttpStatusCodes", config.ValidateStatusList); err != nil {
+		return errors.Errorf("configuration validation error: %s", err.Error())
+	}
+
+	if err := validate.Struct(cfg); err != nil {
+
+		for _, err := range err.(validator.ValidationErrors) {
+			switch err.Tag() {
+			case "gt":
+				return errors.Errorf("configuration validation error: parameter %s should be > %s. Actual value: %d", err.Field(), err.Param(), err.Value())
+			case "url":
+				return errors.Errorf("configuration validation error: parameter %s should be a string in URL format. Example: http://localhost:8080/; actual value: %s", err.Field(), err.Value())
+			case "oneof":
+				return errors.Errorf("configuration validation error: parameter %s should have one of the following value: %s; actual value: %s", err.Field(), err.Param(), err.Value())
+			}
+		}
+		return errors.Wrap(err, "configuration validation error")
+	}
+
+	// oauth introspection endpoint: validate format of configured content-type
+	if cfg.Server.Oauth.Introspection.ContentType != "" {
+		_, _, err := mime.ParseMediaType(cfg.Server.Oauth.Introspection.ContentType)
+		if err != nil {
+			return errors.Wrap(err, "configuration validation error")
+		}
+	}
+
+	if _, err := proxy.ParseRoutes(cfg.Server.Upstream.Routes); err != nil {
+		return errors.Wrap(err, "configuration validation error")
+	}
+
+	if _, err := handlers.ParseVersionSpecs(cfg.APIVersions.Specs); err != nil {
+		return errors.Wrap(err, "configuration validation error")
+	}
+
+	// the GraphQL operations are not protected if the persisted queries can't be loaded
+	if _, err := graphql.New(&cfg.GraphQL); err != nil {
+		return errors.Wrap(err, "configuration validation error")
+	}
+
+	// HTTP/2 is negotiated by ALPN, the cleartext HTTP/2 (h2c) is not supported by the proxy client
+	if cfg.Server.Upstream.Protocol == config.ProtocolHTTP2 && !strings.HasPrefix(strings.ToLower(cfg.Server.URL), "https://") {
+		return errors.New("configuration validation error: HTTP2 upstream protocol requires the https server URL")
+	}
+
+	// the SOAP operations are not validated if the WSDL can't be loaded
+	if _, err := soap.New(&cfg.SOAP, cfg.BodyDecoders.MaxDepth); err != nil {
+		return errors.Wrap(err, "configuration validation error")
+	}
+
+	// gRPC requires HTTP/2, the messages are validated by the protobuf descriptors
+	if cfg.GRPCWeb.Enabled {
+		if cfg.Server.Upstream.Protocol != config.ProtocolHTTP2 {
+			return errors.New("configuration validation error: gRPC-Web requires the HTTP2 upstream protocol")
+		}
+		if cfg.BodyDecoders.ProtobufDescriptors == "" {
+			return errors.New("configuration validation error: gRPC-Web requires the protobuf descriptors (BodyDecoders.ProtobufDescriptors)")
+		}
+	}
+
+	if cfg.ConfigWatch.Provider != "" && cfg.ConfigWatch.Address == "" {
+		return errors.Errorf("configuration validation error: parameter ConfigWatch.Address is required by the %s provider", cfg.ConfigWatch.Provider)
+	}
+
+	if cfg.Idempotency.Enabled {
+		if _, err := regexp.Compile(cfg.Idempotency.KeyPattern); err != nil {
+			return errors.Wrap(err, "configuration validation error: parameter Idempotency.KeyPattern")
+		}
+	}
+
+	if cfg.EventSink.Type != "" {
+		if cfg.EventSink.URL == "" {
+			return errors.New("configuration validation error: parameter EventSink.URL is required by the event sink")
+		}
+		if cfg.EventSink.FlushInterval <= 0 || cfg.EventSink.Timeout <= 0 {
+			return errors.New("configuration validation error: parameters EventSink.FlushInterval and EventSink.Timeout should be positive")
+		}
+	}
+
+	if cfg.Analyzer.URL != "" && (cfg.Analyzer.FlushInterval <= 0 || cfg.Analyzer.Timeout <= 0) {
+		return errors.New("configuration validation error: parameters Analyzer.FlushInterval and Analyzer.Timeout should be positive")
+	}
+
+	if len(cfg.Passthrough.Routes) > 0 {
+		if cfg.Passthrough.HelloTimeout <= 0 || cfg.Passthrough.DialTimeout <= 0 {
+			return errors.New("configuration validation error: parameters Passthrough.HelloTimeout and Passthrough.DialTimeout should be positive")
+		}
+		if _, err := passthrough.ParseRoutes(cfg.Passthrough.Routes); err != nil {
+			return errors.Wrap(err, "configuration validation error")
+		}
+	}
+
+	if cfg.Coalescing.Enabled && cfg.Coalescing.MaxWait <= 0 {
+		return errors.New("configuration validation error: parameter Coalescing.MaxWait should be positive")
+	}
+
+	if cfg.Server.Concurrency.Enabled {
+		c := cfg.Server.Concurrency
+		if c.MinLimit <= 0 || c.MinLimit > c.MaxLimit || c.InitialLimit < c.MinLimit || c.InitialLimit > c.MaxLimit {
+			return errors.New("configuration validation error: parameter Server.Concurrency.InitialLimit should be between MinLimit and MaxLimit and MinLimit should be positive")
+		}
+	}
+
+	if cfg.UpstreamSLO.Threshold > 0 && cfg.UpstreamSLO.Window <= 0 {
+		return errors.New("configuration validation error: parameter UpstreamSLO.Window should be positive")
+	}
+
+	if cfg.ResponseDiff.Enabled {
+		if _, err := url.ParseRequestURI(cfg.ResponseDiff.URL); err != nil {
+			return errors.Wrap(err, "configuration validation error: parameter ResponseDiff.URL")
+		}
+	}
+
+	for _, feed := range cfg.ThreatIntel.Feeds {
+		if _, err := denylist.ParseFeed(feed, cfg.ThreatIntel.TTL); err != nil {
+			return errors.Wrap(err, "configuration validation error")
+		}
+	}
+
+	if cfg.Consumers.ProfilesFile != "" {
+		data, err := os.ReadFile(cfg.Consumers.ProfilesFile)
+		if err != nil {
+			return errors.Wrap(err, "configuration validation error: parameter Consumers.ProfilesFile")
+		}
+		if _, err := consumers.Load(data); err != nil {
+			return errors.Wrap(err, "configuration validation error")
+		}
+	}
+
+	if _, err := scoring.New(&cfg.Scoring); err != nil {
+		return errors.Wrap(err, "configuration validation error")
+	}
+
+	if _, err := access.ParsePolicies(cfg.AccessControl.TagPolicies); err != nil {
+		return errors.Wrap(err, "configuration validation error")
+	}
+
+	if cfg.PIIDetection.Enabled {
+		if _, err := pii.New(&cfg.PIIDetection); err != nil {
+			return errors.Wrap(err, "configuration validation error")
+		}
+	}
+
+	// the redis state backend shares rate limits between the APIFW instances
+	if cfg.StateBackend == state.BackendRedis && cfg.Redis.Addr == "" {
+		return errors.Errorf("configuration validation error: parameter Redis.Addr is required by the %s state backend", state.BackendRedis)
+	}
+
+	// the revoked tokens are accepted if the revoked JWT IDs can't be loaded
+	if strings.EqualFold(cfg.Server.Oauth.ValidationType, "jwt") {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := denylist.CheckRevokedJTI(ctx, cfg)
+		cancel()
+		if err != nil {
+			return errors.Wrap(err, "configuration validation error")
+		}
+	}
+
+	// the tokens are validated by the keys of the OpenID provider
+	if cfg.Server.Oauth.OIDC.Issuer != "" {
+		if _, err := woauth2.NewOIDC(&cfg.Server.Oauth, logrus.New()); err != nil {
+			return errors.Wrap(err, "configuration validation error: discovering OpenID provider configuration")
+		}
+	}
+
+	// the client certificates are requested by the TLS handshake, so they can't be verified on the plain HTTP listener
+	if cfg.TLS.ClientAuth != web.ClientAuthNone {
+		if apiHost, err := url.ParseRequestURI(cfg.APIHost); err == nil && apiHost.Scheme != "https" {
+			return errors.Errorf("configuration validation error: parameter TLS.ClientAuth %s requires the https API host. Actual value: %s", cfg.TLS.ClientAuth, cfg.APIHost)
+		}
+	}
+
+	// all credentials are rejected if the users can't be loaded
+	if cfg.BasicAuth.HtpasswdFile != "" {
+		if _, err := basicauth.NewHtpasswd(cfg.BasicAuth.HtpasswdFile, logrus.New()); err != nil {
+			return errors.Wrap(err, "configuration validation error: parameter BasicAuth.HtpasswdFile")
+		}
+	}
+
+	// the admin API changes the validation modes and the API Specs, so it's served without the token on the loopback address only
+	if cfg.AdminAPIHost != "" && cfg.AdminAPIToken == "" && !loopbackAddress(cfg.AdminAPIHost) {
+		return errors.New("configuration validation error: parameter AdminAPIToken is required by the admin API listening on the non-loopback address")
+	}
+
+	return nil
+}
+
+// loopbackAddress returns true if the host of the listening address is the loopback address
+func loopbackAddress(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// activatedListener returns the systemd socket with the name. The single unnamed socket is used by the API
+func activatedListener(listeners map[string]net.Listener, name string) net.Listener {
+	if ln, ok := listeners[name]; ok {
+		return ln
+	}
+
+	if name == "api" && len(listeners) == 1 {
+		return listeners["0"]
+	}
+
+	return nil
+}
+
+// notifySystemd sends the state to systemd if APIFW is started by systemd with Type=notify
+func notifySystemd(logger *logrus.Logger, state string) {
+	sent, err := systemd.Notify(state)
+	if err != nil {
+		logger.Errorf("%s: systemd notify %s: %s", logPrefix, state, err.Error())
+		return
+	}
+	if sent {
+		logger.Debugf("%s: systemd notified: %s", logPrefix, state)
+	}
+}
+
+// loadSwagger loads the API Spec from the file, URL or blob storage and builds the router
+func loadSwagger(apiSpecs string, cfg *config.APIFWConfiguration, logger *logrus.Logger) (*router.Router, error) {
+
+	var swagger *openapi3.T
+
+	apiSpecUrl, err := url.ParseRequestURI(apiSpecs)
+	if err != nil {
+		logger.Debugf("%s: Trying to parse API Spec value as URL : %v\n", logPrefix, err.Error())
+	}
+
+	switch {
+	case apiSpecUrl == nil:
+		swagger, err = loader.NewOpenAPILoader(apiSpecs, cfg.APISpecsAllowRemoteRefs).LoadFromFile(apiSpecs)
+		if err != nil {
+			return nil, errors.Wrap(err, "loading swagwaf file")
+		}
+	case loader.IsBlobURL(apiSpecUrl):
+		data, err := loader.LoadBlob(&cfg.APISpecsBlob, apiSpecUrl)
+		if err != nil {
+			return nil, errors.Wrap(err, "loading swagwaf from blob storage")
+		}
+		return loadSwaggerData(data, apiSpecs, cfg)
+	default:
+		swagger, err = loader.NewOpenAPILoader(apiSpecs, cfg.APISpecsAllowRemoteRefs).LoadFromURI(apiSpecUrl)
+		if err != nil {
+			return nil, errors.Wrap(err, "loading swagwaf url")
+		}
+	}
+
+	return newSwaggerRouter(swagger)
+}
+
+// loadSwaggerData loads the API Spec from the content of the API Spec file and builds the router. The refs
+// are resolved relative to the location of the API Spec
+func loadSwaggerData(data []byte, apiSpecs string, cfg *config.APIFWConfiguration) (*router.Router, error) {
+
+	swagger, err := loader.NewOpenAPILoader(apiSpecs, cfg.APISpecsAllowRemoteRefs).LoadFromData(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "loading swagwaf data")
+	}
+
+	return newSwaggerRouter(swagger)
+}
+
+func newSwaggerRouter(swagger *openapi3.T) (*router.Router, error) {
+
+	// bundle the referenced files into the single API Spec
+	swagger.InternalizeRefs(context.Background(), nil)
+
+	swagRouter, err := router.NewRouter(swagger)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing swagwaf file")
+	}
+
+	return swagRouter, nil
+}
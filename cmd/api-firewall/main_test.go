@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/config"
+	"github.com/wallarm/api-firewall/internal/platform/web"
+)
+
+func TestAPIServerSettings(t *testing.T) {
+
+	cfg := testCheckConfig(t)
+	cfg.HTTPServer.ReadBufferSize = 8192
+	cfg.HTTPServer.WriteBufferSize = 16384
+	cfg.HTTPServer.MaxRequestBodySize = 1024
+	cfg.HTTPServer.Concurrency = 100
+	cfg.HTTPServer.IdleTimeout = time.Minute
+	cfg.HTTPServer.MaxConnsPerIP = 10
+	cfg.HTTPServer.MaxRequestsPerConn = 1000
+	cfg.HTTPServer.TCPKeepalive = true
+	cfg.HTTPServer.TCPKeepalivePeriod = 30 * time.Second
+
+	if err := validateConfig(cfg); err != nil {
+		t.Fatalf("Unexpected validation error: %s", err)
+	}
+
+	api := newAPIServer(cfg, func(ctx *fasthttp.RequestCtx) {}, logrus.New())
+
+	if api.ReadBufferSize != 8192 || api.WriteBufferSize != 16384 || api.MaxRequestBodySize != 1024 ||
+		api.Concurrency != 100 || api.IdleTimeout != time.Minute || api.MaxConnsPerIP != 10 ||
+		api.MaxRequestsPerConn != 1000 || !api.TCPKeepalive || api.TCPKeepalivePeriod != 30*time.Second {
+		t.Errorf("Incorrect API server settings: %+v", api)
+	}
+
+	// the header read timeout replaces the read timeout and the idle connections are closed by the read timeout
+	cfg.HTTPServer.IdleTimeout = 0
+	cfg.HTTPServer.HeaderReadTimeout = 2 * time.Second
+
+	api = newAPIServer(cfg, func(ctx *fasthttp.RequestCtx) {}, logrus.New())
+
+	if api.ReadTimeout != 2*time.Second || api.IdleTimeout != cfg.ReadTimeout || api.HeaderReceived == nil {
+		t.Errorf("Incorrect API server timeouts. Expected: read timeout 2s and idle timeout %s and got %s and %s",
+			cfg.ReadTimeout, api.ReadTimeout, api.IdleTimeout)
+	}
+}
+
+func TestValidateConfigHTTPServer(t *testing.T) {
+
+	testCases := []func(cfg *config.APIFWConfiguration){
+		func(cfg *config.APIFWConfiguration) { cfg.HTTPServer.ReadBufferSize = -1 },
+		func(cfg *config.APIFWConfiguration) { cfg.HTTPServer.MaxRequestBodySize = -1 },
+		func(cfg *config.APIFWConfiguration) { cfg.HTTPServer.Concurrency = -1 },
+		func(cfg *config.APIFWConfiguration) { cfg.HTTPServer.IdleTimeout = -time.Second },
+		func(cfg *config.APIFWConfiguration) { cfg.HTTPServer.HeaderReadTimeout = -time.Second },
+	}
+
+	for i, setup := range testCases {
+		cfg := testCheckConfig(t)
+		setup(cfg)
+
+		if err := validateConfig(cfg); err == nil {
+			t.Errorf("Expected validation error of the negative HTTP server setting %d", i)
+		}
+	}
+}
+
+func TestValidateConfigClientAuth(t *testing.T) {
+
+	testCases := []struct {
+		apiHost    string
+		clientAuth string
+		valid      bool
+	}{
+		{"http://127.0.0.1:8282", web.ClientAuthNone, true},
+		{"http://127.0.0.1:8282", web.ClientAuthOptional, false},
+		{"http://127.0.0.1:8282", web.ClientAuthRequire, false},
+		{"https://127.0.0.1:8282", web.ClientAuthOptional, true},
+		{"https://127.0.0.1:8282", web.ClientAuthRequire, true},
+	}
+
+	for i, tc := range testCases {
+		cfg := testCheckConfig(t)
+		cfg.APIHost = tc.apiHost
+		cfg.TLS.ClientAuth = tc.clientAuth
+
+		if err := validateConfig(cfg); (err == nil) != tc.valid {
+			t.Errorf("Incorrect validation result of the client authentication %d. Expected valid: %t and got error: %v", i, tc.valid, err)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wallarm/api-firewall/internal/config"
+	"github.com/wallarm/api-firewall/internal/platform/modes"
+	"github.com/wallarm/api-firewall/internal/platform/ratelimit"
+)
+
+// scheduledPolicy merges the active windows into the validation modes and the rate limit scale. The modes
+// of the later windows override the modes of the earlier windows and the smallest rate limit scale is used
+func scheduledPolicy(active []*config.ScheduleWindow) (modes.Status, float64) {
+
+	status := modes.Status{Operations: make(map[string]modes.Mode)}
+	var rateLimitScale float64
+
+	merge := func(mode modes.Mode, w *config.ScheduleWindow) modes.Mode {
+		if w.RequestValidation != "" {
+			mode.Request = w.RequestValidation
+		}
+		if w.ResponseValidation != "" {
+			mode.Response = w.ResponseValidation
+		}
+		return mode
+	}
+
+	for _, w := range active {
+		if len(w.Operations) == 0 {
+			status.Global = merge(status.Global, w)
+		}
+		for _, operation := range w.Operations {
+			status.Operations[operation] = merge(status.Operations[operation], w)
+		}
+
+		if w.RateLimitScale > 0 && (rateLimitScale == 0 || w.RateLimitScale < rateLimitScale) {
+			rateLimitScale = w.RateLimitScale
+		}
+	}
+
+	return status, rateLimitScale
+}
+
+// applySchedule applies the policy of the active windows
+func applySchedule(active []*config.ScheduleWindow, validationModes *modes.Overrides, logger *logrus.Logger) {
+
+	status, rateLimitScale := scheduledPolicy(active)
+
+	validationModes.Schedule(status)
+	ratelimit.SetScale(rateLimitScale)
+
+	names := make([]string, 0, len(active))
+	for _, w := range active {
+		names = append(names, w.Name)
+	}
+
+	logger.WithFields(logrus.Fields{
+		"windows":          strings.Join(names, ","),
+		"rate_limit_scale": rateLimitScale,
+	}).Infof("%s: scheduled windows changed", logPrefix)
+}
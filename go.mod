@@ -6,8 +6,12 @@ require (
 	github.com/ardanlabs/conf v1.5.0
 	github.com/dgraph-io/ristretto v0.1.0
 	github.com/fasthttp/router v1.4.12
+	github.com/fxamacker/cbor/v2 v2.4.0
 	github.com/getkin/kin-openapi v0.100.0
+	github.com/go-asn1-ber/asn1-ber v1.5.1
+	github.com/go-ldap/ldap/v3 v3.4.1
 	github.com/go-playground/validator v9.31.0+incompatible
+	github.com/go-redis/redis/v8 v8.11.5
 	github.com/golang-jwt/jwt v3.2.2+incompatible
 	github.com/golang/mock v1.6.0
 	github.com/karlseguin/ccache/v2 v2.0.8
@@ -16,12 +20,18 @@ require (
 	github.com/sirupsen/logrus v1.9.0
 	github.com/valyala/fasthttp v1.40.0
 	github.com/valyala/fastjson v1.6.3
+	github.com/vmihailenco/msgpack/v5 v5.3.5
+	golang.org/x/crypto v0.0.0-20220214200702-86341886e292
 	golang.org/x/exp v0.0.0-20220909182711-5c715a9e8561
+	golang.org/x/time v0.3.0
+	google.golang.org/protobuf v1.28.1
 )
 
 require (
+	github.com/Azure/go-ntlmssp v0.0.0-20200615164410-66371956d46c // indirect
 	github.com/andybalholm/brotli v1.0.4 // indirect
 	github.com/cespare/xxhash/v2 v2.1.2 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
 	github.com/dustin/go-humanize v1.0.0 // indirect
 	github.com/go-openapi/jsonpointer v0.19.5 // indirect
 	github.com/go-openapi/swag v0.22.3 // indirect
@@ -32,6 +42,8 @@ require (
 	github.com/klauspost/compress v1.15.9 // indirect
 	github.com/mailru/easyjson v0.7.7 // indirect
 	github.com/valyala/bytebufferpool v1.0.0 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
 	golang.org/x/sys v0.0.0-20220909162455-aba9fc2a8ff2 // indirect
 )
 
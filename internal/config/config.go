@@ -7,9 +7,34 @@ import (
 )
 
 type TLS struct {
-	CertsPath string `conf:"default:certs"`
-	CertFile  string `conf:"default:localhost.crt"`
-	CertKey   string `conf:"default:localhost.key"`
+	CertsPath          string   `conf:"default:certs"`
+	CertFile           string   `conf:"default:localhost.crt"`
+	CertKey            string   `conf:"default:localhost.key"`
+	ClientAuth         string   `conf:"default:NONE" validate:"oneof=NONE OPTIONAL REQUIRE"`
+	ClientCA           string   `conf:""`
+	AllowedClientNames []string `conf:""`
+	ClientCertHeader   string   `conf:"default:X-Client-Cert-Subject"`
+	Revocation         Revocation
+	Fingerprint        TLSFingerprint
+}
+
+// TLSFingerprint computes the JA3 and JA4 fingerprints of the TLS client hello of the API connections.
+// The requests of the fingerprints in Deny (the JA3 hashes or the JA4 fingerprints) are blocked.
+// The fingerprints are passed to the upstream in JA3Header and JA4Header if they are set
+type TLSFingerprint struct {
+	Enabled   bool     `conf:"default:false"`
+	Deny      []string `conf:""`
+	JA3Header string   `conf:"default:X-JA3-Fingerprint"`
+	JA4Header string   `conf:"default:X-JA4-Fingerprint"`
+}
+
+type Revocation struct {
+	OCSP              bool          `conf:"default:false"`
+	OCSPTimeout       time.Duration `conf:"default:5s"`
+	CacheTTL          time.Duration `conf:"default:1h"`
+	CRLFiles          []string      `conf:""`
+	CRLReloadInterval time.Duration `conf:"default:1h"`
+	FailurePolicy     string        `conf:"default:FAIL_CLOSED" validate:"oneof=FAIL_OPEN FAIL_CLOSED"`
 }
 
 type Server struct {
@@ -21,13 +46,100 @@ type Server struct {
 	ReadTimeout        time.Duration `conf:"default:5s"`
 	WriteTimeout       time.Duration `conf:"default:5s"`
 	DialTimeout        time.Duration `conf:"default:200ms"`
+	Upstream           Upstream
+	Concurrency        AdaptiveConcurrency
+	BackendAuth        BackendAuth
 	Oauth              Oauth
 }
 
+const (
+	ConcurrencyGradient = "GRADIENT"
+	ConcurrencyAIMD     = "AIMD"
+)
+
+// AdaptiveConcurrency limits the number of the concurrent requests to the upstream by the limit adjusted by
+// the upstream latency, the requests exceeding the limit are responded by 503 status code. The GRADIENT algorithm
+// compares the latency with the long-term latency, the AIMD algorithm increases the limit by one while the latency
+// is under LatencyThreshold and decreases the limit by BackoffRatio otherwise. The upstream errors decrease the limit
+type AdaptiveConcurrency struct {
+	Enabled          bool          `conf:"default:false"`
+	Algorithm        string        `conf:"default:GRADIENT" validate:"oneof=GRADIENT AIMD"`
+	InitialLimit     int           `conf:"default:20"`
+	MinLimit         int           `conf:"default:1"`
+	MaxLimit         int           `conf:"default:1000"`
+	LatencyThreshold time.Duration `conf:"default:1s"`
+	BackoffRatio     float64       `conf:"default:0.9" validate:"gt=0,lt=1"`
+}
+
+// BackendAuth holds the credentials of the firewall toward the upstream. The token and the password are set
+// by the values or read from the files. The files and the client certificate are reloaded after the refresh
+// interval if they have been changed
+type BackendAuth struct {
+	Type            string        `conf:"default:NONE" validate:"oneof=NONE BEARER BASIC"`
+	Header          string        `conf:"default:Authorization"`
+	Token           string        `conf:"mask"`
+	TokenFile       string        `conf:""`
+	Username        string        `conf:""`
+	Password        string        `conf:"mask"`
+	PasswordFile    string        `conf:""`
+	ClientCert      string        `conf:""`
+	ClientKey       string        `conf:""`
+	RefreshInterval time.Duration `conf:"default:1m"`
+}
+
+const (
+	ProtocolHTTP1 = "HTTP1"
+	ProtocolHTTP2 = "HTTP2"
+)
+
+// Upstream holds the settings of the connections to the protected API. MaxConns limits
+// the number of the open connections of all clients of the pool, zero means no limit.
+// TLSSessionCacheSize is the number of the TLS sessions kept for resumption, zero disables the resumption.
+// HTTP2 protocol negotiates HTTP/2 with the upstream by ALPN and falls back to HTTP/1.1.
+// Routes select the upstream clusters by the path prefix ("/v1/payments https://payments:8443")
+// or by the tag ("tag=payments https://payments:8443") of the operations, the first matching route is used
+type Upstream struct {
+	Routes              []string      `conf:""`
+	Protocol            string        `conf:"default:HTTP1" validate:"oneof=HTTP1 HTTP2"`
+	DisableKeepAlive    bool          `conf:"default:false"`
+	MaxConns            int           `conf:"default:0"`
+	IdleConnTimeout     time.Duration `conf:"default:10s"`
+	MaxConnDuration     time.Duration `conf:"default:0s"`
+	TLSSessionCacheSize int           `conf:"default:0"`
+}
+
+// HTTPServer holds the settings of the API listener. HeaderReadTimeout limits the time of reading the request
+// headers, the body is read by ReadTimeout then. MinTransferRate (bytes per second) disconnects the clients
+// sending the request bodies or reading the responses slower than the rate after the MinTransferRateGrace period.
+// MaxConnsPerIP limits the number of the concurrent connections of the client IP address
+type HTTPServer struct {
+	ReadBufferSize       int           `conf:"default:4096" validate:"gte=0"`
+	WriteBufferSize      int           `conf:"default:4096" validate:"gte=0"`
+	MaxRequestBodySize   int           `conf:"default:4194304" validate:"gte=0"`
+	Concurrency          int           `conf:"default:262144" validate:"gte=0"`
+	IdleTimeout          time.Duration `conf:"default:0s" validate:"gte=0"`
+	MaxConnsPerIP        int           `conf:"default:0" validate:"gte=0"`
+	MaxRequestsPerConn   int           `conf:"default:0" validate:"gte=0"`
+	TCPKeepalive         bool          `conf:"default:false"`
+	TCPKeepalivePeriod   time.Duration `conf:"default:0s" validate:"gte=0"`
+	HeaderReadTimeout    time.Duration `conf:"default:0s" validate:"gte=0"`
+	MinTransferRate      int           `conf:"default:0" validate:"gte=0"`
+	MinTransferRateGrace time.Duration `conf:"default:1s" validate:"gte=0"`
+}
+
+// Passthrough routes the TLS connections of the API listener by the server name (SNI). The connections of the
+// server names of Routes (server_name=host:port, *.example.com matches the subdomains) are passed to the upstreams
+// without the TLS termination and the validation. The other connections are served by APIFW
+type Passthrough struct {
+	Routes       []string      `conf:""`
+	HelloTimeout time.Duration `conf:"default:5s"`
+	DialTimeout  time.Duration `conf:"default:5s"`
+}
+
 type JWT struct {
 	SignatureAlgorithm string `conf:"default:RS256"`
 	PubCertFile        string `conf:""`
-	SecretKey          string `conf:""`
+	SecretKey          string `conf:"mask"`
 }
 
 type Token struct {
@@ -35,14 +147,50 @@ type Token struct {
 	HeaderName       string `conf:""`
 	TrimBearerPrefix bool   `conf:"default:true"`
 	File             string `conf:""`
+	RedisKey         string `conf:""`
+}
+
+type JTI struct {
+	File            string        `conf:""`
+	RedisKey        string        `conf:""`
+	RefreshInterval time.Duration `conf:"default:1m"`
 }
 
+// Denylist denies the Tokens and the JTI of the tokens. If the shared state is not available, the requests
+// are checked by the local denylist (FAIL_OPEN) or blocked (FAIL_CLOSED) according to the FailurePolicy
 type Denylist struct {
-	Tokens Token
+	Tokens        Token
+	JTI           JTI
+	FailurePolicy string `conf:"default:FAIL_OPEN" validate:"oneof=FAIL_OPEN FAIL_CLOSED"`
+}
+
+type LDAP struct {
+	URL                string        `conf:""`
+	BindDN             string        `conf:""`
+	BindPassword       string        `conf:"mask"`
+	BaseDN             string        `conf:""`
+	UserFilter         string        `conf:"default:(sAMAccountName=%s)"`
+	GroupFilter        string        `conf:""`
+	StartTLS           bool          `conf:"default:false"`
+	InsecureConnection bool          `conf:"default:false"`
+	Timeout            time.Duration `conf:"default:5s"`
+	CacheTTL           time.Duration `conf:"default:5m"`
+}
+
+type BasicAuth struct {
+	HtpasswdFile string `conf:""`
+	LDAP         LDAP
+}
+
+type Redis struct {
+	Addr      string `conf:""`
+	Password  string `conf:"mask"`
+	DB        int    `conf:"default:0"`
+	KeyPrefix string `conf:"default:apifw:"`
 }
 
 type Introspection struct {
-	ClientAuthBearerToken string        `conf:""`
+	ClientAuthBearerToken string        `conf:"mask"`
 	Endpoint              string        `conf:""`
 	EndpointParams        string        `conf:""`
 	TokenParamName        string        `conf:""`
@@ -51,32 +199,501 @@ type Introspection struct {
 	RefreshInterval       time.Duration `conf:"default:10m"`
 }
 
+// Roles contains the name of the token claim with the roles and the roles required by the operations.
+// The roles are checked only for the operations secured by the oauth2 or openIdConnect schemes
+type Roles struct {
+	ClaimName  string            `conf:"default:roles"`
+	Operations map[string]string `conf:""`
+}
+
+type OIDC struct {
+	Issuer          string        `conf:""`
+	RefreshInterval time.Duration `conf:"default:1h"`
+}
+
 type Oauth struct {
 	ValidationType string `conf:"default:JWT"`
 	JWT            JWT
 	Introspection  Introspection
+	Roles          Roles
+	OIDC           OIDC
+	ClaimsHeaders  map[string]string `conf:""`
+}
+
+// Schedule contains the location of the JSON file of the scheduled policy windows. The window is active
+// during Duration after each start matched by the cron expression in Timezone
+type Schedule struct {
+	File     string `conf:""`
+	Timezone string `conf:"default:UTC"`
+}
+
+// Experiment assigns Percentage of the clients to the treatment cohort validated by the alternative
+// validation modes. The cohort is sticky by the hash of the KeyHeader value or of the client IP address
+// if the KeyHeader is not set or the request has no such header. The verdicts are counted by cohort
+type Experiment struct {
+	Name               string `conf:"default:enforcement"`
+	Percentage         int    `conf:"default:0" validate:"min=0,max=100"`
+	KeyHeader          string `conf:""`
+	RequestValidation  string `conf:"" validate:"omitempty,oneof=DISABLE BLOCK LOG_ONLY"`
+	ResponseValidation string `conf:"" validate:"omitempty,oneof=DISABLE BLOCK LOG_ONLY"`
+}
+
+// Consumers contains the location of the consumer profiles JSON file. The consumers are identified
+// by the API key header, the subject claim of the validated token or the common name of the client certificate
+type Consumers struct {
+	ProfilesFile    string        `conf:""`
+	APIKeyHeader    string        `conf:"default:X-API-Key"`
+	SubjectClaim    string        `conf:"default:sub"`
+	RefreshInterval time.Duration `conf:"default:1m"`
+}
+
+// Scoring accumulates the weak signals of the request into the score. The request validation
+// error doesn't block the request in the BLOCK mode unless the score reaches the block threshold
+type Scoring struct {
+	Enabled                 bool          `conf:"default:false"`
+	SchemaWeight            int           `conf:"default:5"`
+	HeuristicWeight         int           `conf:"default:4"`
+	HeuristicPatterns       []string      `conf:""`
+	VelocityWeight          int           `conf:"default:3"`
+	VelocityLimit           int           `conf:"default:100"`
+	VelocityWindow          time.Duration `conf:"default:1m"`
+	HeaderConsistencyWeight int           `conf:"default:0"`
+	LogThreshold            int           `conf:"default:3"`
+	ChallengeThreshold      int           `conf:"default:6"`
+	ChallengeStatusCode     int           `conf:"default:429" validate:"HttpStatusCodes"`
+	BlockThreshold          int           `conf:"default:9"`
+	Challenge               Challenge
+}
+
+// Challenge redirects the challenged clients to the CAPTCHA or the JS challenge provider with the request URI
+// in the ReturnParam query parameter. The provider sets the clearance cookie signed by Secret to the clients
+// which passed the challenge, the clients with the valid cookie are not challenged until the cookie expires.
+// The cookie is bound to the client address if BindAddress is set
+type Challenge struct {
+	URL         string `conf:""`
+	ReturnParam string `conf:"default:return_to"`
+	CookieName  string `conf:"default:apifw_clearance"`
+	Secret      string `conf:"mask"`
+	BindAddress bool   `conf:"default:true"`
+}
+
+// DeniedRequests stores the requests blocked by the request validation, so they can be
+// validated again by the admin API after the API Spec is fixed
+type DeniedRequests struct {
+	Store         bool     `conf:"default:false"`
+	Capacity      int      `conf:"default:1000"`
+	MaxBodySize   int      `conf:"default:65536"`
+	RedactHeaders []string `conf:"default:Authorization;Cookie;Proxy-Authorization"`
+}
+
+// SchemaLearning collects the request body fields and the enum values which are not described
+// by the API Spec in the LOG_ONLY request validation mode
+type SchemaLearning struct {
+	Enabled        bool `conf:"default:false"`
+	MaxSuggestions int  `conf:"default:10000"`
+}
+
+// AccessControl contains the policies of the operations with the tags in the "TAG [scopes=SCOPE,...] [networks=CIDR,...]" format
+type AccessControl struct {
+	TagPolicies []string `conf:""`
 }
 
 type ShadowAPI struct {
 	ExcludeList []int `conf:"default:404,env:SHADOW_API_EXCLUDE_LIST" validate:"HttpStatusCodes"`
 }
 
+// Deprecation contains the link of the deprecation policy and the consumers counted separately by the usage
+// of the deprecated operations. The consumer is the value of the ConsumerHeader, the values not listed in
+// Consumers are counted as the other consumer, so the number of the counters is bounded
+type Deprecation struct {
+	Link           string   `conf:""`
+	ConsumerHeader string   `conf:""`
+	Consumers      []string `conf:""`
+}
+
+// GitSpecs checks out the API Spec at the Path of the Repository. The Ref is the branch, the tag or the full
+// commit SHA: the pinned commit is checked out once and is never updated by the polling. The commits are checked
+// by git verify-commit if VerifySignature is set: the GPG signatures by the keys of the GnuPG keyring and the SSH
+// signatures by the keys of the AllowedSignersFile
+type GitSpecs struct {
+	Repository         string        `conf:""`
+	Ref                string        `conf:"default:main"`
+	Path               string        `conf:"default:swagger.json"`
+	Dir                string        `conf:"default:/tmp/api-firewall/specs"`
+	Username           string        `conf:"default:x-access-token"`
+	Token              string        `conf:"mask"`
+	PollInterval       time.Duration `conf:"default:0s"`
+	VerifySignature    bool          `conf:"default:false"`
+	AllowedSignersFile string        `conf:""`
+}
+
+// BlobStorage downloads the API Spec from the object storage. The object is polled every PollInterval and the
+// API Spec is reloaded if the checksum of the object is changed. The zero PollInterval disables the polling
+type BlobStorage struct {
+	S3Region     string        `conf:"default:us-east-1"`
+	S3Endpoint   string        `conf:""`
+	Timeout      time.Duration `conf:"default:30s"`
+	PollInterval time.Duration `conf:"default:0s"`
+}
+
+type ConfigWatch struct {
+	Provider     string        `conf:"" validate:"omitempty,oneof=CONSUL ETCD"`
+	Address      string        `conf:""`
+	Prefix       string        `conf:"default:apifw/"`
+	Token        string        `conf:"mask"`
+	WaitTime     time.Duration `conf:"default:30s"`
+	PollInterval time.Duration `conf:"default:5s"`
+}
+
+type JSONLimits struct {
+	MaxDepth        int `conf:"default:64"`
+	MaxKeys         int `conf:"default:0"`
+	MaxArrayLength  int `conf:"default:0"`
+	MaxStringLength int `conf:"default:0"`
+
+	RejectDuplicateKeys bool `conf:"default:false"`
+	Prefilter           bool `conf:"default:false"`
+}
+
+type JSONNumbers struct {
+	BigIntegers         string `conf:"default:FLOAT" validate:"oneof=FLOAT STRING REJECT"`
+	RejectPrecisionLoss bool   `conf:"default:false"`
+}
+
+// ParallelValidation validates the request bodies of MinBodySize bytes or larger concurrently with the parameters
+// once the security requirements are met. At most Workers bodies are validated in parallel, the other bodies are validated
+// sequentially. Zero Workers disable the parallel validation
+type ParallelValidation struct {
+	Workers     int   `conf:"default:0" validate:"gte=0"`
+	MinBodySize int64 `conf:"default:65536" validate:"gte=0"`
+}
+
+// Pools sizes the pools of the FastJSON parsers and of the body buffers. At most ParserPoolSize idle parsers are
+// kept in ParserPoolShards shards (GOMAXPROCS shards if zero), the zero ParserPoolSize keeps the unbounded pool.
+// The body buffers larger than MaxBufferSize bytes are not returned to the pool. The contention is reported
+// every WarnInterval if more than WarnThreshold of the parsers or the buffers taken from the pool are allocated.
+// The zero WarnInterval disables the warnings
+type Pools struct {
+	ParserPoolSize   int           `conf:"default:0" validate:"gte=0"`
+	ParserPoolShards int           `conf:"default:0" validate:"gte=0"`
+	MaxBufferSize    int           `conf:"default:1048576" validate:"gt=0"`
+	WarnInterval     time.Duration `conf:"default:1m"`
+	WarnThreshold    float64       `conf:"default:0.1" validate:"gte=0,lte=1"`
+}
+
+type ResponsePassthrough struct {
+	ContentTypes []string `conf:"default:application/octet-stream;video/*;image/*"`
+}
+
+type ResponseCharset struct {
+	Allowed   []string `conf:""`
+	Transcode bool     `conf:"default:false"`
+}
+
+type BodyDecoders struct {
+	ProtobufDescriptors string `conf:""`
+	MaxSize             int64  `conf:"default:10485760"`
+	MaxDepth            int    `conf:"default:64"`
+}
+
+type StrictHeaders struct {
+	Enabled bool     `conf:"default:false"`
+	Prefix  string   `conf:"default:X-"`
+	Allowed []string `conf:"default:X-Forwarded-Host;X-Forwarded-Proto;X-Real-IP;X-Request-ID"`
+}
+
+type StrictContentType struct {
+	Request  bool `conf:"default:false"`
+	Response bool `conf:"default:false"`
+}
+
+type ContentTypeMatching struct {
+	Mode string `conf:"default:LENIENT" validate:"oneof=STRICT LENIENT"`
+}
+
+type URINormalization struct {
+	Mode string `conf:"default:DISABLE" validate:"oneof=DISABLE BLOCK LOG_ONLY"`
+}
+
+type RequestSmuggling struct {
+	Mode string `conf:"default:BLOCK" validate:"oneof=DISABLE BLOCK LOG_ONLY"`
+}
+
+type MethodOverride struct {
+	Policy  string   `conf:"default:ALLOW" validate:"oneof=ALLOW BLOCK APPLY"`
+	Headers []string `conf:"default:X-HTTP-Method-Override;X-HTTP-Method;X-Method-Override"`
+}
+
+type ParameterPollution struct {
+	Policy string `conf:"default:ALLOW" validate:"oneof=ALLOW BLOCK KEEP_FIRST KEEP_LAST"`
+}
+
+type RouteMatching struct {
+	IgnoreTrailingSlash bool `conf:"default:false"`
+	CaseInsensitive     bool `conf:"default:false"`
+	CollapseSlashes     bool `conf:"default:false"`
+}
+
+type FaultInjection struct {
+	Enabled         bool          `conf:"default:false"`
+	Operations      []string      `conf:""`
+	Percentage      float64       `conf:"default:0" validate:"gte=0,lte=100"`
+	Latency         time.Duration `conf:"default:0s"`
+	StatusCode      int           `conf:"default:0"`
+	ConnectionReset bool          `conf:"default:false"`
+}
+
+type GraphQL struct {
+	Operations           []string `conf:""`
+	PersistedQueries     []string `conf:""`
+	PersistedQueriesFile string   `conf:""`
+}
+
+type GRPCWeb struct {
+	Enabled bool `conf:"default:false"`
+}
+
+type SOAP struct {
+	WSDLFile string `conf:""`
+	Path     string `conf:""`
+}
+
+type Idempotency struct {
+	Enabled      bool          `conf:"default:false"`
+	Header       string        `conf:"default:Idempotency-Key"`
+	KeyPattern   string        `conf:"default:^[A-Za-z0-9_.:-]+$"`
+	MaxKeyLength int           `conf:"default:255"`
+	Required     bool          `conf:"default:false"`
+	TTL          time.Duration `conf:"default:24h"`
+}
+
+type Coalescing struct {
+	Enabled    bool          `conf:"default:false"`
+	KeyHeaders []string      `conf:"default:Accept;Accept-Encoding;Accept-Language"`
+	MaxWait    time.Duration `conf:"default:5s"`
+}
+
+// VerdictCache keeps the failed request validation verdicts of the BLOCK mode for the TTL, so the identical requests
+// (the same operation, method, URI, headers except the IgnoreHeaders and body) are blocked without the validation.
+// The security requirements errors are not cached. The zero TTL disables the cache
+type VerdictCache struct {
+	TTL           time.Duration `conf:"default:0s"`
+	MaxEntries    int64         `conf:"default:10000" validate:"gt=0"`
+	IgnoreHeaders []string      `conf:"default:Date;X-Request-Id;Traceparent;Tracestate"`
+}
+
+// UpstreamSLO sets the default upstream response time objective of the operations: the Objective percentage
+// of the upstream responses in the Window should be faster than the Threshold. The objective of the operation
+// is overridden by the x-wallarm-upstream-slo extension. The zero Threshold disables the default objective
+type UpstreamSLO struct {
+	Threshold   time.Duration `conf:"default:0s"`
+	Objective   float64       `conf:"default:99" validate:"gt=0,lte=100"`
+	Window      time.Duration `conf:"default:1m"`
+	MinRequests int           `conf:"default:20"`
+}
+
+type PIIDetection struct {
+	Enabled        bool              `conf:"default:false"`
+	Types          []string          `conf:"default:email;card;iban;ssn"`
+	Checksum       bool              `conf:"default:true"`
+	CustomPatterns map[string]string `conf:""`
+	MaxBodySize    int               `conf:"default:1048576"`
+}
+
+type ResponseDiff struct {
+	Enabled       bool          `conf:"default:false"`
+	URL           string        `conf:""`
+	Percentage    float64       `conf:"default:100" validate:"gte=0,lte=100"`
+	Timeout       time.Duration `conf:"default:5s"`
+	IgnoreFields  []string      `conf:""`
+	MaxDiffs      int           `conf:"default:20"`
+	MaxConcurrent int           `conf:"default:100" validate:"gte=0"`
+}
+
+// GeoIP enriches the logs and the events with the country and the city of the client IP address looked up in the
+// CityDatabase (the GeoIP2 or GeoLite2 City or Country MMDB file) and with the autonomous system looked up in the
+// ASNDatabase (the GeoLite2 ASN MMDB file). The city names are in the Language if the database contains it
+type GeoIP struct {
+	CityDatabase string `conf:""`
+	ASNDatabase  string `conf:""`
+	Language     string `conf:"default:en"`
+}
+
+// Analyzer forwards the sanitized copies of the requests with the verdicts of the Decisions to the external
+// analysis endpoint in the JSON batches. The copies are dropped when the queue is full, so the slow endpoint
+// doesn't delay the requests. The redacted headers are not forwarded and the bodies are truncated to MaxBodySize
+type Analyzer struct {
+	URL           string        `conf:""`
+	Token         string        `conf:"mask"`
+	Decisions     []string      `conf:"default:failed;blocked"`
+	QueueSize     int           `conf:"default:10000" validate:"gt=0"`
+	BatchSize     int           `conf:"default:100" validate:"gt=0"`
+	FlushInterval time.Duration `conf:"default:1s"`
+	Timeout       time.Duration `conf:"default:5s"`
+	MaxRetries    int           `conf:"default:3" validate:"gte=0"`
+	MaxBodySize   int           `conf:"default:4096" validate:"gte=0"`
+	RedactHeaders []string      `conf:"default:Authorization;Cookie;Proxy-Authorization;Set-Cookie"`
+}
+
+// EventSink stores the verdicts of all requests for the analytics. The verdicts are written in batches into the
+// ClickHouse Table (the JSONEachRow rows inserted by the HTTP interface) or into the Elasticsearch Index (the
+// documents indexed by the bulk API). The verdicts are dropped when the queue is full
+type EventSink struct {
+	Type          string        `conf:"" validate:"omitempty,oneof=CLICKHOUSE ELASTICSEARCH"`
+	URL           string        `conf:""`
+	Table         string        `conf:"default:apifw_verdicts"`
+	Index         string        `conf:"default:apifw-verdicts"`
+	Username      string        `conf:""`
+	Password      string        `conf:"mask"`
+	QueueSize     int           `conf:"default:100000" validate:"gt=0"`
+	BatchSize     int           `conf:"default:1000" validate:"gt=0"`
+	FlushInterval time.Duration `conf:"default:5s"`
+	Timeout       time.Duration `conf:"default:10s"`
+	MaxRetries    int           `conf:"default:3" validate:"gte=0"`
+}
+
+// Honeypot serves the decoy Routes and denies the tokens of their callers for the DenyTTL. The caller addresses
+// are denied only if DenyAddresses is set: behind the load balancer or NAT the clients share the address
+type Honeypot struct {
+	Routes        []string      `conf:""`
+	StatusCode    int           `conf:"default:200" validate:"HttpStatusCodes"`
+	ContentType   string        `conf:"default:application/json"`
+	Body          string        `conf:"default:{\"status\":\"ok\"}"`
+	DenyTTL       time.Duration `conf:"default:1h"`
+	DenyAddresses bool          `conf:"default:false"`
+}
+
+type ThreatIntel struct {
+	Feeds           []string      `conf:""`
+	TTL             time.Duration `conf:"default:24h"`
+	RefreshInterval time.Duration `conf:"default:1h"`
+	Timeout         time.Duration `conf:"default:30s"`
+	MaxEntries      int           `conf:"default:1000000" validate:"gt=0"`
+}
+
+// Ban denies the tokens of the clients for the Duration after the Threshold of the requests blocked in the Window.
+// The client addresses are banned only if Addresses is set: behind the load balancer or NAT the clients share the address
+type Ban struct {
+	Enabled   bool          `conf:"default:false"`
+	Addresses bool          `conf:"default:false"`
+	Threshold int           `conf:"default:10" validate:"gt=0"`
+	Window    time.Duration `conf:"default:1m"`
+	Duration  time.Duration `conf:"default:1h"`
+}
+
+type BodyLimits struct {
+	DeriveFromSchema bool `conf:"default:false"`
+	SchemaFactor     int  `conf:"default:2" validate:"gt=0"`
+}
+
+type Tarpit struct {
+	Enabled         bool          `conf:"default:false"`
+	Delay           time.Duration `conf:"default:10s"`
+	Body            string        `conf:"default:Forbidden"`
+	DribbleBytes    int           `conf:"default:1"`
+	DribbleInterval time.Duration `conf:"default:1s"`
+	MaxConcurrent   int           `conf:"default:1000" validate:"gte=0"`
+}
+
+type Maintenance struct {
+	Enabled     bool              `conf:"default:false"`
+	Operations  []string          `conf:""`
+	StatusCode  int               `conf:"default:503" validate:"HttpStatusCodes"`
+	Headers     map[string]string `conf:""`
+	ContentType string            `conf:"default:text/plain; charset=utf-8"`
+	Body        string            `conf:"default:Service is under maintenance"`
+}
+
+type VerdictSigning struct {
+	Secret string `conf:"mask"`
+}
+
+// APIVersions contains the API Specs of the versions in the version=spec format, the spec is the path or the URL.
+// The pairs are separated by semicolons because the URL contains colons
+type APIVersions struct {
+	Specs          []string `conf:""`
+	Header         string   `conf:"default:Accept-Version"`
+	MediaTypeParam string   `conf:"default:version"`
+}
+
 type APIFWConfiguration struct {
 	conf.Version
-	TLS    TLS
-	Server Server
+	conf.Args
+	TLS         TLS
+	Server      Server
+	HTTPServer  HTTPServer
+	Passthrough Passthrough
 
 	APIHost                   string        `conf:"default:http://0.0.0.0:8282,env:URL" validate:"required,url"`
 	HealthAPIHost             string        `conf:"default:0.0.0.0:9667,env:HEALTH_HOST" validate:"required"`
+	AdminAPIHost              string        `conf:"env:ADMIN_HOST"`
+	AdminAPIToken             string        `conf:"mask,env:ADMIN_TOKEN"`
 	ReadTimeout               time.Duration `conf:"default:5s"`
 	WriteTimeout              time.Duration `conf:"default:5s"`
 	LogLevel                  string        `conf:"default:DEBUG" validate:"required,oneof=DEBUG INFO ERROR WARNING"`
-	LogFormat                 string        `conf:"default:TEXT" validate:"required,oneof=TEXT JSON"`
+	LogFormat                 string        `conf:"default:TEXT" validate:"required,oneof=TEXT JSON CEF LEEF"`
 	RequestValidation         string        `conf:"required" validate:"required,oneof=DISABLE BLOCK LOG_ONLY"`
 	ResponseValidation        string        `conf:"required" validate:"required,oneof=DISABLE BLOCK LOG_ONLY"`
+	ResponseHeadersValidation string        `conf:"default:DISABLE" validate:"oneof=DISABLE BLOCK LOG_ONLY"`
+	ResponseStatusValidation  string        `conf:"default:DISABLE" validate:"oneof=DISABLE BLOCK LOG_ONLY"`
+	ContentNegotiation        string        `conf:"default:DISABLE" validate:"oneof=DISABLE BLOCK LOG_ONLY"`
+	ExcludeResponseBody       []string      `conf:""`
 	CustomBlockStatusCode     int           `conf:"default:403" validate:"HttpStatusCodes"`
 	AddValidationStatusHeader bool          `conf:"default:false"`
+	AddTimingHeader           bool          `conf:"default:false"`
+	RespondMethodNotAllowed   bool          `conf:"default:true"`
 	APISpecs                  string        `conf:"default:swagger.json,env:API_SPECS"`
+	APISpecsAllowRemoteRefs   bool          `conf:"default:false"`
+	APISpecsGit               GitSpecs
+	APISpecsBlob              BlobStorage
+	ConfigWatch               ConfigWatch
+	APIVersions               APIVersions
+	Deprecation               Deprecation
+	BodyDecoders              BodyDecoders
+	JSONLimits                JSONLimits
+	JSONNumbers               JSONNumbers
+	ParallelValidation        ParallelValidation
+	Pools                     Pools
+	ResponsePassthrough       ResponsePassthrough
+	ResponseCharset           ResponseCharset
+	StrictHeaders             StrictHeaders
+	StrictContentType         StrictContentType
+	ContentTypeMatching       ContentTypeMatching
+	URINormalization          URINormalization
+	RequestSmuggling          RequestSmuggling
+	MethodOverride            MethodOverride
+	ParameterPollution        ParameterPollution
+	RouteMatching             RouteMatching
+	VerdictSigning            VerdictSigning
+	FaultInjection            FaultInjection
+	Maintenance               Maintenance
+	Schedule                  Schedule
+	Experiment                Experiment
+	Idempotency               Idempotency
+	Coalescing                Coalescing
+	VerdictCache              VerdictCache
+	UpstreamSLO               UpstreamSLO
+	GraphQL                   GraphQL
+	GRPCWeb                   GRPCWeb
+	SOAP                      SOAP
+	PIIDetection              PIIDetection
+	ResponseDiff              ResponseDiff
+	GeoIP                     GeoIP
+	Analyzer                  Analyzer
+	EventSink                 EventSink
+	Honeypot                  Honeypot
+	BodyLimits                BodyLimits
+	AccessControl             AccessControl
+	Consumers                 Consumers
+	SchemaLearning            SchemaLearning
+	DeniedRequests            DeniedRequests
+	Scoring                   Scoring
+	Ban                       Ban
+	Tarpit                    Tarpit
+	ThreatIntel               ThreatIntel
 	ShadowAPI                 ShadowAPI
 	Denylist                  Denylist
+	BasicAuth                 BasicAuth
+	Redis                     Redis
+	StateBackend              string `conf:"default:LOCAL" validate:"oneof=LOCAL REDIS"`
 }
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// redactedValue replaces the values of the fields with the mask option
+const redactedValue = "xxxxxx"
+
+// Redacted returns the configuration as the map of the field names to the values with the values
+// of the fields with the mask option redacted. The durations are represented by the strings
+func Redacted(cfg interface{}) interface{} {
+	return redact(reflect.ValueOf(cfg), false)
+}
+
+func redact(v reflect.Value, mask bool) interface{} {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	if d, ok := v.Interface().(time.Duration); ok {
+		return d.String()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		fields := make(map[string]interface{}, v.NumField())
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			fields[field.Name] = redact(v.Field(i), hasMask(field.Tag.Get("conf")))
+		}
+		return fields
+	case reflect.String:
+		if mask && v.String() != "" {
+			return redactedValue
+		}
+		return v.String()
+	}
+
+	return v.Interface()
+}
+
+func hasMask(tag string) bool {
+	for _, option := range strings.Split(tag, ",") {
+		if strings.TrimSpace(option) == "mask" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,287 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// scheduleInterval is the period of the evaluation of the scheduled windows
+	scheduleInterval = 10 * time.Second
+
+	// maxWindowDuration limits the lookback of the window starts
+	maxWindowDuration = 7 * 24 * time.Hour
+)
+
+// ScheduleWindow is the policy applied for Duration after each start matched by the cron expression
+// (minute hour day-of-month month day-of-week). The validation modes override the configured modes
+// of the Operations (selected by operationId or by the method and the path) or of all operations if the
+// Operations are empty. The rate limits are multiplied by RateLimitScale if it is set
+type ScheduleWindow struct {
+	Name               string   `json:"name"`
+	Cron               string   `json:"cron"`
+	Duration           string   `json:"duration"`
+	RequestValidation  string   `json:"request_validation"`
+	ResponseValidation string   `json:"response_validation"`
+	Operations         []string `json:"operations"`
+	RateLimitScale     float64  `json:"rate_limit_scale"`
+
+	cron     *cronExpr
+	duration time.Duration
+}
+
+// LoadSchedule parses and checks the scheduled windows
+func LoadSchedule(data []byte) ([]*ScheduleWindow, error) {
+
+	var windows []*ScheduleWindow
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&windows); err != nil {
+		return nil, fmt.Errorf("decoding schedule: %w", err)
+	}
+
+	names := make(map[string]struct{}, len(windows))
+	for _, w := range windows {
+		if w.Name == "" {
+			return nil, fmt.Errorf("schedule window without name")
+		}
+		if _, ok := names[w.Name]; ok {
+			return nil, fmt.Errorf("schedule window %s: duplicate name", w.Name)
+		}
+		names[w.Name] = struct{}{}
+
+		cron, err := parseCron(w.Cron)
+		if err != nil {
+			return nil, fmt.Errorf("schedule window %s: %w", w.Name, err)
+		}
+		w.cron = cron
+
+		w.duration, err = time.ParseDuration(w.Duration)
+		if err != nil {
+			return nil, fmt.Errorf("schedule window %s: invalid duration: %w", w.Name, err)
+		}
+		if w.duration <= 0 || w.duration > maxWindowDuration {
+			return nil, fmt.Errorf("schedule window %s: duration should be positive and not longer than %s", w.Name, maxWindowDuration)
+		}
+
+		for _, mode := range []string{w.RequestValidation, w.ResponseValidation} {
+			switch mode {
+			case "", "DISABLE", "BLOCK", "LOG_ONLY":
+			default:
+				return nil, fmt.Errorf("schedule window %s: invalid validation mode %q", w.Name, mode)
+			}
+		}
+
+		if w.RateLimitScale < 0 {
+			return nil, fmt.Errorf("schedule window %s: negative rate_limit_scale", w.Name)
+		}
+	}
+
+	return windows, nil
+}
+
+// Scheduler evaluates the scheduled windows in the configured timezone
+type Scheduler struct {
+	windows  []*ScheduleWindow
+	location *time.Location
+}
+
+// NewScheduler loads the schedule file. It returns nil if the file is not configured
+func NewScheduler(cfg *Schedule) (*Scheduler, error) {
+
+	if cfg.File == "" {
+		return nil, nil
+	}
+
+	location, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("schedule timezone: %w", err)
+	}
+
+	data, err := os.ReadFile(cfg.File)
+	if err != nil {
+		return nil, err
+	}
+
+	windows, err := LoadSchedule(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", cfg.File, err)
+	}
+
+	return &Scheduler{windows: windows, location: location}, nil
+}
+
+// Active returns the windows active at the moment in the order of the schedule file
+func (s *Scheduler) Active(now time.Time) []*ScheduleWindow {
+
+	now = now.In(s.location)
+
+	var active []*ScheduleWindow
+	for _, w := range s.windows {
+		// the window started in the last duration is active
+		for start := now.Truncate(time.Minute); now.Sub(start) < w.duration; start = start.Add(-time.Minute) {
+			if w.cron.matches(start) {
+				active = append(active, w)
+				break
+			}
+		}
+	}
+
+	return active
+}
+
+// Run evaluates the windows periodically and calls apply with the active windows on start and
+// after the set of the active windows is changed. Run doesn't return
+func (s *Scheduler) Run(apply func(active []*ScheduleWindow)) {
+
+	var current string
+	for {
+		active := s.Active(time.Now())
+
+		names := make([]string, 0, len(active))
+		for _, w := range active {
+			names = append(names, w.Name)
+		}
+		sort.Strings(names)
+
+		if key := "\x00" + strings.Join(names, "\x00"); key != current {
+			current = key
+			apply(active)
+		}
+
+		time.Sleep(scheduleInterval)
+	}
+}
+
+// cronExpr is the parsed cron expression: the bit sets of the allowed values of the fields
+type cronExpr struct {
+	minute, hour, dom, month, dow uint64
+
+	// the restricted day of month and day of week are matched by either of them
+	domAny, dowAny bool
+}
+
+var (
+	cronMonths = map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}
+	cronDays = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+)
+
+// parseCron parses the five fields cron expression. The fields support the lists, the ranges,
+// the steps and the names of the months and the days of week
+func parseCron(expr string) (*cronExpr, error) {
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q should contain 5 fields", expr)
+	}
+
+	var c cronExpr
+	var err error
+
+	if c.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("cron minute: %w", err)
+	}
+	if c.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("cron hour: %w", err)
+	}
+	if c.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("cron day of month: %w", err)
+	}
+	if c.month, err = parseCronField(fields[3], 1, 12, cronMonths); err != nil {
+		return nil, fmt.Errorf("cron month: %w", err)
+	}
+	// Sunday is either 0 or 7
+	if c.dow, err = parseCronField(fields[4], 0, 7, cronDays); err != nil {
+		return nil, fmt.Errorf("cron day of week: %w", err)
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+
+	c.domAny = fields[2] == "*"
+	c.dowAny = fields[4] == "*"
+
+	return &c, nil
+}
+
+func parseCronField(field string, min, max int, names map[string]int) (uint64, error) {
+
+	value := func(s string) (int, error) {
+		if n, ok := names[strings.ToLower(s)]; ok {
+			return n, nil
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < min || n > max {
+			return 0, fmt.Errorf("invalid value %q", s)
+		}
+		return n, nil
+	}
+
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			rangePart = part[:i]
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", part[i+1:])
+			}
+		}
+
+		from, to := min, max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if from, err = value(bounds[0]); err != nil {
+				return 0, err
+			}
+			if to, err = value(bounds[1]); err != nil {
+				return 0, err
+			}
+			if from > to {
+				return 0, fmt.Errorf("invalid range %q", rangePart)
+			}
+		default:
+			var err error
+			if from, err = value(rangePart); err != nil {
+				return 0, err
+			}
+			// the single value with the step is the start of the range
+			if step == 1 {
+				to = from
+			}
+		}
+
+		for n := from; n <= to; n += step {
+			bits |= 1 << uint(n)
+		}
+	}
+
+	return bits, nil
+}
+
+// matches returns true if the minute of the time is matched by the expression
+func (c *cronExpr) matches(t time.Time) bool {
+
+	if c.minute&(1<<uint(t.Minute())) == 0 || c.hour&(1<<uint(t.Hour())) == 0 || c.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+
+	domMatch := c.dom&(1<<uint(t.Day())) != 0
+	dowMatch := c.dow&(1<<uint(t.Weekday())) != 0
+
+	if c.domAny || c.dowAny {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
@@ -0,0 +1,33 @@
+package mid
+
+import (
+	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/config"
+	"github.com/wallarm/api-firewall/internal/platform/analyzer"
+	"github.com/wallarm/api-firewall/internal/platform/web"
+)
+
+// Analyzer forwards the copies of the handled requests with the verdicts to the external analysis endpoint
+func Analyzer(cfg *config.APIFWConfiguration) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(before web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx *fasthttp.RequestCtx) error {
+
+			err := before(ctx)
+
+			if cfg.Analyzer.URL != "" {
+				analyzer.Default.Forward(ctx)
+			}
+
+			// Return the error, so it can be handled further up the chain.
+			return err
+		}
+
+		return h
+	}
+
+	return m
+}
@@ -0,0 +1,77 @@
+package mid
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/config"
+	"github.com/wallarm/api-firewall/internal/platform/web"
+	"golang.org/x/exp/slices"
+)
+
+// ClientCert checks names of the verified client certificate against the allowlist
+// and passes the certificate subject to the upstream
+func ClientCert(cfg *config.APIFWConfiguration, logger *logrus.Logger) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(before web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx *fasthttp.RequestCtx) error {
+
+			if cfg.TLS.ClientAuth == "" || cfg.TLS.ClientAuth == web.ClientAuthNone {
+				return before(ctx)
+			}
+
+			// remove the header sent by the client
+			if cfg.TLS.ClientCertHeader != "" {
+				ctx.Request.Header.Del(cfg.TLS.ClientCertHeader)
+			}
+
+			state := ctx.TLSConnectionState()
+			if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+				if cfg.TLS.ClientAuth == web.ClientAuthRequire {
+					return web.RespondError(ctx, cfg.CustomBlockStatusCode, nil)
+				}
+				return before(ctx)
+			}
+
+			cert := state.VerifiedChains[0][0]
+
+			if len(cfg.TLS.AllowedClientNames) > 0 {
+				names := append([]string{cert.Subject.CommonName}, cert.DNSNames...)
+				names = append(names, cert.EmailAddresses...)
+				for _, uri := range cert.URIs {
+					names = append(names, uri.String())
+				}
+
+				allowed := slices.IndexFunc(names, func(name string) bool {
+					return slices.Contains(cfg.TLS.AllowedClientNames, name)
+				}) >= 0
+
+				if !allowed {
+					logger.WithFields(logrus.Fields{
+						"request_id":          fmt.Sprintf("#%016X", ctx.ID()),
+						"client_cert_subject": cert.Subject.String(),
+						"client_address":      ctx.RemoteAddr(),
+					}).Error("client certificate is not allowed")
+					return web.RespondError(ctx, cfg.CustomBlockStatusCode, nil)
+				}
+			}
+
+			if cfg.TLS.ClientCertHeader != "" {
+				ctx.Request.Header.Set(cfg.TLS.ClientCertHeader, cert.Subject.String())
+			}
+
+			err := before(ctx)
+
+			// Return the error, so it can be handled further up the chain.
+			return err
+		}
+
+		return h
+	}
+
+	return m
+}
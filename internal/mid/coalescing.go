@@ -0,0 +1,132 @@
+package mid
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/config"
+	"github.com/wallarm/api-firewall/internal/platform/coalescing"
+	"github.com/wallarm/api-firewall/internal/platform/web"
+)
+
+// Coalescing collapses the identical concurrent GET requests to the single request to the upstream: the first
+// request is proxied and the requests arriving before its response are served by the same response. The requests
+// with the credentials or with the no-cache directives and the private responses are never shared.
+// The middleware wraps the proxying of the validated request, so each request is validated by itself, and
+// it must not be used for the operations with the security requirements
+func Coalescing(cfg *config.APIFWConfiguration, operation string, group *coalescing.Group, logger *logrus.Logger) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(before web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx *fasthttp.RequestCtx) error {
+
+			if !coalescableRequest(ctx) {
+				return before(ctx)
+			}
+
+			var key strings.Builder
+			key.WriteString(operation)
+			key.WriteByte('\n')
+			key.Write(ctx.Request.Header.Host())
+			key.Write(ctx.Request.RequestURI())
+			for _, name := range cfg.Coalescing.KeyHeaders {
+				key.WriteByte('\n')
+				key.Write(ctx.Request.Header.Peek(name))
+			}
+
+			call, leader := group.Join(key.String())
+			if !leader {
+				shared := group.Wait(call, cfg.Coalescing.MaxWait)
+				if shared == nil {
+					return before(ctx)
+				}
+
+				coalescingLog(ctx, operation, logger).Debug("response shared by the identical request in flight")
+
+				ctx.Response.Reset()
+				ctx.SetStatusCode(shared.StatusCode)
+				for _, header := range shared.Headers {
+					ctx.Response.Header.Add(header[0], header[1])
+				}
+				ctx.SetBody(shared.Body)
+
+				return nil
+			}
+
+			err := before(ctx)
+
+			// the waiting requests are proxied by themselves if the response can't be shared
+			if err != nil || !shareableResponse(ctx) {
+				group.Complete(key.String(), call, nil)
+				return err
+			}
+
+			response := coalescing.Response{
+				StatusCode: ctx.Response.StatusCode(),
+				Body:       append([]byte(nil), ctx.Response.Body()...),
+			}
+			ctx.Response.Header.VisitAll(func(name, value []byte) {
+				switch string(name) {
+				case fasthttp.HeaderContentLength, fasthttp.HeaderDate, fasthttp.HeaderConnection, fasthttp.HeaderTransferEncoding:
+					return
+				}
+				response.Headers = append(response.Headers, [2]string{string(name), string(value)})
+			})
+			group.Complete(key.String(), call, &response)
+
+			return nil
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// coalescableRequest returns true if the response of the request may be shared: the request is the GET request
+// without the body, the credentials and the directives preventing the use of the cached responses
+func coalescableRequest(ctx *fasthttp.RequestCtx) bool {
+	if !ctx.IsGet() || len(ctx.Request.Body()) > 0 {
+		return false
+	}
+
+	if len(ctx.Request.Header.Peek(fasthttp.HeaderAuthorization)) > 0 || len(ctx.Request.Header.Peek(fasthttp.HeaderCookie)) > 0 {
+		return false
+	}
+
+	cacheControl := bytes.ToLower(ctx.Request.Header.Peek(fasthttp.HeaderCacheControl))
+	if bytes.Contains(cacheControl, []byte("no-cache")) || bytes.Contains(cacheControl, []byte("no-store")) {
+		return false
+	}
+
+	return !bytes.Contains(bytes.ToLower(ctx.Request.Header.Peek(fasthttp.HeaderPragma)), []byte("no-cache"))
+}
+
+// shareableResponse returns true if the response may be served to the other clients
+func shareableResponse(ctx *fasthttp.RequestCtx) bool {
+	if len(ctx.Response.Header.Peek(fasthttp.HeaderSetCookie)) > 0 {
+		return false
+	}
+
+	cacheControl := bytes.ToLower(ctx.Response.Header.Peek(fasthttp.HeaderCacheControl))
+	for _, directive := range []string{"private", "no-store", "no-cache"} {
+		if bytes.Contains(cacheControl, []byte(directive)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func coalescingLog(ctx *fasthttp.RequestCtx, operation string, logger *logrus.Logger) *logrus.Entry {
+	return logger.WithFields(logrus.Fields{
+		"request_id":     fmt.Sprintf("#%016X", ctx.ID()),
+		"operation":      operation,
+		"client_address": ctx.RemoteAddr(),
+	})
+}
@@ -0,0 +1,53 @@
+package mid
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/config"
+	"github.com/wallarm/api-firewall/internal/platform/concurrency"
+	"github.com/wallarm/api-firewall/internal/platform/web"
+)
+
+// ConcurrencyLimit limits the simultaneous in-flight requests of the operation by the limiter. The requests
+// exceeding the limit are responded by 429 status code. The requests without the API key are counted by
+// the client IP address if the limit is set per API key
+func ConcurrencyLimit(cfg *config.APIFWConfiguration, operation string, limiter *concurrency.Limiter, logger *logrus.Logger) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(before web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx *fasthttp.RequestCtx) error {
+
+			client := ctx.RemoteIP().String()
+			if limiter.Key() == concurrency.KeyAPIKey {
+				if apiKey := ctx.Request.Header.Peek(cfg.Consumers.APIKeyHeader); len(apiKey) > 0 {
+					client = concurrency.KeyAPIKey + ":" + string(apiKey)
+				}
+			}
+
+			if !limiter.Acquire(client) {
+				logger.WithFields(logrus.Fields{
+					"request_id":     fmt.Sprintf("#%016X", ctx.ID()),
+					"operation":      operation,
+					"max_concurrent": limiter.Max(),
+					"client_address": ctx.RemoteAddr(),
+				}).Info("request blocked: concurrency limit exceeded")
+
+				return web.RespondError(ctx, fasthttp.StatusTooManyRequests, nil)
+			}
+			defer limiter.Release(client)
+
+			err := before(ctx)
+
+			// Return the error, so it can be handled further up the chain.
+			return err
+		}
+
+		return h
+	}
+
+	return m
+}
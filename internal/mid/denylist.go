@@ -1,6 +1,8 @@
 package mid
 
 import (
+	"context"
+	"fmt"
 	"strings"
 
 	"github.com/sirupsen/logrus"
@@ -10,36 +12,51 @@ import (
 	"github.com/wallarm/api-firewall/internal/platform/web"
 )
 
-// Denylist forbidden requests with tokens in the blacklist
+// Denylist forbidden requests with tokens in the blacklist and requests of the client addresses denied at runtime.
+// The denied requests are slowed down in the tarpit mode
 func Denylist(cfg *config.APIFWConfiguration, deniedTokens *denylist.DeniedTokens, logger *logrus.Logger) web.Middleware {
 
+	tarpit := newTarpit(cfg, logger)
+
 	// This is the actual middleware function to be executed.
 	m := func(before web.Handler) web.Handler {
 
 		// Create the handler that will be attached in the middleware chain.
 		h := func(ctx *fasthttp.RequestCtx) error {
 
-			// check existence and emptiness of the cache
-			if deniedTokens != nil && deniedTokens.ElementsNum > 0 {
-				if cfg.Denylist.Tokens.CookieName != "" {
-					token := string(ctx.Request.Header.Cookie(cfg.Denylist.Tokens.CookieName))
-					if _, found := deniedTokens.Cache.Get(token); found {
-						return web.RespondError(ctx, cfg.CustomBlockStatusCode, nil)
-					}
-				}
-				if cfg.Denylist.Tokens.HeaderName != "" {
-					token := string(ctx.Request.Header.Peek(cfg.Denylist.Tokens.HeaderName))
-					if cfg.Denylist.Tokens.TrimBearerPrefix {
-						token = strings.TrimPrefix(token, "Bearer ")
+			if deniedTokens != nil {
+				// the tokens are checked by the local state if the shared state is not available
+				found, err := deniedTokens.AddressFound(context.Background(), ctx.RemoteIP().String())
+				for _, token := range DenylistTokens(cfg, ctx) {
+					if found {
+						break
 					}
-					if _, found := deniedTokens.Cache.Get(token); found {
-						return web.RespondError(ctx, cfg.CustomBlockStatusCode, nil)
+					var tokenErr error
+					found, tokenErr = deniedTokens.Found(context.Background(), token)
+					if err == nil {
+						err = tokenErr
 					}
 				}
+				if found {
+					return tarpit.block(ctx, cfg.CustomBlockStatusCode)
+				}
+				// the outage of the shared state is logged by the denylist. The request checked by the local
+				// state only is blocked in the FAIL_CLOSED mode
+				if err != nil && cfg.Denylist.FailurePolicy == denylist.PolicyFailClosed {
+					return web.RespondError(ctx, cfg.CustomBlockStatusCode, nil)
+				}
 			}
 
 			err := before(ctx)
 
+			// the clients are banned after the threshold of the requests blocked by the firewall. The responses
+			// of the upstream with the same status code are not counted
+			if deniedTokens != nil && cfg.Ban.Enabled {
+				if verdict := web.GetVerdict(ctx); verdict != nil && verdict.Decision == web.VerdictBlocked {
+					strike(ctx, cfg, deniedTokens, logger)
+				}
+			}
+
 			// Return the error, so it can be handled further up the chain.
 			return err
 		}
@@ -49,3 +66,47 @@ func Denylist(cfg *config.APIFWConfiguration, deniedTokens *denylist.DeniedToken
 
 	return m
 }
+
+// strike counts the blocked request of the tokens of the request and of the client address if the address bans are enabled
+func strike(ctx *fasthttp.RequestCtx, cfg *config.APIFWConfiguration, deniedTokens *denylist.DeniedTokens, logger *logrus.Logger) {
+
+	var clients [][2]string
+	if cfg.Ban.Addresses {
+		clients = append(clients, [2]string{denylist.KindAddress, ctx.RemoteIP().String()})
+	}
+	for _, token := range DenylistTokens(cfg, ctx) {
+		clients = append(clients, [2]string{denylist.KindToken, token})
+	}
+
+	for _, client := range clients {
+		// the outage of the shared state is logged by the denylist
+		banned, err := deniedTokens.Strike(context.Background(), client[0], client[1])
+		if err != nil {
+			continue
+		}
+		if banned {
+			logger.WithFields(logrus.Fields{
+				"request_id":     fmt.Sprintf("#%016X", ctx.ID()),
+				"client_address": ctx.RemoteAddr(),
+				"kind":           client[0],
+				"duration":       cfg.Ban.Duration,
+			}).Warning("client banned")
+		}
+	}
+}
+
+// DenylistTokens returns the tokens of the request checked by the denylist
+func DenylistTokens(cfg *config.APIFWConfiguration, ctx *fasthttp.RequestCtx) []string {
+	var tokens []string
+	if cfg.Denylist.Tokens.CookieName != "" {
+		tokens = append(tokens, string(ctx.Request.Header.Cookie(cfg.Denylist.Tokens.CookieName)))
+	}
+	if cfg.Denylist.Tokens.HeaderName != "" {
+		token := string(ctx.Request.Header.Peek(cfg.Denylist.Tokens.HeaderName))
+		if cfg.Denylist.Tokens.TrimBearerPrefix {
+			token = strings.TrimPrefix(token, "Bearer ")
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
@@ -0,0 +1,69 @@
+package mid
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/config"
+	"github.com/wallarm/api-firewall/internal/platform/web"
+)
+
+// deprecatedUsage counts requests to the deprecated operations per operation and configured consumer
+var deprecatedUsage = expvar.NewMap("deprecated_operations_usage")
+
+// otherConsumer is the consumer of the requests without the configured consumer header value
+const otherConsumer = "other"
+
+// Deprecation adds the Deprecation, Sunset and Link headers to the responses
+// of the deprecated operation and counts the operation usage per configured consumer
+func Deprecation(cfg *config.APIFWConfiguration, operation string, deprecated bool, sunset *time.Time) web.Middleware {
+
+	consumers := make(map[string]struct{}, len(cfg.Deprecation.Consumers))
+	for _, consumer := range cfg.Deprecation.Consumers {
+		consumers[consumer] = struct{}{}
+	}
+
+	// This is the actual middleware function to be executed.
+	m := func(before web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx *fasthttp.RequestCtx) error {
+
+			err := before(ctx)
+
+			if deprecated {
+				ctx.Response.Header.Set("Deprecation", "true")
+			}
+
+			if sunset != nil {
+				ctx.Response.Header.Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+			}
+
+			if cfg.Deprecation.Link != "" {
+				ctx.Response.Header.Add("Link", fmt.Sprintf("<%s>; rel=\"deprecation\"", cfg.Deprecation.Link))
+			}
+
+			if cfg.Deprecation.ConsumerHeader == "" {
+				deprecatedUsage.Add(operation, 1)
+				return err
+			}
+
+			consumer := otherConsumer
+			if _, ok := consumers[string(ctx.Request.Header.Peek(cfg.Deprecation.ConsumerHeader))]; ok {
+				consumer = string(ctx.Request.Header.Peek(cfg.Deprecation.ConsumerHeader))
+			}
+
+			deprecatedUsage.Add(fmt.Sprintf("%s %s", operation, consumer), 1)
+
+			// Return the error, so it can be handled further up the chain.
+			return err
+		}
+
+		return h
+	}
+
+	return m
+}
@@ -0,0 +1,33 @@
+package mid
+
+import (
+	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/config"
+	"github.com/wallarm/api-firewall/internal/platform/sink"
+	"github.com/wallarm/api-firewall/internal/platform/web"
+)
+
+// EventSink stores the verdicts of the handled requests in the event sink
+func EventSink(cfg *config.APIFWConfiguration) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(before web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx *fasthttp.RequestCtx) error {
+
+			err := before(ctx)
+
+			if cfg.EventSink.Type != "" {
+				sink.Default.Write(ctx)
+			}
+
+			// Return the error, so it can be handled further up the chain.
+			return err
+		}
+
+		return h
+	}
+
+	return m
+}
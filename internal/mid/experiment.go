@@ -0,0 +1,41 @@
+package mid
+
+import (
+	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/config"
+	"github.com/wallarm/api-firewall/internal/platform/experiment"
+	"github.com/wallarm/api-firewall/internal/platform/web"
+)
+
+// Experiment assigns the request to the cohort of the enforcement experiment. The cohort selects the validation
+// modes of the request and the verdict of the request is counted by cohort
+func Experiment(cfg *config.APIFWConfiguration) web.Middleware {
+
+	exp := experiment.New(&cfg.Experiment)
+
+	// This is the actual middleware function to be executed.
+	m := func(before web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx *fasthttp.RequestCtx) error {
+
+			if exp == nil {
+				return before(ctx)
+			}
+
+			cohort := exp.Assign(ctx)
+			experiment.SetCohort(ctx, cohort)
+
+			err := before(ctx)
+
+			experiment.Observe(cohort, web.GetVerdict(ctx), ctx.Response.StatusCode())
+
+			// Return the error, so it can be handled further up the chain.
+			return err
+		}
+
+		return h
+	}
+
+	return m
+}
@@ -0,0 +1,67 @@
+package mid
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/config"
+	"github.com/wallarm/api-firewall/internal/platform/web"
+)
+
+// FaultInjection injects the latency, the error status code or the connection reset into the configured
+// percentage of the requests of the operation, so the resilience of the API consumers can be tested
+func FaultInjection(cfg *config.APIFWConfiguration, operation string, logger *logrus.Logger) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(before web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx *fasthttp.RequestCtx) error {
+
+			fault := cfg.FaultInjection
+			if !fault.Enabled || rand.Float64()*100 >= fault.Percentage {
+				return before(ctx)
+			}
+
+			logger.WithFields(logrus.Fields{
+				"request_id":       fmt.Sprintf("#%016X", ctx.ID()),
+				"operation":        operation,
+				"latency":          fault.Latency,
+				"status_code":      fault.StatusCode,
+				"connection_reset": fault.ConnectionReset,
+			}).Debug("fault injected")
+
+			if fault.Latency > 0 {
+				time.Sleep(fault.Latency)
+			}
+
+			if fault.ConnectionReset {
+				// the connection is closed without the response, the RST is sent instead of FIN
+				ctx.HijackSetNoResponse(true)
+				ctx.Hijack(func(c net.Conn) {
+					if tcpConn, ok := c.(*net.TCPConn); ok {
+						tcpConn.SetLinger(0)
+					}
+				})
+				return nil
+			}
+
+			if fault.StatusCode > 0 {
+				return web.RespondError(ctx, fault.StatusCode, nil)
+			}
+
+			err := before(ctx)
+
+			// Return the error, so it can be handled further up the chain.
+			return err
+		}
+
+		return h
+	}
+
+	return m
+}
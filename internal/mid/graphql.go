@@ -0,0 +1,43 @@
+package mid
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/config"
+	"github.com/wallarm/api-firewall/internal/platform/graphql"
+	"github.com/wallarm/api-firewall/internal/platform/web"
+)
+
+// PersistedQueries blocks the GraphQL requests of the operation with the queries which are not
+// in the allowlist of the persisted queries, so only the pre-approved queries reach the backend
+func PersistedQueries(cfg *config.APIFWConfiguration, operation string, allowlist *graphql.Allowlist, logger *logrus.Logger) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(before web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx *fasthttp.RequestCtx) error {
+
+			if err := allowlist.Check(&ctx.Request); err != nil {
+				logger.WithFields(logrus.Fields{
+					"request_id": fmt.Sprintf("#%016X", ctx.ID()),
+					"operation":  operation,
+					"reason":     err,
+				}).Error("request blocked: graphql query is not allowed")
+
+				return web.RespondError(ctx, cfg.CustomBlockStatusCode, nil)
+			}
+
+			err := before(ctx)
+
+			// Return the error, so it can be handled further up the chain.
+			return err
+		}
+
+		return h
+	}
+
+	return m
+}
@@ -0,0 +1,143 @@
+package mid
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"regexp"
+
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/config"
+	"github.com/wallarm/api-firewall/internal/platform/idempotency"
+	"github.com/wallarm/api-firewall/internal/platform/web"
+)
+
+// IdempotentReplayed is the header of the responses replayed by the idempotency key
+const IdempotentReplayed = "Idempotent-Replayed"
+
+// Credential is the header, the query parameter or the cookie passing the credential of the security scheme
+type Credential struct {
+	In   string
+	Name string
+}
+
+// Idempotency replays the stored response of the completed request with the same idempotency key
+// instead of proxying the request to the upstream again. The middleware is executed after the validation
+// of the request. The keys are scoped by the operation, the Authorization header and the credentials of
+// the security schemes of the operation. The key reused with another body is responded by 422 status code
+// and the request with the key of the request in progress is responded by 409 status code
+func Idempotency(cfg *config.APIFWConfiguration, operation string, credentials []Credential, store *idempotency.Store, keyPattern *regexp.Regexp, logger *logrus.Logger) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(before web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx *fasthttp.RequestCtx) error {
+
+			key := string(ctx.Request.Header.Peek(cfg.Idempotency.Header))
+			if key == "" {
+				if cfg.Idempotency.Required {
+					idempotencyLog(ctx, operation, logger).Error("request blocked: idempotency key is missing")
+					return web.RespondError(ctx, fasthttp.StatusBadRequest, nil)
+				}
+				return before(ctx)
+			}
+
+			if len(key) > cfg.Idempotency.MaxKeyLength || !keyPattern.MatchString(key) {
+				idempotencyLog(ctx, operation, logger).Error("request blocked: invalid idempotency key")
+				return web.RespondError(ctx, fasthttp.StatusBadRequest, nil)
+			}
+
+			scope := credentialsHash(ctx, credentials)
+			storeKey := fmt.Sprintf("%s %x %s", operation, scope, key)
+			requestHash := sha256.Sum256(ctx.Request.Body())
+
+			stored, ok := store.Begin(storeKey)
+			if !ok {
+				idempotencyLog(ctx, operation, logger).Info("request blocked: request with the same idempotency key is in progress")
+				return web.RespondError(ctx, fasthttp.StatusConflict, nil)
+			}
+
+			if stored != nil {
+				if stored.RequestHash != requestHash {
+					idempotencyLog(ctx, operation, logger).Info("request blocked: idempotency key is reused with another request body")
+					return web.RespondError(ctx, fasthttp.StatusUnprocessableEntity, nil)
+				}
+
+				idempotencyLog(ctx, operation, logger).Debug("response replayed by idempotency key")
+
+				ctx.Response.Reset()
+				ctx.SetStatusCode(stored.StatusCode)
+				for _, header := range stored.Headers {
+					ctx.Response.Header.Add(header[0], header[1])
+				}
+				ctx.Response.Header.Set(IdempotentReplayed, "true")
+				ctx.SetBody(stored.Body)
+
+				return nil
+			}
+
+			err := before(ctx)
+
+			// the failed requests may be retried with the same key
+			if err != nil || ctx.Response.StatusCode() >= fasthttp.StatusInternalServerError {
+				store.Abort(storeKey)
+				return err
+			}
+
+			response := idempotency.Response{
+				RequestHash: requestHash,
+				StatusCode:  ctx.Response.StatusCode(),
+				Body:        append([]byte(nil), ctx.Response.Body()...),
+			}
+			ctx.Response.Header.VisitAll(func(name, value []byte) {
+				switch string(name) {
+				case fasthttp.HeaderContentLength, fasthttp.HeaderDate, fasthttp.HeaderConnection, fasthttp.HeaderTransferEncoding:
+					return
+				}
+				response.Headers = append(response.Headers, [2]string{string(name), string(value)})
+			})
+			store.Complete(storeKey, &response)
+
+			return nil
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// credentialsHash returns the hash of the Authorization header and the credentials passed by the request
+func credentialsHash(ctx *fasthttp.RequestCtx, credentials []Credential) [sha256.Size]byte {
+	h := sha256.New()
+	h.Write(ctx.Request.Header.Peek(fasthttp.HeaderAuthorization))
+
+	for _, credential := range credentials {
+		var value []byte
+		switch credential.In {
+		case "header":
+			value = ctx.Request.Header.Peek(credential.Name)
+		case "query":
+			value = ctx.QueryArgs().Peek(credential.Name)
+		case "cookie":
+			value = ctx.Request.Header.Cookie(credential.Name)
+		}
+
+		// the length prefix keeps the values of the different credentials apart
+		fmt.Fprintf(h, "\x00%s\x00%s\x00%d\x00", credential.In, credential.Name, len(value))
+		h.Write(value)
+	}
+
+	var sum [sha256.Size]byte
+	h.Sum(sum[:0])
+	return sum
+}
+
+func idempotencyLog(ctx *fasthttp.RequestCtx, operation string, logger *logrus.Logger) *logrus.Entry {
+	return logger.WithFields(logrus.Fields{
+		"request_id":     fmt.Sprintf("#%016X", ctx.ID()),
+		"operation":      operation,
+		"client_address": ctx.RemoteAddr(),
+	})
+}
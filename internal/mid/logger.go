@@ -6,6 +6,8 @@ import (
 
 	"github.com/sirupsen/logrus"
 	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/platform/tlsfp"
+	"github.com/wallarm/api-firewall/internal/platform/useragent"
 	"github.com/wallarm/api-firewall/internal/platform/web"
 )
 
@@ -22,14 +24,50 @@ func Logger(logger *logrus.Logger) web.Middleware {
 
 			err := before(ctx)
 
-			logger.WithFields(logrus.Fields{
+			fields := logrus.Fields{
 				"request_id":      fmt.Sprintf("#%016X", ctx.ID()),
 				"status_code":     ctx.Response.StatusCode(),
 				"method":          fmt.Sprintf("%s", ctx.Request.Header.Method()),
 				"path":            fmt.Sprintf("%s", ctx.Path()),
 				"client_address":  ctx.RemoteAddr(),
 				"processing_time": time.Since(start),
-			}).Debug("new request")
+			}
+
+			if verdict := web.GetVerdict(ctx); verdict != nil {
+				fields["verdict"] = verdict.Decision
+				if verdict.Operation != "" {
+					fields["operation"] = verdict.Operation
+				}
+				if verdict.Rule != "" {
+					fields["verdict_rule"] = verdict.Rule
+					fields["verdict_reason"] = verdict.Reason
+				}
+				fields["routing_time"] = verdict.RoutingTime
+				fields["request_validation_time"] = verdict.RequestValidationTime
+				fields["upstream_time"] = verdict.UpstreamTime
+				fields["response_validation_time"] = verdict.ResponseValidationTime
+			}
+
+			client := useragent.FromCtx(ctx)
+			fields["device"] = client.Device
+			if client.Browser != "" {
+				fields["browser"] = client.Browser
+				fields["browser_version"] = client.BrowserVersion
+			}
+			if client.OS != "" {
+				fields["os"] = client.OS
+			}
+
+			if state := ctx.TLSConnectionState(); state != nil && len(state.PeerCertificates) > 0 {
+				fields["client_cert_subject"] = state.PeerCertificates[0].Subject.String()
+			}
+
+			if fingerprint := tlsfp.FromConn(ctx.Conn()); fingerprint != nil {
+				fields["ja3"] = fingerprint.JA3Hash
+				fields["ja4"] = fingerprint.JA4
+			}
+
+			logger.WithFields(fields).Debug("new request")
 
 			// Return the error, so it can be handled further up the chain.
 			return err
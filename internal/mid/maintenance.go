@@ -0,0 +1,49 @@
+package mid
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/config"
+	"github.com/wallarm/api-firewall/internal/platform/maintenance"
+	"github.com/wallarm/api-firewall/internal/platform/web"
+)
+
+// Maintenance responds by the configured static response without proxying the request if the maintenance mode
+// is enabled globally or for one of the operation keys. The global maintenance mode is checked if no keys are passed
+func Maintenance(cfg *config.APIFWConfiguration, mode *maintenance.Mode, keys []string, logger *logrus.Logger) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(before web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx *fasthttp.RequestCtx) error {
+
+			if mode == nil || !mode.Active(keys...) {
+				return before(ctx)
+			}
+
+			logger.WithFields(logrus.Fields{
+				"request_id":     fmt.Sprintf("#%016X", ctx.ID()),
+				"method":         string(ctx.Method()),
+				"path":           string(ctx.Path()),
+				"client_address": ctx.RemoteAddr(),
+			}).Debug("request served in maintenance mode")
+
+			ctx.Response.Reset()
+			ctx.SetStatusCode(cfg.Maintenance.StatusCode)
+			for name, value := range cfg.Maintenance.Headers {
+				ctx.Response.Header.Set(name, value)
+			}
+			ctx.SetContentType(cfg.Maintenance.ContentType)
+			ctx.SetBodyString(cfg.Maintenance.Body)
+
+			return nil
+		}
+
+		return h
+	}
+
+	return m
+}
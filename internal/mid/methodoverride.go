@@ -0,0 +1,97 @@
+package mid
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/config"
+	"github.com/wallarm/api-firewall/internal/platform/web"
+)
+
+var overrideMethods = [][]byte{
+	[]byte(fasthttp.MethodGet),
+	[]byte(fasthttp.MethodHead),
+	[]byte(fasthttp.MethodPost),
+	[]byte(fasthttp.MethodPut),
+	[]byte(fasthttp.MethodPatch),
+	[]byte(fasthttp.MethodDelete),
+	[]byte(fasthttp.MethodOptions),
+}
+
+// MethodOverride handles the method override headers: the requests with these headers are passed as is, blocked or
+// the method is overridden before routing, so the effective method is validated and sent to the backend
+func MethodOverride(cfg *config.APIFWConfiguration, logger *logrus.Logger) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(before web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx *fasthttp.RequestCtx) error {
+
+			if cfg.MethodOverride.Policy == "" || cfg.MethodOverride.Policy == web.MethodOverrideAllow {
+				return before(ctx)
+			}
+
+			var method []byte
+			for _, name := range cfg.MethodOverride.Headers {
+				if value := ctx.Request.Header.Peek(name); len(value) > 0 {
+					if method != nil && !bytes.EqualFold(method, value) {
+						return blockMethodOverride(ctx, cfg, logger, "conflicting method override headers")
+					}
+					method = value
+				}
+			}
+
+			if method == nil {
+				return before(ctx)
+			}
+
+			if cfg.MethodOverride.Policy == web.MethodOverrideBlock {
+				return blockMethodOverride(ctx, cfg, logger, "method override header")
+			}
+
+			if !ctx.IsPost() {
+				return blockMethodOverride(ctx, cfg, logger, "method override in non-POST request")
+			}
+
+			method = bytes.ToUpper(bytes.TrimSpace(method))
+			supported := false
+			for _, m := range overrideMethods {
+				if bytes.Equal(method, m) {
+					supported = true
+					break
+				}
+			}
+			if !supported {
+				return blockMethodOverride(ctx, cfg, logger, fmt.Sprintf("unsupported override method %q", method))
+			}
+
+			ctx.Request.Header.SetMethodBytes(method)
+			for _, name := range cfg.MethodOverride.Headers {
+				ctx.Request.Header.Del(name)
+			}
+
+			err := before(ctx)
+
+			// Return the error, so it can be handled further up the chain.
+			return err
+		}
+
+		return h
+	}
+
+	return m
+}
+
+func blockMethodOverride(ctx *fasthttp.RequestCtx, cfg *config.APIFWConfiguration, logger *logrus.Logger, reason string) error {
+	logger.WithFields(logrus.Fields{
+		"request_id": fmt.Sprintf("#%016X", ctx.ID()),
+		"method":     string(ctx.Method()),
+		"path":       string(ctx.Path()),
+		"reason":     reason,
+	}).Error("request blocked")
+
+	return web.RespondError(ctx, cfg.CustomBlockStatusCode, nil)
+}
@@ -0,0 +1,111 @@
+package mid
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/savsgio/gotils/strconv"
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/config"
+	"github.com/wallarm/api-firewall/internal/platform/web"
+)
+
+// URINormalization detects the request URIs which could be decoded differently by APIFW and the backends:
+// double percent-encoding, invalid and overlong UTF-8 sequences, NUL bytes, backslashes and dot segments.
+// The path is decoded and normalized by fasthttp before routing, so such URIs are blocked instead of being rewritten.
+func URINormalization(cfg *config.APIFWConfiguration, logger *logrus.Logger) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(before web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx *fasthttp.RequestCtx) error {
+
+			if cfg.URINormalization.Mode == "" || cfg.URINormalization.Mode == web.ValidationDisable {
+				return before(ctx)
+			}
+
+			if reason := ambiguousURI(ctx.Request.Header.RequestURI()); reason != "" {
+				logger.WithFields(logrus.Fields{
+					"request_id": fmt.Sprintf("#%016X", ctx.ID()),
+					"uri":        strconv.B2S(ctx.Request.Header.RequestURI()),
+					"reason":     reason,
+				}).Error("ambiguous request URI")
+
+				if cfg.URINormalization.Mode == web.ValidationBlock {
+					return web.RespondError(ctx, cfg.CustomBlockStatusCode, nil)
+				}
+			}
+
+			err := before(ctx)
+
+			// Return the error, so it can be handled further up the chain.
+			return err
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// ambiguousURI returns the reason why the raw request URI is ambiguous or an empty string
+func ambiguousURI(rawURI []byte) string {
+	rawPath, rawQuery := rawURI, []byte(nil)
+	if i := bytes.IndexByte(rawURI, '?'); i >= 0 {
+		rawPath, rawQuery = rawURI[:i], rawURI[i+1:]
+	}
+
+	path, err := url.PathUnescape(strconv.B2S(rawPath))
+	if err != nil {
+		return "invalid percent-encoding in path"
+	}
+	if reason := ambiguousValue(path); reason != "" {
+		return reason + " in path"
+	}
+	if strings.ContainsRune(path, '\\') {
+		return "backslash in path"
+	}
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "." || segment == ".." {
+			return "dot segment in path"
+		}
+	}
+
+	for _, param := range bytes.Split(rawQuery, []byte("&")) {
+		value, err := url.QueryUnescape(strconv.B2S(param))
+		if err != nil {
+			return "invalid percent-encoding in query"
+		}
+		if reason := ambiguousValue(value); reason != "" {
+			return reason + " in query"
+		}
+	}
+
+	return ""
+}
+
+// ambiguousValue checks the value decoded once
+func ambiguousValue(value string) string {
+	if !utf8.ValidString(value) {
+		// overlong encodings are invalid UTF-8 sequences
+		return "invalid UTF-8 sequence"
+	}
+	if strings.IndexByte(value, 0) >= 0 {
+		return "NUL byte"
+	}
+	for i := 0; i+2 < len(value); i++ {
+		if value[i] == '%' && isHex(value[i+1]) && isHex(value[i+2]) {
+			return "double percent-encoding"
+		}
+	}
+	return ""
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
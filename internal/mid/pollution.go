@@ -0,0 +1,141 @@
+package mid
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/config"
+	"github.com/wallarm/api-firewall/internal/platform/web"
+)
+
+// ParameterPollution handles the query parameters and the urlencoded form fields passed several times:
+// the request is blocked or only the first or the last value of the parameter is kept, so APIFW and
+// the backend see the same value. The parameters documented as arrays are allowed to be repeated
+func ParameterPollution(cfg *config.APIFWConfiguration, multiValued map[string]struct{}, logger *logrus.Logger) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(before web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx *fasthttp.RequestCtx) error {
+
+			if cfg.ParameterPollution.Policy == "" || cfg.ParameterPollution.Policy == web.ParameterPollutionAllow {
+				return before(ctx)
+			}
+
+			queryName := duplicatedArg(ctx.QueryArgs(), multiValued)
+
+			var formName []byte
+			if bytes.HasPrefix(ctx.Request.Header.ContentType(), []byte("application/x-www-form-urlencoded")) {
+				formName = duplicatedArg(ctx.PostArgs(), multiValued)
+			}
+
+			if queryName == nil && formName == nil {
+				return before(ctx)
+			}
+
+			if cfg.ParameterPollution.Policy == web.ParameterPollutionBlock {
+				reason := fmt.Sprintf("duplicated query parameter %q", queryName)
+				if queryName == nil {
+					reason = fmt.Sprintf("duplicated form field %q", formName)
+				}
+
+				logger.WithFields(logrus.Fields{
+					"request_id": fmt.Sprintf("#%016X", ctx.ID()),
+					"method":     string(ctx.Method()),
+					"path":       string(ctx.Path()),
+					"reason":     reason,
+				}).Error("request blocked")
+
+				return web.RespondError(ctx, cfg.CustomBlockStatusCode, nil)
+			}
+
+			keepLast := cfg.ParameterPollution.Policy == web.ParameterPollutionKeepLast
+
+			if queryName != nil {
+				args := dedupArgs(ctx.QueryArgs(), multiValued, keepLast)
+
+				requestURI := ctx.Request.Header.RequestURI()
+				if i := bytes.IndexByte(requestURI, '?'); i >= 0 {
+					requestURI = requestURI[:i]
+				}
+				requestURI = append(append(append([]byte{}, requestURI...), '?'), args.QueryString()...)
+				ctx.Request.SetRequestURIBytes(requestURI)
+				fasthttp.ReleaseArgs(args)
+			}
+
+			if formName != nil {
+				args := dedupArgs(ctx.PostArgs(), multiValued, keepLast)
+				ctx.Request.SetBody(args.QueryString())
+				fasthttp.ReleaseArgs(args)
+			}
+
+			err := before(ctx)
+
+			// Return the error, so it can be handled further up the chain.
+			return err
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// duplicatedArg returns the name of the first argument passed several times which is not multi-valued
+func duplicatedArg(args *fasthttp.Args, multiValued map[string]struct{}) []byte {
+	if args.Len() < 2 {
+		return nil
+	}
+
+	var duplicated []byte
+	seen := make(map[string]struct{}, args.Len())
+	args.VisitAll(func(key, _ []byte) {
+		if duplicated != nil {
+			return
+		}
+		if _, ok := multiValued[string(key)]; ok {
+			return
+		}
+		if _, ok := seen[string(key)]; ok {
+			duplicated = append([]byte{}, key...)
+			return
+		}
+		seen[string(key)] = struct{}{}
+	})
+
+	return duplicated
+}
+
+// dedupArgs returns the arguments with the first or the last value of each argument which is not multi-valued.
+// The order of the arguments is kept. The returned arguments should be released by fasthttp.ReleaseArgs
+func dedupArgs(args *fasthttp.Args, multiValued map[string]struct{}, keepLast bool) *fasthttp.Args {
+	last := make(map[string]int, args.Len())
+	i := 0
+	args.VisitAll(func(key, _ []byte) {
+		last[string(key)] = i
+		i++
+	})
+
+	result := fasthttp.AcquireArgs()
+	seen := make(map[string]struct{}, args.Len())
+	i = 0
+	args.VisitAll(func(key, value []byte) {
+		defer func() { i++ }()
+
+		if _, ok := multiValued[string(key)]; !ok {
+			if keepLast && last[string(key)] != i {
+				return
+			}
+			if _, ok := seen[string(key)]; ok && !keepLast {
+				return
+			}
+			seen[string(key)] = struct{}{}
+		}
+		result.AddBytesKV(key, value)
+	})
+
+	return result
+}
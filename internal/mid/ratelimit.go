@@ -0,0 +1,47 @@
+package mid
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/platform/ratelimit"
+	"github.com/wallarm/api-firewall/internal/platform/web"
+)
+
+// RateLimit throttles the requests of the operation by the limiter. The throttled requests
+// are responded by 429 status code with the Retry-After header
+func RateLimit(operation string, limiter *ratelimit.Limiter, logger *logrus.Logger) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(before web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx *fasthttp.RequestCtx) error {
+
+			if !limiter.Allow(ctx.RemoteIP().String()) {
+				logger.WithFields(logrus.Fields{
+					"request_id":     fmt.Sprintf("#%016X", ctx.ID()),
+					"operation":      operation,
+					"client_address": ctx.RemoteAddr(),
+				}).Info("request blocked: rate limit exceeded")
+
+				err := web.RespondError(ctx, fasthttp.StatusTooManyRequests, nil)
+				// the retry period depends on the limit scaled by the schedule
+				ctx.Response.Header.Set(fasthttp.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(limiter.RetryAfter().Seconds()))))
+				return err
+			}
+
+			err := before(ctx)
+
+			// Return the error, so it can be handled further up the chain.
+			return err
+		}
+
+		return h
+	}
+
+	return m
+}
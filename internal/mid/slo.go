@@ -0,0 +1,56 @@
+package mid
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/platform/slo"
+	"github.com/wallarm/api-firewall/internal/platform/web"
+)
+
+// UpstreamSLO tracks the upstream response times of the operation by the objective. The requests which are not
+// proxied to the upstream are not tracked, the validation result doesn't affect the tracking
+func UpstreamSLO(operation string, tracker *slo.Tracker, logger *logrus.Logger) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(before web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx *fasthttp.RequestCtx) error {
+
+			err := before(ctx)
+
+			verdict := web.GetVerdict(ctx)
+			if verdict == nil || verdict.UpstreamTime == 0 {
+				return err
+			}
+
+			slow, alert := tracker.Observe(verdict.UpstreamTime)
+			if slow {
+				logger.WithFields(logrus.Fields{
+					"request_id":    fmt.Sprintf("#%016X", ctx.ID()),
+					"operation":     operation,
+					"upstream_time": verdict.UpstreamTime,
+				}).Debug("upstream response time exceeds the SLO threshold")
+			}
+
+			if alert != nil {
+				logger.WithFields(logrus.Fields{
+					"operation":  alert.Operation,
+					"threshold":  alert.Threshold,
+					"objective":  alert.Objective,
+					"compliance": alert.Compliance(),
+					"requests":   alert.Requests,
+					"slow":       alert.Slow,
+				}).Warning("upstream response time SLO is violated")
+			}
+
+			return err
+		}
+
+		return h
+	}
+
+	return m
+}
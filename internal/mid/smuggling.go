@@ -0,0 +1,114 @@
+package mid
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/config"
+	"github.com/wallarm/api-firewall/internal/platform/web"
+)
+
+// headers which must not be repeated in the request
+var singleHeaders = [][]byte{
+	[]byte(fasthttp.HeaderContentLength),
+	[]byte(fasthttp.HeaderTransferEncoding),
+	[]byte(fasthttp.HeaderHost),
+}
+
+// RequestSmuggling rejects the requests which could be parsed differently by APIFW and the backend:
+// conflicting Transfer-Encoding and Content-Length headers, duplicated critical headers and obs-fold header values
+func RequestSmuggling(cfg *config.APIFWConfiguration, logger *logrus.Logger) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(before web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx *fasthttp.RequestCtx) error {
+
+			if cfg.RequestSmuggling.Mode == "" || cfg.RequestSmuggling.Mode == web.ValidationDisable {
+				return before(ctx)
+			}
+
+			if reason := ambiguousHeaders(ctx.Request.Header.RawHeaders()); reason != "" {
+				logger.WithFields(logrus.Fields{
+					"request_id":     fmt.Sprintf("#%016X", ctx.ID()),
+					"client_address": ctx.RemoteAddr(),
+					"reason":         reason,
+				}).Error("request smuggling attempt")
+
+				if cfg.RequestSmuggling.Mode == web.ValidationBlock {
+					// the rest of the connection can't be trusted
+					ctx.SetConnectionClose()
+					return web.RespondError(ctx, fasthttp.StatusBadRequest, nil)
+				}
+			}
+
+			err := before(ctx)
+
+			// Return the error, so it can be handled further up the chain.
+			return err
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// ambiguousHeaders returns the reason why the raw request headers are ambiguous or an empty string
+func ambiguousHeaders(rawHeaders []byte) string {
+	counts := make(map[string]int, len(singleHeaders))
+	var transferEncoding []byte
+
+	for _, line := range bytes.Split(rawHeaders, []byte("\n")) {
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		if len(line) == 0 {
+			continue
+		}
+
+		if line[0] == ' ' || line[0] == '\t' {
+			return "obs-fold header value"
+		}
+
+		i := bytes.IndexByte(line, ':')
+		if i <= 0 {
+			return "invalid header line"
+		}
+
+		name, value := line[:i], bytes.TrimSpace(line[i+1:])
+		if bytes.ContainsAny(name, " \t") {
+			return fmt.Sprintf("whitespace in header name %q", name)
+		}
+
+		for _, h := range singleHeaders {
+			if bytes.EqualFold(name, h) {
+				counts[string(h)]++
+				if counts[string(h)] > 1 {
+					return fmt.Sprintf("duplicate %s header", h)
+				}
+			}
+		}
+
+		switch {
+		case bytes.EqualFold(name, []byte(fasthttp.HeaderContentLength)):
+			if len(value) == 0 || len(bytes.Trim(value, "0123456789")) > 0 {
+				return fmt.Sprintf("invalid %s header", fasthttp.HeaderContentLength)
+			}
+		case bytes.EqualFold(name, []byte(fasthttp.HeaderTransferEncoding)):
+			transferEncoding = value
+		}
+	}
+
+	if counts[fasthttp.HeaderTransferEncoding] > 0 {
+		if counts[fasthttp.HeaderContentLength] > 0 {
+			return fmt.Sprintf("both %s and %s headers", fasthttp.HeaderTransferEncoding, fasthttp.HeaderContentLength)
+		}
+		if !bytes.EqualFold(transferEncoding, []byte("chunked")) {
+			return fmt.Sprintf("unsupported %s header", fasthttp.HeaderTransferEncoding)
+		}
+	}
+
+	return ""
+}
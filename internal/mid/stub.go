@@ -0,0 +1,49 @@
+package mid
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/platform/web"
+)
+
+// StubResponse is the static response served by APIFW instead of the upstream
+type StubResponse struct {
+	StatusCode  int
+	ContentType string
+	Headers     map[string]string
+	Body        []byte
+}
+
+// Stub responds by the static response without proxying the request to the upstream
+func Stub(operation string, stub StubResponse, logger *logrus.Logger) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(before web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx *fasthttp.RequestCtx) error {
+
+			logger.WithFields(logrus.Fields{
+				"request_id": fmt.Sprintf("#%016X", ctx.ID()),
+				"operation":  operation,
+			}).Debug("request served by stub")
+
+			ctx.SetStatusCode(stub.StatusCode)
+			for name, value := range stub.Headers {
+				ctx.Response.Header.Set(name, value)
+			}
+			if stub.ContentType != "" {
+				ctx.SetContentType(stub.ContentType)
+			}
+			ctx.SetBody(stub.Body)
+
+			return nil
+		}
+
+		return h
+	}
+
+	return m
+}
@@ -0,0 +1,84 @@
+package mid
+
+import (
+	"bufio"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/config"
+	"github.com/wallarm/api-firewall/internal/platform/web"
+)
+
+// tarpit slows down the flagged client: the response is delayed and then the body is sent by small chunks.
+// The request is blocked immediately if the number of the tarpitted requests reaches the limit
+type tarpit struct {
+	cfg    *config.APIFWConfiguration
+	logger *logrus.Logger
+	slots  chan struct{}
+}
+
+func newTarpit(cfg *config.APIFWConfiguration, logger *logrus.Logger) *tarpit {
+	if !cfg.Tarpit.Enabled {
+		return nil
+	}
+
+	return &tarpit{
+		cfg:    cfg,
+		logger: logger,
+		slots:  make(chan struct{}, cfg.Tarpit.MaxConcurrent),
+	}
+}
+
+// block responds by the block status code. The response is slowed down if the tarpit mode is enabled
+func (t *tarpit) block(ctx *fasthttp.RequestCtx, statusCode int) error {
+
+	if t == nil {
+		return web.RespondError(ctx, statusCode, nil)
+	}
+
+	select {
+	case t.slots <- struct{}{}:
+	default:
+		return web.RespondError(ctx, statusCode, nil)
+	}
+
+	t.logger.WithFields(logrus.Fields{
+		"request_id":     fmt.Sprintf("#%016X", ctx.ID()),
+		"client_address": ctx.RemoteAddr(),
+	}).Debug("request tarpitted")
+
+	time.Sleep(t.cfg.Tarpit.Delay)
+
+	body := []byte(t.cfg.Tarpit.Body)
+	chunkSize := t.cfg.Tarpit.DribbleBytes
+	if chunkSize <= 0 {
+		chunkSize = 1
+	}
+
+	ctx.Response.Reset()
+	ctx.SetStatusCode(statusCode)
+	ctx.SetContentType("text/plain; charset=utf-8")
+	ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer func() { <-t.slots }()
+
+		for start := 0; start < len(body); start += chunkSize {
+			end := start + chunkSize
+			if end > len(body) {
+				end = len(body)
+			}
+			if _, err := w.Write(body[start:end]); err != nil {
+				return
+			}
+			if err := w.Flush(); err != nil {
+				return
+			}
+			if end < len(body) {
+				time.Sleep(t.cfg.Tarpit.DribbleInterval)
+			}
+		}
+	})
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package mid
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/config"
+	"github.com/wallarm/api-firewall/internal/platform/tlsfp"
+	"github.com/wallarm/api-firewall/internal/platform/web"
+)
+
+// TLSFingerprint blocks the requests of the connections with the denied JA3 or JA4 fingerprints
+// and passes the fingerprints to the upstream
+func TLSFingerprint(cfg *config.APIFWConfiguration, logger *logrus.Logger) web.Middleware {
+
+	denied := make(map[string]struct{}, len(cfg.TLS.Fingerprint.Deny))
+	for _, fingerprint := range cfg.TLS.Fingerprint.Deny {
+		denied[fingerprint] = struct{}{}
+	}
+
+	// This is the actual middleware function to be executed.
+	m := func(before web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx *fasthttp.RequestCtx) error {
+
+			if !cfg.TLS.Fingerprint.Enabled {
+				return before(ctx)
+			}
+
+			// remove the headers sent by the client
+			for _, header := range []string{cfg.TLS.Fingerprint.JA3Header, cfg.TLS.Fingerprint.JA4Header} {
+				if header != "" {
+					ctx.Request.Header.Del(header)
+				}
+			}
+
+			fingerprint := tlsfp.FromConn(ctx.Conn())
+			if fingerprint == nil {
+				return before(ctx)
+			}
+
+			_, ja3Denied := denied[fingerprint.JA3Hash]
+			_, ja4Denied := denied[fingerprint.JA4]
+			if ja3Denied || ja4Denied {
+				logger.WithFields(logrus.Fields{
+					"request_id":     fmt.Sprintf("#%016X", ctx.ID()),
+					"client_address": ctx.RemoteAddr(),
+					"ja3":            fingerprint.JA3Hash,
+					"ja4":            fingerprint.JA4,
+				}).Error("request blocked: TLS fingerprint is denied")
+				return web.RespondError(ctx, cfg.CustomBlockStatusCode, nil)
+			}
+
+			if cfg.TLS.Fingerprint.JA3Header != "" {
+				ctx.Request.Header.Set(cfg.TLS.Fingerprint.JA3Header, fingerprint.JA3Hash)
+			}
+			if cfg.TLS.Fingerprint.JA4Header != "" {
+				ctx.Request.Header.Set(cfg.TLS.Fingerprint.JA4Header, fingerprint.JA4)
+			}
+
+			return before(ctx)
+		}
+
+		return h
+	}
+
+	return m
+}
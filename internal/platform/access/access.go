@@ -0,0 +1,130 @@
+package access
+
+import (
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	fieldScopes   = "scopes"
+	fieldNetworks = "networks"
+)
+
+// Policy is the access control of the operations with the tag. The token has to contain
+// all scopes and the client address has to be in one of the networks
+type Policy struct {
+	Tag      string
+	Scopes   []string
+	Networks []*net.IPNet
+}
+
+// ParsePolicy parses the policy in the "TAG [scopes=SCOPE,...] [networks=CIDR,...]" format.
+// The single address is accepted as the network with the one address
+func ParsePolicy(value string) (Policy, error) {
+
+	fields := strings.Fields(value)
+	if len(fields) < 2 {
+		return Policy{}, errors.Errorf("tag policy %q: the tag and at least one of scopes and networks are required", value)
+	}
+
+	policy := Policy{Tag: fields[0]}
+
+	for _, field := range fields[1:] {
+		name, list, ok := strings.Cut(field, "=")
+		if !ok || list == "" {
+			return Policy{}, errors.Errorf("tag policy %q: invalid field %q", value, field)
+		}
+
+		switch strings.ToLower(name) {
+		case fieldScopes:
+			policy.Scopes = append(policy.Scopes, strings.Split(list, ",")...)
+		case fieldNetworks:
+			for _, network := range strings.Split(list, ",") {
+				ipNet, err := parseNetwork(network)
+				if err != nil {
+					return Policy{}, errors.Wrapf(err, "tag policy %q", value)
+				}
+				policy.Networks = append(policy.Networks, ipNet)
+			}
+		default:
+			return Policy{}, errors.Errorf("tag policy %q: unknown field %q", value, name)
+		}
+	}
+
+	return policy, nil
+}
+
+// ParsePolicies parses the policies keyed by the tags. The policies of the same tag are merged
+func ParsePolicies(values []string) (map[string]Policy, error) {
+
+	policies := make(map[string]Policy, len(values))
+
+	for _, value := range values {
+		policy, err := ParsePolicy(value)
+		if err != nil {
+			return nil, err
+		}
+
+		if existing, ok := policies[policy.Tag]; ok {
+			policy.Scopes = append(existing.Scopes, policy.Scopes...)
+			policy.Networks = append(existing.Networks, policy.Networks...)
+		}
+		policies[policy.Tag] = policy
+	}
+
+	return policies, nil
+}
+
+// Operation returns the policies of the operation tags
+func Operation(policies map[string]Policy, tags []string) []Policy {
+
+	var operationPolicies []Policy
+
+	for _, tag := range tags {
+		if policy, ok := policies[tag]; ok {
+			operationPolicies = append(operationPolicies, policy)
+		}
+	}
+
+	return operationPolicies
+}
+
+// AllowsAddress returns true if the policy doesn't restrict the networks or the address is in one of them
+func (p Policy) AllowsAddress(ip net.IP) bool {
+
+	if len(p.Networks) == 0 {
+		return true
+	}
+
+	for _, network := range p.Networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseNetwork(value string) (*net.IPNet, error) {
+
+	if !strings.Contains(value, "/") {
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return nil, errors.Errorf("invalid network %q", value)
+		}
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+
+	_, ipNet, err := net.ParseCIDR(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return ipNet, nil
+}
@@ -0,0 +1,255 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/config"
+	"github.com/wallarm/api-firewall/internal/platform/geoip"
+	"github.com/wallarm/api-firewall/internal/platform/useragent"
+	"github.com/wallarm/api-firewall/internal/platform/web"
+)
+
+// Event is the sanitized copy of the request with the verdict, the location and the parsed User-Agent of the client
+type Event struct {
+	RequestID     string              `json:"request_id"`
+	Time          time.Time           `json:"time"`
+	ClientAddress string              `json:"client_address"`
+	Method        string              `json:"method"`
+	URI           string              `json:"uri"`
+	Headers       map[string][]string `json:"headers"`
+	Body          []byte              `json:"body"`
+	Truncated     bool                `json:"truncated"`
+	StatusCode    int                 `json:"status_code"`
+	Verdict       web.Verdict         `json:"verdict"`
+	Location      geoip.Location      `json:"location"`
+	Client        useragent.Client    `json:"client"`
+}
+
+// Stats are the numbers of the forwarded events. The events are dropped when the queue is full
+// and failed when the batch is not accepted by the endpoint after the retries
+type Stats struct {
+	Queued    int64 `json:"queued"`
+	Forwarded int64 `json:"forwarded"`
+	Dropped   int64 `json:"dropped"`
+	Failed    int64 `json:"failed"`
+	Batches   int64 `json:"batches"`
+}
+
+// Forwarder sends the events to the analysis endpoint in the background
+type Forwarder struct {
+	mu        sync.RWMutex
+	cfg       *config.Analyzer
+	logger    *logrus.Logger
+	client    *fasthttp.Client
+	decisions map[string]struct{}
+	redact    map[string]struct{}
+	queue     chan Event
+	done      chan struct{}
+
+	stats Stats
+}
+
+// Default is the forwarder of the requests of all handlers. The requests are not forwarded until
+// the forwarder is started
+var Default = &Forwarder{}
+
+// Start starts forwarding the events to the analysis endpoint. The started forwarder should be stopped
+func (f *Forwarder) Start(cfg *config.Analyzer, logger *logrus.Logger) error {
+
+	if _, err := url.ParseRequestURI(cfg.URL); err != nil {
+		return fmt.Errorf("analyzer url: %w", err)
+	}
+
+	decisions := make(map[string]struct{}, len(cfg.Decisions))
+	for _, decision := range cfg.Decisions {
+		decisions[strings.ToLower(decision)] = struct{}{}
+	}
+
+	redact := make(map[string]struct{}, len(cfg.RedactHeaders))
+	for _, header := range cfg.RedactHeaders {
+		redact[strings.ToLower(header)] = struct{}{}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.cfg = cfg
+	f.logger = logger
+	f.client = &fasthttp.Client{ReadTimeout: cfg.Timeout, WriteTimeout: cfg.Timeout, NoDefaultUserAgentHeader: true}
+	f.decisions = decisions
+	f.redact = redact
+	f.queue = make(chan Event, cfg.QueueSize)
+	f.done = make(chan struct{})
+
+	go f.run(f.queue, f.done)
+
+	return nil
+}
+
+// Stop sends the queued events and stops the forwarder
+func (f *Forwarder) Stop() {
+	f.mu.Lock()
+	queue, done := f.queue, f.done
+	f.queue = nil
+	f.mu.Unlock()
+
+	if queue == nil {
+		return
+	}
+
+	close(queue)
+	<-done
+}
+
+// Stats returns the numbers of the forwarded events
+func (f *Forwarder) Stats() Stats {
+	return Stats{
+		Queued:    atomic.LoadInt64(&f.stats.Queued),
+		Forwarded: atomic.LoadInt64(&f.stats.Forwarded),
+		Dropped:   atomic.LoadInt64(&f.stats.Dropped),
+		Failed:    atomic.LoadInt64(&f.stats.Failed),
+		Batches:   atomic.LoadInt64(&f.stats.Batches),
+	}
+}
+
+// Forward queues the copy of the handled request if the decision of the verdict is forwarded.
+// The copy is dropped if the queue is full
+func (f *Forwarder) Forward(ctx *fasthttp.RequestCtx) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.queue == nil {
+		return
+	}
+
+	verdict := web.GetVerdict(ctx)
+	if verdict == nil {
+		return
+	}
+	if _, ok := f.decisions[verdict.Decision]; !ok {
+		return
+	}
+
+	event := Event{
+		RequestID:     fmt.Sprintf("#%016X", ctx.ID()),
+		Time:          ctx.Time(),
+		ClientAddress: ctx.RemoteIP().String(),
+		Method:        string(ctx.Method()),
+		URI:           string(ctx.RequestURI()),
+		Headers:       make(map[string][]string),
+		StatusCode:    ctx.Response.StatusCode(),
+		Verdict:       *verdict,
+		Location:      geoip.Default.Lookup(ctx.RemoteIP()),
+		Client:        useragent.FromCtx(ctx),
+	}
+
+	ctx.Request.Header.VisitAll(func(k, v []byte) {
+		name := string(k)
+		if _, ok := f.redact[strings.ToLower(name)]; ok {
+			return
+		}
+		event.Headers[name] = append(event.Headers[name], string(v))
+	})
+
+	body := ctx.Request.Body()
+	if len(body) > f.cfg.MaxBodySize {
+		body = body[:f.cfg.MaxBodySize]
+		event.Truncated = true
+	}
+	event.Body = append([]byte(nil), body...)
+
+	select {
+	case f.queue <- event:
+		atomic.AddInt64(&f.stats.Queued, 1)
+	default:
+		atomic.AddInt64(&f.stats.Dropped, 1)
+	}
+}
+
+// run collects the events into the batches. The batch is sent when it is full or after the flush interval
+func (f *Forwarder) run(queue chan Event, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(f.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Event, 0, f.cfg.BatchSize)
+	for {
+		select {
+		case event, ok := <-queue:
+			if !ok {
+				f.send(batch)
+				return
+			}
+			batch = append(batch, event)
+			if len(batch) >= f.cfg.BatchSize {
+				f.send(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			f.send(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// send posts the batch to the endpoint. The batch is retried with the exponential backoff. The events
+// are queued while the batch is sent, so the events over the queue size are dropped by the slow endpoint
+func (f *Forwarder) send(batch []Event) {
+	if len(batch) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(batch)
+	if err != nil {
+		atomic.AddInt64(&f.stats.Failed, int64(len(batch)))
+		f.logger.WithFields(logrus.Fields{"error": err}).Error("analyzer: encoding events")
+		return
+	}
+
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	res := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(res)
+
+	backoff := 100 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		req.SetRequestURI(f.cfg.URL)
+		req.Header.SetMethod(fasthttp.MethodPost)
+		req.Header.SetContentType("application/json")
+		if f.cfg.Token != "" {
+			req.Header.Set(fasthttp.HeaderAuthorization, "Bearer "+f.cfg.Token)
+		}
+		req.SetBody(body)
+
+		err = f.client.DoTimeout(req, res, f.cfg.Timeout)
+		if err == nil && res.StatusCode() < fasthttp.StatusMultipleChoices {
+			atomic.AddInt64(&f.stats.Forwarded, int64(len(batch)))
+			atomic.AddInt64(&f.stats.Batches, 1)
+			return
+		}
+		if err == nil {
+			err = fmt.Errorf("unexpected status code %d", res.StatusCode())
+		}
+
+		if attempt >= f.cfg.MaxRetries {
+			break
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	atomic.AddInt64(&f.stats.Failed, int64(len(batch)))
+	f.logger.WithFields(logrus.Fields{
+		"error":  err,
+		"events": len(batch),
+	}).Error("analyzer: forwarding events")
+}
@@ -0,0 +1,206 @@
+package backendauth
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/config"
+)
+
+const (
+	TypeNone   = "NONE"
+	TypeBearer = "BEARER"
+	TypeBasic  = "BASIC"
+)
+
+// Credentials are the credentials of the firewall toward the upstream. The secrets read from the files
+// are reloaded after the refresh interval if the files have been changed and the malformed files
+// don't replace the loaded credentials
+type Credentials struct {
+	cfg    *config.BackendAuth
+	logger *logrus.Logger
+
+	name string
+
+	mu          sync.RWMutex
+	header      string
+	certificate *tls.Certificate
+	modTimes    map[string]time.Time
+	checkedAt   time.Time
+}
+
+// New loads the credentials. It returns nil if the backend authentication is not configured
+func New(cfg *config.BackendAuth, logger *logrus.Logger) (*Credentials, error) {
+
+	if (cfg.Type == "" || cfg.Type == TypeNone) && cfg.ClientCert == "" {
+		return nil, nil
+	}
+
+	if (cfg.ClientCert == "") != (cfg.ClientKey == "") {
+		return nil, errors.New("backend auth: both client certificate and key should be set")
+	}
+
+	c := Credentials{
+		cfg:       cfg,
+		logger:    logger,
+		name:      cfg.Header,
+		modTimes:  make(map[string]time.Time),
+		checkedAt: time.Now(),
+	}
+
+	if c.name == "" {
+		c.name = fasthttp.HeaderAuthorization
+	}
+
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// secret returns the value or the trimmed content of the file if the file is set
+func secret(value, file string) (string, error) {
+	if file == "" {
+		return value, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", errors.Wrap(err, "backend auth: reading secret")
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// modified returns true if one of the files has been changed since the last load
+func (c *Credentials) modified() (bool, map[string]time.Time, error) {
+
+	modTimes := make(map[string]time.Time)
+	for _, file := range []string{c.cfg.TokenFile, c.cfg.PasswordFile, c.cfg.ClientCert, c.cfg.ClientKey} {
+		if file == "" {
+			continue
+		}
+		fi, err := os.Stat(file)
+		if err != nil {
+			return false, nil, errors.Wrap(err, "backend auth")
+		}
+		modTimes[file] = fi.ModTime()
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if len(modTimes) != len(c.modTimes) || c.header == "" && c.certificate == nil {
+		return true, modTimes, nil
+	}
+	for file, modTime := range modTimes {
+		if !modTime.Equal(c.modTimes[file]) {
+			return true, modTimes, nil
+		}
+	}
+
+	return false, modTimes, nil
+}
+
+// load reads the secrets if the files have been changed since the last load
+func (c *Credentials) load() error {
+
+	modified, modTimes, err := c.modified()
+	if err != nil || !modified {
+		return err
+	}
+
+	var header string
+
+	switch c.cfg.Type {
+	case TypeBearer:
+		token, err := secret(c.cfg.Token, c.cfg.TokenFile)
+		if err != nil {
+			return err
+		}
+		if token == "" {
+			return errors.New("backend auth: empty bearer token")
+		}
+		header = "Bearer " + token
+	case TypeBasic:
+		password, err := secret(c.cfg.Password, c.cfg.PasswordFile)
+		if err != nil {
+			return err
+		}
+		if c.cfg.Username == "" {
+			return errors.New("backend auth: empty basic auth username")
+		}
+		header = "Basic " + base64.StdEncoding.EncodeToString([]byte(c.cfg.Username+":"+password))
+	}
+
+	var certificate *tls.Certificate
+	if c.cfg.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(c.cfg.ClientCert, c.cfg.ClientKey)
+		if err != nil {
+			return errors.Wrap(err, "backend auth: loading client certificate")
+		}
+		certificate = &cert
+	}
+
+	c.mu.Lock()
+	c.header = header
+	c.certificate = certificate
+	c.modTimes = modTimes
+	c.mu.Unlock()
+
+	return nil
+}
+
+// refresh reloads the changed files if the refresh interval passed
+func (c *Credentials) refresh() {
+
+	c.mu.Lock()
+	refresh := c.cfg.RefreshInterval > 0 && time.Since(c.checkedAt) > c.cfg.RefreshInterval
+	if refresh {
+		c.checkedAt = time.Now()
+	}
+	c.mu.Unlock()
+
+	if refresh {
+		if err := c.load(); err != nil {
+			c.logger.Errorf("%s: the loaded credentials are kept", err)
+		}
+	}
+}
+
+// Apply sets the authorization header of the request to the upstream. The header sent by the client is replaced
+func (c *Credentials) Apply(req *fasthttp.Request) {
+
+	c.refresh()
+
+	c.mu.RLock()
+	header := c.header
+	c.mu.RUnlock()
+
+	if header != "" {
+		req.Header.Set(c.name, header)
+	}
+}
+
+// ClientCertificate returns the client certificate presented to the upstream in the TLS handshake
+func (c *Credentials) ClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+
+	c.refresh()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.certificate == nil {
+		return &tls.Certificate{}, nil
+	}
+
+	return c.certificate, nil
+}
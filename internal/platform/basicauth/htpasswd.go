@@ -0,0 +1,196 @@
+package basicauth
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	apr1Prefix = "$apr1$"
+	shaPrefix  = "{SHA}"
+	itoa64     = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+)
+
+var errInvalidCredentials = errors.New("invalid basic auth credentials")
+
+// Authenticator verifies the credentials of the basic authentication
+type Authenticator interface {
+	Authenticate(ctx context.Context, username, password string) error
+}
+
+// Unavailable rejects all credentials. It is used if the configured users can't be loaded, so the basic
+// authentication doesn't fall back to the check of the header only
+type Unavailable struct {
+	Err error
+}
+
+// Authenticate returns the error of loading the users
+func (u Unavailable) Authenticate(ctx context.Context, username, password string) error {
+	return errors.Wrap(u.Err, "basic auth users unavailable")
+}
+
+// Htpasswd verifies credentials using the users from the htpasswd file.
+// Supported hash formats: bcrypt, apr1 (Apache MD5) and SHA1.
+type Htpasswd struct {
+	Logger *logrus.Logger
+	users  map[string]string
+}
+
+// NewHtpasswd loads the users from the htpasswd file. The file with the malformed entries or the password hashes
+// of the unsupported formats isn't loaded, so the users aren't rejected silently
+func NewHtpasswd(fileName string, logger *logrus.Logger) (*Htpasswd, error) {
+
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	users := make(map[string]string)
+
+	s := bufio.NewScanner(f)
+	for lineNum := 1; s.Scan(); lineNum++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		user, hash, found := strings.Cut(line, ":")
+		if !found || user == "" {
+			return nil, errors.Errorf("htpasswd line %d: invalid entry", lineNum)
+		}
+		if !supportedHash(hash) {
+			return nil, errors.Errorf("htpasswd line %d: unsupported password hash of the user %s", lineNum, user)
+		}
+
+		users[user] = hash
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	logger.Debugf("Basic auth: loaded %d users from the htpasswd file", len(users))
+
+	return &Htpasswd{Logger: logger, users: users}, nil
+}
+
+// Authenticate checks the password of the user
+func (h *Htpasswd) Authenticate(ctx context.Context, username, password string) error {
+
+	hash, found := h.users[username]
+	if !found {
+		return errInvalidCredentials
+	}
+
+	if !matchPassword(hash, password) {
+		return errInvalidCredentials
+	}
+
+	return nil
+}
+
+// supportedHash returns true if the password hash is in the bcrypt, apr1 or SHA1 format
+func supportedHash(hash string) bool {
+	return strings.HasPrefix(hash, "$2") || strings.HasPrefix(hash, apr1Prefix) || strings.HasPrefix(hash, shaPrefix)
+}
+
+func matchPassword(hash, password string) bool {
+	switch {
+	case strings.HasPrefix(hash, "$2"):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	case strings.HasPrefix(hash, apr1Prefix):
+		salt, _, _ := strings.Cut(strings.TrimPrefix(hash, apr1Prefix), "$")
+		return subtle.ConstantTimeCompare([]byte(hash), []byte(apr1(password, salt))) == 1
+	case strings.HasPrefix(hash, shaPrefix):
+		sum := sha1.Sum([]byte(password))
+		return subtle.ConstantTimeCompare([]byte(hash), []byte(shaPrefix+base64.StdEncoding.EncodeToString(sum[:]))) == 1
+	}
+
+	// plain text passwords are not supported
+	return false
+}
+
+// apr1 returns the Apache variant of the MD5-based crypt hash
+func apr1(password, salt string) string {
+	pw := []byte(password)
+	s := []byte(salt)
+	if len(s) > 8 {
+		s = s[:8]
+	}
+
+	d := md5.New()
+	d.Write(pw)
+	d.Write([]byte(apr1Prefix))
+	d.Write(s)
+
+	d2 := md5.New()
+	d2.Write(pw)
+	d2.Write(s)
+	d2.Write(pw)
+	final := d2.Sum(nil)
+
+	for i := len(pw); i > 0; i -= 16 {
+		n := i
+		if n > 16 {
+			n = 16
+		}
+		d.Write(final[:n])
+	}
+
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			d.Write([]byte{0})
+		} else {
+			d.Write(pw[:1])
+		}
+	}
+	final = d.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		d := md5.New()
+		if i&1 != 0 {
+			d.Write(pw)
+		} else {
+			d.Write(final)
+		}
+		if i%3 != 0 {
+			d.Write(s)
+		}
+		if i%7 != 0 {
+			d.Write(pw)
+		}
+		if i&1 != 0 {
+			d.Write(final)
+		} else {
+			d.Write(pw)
+		}
+		final = d.Sum(nil)
+	}
+
+	var out []byte
+	to64 := func(v uint32, n int) {
+		for ; n > 0; n-- {
+			out = append(out, itoa64[v&0x3f])
+			v >>= 6
+		}
+	}
+
+	to64(uint32(final[0])<<16|uint32(final[6])<<8|uint32(final[12]), 4)
+	to64(uint32(final[1])<<16|uint32(final[7])<<8|uint32(final[13]), 4)
+	to64(uint32(final[2])<<16|uint32(final[8])<<8|uint32(final[14]), 4)
+	to64(uint32(final[3])<<16|uint32(final[9])<<8|uint32(final[15]), 4)
+	to64(uint32(final[4])<<16|uint32(final[10])<<8|uint32(final[5]), 4)
+	to64(uint32(final[11]), 2)
+
+	return apr1Prefix + string(s) + "$" + string(out)
+}
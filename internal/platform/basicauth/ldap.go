@@ -0,0 +1,101 @@
+package basicauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/karlseguin/ccache/v2"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/wallarm/api-firewall/internal/config"
+)
+
+// LDAP verifies credentials by binding to the LDAP (Active Directory) server as the user.
+// The user DN is found by the search with the service account using the user and group filters.
+type LDAP struct {
+	Cfg    *config.LDAP
+	Logger *logrus.Logger
+	Cache  *ccache.Cache
+}
+
+func NewLDAP(cfg *config.LDAP, logger *logrus.Logger) *LDAP {
+	return &LDAP{
+		Cfg:    cfg,
+		Logger: logger,
+		Cache:  ccache.New(ccache.Configure()),
+	}
+}
+
+// Authenticate binds to the LDAP server using the user credentials. Successful
+// authentications are cached for the configured time.
+func (l *LDAP) Authenticate(ctx context.Context, username, password string) error {
+
+	// empty password leads to the unauthenticated bind that always succeeds
+	if username == "" || password == "" {
+		return errInvalidCredentials
+	}
+
+	passwordHash := sha256.Sum256([]byte(username + ":" + password))
+	cacheKey := hex.EncodeToString(passwordHash[:])
+
+	if item := l.Cache.Get(cacheKey); item != nil && !item.Expired() {
+		return nil
+	}
+
+	conn, err := ldap.DialURL(l.Cfg.URL, ldap.DialWithTLSConfig(&tls.Config{InsecureSkipVerify: l.Cfg.InsecureConnection}))
+	if err != nil {
+		return errors.Wrap(err, "ldap connection")
+	}
+	defer conn.Close()
+
+	conn.SetTimeout(l.Cfg.Timeout)
+
+	if l.Cfg.StartTLS {
+		if err := conn.StartTLS(&tls.Config{InsecureSkipVerify: l.Cfg.InsecureConnection}); err != nil {
+			return errors.Wrap(err, "ldap starttls")
+		}
+	}
+
+	// search the user DN using the service account
+	if l.Cfg.BindDN != "" {
+		if err := conn.Bind(l.Cfg.BindDN, l.Cfg.BindPassword); err != nil {
+			return errors.Wrap(err, "ldap service account bind")
+		}
+	}
+
+	filter := fmt.Sprintf(l.Cfg.UserFilter, ldap.EscapeFilter(username))
+	if l.Cfg.GroupFilter != "" {
+		filter = fmt.Sprintf("(&%s%s)", filter, l.Cfg.GroupFilter)
+	}
+
+	searchRequest := ldap.NewSearchRequest(
+		l.Cfg.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(l.Cfg.Timeout/time.Second), false,
+		filter,
+		[]string{"dn"},
+		nil,
+	)
+
+	sr, err := conn.Search(searchRequest)
+	if err != nil {
+		return errors.Wrap(err, "ldap search")
+	}
+
+	if len(sr.Entries) != 1 {
+		l.Logger.Debugf("Basic auth: ldap user %s not found or is not a member of the group", username)
+		return errInvalidCredentials
+	}
+
+	if err := conn.Bind(sr.Entries[0].DN, password); err != nil {
+		return errInvalidCredentials
+	}
+
+	l.Cache.Set(cacheKey, true, l.Cfg.CacheTTL)
+
+	return nil
+}
@@ -0,0 +1,218 @@
+package classification
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/valyala/fastjson"
+	"github.com/wallarm/api-firewall/internal/platform/router"
+)
+
+// Extension is the name of the schema property extension with the data classification
+const Extension = "x-data-classification"
+
+// arrayItems is the path segment of the array items
+const arrayItems = "[]"
+
+// Field is the classified property of the response body
+type Field struct {
+	Path           []string
+	Classification string
+}
+
+// Name returns the dot separated path of the field
+func (f Field) Name() string {
+	return strings.Join(f.Path, ".")
+}
+
+// Fields returns the classified properties of the JSON response bodies of the operation
+func Fields(operation *openapi3.Operation) ([]Field, error) {
+
+	var fields []Field
+	seen := make(map[string]struct{})
+
+	codes := make([]string, 0, len(operation.Responses))
+	for code := range operation.Responses {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	for _, code := range codes {
+		response := operation.Responses[code]
+		if response == nil || response.Value == nil {
+			continue
+		}
+		for mediaType, content := range response.Value.Content {
+			if !strings.Contains(mediaType, "json") || content.Schema == nil {
+				continue
+			}
+			found, err := collect(content.Schema, nil, make(map[*openapi3.Schema]struct{}))
+			if err != nil {
+				return nil, err
+			}
+			for _, field := range found {
+				key := field.Name() + " " + field.Classification
+				if _, ok := seen[key]; ok {
+					continue
+				}
+				seen[key] = struct{}{}
+				fields = append(fields, field)
+			}
+		}
+	}
+
+	return fields, nil
+}
+
+// collect walks the schema properties. The recursive schemas are walked once
+func collect(schemaRef *openapi3.SchemaRef, path []string, visited map[*openapi3.Schema]struct{}) ([]Field, error) {
+
+	schema := schemaRef.Value
+	if schema == nil {
+		return nil, nil
+	}
+	if _, ok := visited[schema]; ok {
+		return nil, nil
+	}
+	visited[schema] = struct{}{}
+	defer delete(visited, schema)
+
+	var fields []Field
+
+	var classification string
+	found, err := router.GetExtension(schema.Extensions, Extension, &classification)
+	if err != nil {
+		return nil, err
+	}
+	if found && classification != "" && len(path) > 0 {
+		fields = append(fields, Field{Path: append([]string(nil), path...), Classification: classification})
+	}
+
+	names := make([]string, 0, len(schema.Properties))
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		found, err := collect(schema.Properties[name], append(path, name), visited)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, found...)
+	}
+
+	if schema.Items != nil {
+		found, err := collect(schema.Items, append(path, arrayItems), visited)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, found...)
+	}
+
+	for _, schemas := range []openapi3.SchemaRefs{schema.AllOf, schema.OneOf, schema.AnyOf} {
+		for _, s := range schemas {
+			found, err := collect(s, path, visited)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, found...)
+		}
+	}
+
+	return fields, nil
+}
+
+// Flowing returns the fields which have non-null values in the body
+func Flowing(body *fastjson.Value, fields []Field) []Field {
+
+	var flowing []Field
+	for _, field := range fields {
+		if present(body, field.Path) {
+			flowing = append(flowing, field)
+		}
+	}
+
+	return flowing
+}
+
+func present(value *fastjson.Value, path []string) bool {
+
+	if value == nil || value.Type() == fastjson.TypeNull {
+		return false
+	}
+
+	if len(path) == 0 {
+		return true
+	}
+
+	if path[0] == arrayItems {
+		items, err := value.Array()
+		if err != nil {
+			return false
+		}
+		for _, item := range items {
+			if present(item, path[1:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if value.Type() != fastjson.TypeObject {
+		return false
+	}
+
+	return present(value.Get(path[0]), path[1:])
+}
+
+// Report counts the responses with the classified fields by endpoint, classification and field
+type Report struct {
+	mu        sync.Mutex
+	endpoints map[string]map[string]map[string]int64
+}
+
+// Flows is the report of the classified fields served by all endpoints
+var Flows = &Report{endpoints: make(map[string]map[string]map[string]int64)}
+
+// Add counts the classified fields found in the response of the endpoint
+func (r *Report) Add(endpoint string, fields []Field) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	classifications, ok := r.endpoints[endpoint]
+	if !ok {
+		classifications = make(map[string]map[string]int64)
+		r.endpoints[endpoint] = classifications
+	}
+
+	for _, field := range fields {
+		counts, ok := classifications[field.Classification]
+		if !ok {
+			counts = make(map[string]int64)
+			classifications[field.Classification] = counts
+		}
+		counts[field.Name()]++
+	}
+}
+
+// Snapshot returns the copy of the report
+func (r *Report) Snapshot() map[string]map[string]map[string]int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	snapshot := make(map[string]map[string]map[string]int64, len(r.endpoints))
+	for endpoint, classifications := range r.endpoints {
+		snapshot[endpoint] = make(map[string]map[string]int64, len(classifications))
+		for classification, counts := range classifications {
+			snapshot[endpoint][classification] = make(map[string]int64, len(counts))
+			for name, count := range counts {
+				snapshot[endpoint][classification][name] = count
+			}
+		}
+	}
+
+	return snapshot
+}
@@ -0,0 +1,99 @@
+package coalescing
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Response is the response of the leading request shared with the coalesced requests
+type Response struct {
+	StatusCode int
+	Headers    [][2]string
+	Body       []byte
+}
+
+// Call is the request in flight to the upstream. The identical requests wait for the response of the call
+type Call struct {
+	done     chan struct{}
+	response *Response
+}
+
+// Stats are the numbers of the requests sent to the upstream by the leaders and the requests served
+// by the responses of the leaders
+type Stats struct {
+	Leaders   int64 `json:"leaders"`
+	Coalesced int64 `json:"coalesced"`
+	Expired   int64 `json:"expired"`
+}
+
+// totals are the numbers of the requests of all groups
+var totals Stats
+
+// Totals returns the numbers of the leading, the coalesced and the expired requests
+func Totals() Stats {
+	return Stats{
+		Leaders:   atomic.LoadInt64(&totals.Leaders),
+		Coalesced: atomic.LoadInt64(&totals.Coalesced),
+		Expired:   atomic.LoadInt64(&totals.Expired),
+	}
+}
+
+// Group collapses the identical concurrent requests to the single request to the upstream
+type Group struct {
+	mu    sync.Mutex
+	calls map[string]*Call
+}
+
+// New creates the group of the requests in flight
+func New() *Group {
+	return &Group{calls: make(map[string]*Call)}
+}
+
+// Join returns the call in flight with the key. If there is no call in flight then the new call is started
+// and the caller is the leader which should complete the call
+func (g *Group) Join(key string) (*Call, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if c, ok := g.calls[key]; ok {
+		return c, false
+	}
+
+	c := &Call{done: make(chan struct{})}
+	g.calls[key] = c
+	atomic.AddInt64(&totals.Leaders, 1)
+
+	return c, true
+}
+
+// Complete shares the response with the waiting requests and removes the call. The nil response
+// is not shared, so the waiting requests are sent to the upstream
+func (g *Group) Complete(key string, c *Call, response *Response) {
+	g.mu.Lock()
+	if g.calls[key] == c {
+		delete(g.calls, key)
+	}
+	g.mu.Unlock()
+
+	c.response = response
+	close(c.done)
+}
+
+// Wait returns the response of the call. The function returns nil if the response is not shared
+// or the call is not completed in the timeout
+func (g *Group) Wait(c *Call, timeout time.Duration) *Response {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-c.done:
+		if c.response != nil {
+			atomic.AddInt64(&totals.Coalesced, 1)
+		}
+		return c.response
+	case <-timer.C:
+		atomic.AddInt64(&totals.Expired, 1)
+		return nil
+	}
+}
@@ -0,0 +1,97 @@
+package concurrency
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+const (
+	KeyIP     = "ip"
+	KeyGlobal = "global"
+	KeyAPIKey = "api_key"
+)
+
+var ErrInvalidPolicy = errors.New("concurrency limit policy must set max_concurrent")
+
+// Policy is the limit of the simultaneous in-flight requests of the operation set by the x-wallarm-concurrency extension
+type Policy struct {
+	MaxConcurrent int    `json:"max_concurrent"`
+	Key           string `json:"key"`
+}
+
+// Limiter counts the in-flight requests shared by all requests (global key) or separate
+// for each client IP address (ip key, default) or for each API key (api_key key)
+type Limiter struct {
+	max int
+	key string
+
+	mu       sync.Mutex
+	inflight map[string]int
+}
+
+// New creates the limiter of the policy
+func New(policy Policy) (*Limiter, error) {
+	if policy.MaxConcurrent <= 0 {
+		return nil, ErrInvalidPolicy
+	}
+
+	switch policy.Key {
+	case "":
+		policy.Key = KeyIP
+	case KeyIP, KeyGlobal, KeyAPIKey:
+	default:
+		return nil, fmt.Errorf("concurrency limit policy: unknown key %q", policy.Key)
+	}
+
+	return &Limiter{
+		max:      policy.MaxConcurrent,
+		key:      policy.Key,
+		inflight: make(map[string]int),
+	}, nil
+}
+
+// Key returns the key of the policy: ip, global or api_key
+func (l *Limiter) Key() string {
+	return l.key
+}
+
+// Max returns the maximum number of the simultaneous requests
+func (l *Limiter) Max() int {
+	return l.max
+}
+
+// Acquire returns true if the request of the client doesn't exceed the limit. The acquired
+// request should be released by Release when it is completed
+func (l *Limiter) Acquire(client string) bool {
+	if l.key == KeyGlobal {
+		client = ""
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.inflight[client] >= l.max {
+		return false
+	}
+	l.inflight[client]++
+
+	return true
+}
+
+// Release completes the request acquired by Acquire
+func (l *Limiter) Release(client string) {
+	if l.key == KeyGlobal {
+		client = ""
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// the counters of the idle clients are removed
+	if l.inflight[client] <= 1 {
+		delete(l.inflight, client)
+		return
+	}
+	l.inflight[client]--
+}
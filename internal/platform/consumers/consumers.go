@@ -0,0 +1,249 @@
+package consumers
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/wallarm/api-firewall/internal/config"
+	"github.com/wallarm/api-firewall/internal/platform/concurrency"
+	"github.com/wallarm/api-firewall/internal/platform/modes"
+	"github.com/wallarm/api-firewall/internal/platform/ratelimit"
+)
+
+const (
+	KindAPIKey     = "api_key"
+	KindSubject    = "subject"
+	KindCommonName = "common_name"
+)
+
+// Profile is the configuration of the consumer identified by the API key, the subject (sub claim)
+// of the JWT or the common name of the client certificate
+type Profile struct {
+	Name          string            `json:"name"`
+	APIKeys       []string          `json:"api_keys"`
+	Subjects      []string          `json:"subjects"`
+	CommonNames   []string          `json:"common_names"`
+	RateLimit     *ratelimit.Policy `json:"rate_limit"`
+	MaxConcurrent int               `json:"max_concurrent"`
+	Tags          []string          `json:"tags"`
+	Operations    []string          `json:"operations"`
+	Validation    modes.Mode        `json:"validation"`
+
+	limiter     *ratelimit.Limiter
+	concurrency *concurrency.Limiter
+}
+
+// Limiter returns the rate limiter shared by the requests of the consumer or nil if the rate limit is not set
+func (p *Profile) Limiter() *ratelimit.Limiter {
+	return p.limiter
+}
+
+// ConcurrencyLimiter returns the limiter of the simultaneous requests of the consumer or nil if the limit is not set
+func (p *Profile) ConcurrencyLimiter() *concurrency.Limiter {
+	return p.concurrency
+}
+
+// Allows returns true if the profile doesn't restrict the operations or the operation is selected
+// by operationId, by the method and the path or by one of the tags
+func (p *Profile) Allows(operationKeys []string, tags []string) bool {
+
+	if len(p.Operations) == 0 && len(p.Tags) == 0 {
+		return true
+	}
+
+	for _, operation := range p.Operations {
+		for _, key := range operationKeys {
+			if operation == key {
+				return true
+			}
+		}
+	}
+
+	for _, allowed := range p.Tags {
+		for _, tag := range tags {
+			if allowed == tag {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Profiles holds the consumer profiles loaded from the JSON file. The file is reloaded
+// if it has been changed and the malformed file doesn't replace the loaded profiles
+type Profiles struct {
+	cfg    *config.Consumers
+	logger *logrus.Logger
+
+	mu        sync.RWMutex
+	profiles  map[string]*Profile
+	index     map[string]*Profile
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+// New loads the profiles file. It returns nil if the file is not configured
+func New(cfg *config.Consumers, logger *logrus.Logger) (*Profiles, error) {
+
+	if cfg.ProfilesFile == "" {
+		return nil, nil
+	}
+
+	p := Profiles{
+		cfg:       cfg,
+		logger:    logger,
+		checkedAt: time.Now(),
+	}
+
+	if err := p.load(); err != nil {
+		return nil, err
+	}
+
+	logger.Debugf("Consumers: loaded %d profiles", len(p.profiles))
+
+	return &p, nil
+}
+
+// Load parses and checks the profiles
+func Load(data []byte) ([]*Profile, error) {
+
+	var profiles []*Profile
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&profiles); err != nil {
+		return nil, errors.Wrap(err, "decoding consumer profiles")
+	}
+
+	names := make(map[string]struct{}, len(profiles))
+	for _, profile := range profiles {
+		if profile.Name == "" {
+			return nil, errors.New("consumer profile without name")
+		}
+		if _, ok := names[profile.Name]; ok {
+			return nil, errors.Errorf("consumer profile %s: duplicate name", profile.Name)
+		}
+		names[profile.Name] = struct{}{}
+
+		if err := profile.Validation.Validate(); err != nil {
+			return nil, errors.Wrapf(err, "consumer profile %s", profile.Name)
+		}
+		if profile.RateLimit != nil {
+			if _, err := ratelimit.New(*profile.RateLimit); err != nil {
+				return nil, errors.Wrapf(err, "consumer profile %s", profile.Name)
+			}
+		}
+		if profile.MaxConcurrent < 0 {
+			return nil, errors.Errorf("consumer profile %s: negative max_concurrent", profile.Name)
+		}
+	}
+
+	return profiles, nil
+}
+
+// load reads the profiles file if it has been changed since the last load. The rate limiters
+// of the profiles with the unchanged rate limits and the concurrency limiters of the profiles
+// with the unchanged concurrency limits are kept
+func (p *Profiles) load() error {
+
+	fi, err := os.Stat(p.cfg.ProfilesFile)
+	if err != nil {
+		return err
+	}
+
+	p.mu.RLock()
+	modified := !fi.ModTime().Equal(p.modTime)
+	p.mu.RUnlock()
+
+	if !modified {
+		return nil
+	}
+
+	data, err := os.ReadFile(p.cfg.ProfilesFile)
+	if err != nil {
+		return err
+	}
+
+	loaded, err := Load(data)
+	if err != nil {
+		return err
+	}
+
+	p.mu.RLock()
+	previous := p.profiles
+	p.mu.RUnlock()
+
+	profiles := make(map[string]*Profile, len(loaded))
+	index := make(map[string]*Profile)
+
+	for _, profile := range loaded {
+		if profile.RateLimit != nil {
+			if old, ok := previous[profile.Name]; ok && old.RateLimit != nil && *old.RateLimit == *profile.RateLimit {
+				profile.limiter = old.limiter
+			} else {
+				// the error is checked by Load
+				profile.limiter, _ = ratelimit.New(*profile.RateLimit)
+			}
+		}
+		if profile.MaxConcurrent > 0 {
+			if old, ok := previous[profile.Name]; ok && old.MaxConcurrent == profile.MaxConcurrent {
+				profile.concurrency = old.concurrency
+			} else {
+				// the limit is checked by Load
+				profile.concurrency, _ = concurrency.New(concurrency.Policy{MaxConcurrent: profile.MaxConcurrent, Key: concurrency.KeyGlobal})
+			}
+		}
+
+		profiles[profile.Name] = profile
+		for _, key := range profile.APIKeys {
+			index[KindAPIKey+":"+key] = profile
+		}
+		for _, subject := range profile.Subjects {
+			index[KindSubject+":"+subject] = profile
+		}
+		for _, name := range profile.CommonNames {
+			index[KindCommonName+":"+name] = profile
+		}
+	}
+
+	p.mu.Lock()
+	p.profiles = profiles
+	p.index = index
+	p.modTime = fi.ModTime()
+	p.mu.Unlock()
+
+	return nil
+}
+
+// Find returns the profile of the consumer identified by the value of the kind or nil if the profile is not found
+func (p *Profiles) Find(kind, value string) *Profile {
+
+	if value == "" {
+		return nil
+	}
+
+	// reload the file if the refresh interval passed
+	p.mu.Lock()
+	refresh := time.Since(p.checkedAt) > p.cfg.RefreshInterval
+	if refresh {
+		p.checkedAt = time.Now()
+	}
+	p.mu.Unlock()
+
+	if refresh {
+		if err := p.load(); err != nil {
+			p.logger.Errorf("Consumers: can't reload profiles: %s: the loaded profiles are kept", err)
+		}
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.index[kind+":"+value]
+}
@@ -2,31 +2,84 @@ package denylist
 
 import (
 	"bufio"
+	"context"
 	"io"
 	"os"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/dgraph-io/ristretto"
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/wallarm/api-firewall/internal/config"
+	"github.com/wallarm/api-firewall/internal/platform/state"
 )
 
 const (
 	BufferItems = 64
 	ElementCost = 1
+
+	PolicyFailOpen   = "FAIL_OPEN"
+	PolicyFailClosed = "FAIL_CLOSED"
 )
 
 type DeniedTokens struct {
 	Cache       *ristretto.Cache
 	ElementsNum int64
+	Feeds       *Feeds
+
+	redis    *redis.Client
+	redisKey string
+	dynamic  *dynamic
+	ban      config.Ban
+	logger   *logrus.Logger
+
+	// sharedDown is set while the shared state is not available, so only the changes of the state are logged
+	sharedDown int32
 }
 
 func New(cfg *config.APIFWConfiguration, logger *logrus.Logger) (*DeniedTokens, error) {
 
-	if cfg.Denylist.Tokens.File == "" {
+	if cfg.Denylist.Tokens.File == "" && cfg.Denylist.Tokens.RedisKey == "" && len(cfg.Honeypot.Routes) == 0 && len(cfg.ThreatIntel.Feeds) == 0 && !cfg.Ban.Enabled {
 		return nil, nil
 	}
 
+	// the addresses of the IP reputation feeds are fetched by Feeds.Run
+	var feeds *Feeds
+	if len(cfg.ThreatIntel.Feeds) > 0 {
+		f, err := NewFeeds(&cfg.ThreatIntel, logger)
+		if err != nil {
+			return nil, err
+		}
+		feeds = f
+	}
+
+	// the callers of the honeypot routes and the banned clients are denied at runtime
+	var dynamicList *dynamic
+	if len(cfg.Honeypot.Routes) > 0 || cfg.Ban.Enabled {
+		d, err := newDynamic(cfg)
+		if err != nil {
+			return nil, err
+		}
+		dynamicList = d
+	}
+
+	// tokens in the Redis set are shared by the APIFW instances
+	var redisClient *redis.Client
+	if cfg.Denylist.Tokens.RedisKey != "" {
+		client, err := state.Redis(&cfg.Redis)
+		if err != nil {
+			return nil, err
+		}
+		redisClient = client
+	}
+
+	if cfg.Denylist.Tokens.File == "" {
+		return &DeniedTokens{redis: redisClient, redisKey: cfg.Denylist.Tokens.RedisKey, dynamic: dynamicList, Feeds: feeds, ban: cfg.Ban, logger: logger}, nil
+	}
+
 	var totalEntries int64
 	var totalCacheCapacity int64
 
@@ -101,5 +154,137 @@ func New(cfg *config.APIFWConfiguration, logger *logrus.Logger) (*DeniedTokens,
 		return nil, err
 	}
 
-	return &DeniedTokens{Cache: cache, ElementsNum: totalEntries}, nil
+	return &DeniedTokens{Cache: cache, ElementsNum: totalEntries, redis: redisClient, redisKey: cfg.Denylist.Tokens.RedisKey, dynamic: dynamicList, Feeds: feeds, ban: cfg.Ban, logger: logger}, nil
+}
+
+// Found checks the token in the tokens loaded from the file, in the tokens denied at runtime and in the Redis set.
+// The error is returned if the shared state is not available and the token is not found in the local state
+func (d *DeniedTokens) Found(ctx context.Context, token string) (bool, error) {
+
+	if token == "" {
+		return false, nil
+	}
+
+	if d.Cache != nil {
+		if _, found := d.Cache.Get(token); found {
+			return true, nil
+		}
+	}
+
+	var sharedErr error
+
+	if d.dynamic != nil {
+		found, err := d.dynamic.found(ctx, KindToken, token)
+		if found {
+			return true, nil
+		}
+		sharedErr = err
+	}
+
+	if d.redis != nil && sharedErr == nil {
+		found, err := d.redis.SIsMember(ctx, d.redisKey, token).Result()
+		if err == nil {
+			return found, d.shared(nil)
+		}
+		sharedErr = errors.Wrap(err, "denylist check")
+	}
+
+	return false, d.shared(sharedErr)
+}
+
+// AddressFound checks the client address in the IP reputation feeds and in the addresses denied at runtime.
+// The error is returned if the shared state is not available and the address is not found in the local state
+func (d *DeniedTokens) AddressFound(ctx context.Context, address string) (bool, error) {
+
+	if d.Feeds != nil {
+		if _, found := d.Feeds.Found(address); found {
+			return true, nil
+		}
+	}
+
+	if d.dynamic == nil || address == "" {
+		return false, nil
+	}
+
+	found, err := d.dynamic.found(ctx, KindAddress, address)
+	if found {
+		return true, nil
+	}
+
+	return false, d.shared(err)
+}
+
+// shared logs the changes of the shared state availability and returns the error of the shared state
+func (d *DeniedTokens) shared(err error) error {
+	if d.redis == nil && (d.dynamic == nil || d.dynamic.redis == nil) {
+		return err
+	}
+
+	if err == nil {
+		if atomic.CompareAndSwapInt32(&d.sharedDown, 1, 0) {
+			d.logger.Infof("denylist: shared state is available again")
+		}
+		return nil
+	}
+
+	if atomic.CompareAndSwapInt32(&d.sharedDown, 0, 1) {
+		d.logger.Warnf("denylist: shared state is not available, checking the local state only: %s", err)
+	}
+
+	return err
+}
+
+// Deny adds the client address or the token to the denylist for the TTL
+func (d *DeniedTokens) Deny(ctx context.Context, kind, value string, ttl time.Duration) error {
+
+	if d.dynamic == nil || value == "" {
+		return nil
+	}
+
+	return d.dynamic.add(ctx, kind, value, ttl)
+}
+
+// Strike counts the blocked request of the client address or the token. The client is banned for the ban duration
+// after the threshold of the blocked requests within the window. It returns true if the client has been banned
+func (d *DeniedTokens) Strike(ctx context.Context, kind, value string) (bool, error) {
+
+	if d.dynamic == nil || !d.ban.Enabled || value == "" {
+		return false, nil
+	}
+
+	strikes, err := d.dynamic.strike(ctx, kind, value, d.ban.Window)
+	if err != nil {
+		return false, d.shared(err)
+	}
+
+	if strikes != int64(d.ban.Threshold) {
+		return false, d.shared(nil)
+	}
+
+	if err := d.dynamic.add(ctx, kind, value, d.ban.Duration); err != nil {
+		return false, d.shared(err)
+	}
+
+	return true, d.shared(nil)
+}
+
+// Bans returns the client addresses and the hashes of the tokens denied at runtime
+func (d *DeniedTokens) Bans(ctx context.Context) ([]Ban, error) {
+
+	if d.dynamic == nil {
+		return []Ban{}, nil
+	}
+
+	return d.dynamic.list(ctx)
+}
+
+// Lift removes the client address or the token from the denylist and resets its blocked requests counter.
+// The token is passed as is or as the hash returned by Bans. It returns false if the client is not denied
+func (d *DeniedTokens) Lift(ctx context.Context, kind, value string) (bool, error) {
+
+	if d.dynamic == nil {
+		return false, nil
+	}
+
+	return d.dynamic.remove(ctx, kind, value)
 }
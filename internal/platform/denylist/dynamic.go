@@ -0,0 +1,201 @@
+package denylist
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/karlseguin/ccache/v2"
+	"github.com/pkg/errors"
+	"github.com/wallarm/api-firewall/internal/config"
+	"github.com/wallarm/api-firewall/internal/platform/state"
+)
+
+const (
+	KindAddress = "address"
+	KindToken   = "token"
+)
+
+// tokenHashPrefix is the prefix of the SHA-256 hashes of the tokens. The tokens denied at runtime are stored,
+// shared by Redis and listed by the hashes, so the bearer tokens aren't exposed
+const tokenHashPrefix = "sha256:"
+
+// Ban is the client address or the hash of the token denied at runtime
+type Ban struct {
+	Kind    string    `json:"kind"`
+	Value   string    `json:"value"`
+	Expires time.Time `json:"expires"`
+}
+
+// dynamic contains the client addresses and the tokens denied at runtime for the limited time.
+// The entries are shared by the APIFW instances with the redis state backend
+type dynamic struct {
+	cache     *ccache.Cache
+	strikes   *ccache.Cache
+	redis     *redis.Client
+	redisCfg  *config.Redis
+	keyPrefix string
+}
+
+func newDynamic(cfg *config.APIFWConfiguration) (*dynamic, error) {
+
+	d := dynamic{cache: ccache.New(ccache.Configure()), strikes: ccache.New(ccache.Configure())}
+
+	if cfg.StateBackend == state.BackendRedis {
+		client, err := state.Redis(&cfg.Redis)
+		if err != nil {
+			return nil, err
+		}
+		d.redis = client
+		d.redisCfg = &cfg.Redis
+	}
+
+	return &d, nil
+}
+
+// storedValue returns the client address or the hash of the token
+func storedValue(kind, value string) string {
+	if kind != KindToken {
+		return value
+	}
+	sum := sha256.Sum256([]byte(value))
+	return tokenHashPrefix + hex.EncodeToString(sum[:])
+}
+
+// isTokenHash returns true if the value is the hash of the token listed by the admin API
+func isTokenHash(value string) bool {
+	if !strings.HasPrefix(value, tokenHashPrefix) || len(value) != len(tokenHashPrefix)+2*sha256.Size {
+		return false
+	}
+	_, err := hex.DecodeString(strings.TrimPrefix(value, tokenHashPrefix))
+	return err == nil
+}
+
+func (d *dynamic) add(ctx context.Context, kind, value string, ttl time.Duration) error {
+
+	value = storedValue(kind, value)
+
+	d.cache.Set(kind+":"+value, struct{}{}, ttl)
+
+	if d.redis != nil {
+		if err := d.redis.Set(ctx, state.Key(d.redisCfg, "denylist", kind, value), 1, ttl).Err(); err != nil {
+			return errors.Wrap(err, "denylist update")
+		}
+	}
+
+	return nil
+}
+
+func (d *dynamic) found(ctx context.Context, kind, value string) (bool, error) {
+
+	value = storedValue(kind, value)
+
+	if item := d.cache.Get(kind + ":" + value); item != nil && !item.Expired() {
+		return true, nil
+	}
+
+	if d.redis != nil {
+		found, err := d.redis.Exists(ctx, state.Key(d.redisCfg, "denylist", kind, value)).Result()
+		if err != nil {
+			return false, errors.Wrap(err, "denylist check")
+		}
+		return found > 0, nil
+	}
+
+	return false, nil
+}
+
+// strike counts the blocked request of the client address or the token in the fixed window
+// and returns the number of the blocked requests in the current window
+func (d *dynamic) strike(ctx context.Context, kind, value string, window time.Duration) (int64, error) {
+
+	value = storedValue(kind, value)
+
+	// the counter of the window is created with the expiration and incremented in the same transaction,
+	// so the counter never outlives the window if the instance fails between the commands
+	if d.redis != nil {
+		key := state.Key(d.redisCfg, "strikes", kind, value)
+
+		var incr *redis.IntCmd
+		if _, err := d.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.SetNX(ctx, key, 0, window)
+			incr = pipe.Incr(ctx, key)
+			return nil
+		}); err != nil {
+			return 0, errors.Wrap(err, "denylist strike")
+		}
+		return incr.Val(), nil
+	}
+
+	item, err := d.strikes.Fetch(kind+":"+value, window, func() (interface{}, error) {
+		return new(int64), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return atomic.AddInt64(item.Value().(*int64), 1), nil
+}
+
+func (d *dynamic) list(ctx context.Context) ([]Ban, error) {
+
+	bans := []Ban{}
+
+	if d.redis != nil {
+		prefix := state.Key(d.redisCfg, "denylist", "")
+		iter := d.redis.Scan(ctx, 0, prefix+"*", 0).Iterator()
+		for iter.Next(ctx) {
+			kindValue := strings.SplitN(strings.TrimPrefix(iter.Val(), prefix), ":", 2)
+			if len(kindValue) != 2 {
+				continue
+			}
+			ttl, err := d.redis.PTTL(ctx, iter.Val()).Result()
+			if err != nil {
+				return nil, errors.Wrap(err, "denylist list")
+			}
+			if ttl < 0 {
+				continue
+			}
+			bans = append(bans, Ban{Kind: kindValue[0], Value: kindValue[1], Expires: time.Now().Add(ttl)})
+		}
+		if err := iter.Err(); err != nil {
+			return nil, errors.Wrap(err, "denylist list")
+		}
+		return bans, nil
+	}
+
+	d.cache.ForEachFunc(func(key string, item *ccache.Item) bool {
+		kindValue := strings.SplitN(key, ":", 2)
+		if !item.Expired() && len(kindValue) == 2 {
+			bans = append(bans, Ban{Kind: kindValue[0], Value: kindValue[1], Expires: item.Expires()})
+		}
+		return true
+	})
+
+	return bans, nil
+}
+
+// remove lifts the ban of the client address or the token. The token is passed as is or as the listed hash
+func (d *dynamic) remove(ctx context.Context, kind, value string) (bool, error) {
+
+	if kind != KindToken || !isTokenHash(value) {
+		value = storedValue(kind, value)
+	}
+
+	removed := d.cache.Delete(kind + ":" + value)
+	d.strikes.Delete(kind + ":" + value)
+
+	if d.redis != nil {
+		deleted, err := d.redis.Del(ctx, state.Key(d.redisCfg, "denylist", kind, value), state.Key(d.redisCfg, "strikes", kind, value)).Result()
+		if err != nil {
+			return false, errors.Wrap(err, "denylist remove")
+		}
+		removed = removed || deleted > 0
+	}
+
+	return removed, nil
+}
@@ -0,0 +1,321 @@
+package denylist
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/config"
+)
+
+const (
+	FeedFormatText = "TEXT"
+	FeedFormatSTIX = "STIX"
+)
+
+// stixAddressPattern matches the addresses in the patterns of the STIX indicators
+var stixAddressPattern = regexp.MustCompile(`ipv[46]-addr:value\s*=\s*'([^']+)'`)
+
+// Feed is the IP reputation feed. The feed is configured as "URL [FORMAT] [TTL]"
+type Feed struct {
+	URL    string
+	Format string
+	TTL    time.Duration
+}
+
+// FeedStats are the metrics of the feed
+type FeedStats struct {
+	Entries int       `json:"entries"`
+	Hits    int64     `json:"hits"`
+	Errors  int64     `json:"errors"`
+	Updated time.Time `json:"updated"`
+	Expires time.Time `json:"expires"`
+}
+
+// feedList contains the addresses and the networks of the last successful fetch of the feed
+type feedList struct {
+	addresses map[string]struct{}
+	networks  []*net.IPNet
+	updated   time.Time
+	expires   time.Time
+
+	hits   int64
+	errors int64
+}
+
+func (l *feedList) contains(ip net.IP) bool {
+	if _, ok := l.addresses[ip.String()]; ok {
+		return true
+	}
+	for _, network := range l.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Feeds contains the addresses of the IP reputation feeds. The addresses of the feed expire
+// after the TTL of the feed if the feed can't be fetched again
+type Feeds struct {
+	cfg    *config.ThreatIntel
+	logger *logrus.Logger
+	feeds  []Feed
+
+	mu    sync.RWMutex
+	lists map[string]*feedList
+}
+
+func NewFeeds(cfg *config.ThreatIntel, logger *logrus.Logger) (*Feeds, error) {
+
+	feeds := make([]Feed, 0, len(cfg.Feeds))
+	for _, feed := range cfg.Feeds {
+		f, err := ParseFeed(feed, cfg.TTL)
+		if err != nil {
+			return nil, err
+		}
+		feeds = append(feeds, f)
+	}
+
+	lists := make(map[string]*feedList, len(feeds))
+	for _, feed := range feeds {
+		lists[feed.URL] = &feedList{}
+	}
+
+	return &Feeds{cfg: cfg, logger: logger, feeds: feeds, lists: lists}, nil
+}
+
+// ParseFeed parses the feed configured as "URL [FORMAT] [TTL]". The plain text format and the default TTL are used by default
+func ParseFeed(feed string, defaultTTL time.Duration) (Feed, error) {
+
+	parts := strings.Fields(feed)
+	if len(parts) == 0 || len(parts) > 3 {
+		return Feed{}, errors.Errorf("invalid threat intelligence feed: %q", feed)
+	}
+
+	f := Feed{URL: parts[0], Format: FeedFormatText, TTL: defaultTTL}
+	if !strings.HasPrefix(f.URL, "http://") && !strings.HasPrefix(f.URL, "https://") {
+		return Feed{}, errors.Errorf("invalid threat intelligence feed URL: %q", f.URL)
+	}
+
+	for _, part := range parts[1:] {
+		switch strings.ToUpper(part) {
+		case FeedFormatText, FeedFormatSTIX:
+			f.Format = strings.ToUpper(part)
+		default:
+			ttl, err := time.ParseDuration(part)
+			if err != nil || ttl <= 0 {
+				return Feed{}, errors.Errorf("invalid threat intelligence feed option: %q", part)
+			}
+			f.TTL = ttl
+		}
+	}
+
+	return f, nil
+}
+
+// Run fetches the feeds by the refresh interval until the process is stopped
+func (f *Feeds) Run() {
+	for {
+		f.Refresh()
+		time.Sleep(f.cfg.RefreshInterval)
+	}
+}
+
+// Refresh fetches all feeds. The addresses of the feed are kept until the TTL if the feed can't be fetched
+func (f *Feeds) Refresh() {
+	for _, feed := range f.feeds {
+		addresses, networks, err := f.fetch(feed)
+
+		f.mu.Lock()
+		list := f.lists[feed.URL]
+		if err != nil {
+			list.errors++
+			f.mu.Unlock()
+			f.logger.Errorf("Threat intelligence: fetching %s: %s", feed.URL, err.Error())
+			continue
+		}
+
+		now := time.Now()
+		f.lists[feed.URL] = &feedList{
+			addresses: addresses,
+			networks:  networks,
+			updated:   now,
+			expires:   now.Add(feed.TTL),
+			hits:      atomic.LoadInt64(&list.hits),
+			errors:    list.errors,
+		}
+		f.mu.Unlock()
+
+		f.logger.Debugf("Threat intelligence: loaded %d addresses and %d networks from %s", len(addresses), len(networks), feed.URL)
+	}
+}
+
+// Found checks the address in the feeds which are not expired. It returns the URL of the feed which contains the address
+func (f *Feeds) Found(address string) (string, bool) {
+
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return "", false
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	now := time.Now()
+	for _, feed := range f.feeds {
+		list := f.lists[feed.URL]
+		if now.After(list.expires) {
+			continue
+		}
+		if list.contains(ip) {
+			atomic.AddInt64(&list.hits, 1)
+			return feed.URL, true
+		}
+	}
+
+	return "", false
+}
+
+// Stats returns the metrics of the feeds by URL
+func (f *Feeds) Stats() map[string]FeedStats {
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	stats := make(map[string]FeedStats, len(f.lists))
+	for url, list := range f.lists {
+		stats[url] = FeedStats{
+			Entries: len(list.addresses) + len(list.networks),
+			Hits:    atomic.LoadInt64(&list.hits),
+			Errors:  list.errors,
+			Updated: list.updated,
+			Expires: list.expires,
+		}
+	}
+
+	return stats
+}
+
+func (f *Feeds) fetch(feed Feed) (map[string]struct{}, []*net.IPNet, error) {
+
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+
+	res := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(res)
+
+	req.SetRequestURI(feed.URL)
+	req.Header.SetMethod(fasthttp.MethodGet)
+
+	if err := fasthttp.DoTimeout(req, res, f.cfg.Timeout); err != nil {
+		return nil, nil, err
+	}
+
+	if res.StatusCode() != fasthttp.StatusOK {
+		return nil, nil, fmt.Errorf("unexpected status code %d", res.StatusCode())
+	}
+
+	var entries []string
+	var err error
+
+	switch feed.Format {
+	case FeedFormatSTIX:
+		entries, err = stixEntries(res.Body())
+	default:
+		entries, err = textEntries(res.Body())
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	addresses := make(map[string]struct{})
+	var networks []*net.IPNet
+
+	for _, entry := range entries {
+		if len(addresses)+len(networks) >= f.cfg.MaxEntries {
+			f.logger.Warnf("Threat intelligence: %s contains more than %d entries: the rest entries are skipped", feed.URL, f.cfg.MaxEntries)
+			break
+		}
+
+		if ip := net.ParseIP(entry); ip != nil {
+			addresses[ip.String()] = struct{}{}
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			f.logger.Debugf("Threat intelligence: %s: skipping invalid entry %q", feed.URL, entry)
+			continue
+		}
+
+		// the single addresses are matched by the map
+		if ones, bits := network.Mask.Size(); ones == bits {
+			addresses[network.IP.String()] = struct{}{}
+			continue
+		}
+		networks = append(networks, network)
+	}
+
+	return addresses, networks, nil
+}
+
+// textEntries returns the first field of the lines. The empty lines and the comments (#, ;) are skipped
+func textEntries(body []byte) ([]string, error) {
+
+	var entries []string
+
+	s := bufio.NewScanner(bytes.NewReader(body))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		entries = append(entries, strings.FieldsFunc(line, func(r rune) bool {
+			return r == ' ' || r == '\t' || r == ';' || r == ','
+		})[0])
+	}
+
+	return entries, s.Err()
+}
+
+// stixEntries returns the addresses of the STIX 2 bundle: the values of the address objects
+// and the addresses of the indicator patterns
+func stixEntries(body []byte) ([]string, error) {
+
+	var bundle struct {
+		Objects []struct {
+			Type    string `json:"type"`
+			Value   string `json:"value"`
+			Pattern string `json:"pattern"`
+		} `json:"objects"`
+	}
+
+	if err := json.Unmarshal(body, &bundle); err != nil {
+		return nil, errors.Wrap(err, "decoding STIX bundle")
+	}
+
+	var entries []string
+	for _, object := range bundle.Objects {
+		switch object.Type {
+		case "ipv4-addr", "ipv6-addr":
+			entries = append(entries, object.Value)
+		case "indicator":
+			for _, match := range stixAddressPattern.FindAllStringSubmatch(object.Pattern, -1) {
+				entries = append(entries, match[1])
+			}
+		}
+	}
+
+	return entries, nil
+}
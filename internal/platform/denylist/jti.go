@@ -0,0 +1,177 @@
+package denylist
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/wallarm/api-firewall/internal/config"
+	"github.com/wallarm/api-firewall/internal/platform/state"
+)
+
+// RevokedJTI contains IDs (jti claim) of the revoked JWT tokens. The IDs are loaded
+// from the file (one per line) and/or checked in the Redis set.
+type RevokedJTI struct {
+	cfg    *config.JTI
+	logger *logrus.Logger
+	redis  *redis.Client
+
+	mu        sync.RWMutex
+	ids       map[string]struct{}
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+func NewRevokedJTI(cfg *config.APIFWConfiguration, logger *logrus.Logger) (*RevokedJTI, error) {
+
+	if cfg.Denylist.JTI.File == "" && cfg.Denylist.JTI.RedisKey == "" {
+		return nil, nil
+	}
+
+	r := RevokedJTI{
+		cfg:    &cfg.Denylist.JTI,
+		logger: logger,
+	}
+
+	if cfg.Denylist.JTI.RedisKey != "" {
+		client, err := state.Redis(&cfg.Redis)
+		if err != nil {
+			return nil, err
+		}
+		r.redis = client
+	}
+
+	if cfg.Denylist.JTI.File != "" {
+		if err := r.load(); err != nil {
+			return nil, err
+		}
+		logger.Debugf("Denylist: loaded %d revoked JWT IDs", len(r.ids))
+	}
+
+	return &r, nil
+}
+
+// CheckRevokedJTI checks that the file with the revoked IDs can be read and the Redis server is reachable,
+// so the revocation isn't disabled by the missing list
+func CheckRevokedJTI(ctx context.Context, cfg *config.APIFWConfiguration) error {
+
+	if cfg.Denylist.JTI.File != "" {
+		if _, err := os.ReadFile(cfg.Denylist.JTI.File); err != nil {
+			return errors.Wrap(err, "revoked JWT IDs file")
+		}
+	}
+
+	if cfg.Denylist.JTI.RedisKey != "" {
+		client, err := state.Redis(&cfg.Redis)
+		if err != nil {
+			return errors.Wrap(err, "revoked JWT IDs")
+		}
+		if err := client.Ping(ctx).Err(); err != nil {
+			return errors.Wrap(err, "revoked JWT IDs redis")
+		}
+	}
+
+	return nil
+}
+
+// UnavailableJTI fails the check of all tokens. It is used if the revoked IDs can't be loaded,
+// so the revoked tokens aren't accepted
+type UnavailableJTI struct {
+	Err error
+}
+
+// IsRevoked returns the error of loading the revoked IDs
+func (u UnavailableJTI) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	return false, errors.Wrap(u.Err, "revocation list unavailable")
+}
+
+// load reads the file with revoked IDs if it has been changed since the last load
+func (r *RevokedJTI) load() error {
+
+	fi, err := os.Stat(r.cfg.File)
+	if err != nil {
+		return err
+	}
+
+	r.mu.RLock()
+	modified := !fi.ModTime().Equal(r.modTime)
+	r.mu.RUnlock()
+
+	if !modified {
+		return nil
+	}
+
+	f, err := os.Open(r.cfg.File)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	ids := make(map[string]struct{})
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if id := strings.TrimSpace(s.Text()); id != "" {
+			ids[id] = struct{}{}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.ids = ids
+	r.modTime = fi.ModTime()
+	r.mu.Unlock()
+
+	return nil
+}
+
+// IsRevoked checks the JWT ID in the revocation list
+func (r *RevokedJTI) IsRevoked(ctx context.Context, jti string) (bool, error) {
+
+	if jti == "" {
+		return false, nil
+	}
+
+	if r.cfg.File != "" {
+
+		// reload the file if the refresh interval passed
+		r.mu.Lock()
+		refresh := time.Since(r.checkedAt) > r.cfg.RefreshInterval
+		if refresh {
+			r.checkedAt = time.Now()
+		}
+		r.mu.Unlock()
+
+		if refresh {
+			if err := r.load(); err != nil {
+				r.logger.Errorf("Denylist: can't reload revoked JWT IDs: %s", err)
+			}
+		}
+
+		r.mu.RLock()
+		_, found := r.ids[jti]
+		r.mu.RUnlock()
+
+		if found {
+			return true, nil
+		}
+	}
+
+	if r.redis != nil {
+		found, err := r.redis.SIsMember(ctx, r.cfg.RedisKey, jti).Result()
+		if err != nil {
+			return false, errors.Wrap(err, "revocation list check")
+		}
+		return found, nil
+	}
+
+	return false, nil
+}
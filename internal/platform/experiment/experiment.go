@@ -0,0 +1,168 @@
+package experiment
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/config"
+	"github.com/wallarm/api-firewall/internal/platform/web"
+)
+
+const (
+	CohortControl   = "control"
+	CohortTreatment = "treatment"
+
+	// cohortKey is the key of the cohort in the user values of the request context
+	cohortKey = "apifw.cohort"
+)
+
+// Cohort is the group of the clients validated by the same validation modes. The empty modes
+// of the cohort don't change the configured modes
+type Cohort struct {
+	Name               string
+	RequestValidation  string
+	ResponseValidation string
+}
+
+// Experiment assigns the clients to the control and the treatment cohorts
+type Experiment struct {
+	name       string
+	percentage uint32
+	keyHeader  string
+
+	control   *Cohort
+	treatment *Cohort
+}
+
+// New creates the experiment. It returns nil if the experiment doesn't assign the clients to the treatment cohort
+func New(cfg *config.Experiment) *Experiment {
+
+	if cfg.Percentage <= 0 {
+		return nil
+	}
+
+	return &Experiment{
+		name:       cfg.Name,
+		percentage: uint32(cfg.Percentage),
+		keyHeader:  cfg.KeyHeader,
+		control:    &Cohort{Name: CohortControl},
+		treatment: &Cohort{
+			Name:               CohortTreatment,
+			RequestValidation:  cfg.RequestValidation,
+			ResponseValidation: cfg.ResponseValidation,
+		},
+	}
+}
+
+// Assign returns the cohort of the client. The client is identified by the value of the key header
+// or by the IP address. The hash of the client is salted by the name of the experiment, so the clients
+// of the treatment cohort are different in the experiments with the different names
+func (e *Experiment) Assign(ctx *fasthttp.RequestCtx) *Cohort {
+
+	h := fnv.New32a()
+	h.Write([]byte(e.name))
+	h.Write([]byte{0})
+
+	if key := ctx.Request.Header.Peek(e.keyHeader); e.keyHeader != "" && len(key) > 0 {
+		h.Write(key)
+	} else {
+		h.Write(ctx.RemoteIP())
+	}
+
+	if h.Sum32()%100 < e.percentage {
+		return e.treatment
+	}
+	return e.control
+}
+
+// SetCohort stores the cohort in the request context
+func SetCohort(ctx *fasthttp.RequestCtx, cohort *Cohort) {
+	ctx.SetUserValue(cohortKey, cohort)
+}
+
+// GetCohort returns the cohort of the request. It returns nil if the experiment is not enabled
+func GetCohort(ctx *fasthttp.RequestCtx) *Cohort {
+	cohort, _ := ctx.UserValue(cohortKey).(*Cohort)
+	return cohort
+}
+
+// Modes returns the validation modes of the cohort of the request: the modes of the cohort replace the configured modes
+func Modes(ctx *fasthttp.RequestCtx, request, response string) (string, string) {
+	cohort := GetCohort(ctx)
+	if cohort == nil {
+		return request, response
+	}
+
+	if cohort.RequestValidation != "" {
+		request = cohort.RequestValidation
+	}
+	if cohort.ResponseValidation != "" {
+		response = cohort.ResponseValidation
+	}
+
+	return request, response
+}
+
+// Stats are the numbers of the requests of the cohort by the verdict. The failed requests which
+// are not blocked and are accepted by the upstream (1xx-3xx responses) are suspected false positives
+type Stats struct {
+	Requests                int64 `json:"requests"`
+	Passed                  int64 `json:"passed"`
+	Failed                  int64 `json:"failed"`
+	Blocked                 int64 `json:"blocked"`
+	Skipped                 int64 `json:"skipped"`
+	SuspectedFalsePositives int64 `json:"suspected_false_positives"`
+}
+
+// cohorts are the numbers of the requests of the cohorts of all experiments
+var cohorts = struct {
+	mu    sync.Mutex
+	stats map[string]*Stats
+}{stats: make(map[string]*Stats)}
+
+// Observe counts the verdict of the request of the cohort
+func Observe(cohort *Cohort, verdict *web.Verdict, statusCode int) {
+	cohorts.mu.Lock()
+	defer cohorts.mu.Unlock()
+
+	stats, ok := cohorts.stats[cohort.Name]
+	if !ok {
+		stats = &Stats{}
+		cohorts.stats[cohort.Name] = stats
+	}
+
+	stats.Requests++
+
+	if verdict == nil {
+		stats.Skipped++
+		return
+	}
+
+	switch verdict.Decision {
+	case web.VerdictPassed:
+		stats.Passed++
+	case web.VerdictFailed:
+		stats.Failed++
+		if statusCode < fasthttp.StatusBadRequest {
+			stats.SuspectedFalsePositives++
+		}
+	case web.VerdictBlocked:
+		stats.Blocked++
+	default:
+		stats.Skipped++
+	}
+}
+
+// Snapshot returns the copy of the numbers of the requests by cohort
+func Snapshot() map[string]Stats {
+	cohorts.mu.Lock()
+	defer cohorts.mu.Unlock()
+
+	snapshot := make(map[string]Stats, len(cohorts.stats))
+	for name, stats := range cohorts.stats {
+		snapshot[name] = *stats
+	}
+
+	return snapshot
+}
@@ -0,0 +1,167 @@
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wallarm/api-firewall/internal/config"
+)
+
+// Location is the geolocation and the autonomous system of the client IP address
+type Location struct {
+	Country      string `json:"country,omitempty"`
+	City         string `json:"city,omitempty"`
+	ASN          uint   `json:"asn,omitempty"`
+	Organization string `json:"as_org,omitempty"`
+}
+
+// Enricher looks up the client IP addresses in the local MaxMind DB files
+type Enricher struct {
+	mu       sync.RWMutex
+	city     *database
+	asn      *database
+	language string
+}
+
+// Default is the enricher of the logs and the events. It doesn't return the locations until it's loaded
+var Default = &Enricher{}
+
+// Load opens the City (or Country) and the ASN databases of the configuration. The files which are
+// not configured are not looked up
+func (e *Enricher) Load(cfg *config.GeoIP) error {
+
+	var city, asn *database
+	var err error
+
+	if cfg.CityDatabase != "" {
+		if city, err = openDatabase(cfg.CityDatabase); err != nil {
+			return fmt.Errorf("%s: %w", cfg.CityDatabase, err)
+		}
+	}
+
+	if cfg.ASNDatabase != "" {
+		if asn, err = openDatabase(cfg.ASNDatabase); err != nil {
+			return fmt.Errorf("%s: %w", cfg.ASNDatabase, err)
+		}
+	}
+
+	e.mu.Lock()
+	e.city, e.asn, e.language = city, asn, cfg.Language
+	e.mu.Unlock()
+
+	return nil
+}
+
+// Enabled returns true if any database is loaded
+func (e *Enricher) Enabled() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.city != nil || e.asn != nil
+}
+
+// Lookup returns the location of the IP address. The fields which are not found are empty
+func (e *Enricher) Lookup(ip net.IP) Location {
+
+	var location Location
+	if ip == nil {
+		return location
+	}
+
+	e.mu.RLock()
+	city, asn, language := e.city, e.asn, e.language
+	e.mu.RUnlock()
+
+	if city != nil {
+		if record, err := city.lookup(ip); err == nil {
+			location.Country, _ = lookupPath(record, "country", "iso_code").(string)
+			location.City, _ = lookupPath(record, "city", "names", language).(string)
+			// the city names missing in the configured language are returned in English
+			if location.City == "" {
+				location.City, _ = lookupPath(record, "city", "names", "en").(string)
+			}
+		}
+	}
+
+	if asn != nil {
+		if record, err := asn.lookup(ip); err == nil {
+			location.ASN = toUint(lookupPath(record, "autonomous_system_number"))
+			location.Organization, _ = lookupPath(record, "autonomous_system_organization").(string)
+		}
+	}
+
+	return location
+}
+
+// lookupPath returns the value of the nested maps of the record
+func lookupPath(record interface{}, path ...string) interface{} {
+	for _, key := range path {
+		m, ok := record.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		record = m[key]
+	}
+	return record
+}
+
+// Fields returns the log fields of the location
+func (l Location) Fields() logrus.Fields {
+	fields := logrus.Fields{}
+	if l.Country != "" {
+		fields["country"] = l.Country
+	}
+	if l.City != "" {
+		fields["city"] = l.City
+	}
+	if l.ASN != 0 {
+		fields["asn"] = l.ASN
+	}
+	if l.Organization != "" {
+		fields["as_org"] = l.Organization
+	}
+	return fields
+}
+
+// Hook adds the location fields of the client address to the log entries with the client_address field
+type Hook struct {
+	Enricher *Enricher
+}
+
+// Levels returns all levels
+func (h *Hook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire adds the location fields to the entry
+func (h *Hook) Fire(entry *logrus.Entry) error {
+
+	address, ok := entry.Data["client_address"]
+	if !ok {
+		return nil
+	}
+
+	var ip net.IP
+	switch a := address.(type) {
+	case *net.TCPAddr:
+		ip = a.IP
+	case net.IP:
+		ip = a
+	default:
+		host := fmt.Sprint(a)
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		ip = net.ParseIP(host)
+	}
+
+	for name, value := range h.Enricher.Lookup(ip).Fields() {
+		if _, ok := entry.Data[name]; !ok {
+			entry.Data[name] = value
+		}
+	}
+
+	return nil
+}
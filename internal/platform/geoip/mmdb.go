@@ -0,0 +1,309 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"os"
+)
+
+// metadataMarker precedes the metadata section of the MaxMind DB file
+var metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+var errInvalidDatabase = errors.New("geoip: invalid MaxMind DB file")
+
+// database reads the records of the MaxMind DB file (format version 2) loaded into memory
+type database struct {
+	data       []byte
+	dataStart  int
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	ipv4Start  uint
+	dbType     string
+}
+
+// openDatabase loads the MaxMind DB file
+func openDatabase(path string) (*database, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return newDatabase(data)
+}
+
+func newDatabase(data []byte) (*database, error) {
+	i := bytes.LastIndex(data, metadataMarker)
+	if i < 0 {
+		return nil, errInvalidDatabase
+	}
+
+	metadataStart := i + len(metadataMarker)
+	metadata, _, err := (&decoder{data: data[metadataStart:]}).decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("geoip: metadata: %w", err)
+	}
+	fields, ok := metadata.(map[string]interface{})
+	if !ok {
+		return nil, errInvalidDatabase
+	}
+
+	db := &database{data: data}
+	db.nodeCount = toUint(fields["node_count"])
+	db.recordSize = toUint(fields["record_size"])
+	db.ipVersion = toUint(fields["ip_version"])
+	db.dbType, _ = fields["database_type"].(string)
+
+	if major := toUint(fields["binary_format_major_version"]); major != 2 {
+		return nil, fmt.Errorf("geoip: unsupported binary format version %d", major)
+	}
+	switch db.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("geoip: unsupported record size %d", db.recordSize)
+	}
+
+	treeSize := int(db.nodeCount * db.recordSize / 4)
+	db.dataStart = treeSize + 16
+	if db.dataStart > i {
+		return nil, errInvalidDatabase
+	}
+
+	// the IPv4 addresses are the ::/96 subnet of the IPv6 tree
+	if db.ipVersion == 6 {
+		node := uint(0)
+		for b := 0; b < 96 && node < db.nodeCount; b++ {
+			node = db.record(node, 0)
+		}
+		db.ipv4Start = node
+	}
+
+	return db, nil
+}
+
+// record returns the left (bit 0) or the right (bit 1) record of the node
+func (db *database) record(node uint, bit uint) uint {
+	b := db.data[node*db.recordSize/4:]
+	switch db.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	}
+	return uint(binary.BigEndian.Uint32(b[bit*4:]))
+}
+
+// lookup returns the record of the IP address or nil if the address is not found
+func (db *database) lookup(ip net.IP) (interface{}, error) {
+	node := uint(0)
+	bits := 128
+
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		bits = 32
+		if db.ipVersion == 6 {
+			node = db.ipv4Start
+		}
+	} else if db.ipVersion == 4 {
+		return nil, nil
+	}
+
+	for i := 0; i < bits && node < db.nodeCount; i++ {
+		bit := uint(ip[i/8]>>(7-uint(i%8))) & 1
+		node = db.record(node, bit)
+	}
+
+	switch {
+	case node == db.nodeCount:
+		return nil, nil
+	case node < db.nodeCount:
+		return nil, errInvalidDatabase
+	}
+
+	offset := int(node-db.nodeCount) - 16
+	record, _, err := (&decoder{data: db.data[db.dataStart:]}).decode(offset)
+	return record, err
+}
+
+// decoder decodes the values of the data section
+type decoder struct {
+	data []byte
+}
+
+const (
+	typePointer = 1
+	typeString  = 2
+	typeDouble  = 3
+	typeBytes   = 4
+	typeUint16  = 5
+	typeUint32  = 6
+	typeMap     = 7
+	typeInt32   = 8
+	typeUint64  = 9
+	typeUint128 = 10
+	typeArray   = 11
+	typeBoolean = 14
+	typeFloat   = 15
+)
+
+// decode returns the value at the offset and the offset of the next value
+func (d *decoder) decode(offset int) (interface{}, int, error) {
+	if offset < 0 || offset >= len(d.data) {
+		return nil, 0, errInvalidDatabase
+	}
+
+	ctrl := d.data[offset]
+	offset++
+
+	kind := int(ctrl >> 5)
+	if kind == typePointer {
+		pointer, next, err := d.pointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decode(pointer)
+		return value, next, err
+	}
+
+	// the extended types
+	if kind == 0 {
+		if offset >= len(d.data) {
+			return nil, 0, errInvalidDatabase
+		}
+		kind = 7 + int(d.data[offset])
+		offset++
+	}
+
+	size := int(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if offset+n > len(d.data) {
+			return nil, 0, errInvalidDatabase
+		}
+		v := 0
+		for _, b := range d.data[offset : offset+n] {
+			v = v<<8 | int(b)
+		}
+		offset += n
+		switch size {
+		case 29:
+			size = 29 + v
+		case 30:
+			size = 285 + v
+		default:
+			size = 65821 + v
+		}
+	}
+
+	switch kind {
+	case typeMap:
+		m := make(map[string]interface{}, size)
+		for i := 0; i < size; i++ {
+			key, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, 0, errInvalidDatabase
+			}
+			value, next, err := d.decode(next)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[name] = value
+			offset = next
+		}
+		return m, offset, nil
+	case typeArray:
+		a := make([]interface{}, 0, size)
+		for i := 0; i < size; i++ {
+			value, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, value)
+			offset = next
+		}
+		return a, offset, nil
+	case typeBoolean:
+		return size != 0, offset, nil
+	}
+
+	if offset+size > len(d.data) {
+		return nil, 0, errInvalidDatabase
+	}
+	b := d.data[offset : offset+size]
+	offset += size
+
+	switch kind {
+	case typeString:
+		return string(b), offset, nil
+	case typeBytes:
+		return append([]byte(nil), b...), offset, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, errInvalidDatabase
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, errInvalidDatabase
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), offset, nil
+	case typeUint16, typeUint32, typeUint64:
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		return v, offset, nil
+	case typeInt32:
+		var v uint32
+		for _, c := range b {
+			v = v<<8 | uint32(c)
+		}
+		return int64(int32(v)), offset, nil
+	case typeUint128:
+		return new(big.Int).SetBytes(b), offset, nil
+	}
+
+	return nil, 0, fmt.Errorf("geoip: unsupported data type %d", kind)
+}
+
+// pointer returns the offset of the pointed value and the offset after the pointer
+func (d *decoder) pointer(ctrl byte, offset int) (int, int, error) {
+	n := int((ctrl>>3)&0x3) + 1
+	if offset+n > len(d.data) {
+		return 0, 0, errInvalidDatabase
+	}
+
+	v := 0
+	if n < 4 {
+		v = int(ctrl & 0x7)
+	}
+	for _, b := range d.data[offset : offset+n] {
+		v = v<<8 | int(b)
+	}
+
+	switch n {
+	case 2:
+		v += 2048
+	case 3:
+		v += 526336
+	}
+
+	return v, offset + n, nil
+}
+
+func toUint(v interface{}) uint {
+	n, _ := v.(uint64)
+	return uint(n)
+}
@@ -0,0 +1,185 @@
+package graphql
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/config"
+)
+
+var (
+	// ErrNoQuery is returned when the request has neither the query nor the hash of the persisted query
+	ErrNoQuery = errors.New("graphql query is missing")
+	// ErrHashMismatch is returned when the hash of the persisted query differs from the hash of the sent query
+	ErrHashMismatch = errors.New("graphql query doesn't match the persisted query hash")
+	// ErrNotAllowed is returned when the hash of the query is not in the allowlist
+	ErrNotAllowed = errors.New("graphql query is not in the persisted queries allowlist")
+)
+
+// Query is the GraphQL request. The persisted query is sent by the SHA-256 hash in the extensions
+// as in the automatic persisted queries protocol
+type Query struct {
+	Query      string `json:"query"`
+	Extensions struct {
+		PersistedQuery *struct {
+			SHA256Hash string `json:"sha256Hash"`
+		} `json:"persistedQuery"`
+	} `json:"extensions"`
+}
+
+// Allowlist contains the SHA-256 hashes of the pre-approved queries
+type Allowlist struct {
+	hashes map[string]struct{}
+}
+
+// New loads the hashes of the persisted queries from the configuration and the file with one hash per line.
+// It returns nil if no hashes are configured
+func New(cfg *config.GraphQL) (*Allowlist, error) {
+
+	if len(cfg.PersistedQueries) == 0 && cfg.PersistedQueriesFile == "" {
+		return nil, nil
+	}
+
+	a := Allowlist{hashes: make(map[string]struct{}, len(cfg.PersistedQueries))}
+	for _, hash := range cfg.PersistedQueries {
+		if err := a.add(hash); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.PersistedQueriesFile != "" {
+		f, err := os.Open(cfg.PersistedQueriesFile)
+		if err != nil {
+			return nil, fmt.Errorf("persisted queries file: %w", err)
+		}
+		defer f.Close()
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			if err := a.add(line); err != nil {
+				return nil, err
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("persisted queries file: %w", err)
+		}
+	}
+
+	return &a, nil
+}
+
+func (a *Allowlist) add(hash string) error {
+	hash = strings.ToLower(strings.TrimSpace(hash))
+	if decoded, err := hex.DecodeString(hash); err != nil || len(decoded) != sha256.Size {
+		return fmt.Errorf("invalid persisted query hash %q", hash)
+	}
+	a.hashes[hash] = struct{}{}
+	return nil
+}
+
+// Len returns the number of the allowed queries
+func (a *Allowlist) Len() int {
+	return len(a.hashes)
+}
+
+// Check returns an error if any query of the request is not in the allowlist. The queries are read
+// from the query string of the GET requests and from the JSON (including the batches) or the application/graphql
+// body of the POST requests
+func (a *Allowlist) Check(req *fasthttp.Request) error {
+
+	queries, err := parseQueries(req)
+	if err != nil {
+		return err
+	}
+
+	if len(queries) == 0 {
+		return ErrNoQuery
+	}
+
+	for _, query := range queries {
+		hash, err := query.Hash()
+		if err != nil {
+			return err
+		}
+		if _, ok := a.hashes[hash]; !ok {
+			return fmt.Errorf("%w: %s", ErrNotAllowed, hash)
+		}
+	}
+
+	return nil
+}
+
+// Hash returns the SHA-256 hash of the query. The hash of the persisted query has to match the query if both are sent
+func (q *Query) Hash() (string, error) {
+
+	var hash string
+	if q.Extensions.PersistedQuery != nil {
+		hash = strings.ToLower(q.Extensions.PersistedQuery.SHA256Hash)
+	}
+
+	if q.Query != "" {
+		sum := sha256.Sum256([]byte(q.Query))
+		queryHash := hex.EncodeToString(sum[:])
+		if hash != "" && hash != queryHash {
+			return "", ErrHashMismatch
+		}
+		return queryHash, nil
+	}
+
+	if hash == "" {
+		return "", ErrNoQuery
+	}
+
+	return hash, nil
+}
+
+func parseQueries(req *fasthttp.Request) ([]Query, error) {
+
+	if req.Header.IsGet() {
+		var query Query
+		args := req.URI().QueryArgs()
+		query.Query = string(args.Peek("query"))
+		if extensions := args.Peek("extensions"); len(extensions) > 0 {
+			if err := json.Unmarshal(extensions, &query.Extensions); err != nil {
+				return nil, fmt.Errorf("graphql extensions: %w", err)
+			}
+		}
+		return []Query{query}, nil
+	}
+
+	contentType := strings.ToLower(strings.TrimSpace(strings.Split(string(req.Header.ContentType()), ";")[0]))
+	body := bytes.TrimSpace(req.Body())
+
+	switch contentType {
+	case "application/graphql":
+		return []Query{{Query: string(body)}}, nil
+	case "application/json":
+		var queries []Query
+		if bytes.HasPrefix(body, []byte("[")) {
+			if err := json.Unmarshal(body, &queries); err != nil {
+				return nil, fmt.Errorf("graphql batch: %w", err)
+			}
+			return queries, nil
+		}
+
+		var query Query
+		if err := json.Unmarshal(body, &query); err != nil {
+			return nil, fmt.Errorf("graphql request: %w", err)
+		}
+		return []Query{query}, nil
+	}
+
+	return nil, fmt.Errorf("graphql request: unsupported content type %q", contentType)
+}
@@ -0,0 +1,205 @@
+package grpcweb
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	// ContentTypeGRPC is the content type of the native gRPC messages
+	ContentTypeGRPC = "application/grpc+proto"
+
+	contentTypeGRPCWeb     = "application/grpc-web"
+	contentTypeGRPCWebText = "application/grpc-web-text"
+
+	// the status codes of the errors returned by the firewall
+	StatusInvalidArgument = 3
+	StatusInternal        = 13
+
+	headerStatus  = "grpc-status"
+	headerMessage = "grpc-message"
+
+	flagCompressed = 0x01
+	flagTrailer    = 0x80
+
+	frameHeaderSize = 5
+)
+
+var (
+	// ErrCompressed is returned for the compressed messages, as the messages are validated by the descriptors
+	ErrCompressed = errors.New("grpc-web: compressed messages are not supported")
+	// ErrMalformedFrame is returned when the length of the frame exceeds the body
+	ErrMalformedFrame = errors.New("grpc-web: malformed frame")
+)
+
+// Mode returns true if the content type is gRPC-Web and whether the body is base64 encoded (grpc-web-text)
+func Mode(contentType string) (isGRPCWeb bool, text bool) {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	for _, suffix := range []string{"", "+proto"} {
+		switch mediaType {
+		case contentTypeGRPCWeb + suffix:
+			return true, false
+		case contentTypeGRPCWebText + suffix:
+			return true, true
+		}
+	}
+	return false, false
+}
+
+// Frames returns the binary frames of the gRPC-Web body. The body of grpc-web-text is base64 decoded,
+// the chunks of the stream are encoded separately, so each padded chunk is decoded as is
+func Frames(body []byte, text bool) ([]byte, error) {
+	if !text {
+		return body, nil
+	}
+
+	body = bytes.Join(bytes.Fields(body), nil)
+
+	var frames []byte
+	for len(body) > 0 {
+		// the chunk ends after the padding
+		end := len(body)
+		if i := bytes.IndexByte(body, '='); i >= 0 {
+			end = i
+			for end < len(body) && body[end] == '=' {
+				end++
+			}
+		}
+
+		decoded := make([]byte, base64.StdEncoding.DecodedLen(end))
+		n, err := base64.StdEncoding.Decode(decoded, body[:end])
+		if err != nil {
+			return nil, fmt.Errorf("grpc-web: %w", err)
+		}
+		frames = append(frames, decoded[:n]...)
+		body = body[end:]
+	}
+
+	return frames, nil
+}
+
+// Messages returns the data messages of the frames and the trailer frame if present
+func Messages(frames []byte) (messages [][]byte, trailer []byte, err error) {
+	for len(frames) > 0 {
+		if len(frames) < frameHeaderSize {
+			return nil, nil, ErrMalformedFrame
+		}
+
+		flag := frames[0]
+		length := binary.BigEndian.Uint32(frames[1:frameHeaderSize])
+		if uint64(len(frames)-frameHeaderSize) < uint64(length) {
+			return nil, nil, ErrMalformedFrame
+		}
+
+		payload := frames[frameHeaderSize : frameHeaderSize+int(length)]
+		frames = frames[frameHeaderSize+int(length):]
+
+		switch {
+		case flag&flagTrailer != 0:
+			trailer = payload
+		case flag&flagCompressed != 0:
+			return nil, nil, ErrCompressed
+		default:
+			messages = append(messages, payload)
+		}
+	}
+
+	return messages, trailer, nil
+}
+
+// appendFrame appends the frame with the flag and the payload
+func appendFrame(dst []byte, flag byte, payload []byte) []byte {
+	var header [frameHeaderSize]byte
+	header[0] = flag
+	binary.BigEndian.PutUint32(header[1:], uint32(len(payload)))
+	return append(append(dst, header[:]...), payload...)
+}
+
+// Request converts the gRPC-Web request to the native gRPC request with the binary frames
+func Request(req *fasthttp.Request, frames []byte) {
+	req.Header.SetContentType(ContentTypeGRPC)
+	req.Header.Set("Te", "trailers")
+	req.Header.Del("X-Grpc-Web")
+	req.SetBody(frames)
+}
+
+// Response converts the native gRPC response to the gRPC-Web response. The trailers of the response
+// are sent in the trailer frame at the end of the body. The trailers-only responses are sent as is
+func Response(resp *fasthttp.Response, text bool) {
+
+	var trailer []byte
+	resp.Header.VisitAllTrailer(func(name []byte) {
+		for _, value := range peekAll(&resp.Header, name) {
+			trailer = append(trailer, strings.ToLower(string(name))...)
+			trailer = append(trailer, ':')
+			trailer = append(trailer, value...)
+			trailer = append(trailer, '\r', '\n')
+		}
+	})
+
+	var names []string
+	resp.Header.VisitAllTrailer(func(name []byte) {
+		names = append(names, string(name))
+	})
+	for _, name := range names {
+		resp.Header.Del(name)
+	}
+	resp.Header.Del(fasthttp.HeaderTrailer)
+
+	body := append([]byte(nil), resp.Body()...)
+	if len(trailer) > 0 {
+		body = appendFrame(body, flagTrailer, trailer)
+	}
+
+	setBody(resp, body, text)
+}
+
+// Error sets the trailers-only gRPC-Web response with the status code and the message
+func Error(resp *fasthttp.Response, code int, message string, text bool) {
+	resp.Reset()
+	resp.SetStatusCode(fasthttp.StatusOK)
+	resp.Header.Set(headerStatus, strconv.Itoa(code))
+	resp.Header.Set(headerMessage, percentEncode(message))
+	setBody(resp, nil, text)
+}
+
+func setBody(resp *fasthttp.Response, body []byte, text bool) {
+	if text {
+		resp.Header.SetContentType(contentTypeGRPCWebText + "+proto")
+		resp.SetBodyString(base64.StdEncoding.EncodeToString(body))
+		return
+	}
+	resp.Header.SetContentType(contentTypeGRPCWeb + "+proto")
+	resp.SetBody(body)
+}
+
+func peekAll(header *fasthttp.ResponseHeader, name []byte) [][]byte {
+	var values [][]byte
+	header.VisitAll(func(key, value []byte) {
+		if bytes.EqualFold(key, name) {
+			values = append(values, value)
+		}
+	})
+	return values
+}
+
+// percentEncode encodes the grpc-message as required by the gRPC protocol
+func percentEncode(message string) string {
+	var b strings.Builder
+	for i := 0; i < len(message); i++ {
+		c := message[i]
+		if c >= ' ' && c <= '~' && c != '%' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
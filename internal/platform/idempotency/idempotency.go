@@ -0,0 +1,72 @@
+package idempotency
+
+import (
+	"sync"
+	"time"
+
+	"github.com/karlseguin/ccache/v2"
+)
+
+// Response is the completed response stored for the idempotency key
+type Response struct {
+	RequestHash [32]byte
+	StatusCode  int
+	Headers     [][2]string
+	Body        []byte
+}
+
+// Store keeps the responses of the completed requests for the TTL and
+// tracks the keys of the requests which are in progress
+type Store struct {
+	cache *ccache.Cache
+	ttl   time.Duration
+
+	mu         sync.Mutex
+	inProgress map[string]struct{}
+}
+
+// New creates the store of the responses
+func New(ttl time.Duration) *Store {
+	return &Store{
+		cache:      ccache.New(ccache.Configure()),
+		ttl:        ttl,
+		inProgress: make(map[string]struct{}),
+	}
+}
+
+// Begin returns the stored response of the key. If the response is not stored then the key
+// is marked as in progress until the request is completed or aborted. The function returns
+// false if the request with the same key is in progress
+func (s *Store) Begin(key string) (*Response, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if item := s.cache.Get(key); item != nil && !item.Expired() {
+		return item.Value().(*Response), true
+	}
+
+	if _, found := s.inProgress[key]; found {
+		return nil, false
+	}
+
+	s.inProgress[key] = struct{}{}
+
+	return nil, true
+}
+
+// Complete stores the response of the key for the TTL
+func (s *Store) Complete(key string, response *Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cache.Set(key, response, s.ttl)
+	delete(s.inProgress, key)
+}
+
+// Abort removes the in progress mark of the key without storing the response
+func (s *Store) Abort(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.inProgress, key)
+}
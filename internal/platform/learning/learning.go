@@ -0,0 +1,219 @@
+package learning
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/valyala/fastjson"
+)
+
+const (
+	// KindNewField is the property of the request body which is not described by the schema
+	KindNewField = "new_field"
+	// KindEnumValue is the value which is not listed in the enum of the schema
+	KindEnumValue = "enum_value"
+)
+
+// Suggestion is the schema update suggested by the observed request bodies. The path is
+// the JSON pointer of the property, the items of the arrays are addressed by "*"
+type Suggestion struct {
+	Kind      string    `json:"kind"`
+	Path      string    `json:"path"`
+	Type      string    `json:"type,omitempty"`
+	Value     string    `json:"value,omitempty"`
+	Count     int64     `json:"count"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// Observe compares the JSON value with the schema and calls found for each property which is not
+// described by the schema and each value which is not listed in the enum
+func Observe(schema *openapi3.Schema, value *fastjson.Value, path string, found func(kind, path, valueType, value string)) {
+
+	if schema == nil || value == nil {
+		return
+	}
+
+	switch value.Type() {
+	case fastjson.TypeObject:
+		// the values of the maps are described by the additional properties schema
+		if schema.AdditionalProperties != nil && schema.AdditionalProperties.Value != nil {
+			value.GetObject().Visit(func(key []byte, v *fastjson.Value) {
+				Observe(schema.AdditionalProperties.Value, v, path+"/"+string(key), found)
+			})
+			return
+		}
+
+		// the properties of the oneOf and anyOf schemas are ambiguous
+		if len(schema.OneOf) > 0 || len(schema.AnyOf) > 0 {
+			return
+		}
+
+		properties := make(openapi3.Schemas, len(schema.Properties))
+		for name, property := range schema.Properties {
+			properties[name] = property
+		}
+		for _, s := range schema.AllOf {
+			if s.Value != nil {
+				for name, property := range s.Value.Properties {
+					properties[name] = property
+				}
+			}
+		}
+
+		value.GetObject().Visit(func(key []byte, v *fastjson.Value) {
+			property, ok := properties[string(key)]
+			if !ok {
+				found(KindNewField, path+"/"+string(key), typeName(v), "")
+				return
+			}
+			Observe(property.Value, v, path+"/"+string(key), found)
+		})
+	case fastjson.TypeArray:
+		if schema.Items == nil {
+			return
+		}
+		for _, item := range value.GetArray() {
+			Observe(schema.Items.Value, item, path+"/*", found)
+		}
+	case fastjson.TypeString, fastjson.TypeNumber:
+		if len(schema.Enum) == 0 {
+			return
+		}
+
+		var observed string
+		if value.Type() == fastjson.TypeString {
+			observed = string(value.GetStringBytes())
+		} else {
+			observed = strconv.FormatFloat(value.GetFloat64(), 'f', -1, 64)
+		}
+
+		for _, item := range schema.Enum {
+			switch enumValue := item.(type) {
+			case string:
+				if enumValue == observed {
+					return
+				}
+			case float64:
+				if strconv.FormatFloat(enumValue, 'f', -1, 64) == observed {
+					return
+				}
+			}
+		}
+
+		found(KindEnumValue, path, typeName(value), observed)
+	}
+}
+
+func typeName(value *fastjson.Value) string {
+	switch value.Type() {
+	case fastjson.TypeObject:
+		return "object"
+	case fastjson.TypeArray:
+		return "array"
+	case fastjson.TypeString:
+		return "string"
+	case fastjson.TypeNumber:
+		return "number"
+	case fastjson.TypeTrue, fastjson.TypeFalse:
+		return "boolean"
+	}
+	return "null"
+}
+
+// Report collects the suggestions by operation. The new suggestions are not added
+// when the number of the suggestions reaches the limit
+type Report struct {
+	mu         sync.Mutex
+	limit      int
+	count      int
+	operations map[string]map[string]*Suggestion
+}
+
+// Suggestions is the report of the schema updates suggested for all operations
+var Suggestions = &Report{operations: make(map[string]map[string]*Suggestion)}
+
+// SetLimit sets the max number of the suggestions. Zero means no limit
+func (r *Report) SetLimit(limit int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.limit = limit
+}
+
+// Add counts the suggestion for the operation
+func (r *Report) Add(operation, kind, path, valueType, value string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	key := kind + ":" + path + ":" + value
+
+	suggestions, ok := r.operations[operation]
+	if !ok {
+		suggestions = make(map[string]*Suggestion)
+		r.operations[operation] = suggestions
+	}
+
+	if s, ok := suggestions[key]; ok {
+		s.Count++
+		s.LastSeen = now
+		return
+	}
+
+	if r.limit > 0 && r.count >= r.limit {
+		return
+	}
+
+	suggestions[key] = &Suggestion{
+		Kind:      kind,
+		Path:      path,
+		Type:      valueType,
+		Value:     value,
+		Count:     1,
+		FirstSeen: now,
+		LastSeen:  now,
+	}
+	r.count++
+}
+
+// Snapshot returns the suggestions by operation sorted by the path
+func (r *Report) Snapshot() map[string][]Suggestion {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	snapshot := make(map[string][]Suggestion, len(r.operations))
+	for operation, suggestions := range r.operations {
+		list := make([]Suggestion, 0, len(suggestions))
+		for _, s := range suggestions {
+			list = append(list, *s)
+		}
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].Path != list[j].Path {
+				return list[i].Path < list[j].Path
+			}
+			return list[i].Value < list[j].Value
+		})
+		snapshot[operation] = list
+	}
+
+	return snapshot
+}
+
+// Reset removes the suggestions of the operation or all suggestions if the operation is empty
+func (r *Report) Reset(operation string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if operation == "" {
+		r.operations = make(map[string]map[string]*Suggestion)
+		r.count = 0
+		return
+	}
+
+	r.count -= len(r.operations[operation])
+	delete(r.operations, operation)
+}
@@ -0,0 +1,277 @@
+package loader
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/config"
+)
+
+const (
+	SchemeS3    = "s3"
+	SchemeGCS   = "gs"
+	SchemeAzure = "azblob"
+
+	gcsMetadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+	emptyPayloadHash    = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// IsBlobURL returns true if the URL points to the object in the blob storage
+func IsBlobURL(u *url.URL) bool {
+	switch u.Scheme {
+	case SchemeS3, SchemeGCS, SchemeAzure:
+		return true
+	}
+	return false
+}
+
+// LoadBlob downloads the object from the blob storage. Supported URLs are:
+//
+//	s3://bucket/key                    AWS S3 or S3 compatible storage (credentials from AWS_* env variables)
+//	gs://bucket/object                 Google Cloud Storage (token from GOOGLE_OAUTH_ACCESS_TOKEN or instance metadata)
+//	azblob://account/container/blob    Azure Blob Storage (SAS token from AZURE_STORAGE_SAS_TOKEN)
+func LoadBlob(cfg *config.BlobStorage, u *url.URL) ([]byte, error) {
+	data, _, _, err := downloadBlob(cfg, u, "")
+	return data, err
+}
+
+// Blob polls the object in the blob storage. The object is downloaded if its ETag is changed
+// and is compared with the previous object by the SHA-256 checksum
+type Blob struct {
+	Cfg *config.BlobStorage
+	URL *url.URL
+
+	data     []byte
+	etag     string
+	checksum [sha256.Size]byte
+}
+
+func NewBlob(cfg *config.BlobStorage, u *url.URL) *Blob {
+	return &Blob{
+		Cfg: cfg,
+		URL: u,
+	}
+}
+
+// Fetch downloads the object. It returns true if the content of the object has been changed since the last fetch
+func (b *Blob) Fetch() (bool, error) {
+
+	data, etag, notModified, err := downloadBlob(b.Cfg, b.URL, b.etag)
+	if err != nil {
+		return false, err
+	}
+	if notModified {
+		return false, nil
+	}
+
+	b.etag = etag
+
+	checksum := sha256.Sum256(data)
+	if b.data != nil && checksum == b.checksum {
+		return false, nil
+	}
+
+	b.data = data
+	b.checksum = checksum
+
+	return true, nil
+}
+
+// Data returns the content of the last fetched object
+func (b *Blob) Data() []byte {
+	return b.data
+}
+
+// Checksum returns the hex SHA-256 checksum of the last fetched object
+func (b *Blob) Checksum() string {
+	return hex.EncodeToString(b.checksum[:])
+}
+
+// downloadBlob downloads the object if its ETag doesn't match the etag. It returns the content and the ETag
+// of the object, notModified is true if the object matches the etag
+func downloadBlob(cfg *config.BlobStorage, u *url.URL, etag string) (data []byte, newETag string, notModified bool, err error) {
+
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+
+	res := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(res)
+
+	req.Header.SetMethod(fasthttp.MethodGet)
+
+	objectPath := strings.TrimPrefix(u.Path, "/")
+
+	switch u.Scheme {
+	case SchemeS3:
+		endpoint := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", u.Host, cfg.S3Region, objectPath)
+		if cfg.S3Endpoint != "" {
+			// path-style requests to the S3 compatible storage
+			endpoint = fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(cfg.S3Endpoint, "/"), u.Host, objectPath)
+		}
+		req.SetRequestURI(endpoint)
+
+		if etag != "" {
+			req.Header.Set(fasthttp.HeaderIfNoneMatch, etag)
+		}
+
+		if accessKey := os.Getenv("AWS_ACCESS_KEY_ID"); accessKey != "" {
+			signS3Request(req, cfg.S3Region, accessKey, os.Getenv("AWS_SECRET_ACCESS_KEY"), os.Getenv("AWS_SESSION_TOKEN"), time.Now().UTC())
+		}
+
+	case SchemeGCS:
+		req.SetRequestURI(fmt.Sprintf("https://storage.googleapis.com/storage/v1/b/%s/o/%s?alt=media", u.Host, url.PathEscape(objectPath)))
+
+		token, err := gcsToken(cfg)
+		if err != nil {
+			return nil, "", false, errors.Wrap(err, "getting GCS access token")
+		}
+		req.Header.Set(fasthttp.HeaderAuthorization, "Bearer "+token)
+
+		if etag != "" {
+			req.Header.Set(fasthttp.HeaderIfNoneMatch, etag)
+		}
+
+	case SchemeAzure:
+		endpoint := fmt.Sprintf("https://%s.blob.core.windows.net/%s", u.Host, objectPath)
+		if sas := strings.TrimPrefix(os.Getenv("AZURE_STORAGE_SAS_TOKEN"), "?"); sas != "" {
+			endpoint += "?" + sas
+		}
+		req.SetRequestURI(endpoint)
+		req.Header.Set("x-ms-version", "2020-04-08")
+
+		if etag != "" {
+			req.Header.Set(fasthttp.HeaderIfNoneMatch, etag)
+		}
+
+	default:
+		return nil, "", false, fmt.Errorf("unsupported blob storage scheme: %s", u.Scheme)
+	}
+
+	if err := fasthttp.DoTimeout(req, res, cfg.Timeout); err != nil {
+		return nil, "", false, err
+	}
+
+	switch res.StatusCode() {
+	case fasthttp.StatusOK:
+	case fasthttp.StatusNotModified:
+		if etag != "" {
+			return nil, etag, true, nil
+		}
+		fallthrough
+	default:
+		return nil, "", false, fmt.Errorf("unexpected status code %d from %s", res.StatusCode(), u.String())
+	}
+
+	return append([]byte(nil), res.Body()...), string(res.Header.Peek(fasthttp.HeaderETag)), false, nil
+}
+
+// gcsToken returns the access token from the env variable or from the GCE instance metadata server
+func gcsToken(cfg *config.BlobStorage) (string, error) {
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return token, nil
+	}
+
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+
+	res := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(res)
+
+	req.SetRequestURI(gcsMetadataTokenURL)
+	req.Header.SetMethod(fasthttp.MethodGet)
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	if err := fasthttp.DoTimeout(req, res, cfg.Timeout); err != nil {
+		return "", errors.Wrap(err, "metadata server")
+	}
+
+	if res.StatusCode() != fasthttp.StatusOK {
+		return "", fmt.Errorf("unexpected status code %d from the metadata server", res.StatusCode())
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+
+	if err := json.Unmarshal(res.Body(), &token); err != nil {
+		return "", errors.Wrap(err, "metadata server")
+	}
+	if token.AccessToken == "" {
+		return "", errors.New("metadata server: empty access token")
+	}
+
+	return token.AccessToken, nil
+}
+
+// signS3Request signs the request with the AWS Signature Version 4
+func signS3Request(req *fasthttp.Request, region, accessKey, secretKey, sessionToken string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", emptyPayloadHash)
+	if sessionToken != "" {
+		req.Header.Set("x-amz-security-token", sessionToken)
+	}
+
+	headers := map[string]string{"host": string(req.URI().Host())}
+	req.Header.VisitAll(func(key, value []byte) {
+		name := strings.ToLower(string(key))
+		if name == "range" || strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.TrimSpace(string(value))
+		}
+	})
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	query, _ := url.ParseQuery(string(req.URI().QueryString()))
+
+	canonicalRequest := strings.Join([]string{
+		fasthttp.MethodGet,
+		string(req.URI().PathOriginal()),
+		strings.ReplaceAll(query.Encode(), "+", "%20"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptyPayloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalRequestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set(fasthttp.HeaderAuthorization, fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
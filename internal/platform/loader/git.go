@@ -0,0 +1,130 @@
+package loader
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/wallarm/api-firewall/internal/config"
+)
+
+// Git checks out the API Spec from the Git repository. The git binary is used
+// to fetch and check out the commits of the configured ref
+type Git struct {
+	Cfg      *config.GitSpecs
+	Logger   *logrus.Logger
+	revision string
+}
+
+func NewGit(cfg *config.GitSpecs, logger *logrus.Logger) *Git {
+	return &Git{
+		Cfg:    cfg,
+		Logger: logger,
+	}
+}
+
+// SpecPath returns the path of the API Spec in the local checkout
+func (g *Git) SpecPath() string {
+	return path.Join(g.Cfg.Dir, g.Cfg.Path)
+}
+
+// pinned returns true if the ref is the full SHA-1 or SHA-256 commit ID
+func (g *Git) pinned() bool {
+	if len(g.Cfg.Ref) != 40 && len(g.Cfg.Ref) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(g.Cfg.Ref)
+	return err == nil
+}
+
+// Fetch fetches the latest commit of the configured ref into the local repository and checks it out.
+// The commit is not checked out if its signature can't be verified. It returns true if the revision has been changed
+func (g *Git) Fetch(ctx context.Context) (bool, error) {
+
+	if _, err := os.Stat(path.Join(g.Cfg.Dir, ".git")); err != nil {
+		if !os.IsNotExist(err) {
+			return false, err
+		}
+
+		if _, err := g.git(ctx, "init", "--quiet", g.Cfg.Dir); err != nil {
+			return false, errors.Wrap(err, "initializing repository")
+		}
+		if _, err := g.git(ctx, "-C", g.Cfg.Dir, "remote", "add", "origin", g.Cfg.Repository); err != nil {
+			return false, errors.Wrap(err, "initializing repository")
+		}
+	} else if g.pinned() && g.revision == g.Cfg.Ref {
+		return false, nil
+	}
+
+	if _, err := g.git(ctx, "-C", g.Cfg.Dir, "fetch", "--quiet", "--depth", "1", "origin", g.Cfg.Ref); err != nil {
+		return false, errors.Wrap(err, "fetching repository")
+	}
+
+	out, err := g.git(ctx, "-C", g.Cfg.Dir, "rev-parse", "FETCH_HEAD")
+	if err != nil {
+		return false, errors.Wrap(err, "getting revision")
+	}
+
+	revision := strings.TrimSpace(string(out))
+	if g.pinned() && !strings.EqualFold(revision, g.Cfg.Ref) {
+		return false, errors.Errorf("fetched commit %s is not the pinned commit %s", revision, g.Cfg.Ref)
+	}
+	if revision == g.revision {
+		return false, nil
+	}
+
+	if g.Cfg.VerifySignature {
+		if _, err := g.git(ctx, "-C", g.Cfg.Dir, "verify-commit", revision); err != nil {
+			return false, errors.Wrapf(err, "verifying signature of commit %s", revision)
+		}
+	}
+
+	if _, err := g.git(ctx, "-C", g.Cfg.Dir, "checkout", "--quiet", "--force", revision); err != nil {
+		return false, errors.Wrap(err, "checking out repository")
+	}
+
+	g.Logger.Infof("Git: %s checked out at %s (%s)", g.Cfg.Repository, g.Cfg.Ref, revision)
+	g.revision = revision
+
+	return true, nil
+}
+
+// git runs the git command and returns its output. The access token and the allowed signers are passed
+// in the environment, so they are not visible in the command line and are not stored in the repository configuration
+func (g *Git) git(ctx context.Context, args ...string) ([]byte, error) {
+
+	var settings [][2]string
+	if g.Cfg.Token != "" {
+		credentials := base64.StdEncoding.EncodeToString([]byte(g.Cfg.Username + ":" + g.Cfg.Token))
+		settings = append(settings, [2]string{"http.extraHeader", "Authorization: Basic " + credentials})
+	}
+	if g.Cfg.AllowedSignersFile != "" {
+		settings = append(settings, [2]string{"gpg.ssh.allowedSignersFile", g.Cfg.AllowedSignersFile})
+	}
+
+	env := append(os.Environ(), "GIT_TERMINAL_PROMPT=0", fmt.Sprintf("GIT_CONFIG_COUNT=%d", len(settings)))
+	for i, setting := range settings {
+		env = append(env, fmt.Sprintf("GIT_CONFIG_KEY_%d=%s", i, setting[0]), fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", i, setting[1]))
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Env = env
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,198 @@
+package loader
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/config"
+)
+
+const (
+	ProviderConsul = "CONSUL"
+	ProviderEtcd   = "ETCD"
+
+	// kvRequestTimeout is added to the wait time of the Consul blocking query
+	kvRequestTimeout = 10 * time.Second
+)
+
+// KV watches the keys under the prefix in the Consul or etcd key-value store.
+// Consul is watched by the blocking queries and etcd is polled by the v3 JSON gateway
+type KV struct {
+	Cfg      *config.ConfigWatch
+	Logger   *logrus.Logger
+	revision string
+}
+
+func NewKV(cfg *config.ConfigWatch, logger *logrus.Logger) *KV {
+	return &KV{
+		Cfg:    cfg,
+		Logger: logger,
+	}
+}
+
+// Fetch returns the values of the keys under the prefix. The keys are returned without the prefix.
+// It returns true if the values have been changed since the last fetch. The Consul request is blocked
+// until the values are changed or the wait time is elapsed
+func (k *KV) Fetch() (map[string][]byte, bool, error) {
+
+	var values map[string][]byte
+	var revision string
+	var err error
+
+	switch k.Cfg.Provider {
+	case ProviderConsul:
+		values, revision, err = k.consul()
+	case ProviderEtcd:
+		values, revision, err = k.etcd()
+	default:
+		return nil, false, fmt.Errorf("unsupported key-value store: %s", k.Cfg.Provider)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	if revision == k.revision {
+		return values, false, nil
+	}
+
+	k.Logger.Debugf("KV: %s%s changed (revision %s)", k.Cfg.Address, k.Cfg.Prefix, revision)
+	k.revision = revision
+
+	return values, true, nil
+}
+
+// Wait returns the pause between the fetches. Consul doesn't need the pause as the request is blocked
+func (k *KV) Wait() time.Duration {
+	if k.Cfg.Provider == ProviderConsul {
+		return 0
+	}
+	return k.Cfg.PollInterval
+}
+
+// consul reads the keys by the recursive blocking query. The revision is the X-Consul-Index header
+func (k *KV) consul() (map[string][]byte, string, error) {
+
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+
+	res := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(res)
+
+	uri := fmt.Sprintf("%s/v1/kv/%s?recurse=true", strings.TrimSuffix(k.Cfg.Address, "/"), k.Cfg.Prefix)
+	if k.revision != "" {
+		uri += fmt.Sprintf("&index=%s&wait=%ds", k.revision, int(k.Cfg.WaitTime.Seconds()))
+	}
+
+	req.SetRequestURI(uri)
+	req.Header.SetMethod(fasthttp.MethodGet)
+	if k.Cfg.Token != "" {
+		req.Header.Set("X-Consul-Token", k.Cfg.Token)
+	}
+
+	if err := fasthttp.DoTimeout(req, res, k.Cfg.WaitTime+kvRequestTimeout); err != nil {
+		return nil, "", err
+	}
+
+	revision := string(res.Header.Peek("X-Consul-Index"))
+	values := make(map[string][]byte)
+
+	switch res.StatusCode() {
+	case fasthttp.StatusNotFound:
+		return values, revision, nil
+	case fasthttp.StatusOK:
+	default:
+		return nil, "", fmt.Errorf("unexpected status code %d from consul", res.StatusCode())
+	}
+
+	var entries []struct {
+		Key   string
+		Value []byte
+	}
+
+	if err := json.Unmarshal(res.Body(), &entries); err != nil {
+		return nil, "", err
+	}
+
+	for _, entry := range entries {
+		values[strings.TrimPrefix(entry.Key, k.Cfg.Prefix)] = entry.Value
+	}
+
+	return values, revision, nil
+}
+
+// etcd reads the keys by the range request. The revision is the greatest modification revision
+// of the keys and the number of the keys, so the removal of the keys is detected too
+func (k *KV) etcd() (map[string][]byte, string, error) {
+
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+
+	res := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(res)
+
+	body, err := json.Marshal(map[string]string{
+		"key":       base64.StdEncoding.EncodeToString([]byte(k.Cfg.Prefix)),
+		"range_end": base64.StdEncoding.EncodeToString(prefixEnd([]byte(k.Cfg.Prefix))),
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	req.SetRequestURI(strings.TrimSuffix(k.Cfg.Address, "/") + "/v3/kv/range")
+	req.Header.SetMethod(fasthttp.MethodPost)
+	req.Header.SetContentType("application/json")
+	if k.Cfg.Token != "" {
+		req.Header.Set(fasthttp.HeaderAuthorization, k.Cfg.Token)
+	}
+	req.SetBody(body)
+
+	if err := fasthttp.DoTimeout(req, res, kvRequestTimeout); err != nil {
+		return nil, "", err
+	}
+
+	if res.StatusCode() != fasthttp.StatusOK {
+		return nil, "", fmt.Errorf("unexpected status code %d from etcd", res.StatusCode())
+	}
+
+	var rangeResponse struct {
+		Kvs []struct {
+			Key         []byte `json:"key"`
+			Value       []byte `json:"value"`
+			ModRevision string `json:"mod_revision"`
+		} `json:"kvs"`
+	}
+
+	if err := json.Unmarshal(res.Body(), &rangeResponse); err != nil {
+		return nil, "", err
+	}
+
+	var modRevision int64
+	values := make(map[string][]byte, len(rangeResponse.Kvs))
+	for _, kv := range rangeResponse.Kvs {
+		values[strings.TrimPrefix(string(kv.Key), k.Cfg.Prefix)] = kv.Value
+		if rev, err := strconv.ParseInt(kv.ModRevision, 10, 64); err == nil && rev > modRevision {
+			modRevision = rev
+		}
+	}
+
+	return values, fmt.Sprintf("%d:%d", modRevision, len(values)), nil
+}
+
+// prefixEnd returns the end of the etcd range of the keys with the prefix
+func prefixEnd(prefix []byte) []byte {
+	end := append([]byte(nil), prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	// all keys
+	return []byte{0}
+}
@@ -0,0 +1,42 @@
+package loader
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// NewOpenAPILoader creates the OpenAPI loader which resolves $ref to the local files, so the
+// API Spec can be split into multiple files. Refs to the remote files are resolved only if
+// they are on the same host as the API Spec or allowRemoteRefs is set.
+//
+// Each loader has its own cache of the read files, so the changed files are read again
+// when the API Spec is reloaded
+func NewOpenAPILoader(apiSpecs string, allowRemoteRefs bool) *openapi3.Loader {
+
+	var rootHost string
+	if rootURL, err := url.ParseRequestURI(apiSpecs); err == nil {
+		rootHost = rootURL.Host
+	}
+
+	readFromHTTP := openapi3.ReadFromHTTP(http.DefaultClient)
+
+	loader := openapi3.NewLoader()
+	loader.IsExternalRefsAllowed = true
+	loader.ReadFromURIFunc = openapi3.URIMapCache(openapi3.ReadFromURIs(
+		func(loader *openapi3.Loader, location *url.URL) ([]byte, error) {
+			if location.Scheme == "" || location.Host == "" {
+				return nil, openapi3.ErrURINotSupported
+			}
+			if !allowRemoteRefs && location.Host != rootHost {
+				return nil, fmt.Errorf("encountered disallowed remote reference: %q", location.String())
+			}
+			return readFromHTTP(loader, location)
+		},
+		openapi3.ReadFromFile,
+	))
+
+	return loader
+}
@@ -0,0 +1,75 @@
+package maintenance
+
+import (
+	"sort"
+	"sync"
+)
+
+// Mode holds the maintenance mode state which can be changed at runtime. The maintenance
+// mode is enabled globally or for the operations selected by operationId or by the method and the path
+type Mode struct {
+	mu         sync.RWMutex
+	enabled    bool
+	operations map[string]struct{}
+}
+
+// Status is the maintenance mode state
+type Status struct {
+	Enabled    bool     `json:"enabled"`
+	Operations []string `json:"operations"`
+}
+
+// New creates the maintenance mode state
+func New(enabled bool, operations []string) *Mode {
+	m := &Mode{}
+	m.Set(Status{Enabled: enabled, Operations: operations})
+
+	return m
+}
+
+// Set replaces the maintenance mode state
+func (m *Mode) Set(status Status) {
+	operations := make(map[string]struct{}, len(status.Operations))
+	for _, operation := range status.Operations {
+		if operation != "" {
+			operations[operation] = struct{}{}
+		}
+	}
+
+	m.mu.Lock()
+	m.enabled = status.Enabled
+	m.operations = operations
+	m.mu.Unlock()
+}
+
+// Status returns the maintenance mode state
+func (m *Mode) Status() Status {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	status := Status{Enabled: m.enabled, Operations: make([]string, 0, len(m.operations))}
+	for operation := range m.operations {
+		status.Operations = append(status.Operations, operation)
+	}
+	sort.Strings(status.Operations)
+
+	return status
+}
+
+// Active returns true if the maintenance mode is enabled globally or for one of the operation keys
+func (m *Mode) Active(keys ...string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.enabled {
+		return true
+	}
+
+	for _, key := range keys {
+		if _, ok := m.operations[key]; ok {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,161 @@
+package modes
+
+import (
+	"fmt"
+	"sync"
+)
+
+const (
+	validationDisable = "DISABLE"
+	validationBlock   = "BLOCK"
+	validationLog     = "LOG_ONLY"
+)
+
+// Mode is the request and the response validation modes. The empty mode is not overridden
+type Mode struct {
+	Request  string `json:"request,omitempty"`
+	Response string `json:"response,omitempty"`
+}
+
+// Validate checks that the modes are empty or one of DISABLE, BLOCK and LOG_ONLY
+func (m Mode) Validate() error {
+	for _, mode := range []string{m.Request, m.Response} {
+		switch mode {
+		case "", validationDisable, validationBlock, validationLog:
+		default:
+			return fmt.Errorf("invalid validation mode %q: should be one of %s, %s, %s", mode, validationDisable, validationBlock, validationLog)
+		}
+	}
+	return nil
+}
+
+// Status is the validation modes overridden globally and for the operations
+type Status struct {
+	Global     Mode            `json:"global"`
+	Operations map[string]Mode `json:"operations"`
+}
+
+// Overrides holds the validation modes changed at runtime. The modes are overridden globally
+// or for the operations selected by operationId or by the method and the path.
+// The operation modes have priority over the global modes. The scheduled modes are applied
+// before the overrides, so the overrides set by the admin API have priority over the schedule
+type Overrides struct {
+	mu         sync.RWMutex
+	global     Mode
+	operations map[string]Mode
+	scheduled  Status
+}
+
+// New creates the empty validation modes overrides
+func New() *Overrides {
+	return &Overrides{operations: make(map[string]Mode)}
+}
+
+// Schedule replaces the modes of the active scheduled windows. The modes are checked by the schedule loader
+func (o *Overrides) Schedule(status Status) {
+	o.mu.Lock()
+	o.scheduled = status
+	o.mu.Unlock()
+}
+
+// Set overrides the validation modes of the operation or the global modes if the operation is empty.
+// The empty modes reset the overrides. The previous modes are returned
+func (o *Overrides) Set(operation string, mode Mode) (Mode, error) {
+	if err := mode.Validate(); err != nil {
+		return Mode{}, err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if operation == "" {
+		previous := o.global
+		o.global = mode
+		return previous, nil
+	}
+
+	previous := o.operations[operation]
+	if mode == (Mode{}) {
+		delete(o.operations, operation)
+	} else {
+		o.operations[operation] = mode
+	}
+
+	return previous, nil
+}
+
+// Load replaces all overrides by the status. The overrides are not changed if one of the modes is invalid
+func (o *Overrides) Load(status Status) error {
+	if err := status.Global.Validate(); err != nil {
+		return err
+	}
+
+	operations := make(map[string]Mode, len(status.Operations))
+	for operation, mode := range status.Operations {
+		if err := mode.Validate(); err != nil {
+			return fmt.Errorf("operation %s: %w", operation, err)
+		}
+		if mode != (Mode{}) {
+			operations[operation] = mode
+		}
+	}
+
+	o.mu.Lock()
+	o.global = status.Global
+	o.operations = operations
+	o.mu.Unlock()
+
+	return nil
+}
+
+// Status returns the overridden validation modes
+func (o *Overrides) Status() Status {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	status := Status{Global: o.global, Operations: make(map[string]Mode, len(o.operations))}
+	for operation, mode := range o.operations {
+		status.Operations[operation] = mode
+	}
+
+	return status
+}
+
+// Effective returns the validation modes of the operation with the keys: the configured
+// modes are replaced by the global and the operation scheduled modes, then by the global
+// overrides and then by the overrides of the operation
+func (o *Overrides) Effective(keys []string, request, response string) (string, string) {
+	if o == nil {
+		return request, response
+	}
+
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	modes := []Mode{o.scheduled.Global}
+	for _, key := range keys {
+		if mode, ok := o.scheduled.Operations[key]; ok {
+			modes = append(modes, mode)
+			break
+		}
+	}
+
+	modes = append(modes, o.global)
+	for _, key := range keys {
+		if mode, ok := o.operations[key]; ok {
+			modes = append(modes, mode)
+			break
+		}
+	}
+
+	for _, mode := range modes {
+		if mode.Request != "" {
+			request = mode.Request
+		}
+		if mode.Response != "" {
+			response = mode.Response
+		}
+	}
+
+	return request, response
+}
@@ -18,19 +18,17 @@ type Introspection struct {
 	Cfg    *config.Oauth
 	Logger *logrus.Logger
 	Cache  *ccache.Cache
+	OIDC   *OIDC
 }
 
-func (i *Introspection) Validate(ctx context.Context, tokenWithBearer string, scopes []string) error {
-
-	// openapi doesn't contain scopes in endpoint configuration
-	if len(scopes) == 0 {
-		return nil
-	}
+// Validate checks that the token is active and has the scopes. The token metadata returned by the introspection
+// endpoint is returned as the claims even if the operation doesn't require the scopes, so the roles are checked
+func (i *Introspection) Validate(ctx context.Context, tokenWithBearer string, scopes []string) (Claims, error) {
 
 	tokenString := strings.TrimPrefix(tokenWithBearer, "Bearer ")
 
 	if tokenString == "" {
-		return errors.New("oauth token not found")
+		return nil, errors.New("oauth token not found")
 	}
 
 	var meta map[string]interface{}
@@ -41,21 +39,35 @@ func (i *Introspection) Validate(ctx context.Context, tokenWithBearer string, sc
 	case nil:
 		meta, err = i.getTokenMetaInfo(tokenString)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	default:
 		meta = metaCached.Value().(map[string]interface{})
 	}
 
-	scopeString, ok := meta["scope"].(string)
+	i.Cache.Set(tokenString, meta, i.Cfg.Introspection.RefreshInterval)
+
+	if active, _ := meta["active"].(bool); !active {
+		return nil, errors.New("oauth token is not active")
+	}
+
+	if err := i.CheckScopes(Claims(meta), scopes); err != nil {
+		return nil, err
+	}
+
+	return Claims(meta), nil
+}
+
+// CheckScopes checks that the scope field of the token metadata returned by the introspection endpoint contains the scopes
+func (i *Introspection) CheckScopes(claims Claims, scopes []string) error {
+
+	scopeString, ok := claims["scope"].(string)
 	if !ok && len(scopes) > 0 {
 		return errors.New("scope field not found in OAuth provider response")
 	}
 
 	scopesInToken := strings.Split(scopeString, " ")
 
-	i.Cache.Set(tokenString, meta, i.Cfg.Introspection.RefreshInterval)
-
 	for _, scope := range scopes {
 		scopeFound := false
 		for _, scopeInToken := range scopesInToken {
@@ -77,7 +89,13 @@ func (i *Introspection) getTokenMetaInfo(token string) (map[string]interface{},
 	req := fasthttp.AcquireRequest()
 	req.Header.SetMethod(i.Cfg.Introspection.EndpointMethod)
 
-	parsedEndpointUrl, err := url.Parse(i.Cfg.Introspection.Endpoint)
+	// use the discovered endpoint if it's not set in configuration
+	endpoint := i.Cfg.Introspection.Endpoint
+	if endpoint == "" && i.OIDC != nil {
+		endpoint = i.OIDC.Metadata().IntrospectionEndpoint
+	}
+
+	parsedEndpointUrl, err := url.Parse(endpoint)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse introspection endpoint url: %v", err)
 	}
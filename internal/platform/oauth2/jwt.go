@@ -14,28 +14,33 @@ import (
 )
 
 type JWT struct {
-	Cfg       *config.Oauth
-	Logger    *logrus.Logger
-	PubKey    *rsa.PublicKey
-	SecretKey []byte
+	Cfg           *config.Oauth
+	Logger        *logrus.Logger
+	PubKey        *rsa.PublicKey
+	SecretKey     []byte
+	RevokedTokens RevocationList
+	KeySet        KeySet
+	Issuer        string
 }
 
-func (j *JWT) Validate(ctx context.Context, tokenWithBearer string, scopes []string) error {
+func (j *JWT) Validate(ctx context.Context, tokenWithBearer string, scopes []string) (Claims, error) {
 
 	tokenString := strings.TrimPrefix(tokenWithBearer, "Bearer ")
 
-	type MyCustomClaims struct {
-		Scope string `json:"scope"`
-		jwt.StandardClaims
-	}
-
-	token, err := jwt.ParseWithClaims(tokenString, &MyCustomClaims{}, func(token *jwt.Token) (interface{}, error) {
+	token, err := jwt.ParseWithClaims(tokenString, jwt.MapClaims{}, func(token *jwt.Token) (interface{}, error) {
 
 		switch j.Cfg.JWT.SignatureAlgorithm {
 		case "RS256", "RS384", "RS512":
 			if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
 				return nil, errors.New("unknown signing method")
 			}
+			if j.KeySet != nil {
+				kid, _ := token.Header["kid"].(string)
+				return j.KeySet.Key(kid)
+			}
+			if j.PubKey == nil {
+				return nil, errors.New("public key not configured")
+			}
 			return j.PubKey, nil
 		case "HS256", "HS384", "HS512":
 			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
@@ -48,17 +53,43 @@ func (j *JWT) Validate(ctx context.Context, tokenWithBearer string, scopes []str
 	})
 
 	if err != nil {
-		return fmt.Errorf("oauth2 token invalid: %s", err)
+		return nil, fmt.Errorf("oauth2 token invalid: %s", err)
 	}
 
-	claims, ok := token.Claims.(*MyCustomClaims)
+	claims, ok := token.Claims.(jwt.MapClaims)
 	if ok && token.Valid {
-		j.Logger.Debugf("%v %v", claims.Scope, claims.StandardClaims.ExpiresAt)
+		j.Logger.Debugf("%v %v", claims["scope"], claims["exp"])
 	} else {
-		return errors.New("oauth2 token invalid")
+		return nil, errors.New("oauth2 token invalid")
 	}
 
-	scopesInToken := strings.Split(strings.ToLower(claims.Scope), " ")
+	if j.Issuer != "" && !claims.VerifyIssuer(j.Issuer, true) {
+		return nil, errors.New("oauth2 token issued by unknown issuer")
+	}
+
+	if j.RevokedTokens != nil {
+		jti, _ := claims["jti"].(string)
+		revoked, err := j.RevokedTokens.IsRevoked(ctx, jti)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, errors.New("oauth2 token has been revoked")
+		}
+	}
+
+	if err := j.CheckScopes(Claims(claims), scopes); err != nil {
+		return nil, err
+	}
+
+	return Claims(claims), nil
+}
+
+// CheckScopes checks that the scope claim of the validated token contains the scopes. The scopes are case-insensitive
+func (j *JWT) CheckScopes(claims Claims, scopes []string) error {
+
+	scope, _ := claims["scope"].(string)
+	scopesInToken := strings.Split(strings.ToLower(scope), " ")
 
 	for _, scope := range scopes {
 		scopeFound := false
@@ -2,8 +2,60 @@ package oauth2
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
 )
 
+// Claims contains the verified token claims (JWT payload or introspection response)
+type Claims map[string]interface{}
+
+// Value returns the claim value formatted as the header value. The nested claims are addressed
+// by the dot-separated path, the list values are separated by spaces and the objects are encoded as JSON
+func (c Claims) Value(name string) (string, bool) {
+	var value interface{} = map[string]interface{}(c)
+
+	for _, key := range strings.Split(name, ".") {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		if value, ok = obj[key]; !ok || value == nil {
+			return "", false
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, fmt.Sprint(item))
+		}
+		return strings.Join(items, " "), true
+	case map[string]interface{}:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", false
+		}
+		return string(data), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	}
+
+	return fmt.Sprint(value), true
+}
+
 type OAuth2 interface {
-	Validate(ctx context.Context, tokenWithBearer string, scopes []string) error
+	Validate(ctx context.Context, tokenWithBearer string, scopes []string) (Claims, error)
+	// CheckScopes checks the scopes of the claims returned by Validate, so the token validated once
+	// is checked against the scopes of the different requirements
+	CheckScopes(claims Claims, scopes []string) error
+}
+
+// RevocationList checks if the token with the ID (jti claim) has been revoked
+type RevocationList interface {
+	IsRevoked(ctx context.Context, jti string) (bool, error)
 }
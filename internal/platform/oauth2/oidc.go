@@ -0,0 +1,230 @@
+package oauth2
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/config"
+)
+
+const (
+	oidcDiscoveryPath = "/.well-known/openid-configuration"
+	oidcFetchTimeout  = 5 * time.Second
+)
+
+// KeySet returns the public key used to sign the token
+type KeySet interface {
+	Key(kid string) (*rsa.PublicKey, error)
+}
+
+// UnavailableKeySet rejects the tokens if the OpenID provider configuration can't be discovered
+type UnavailableKeySet struct {
+	Err error
+}
+
+func (u UnavailableKeySet) Key(kid string) (*rsa.PublicKey, error) {
+	return nil, errors.Wrap(u.Err, "openid provider configuration unavailable")
+}
+
+// OIDCConfiguration contains the OpenID provider metadata used by APIFW
+type OIDCConfiguration struct {
+	Issuer                string `json:"issuer"`
+	JwksURI               string `json:"jwks_uri"`
+	IntrospectionEndpoint string `json:"introspection_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// OIDC discovers the OpenID provider configuration and keeps it and the provider keys fresh
+type OIDC struct {
+	Cfg    *config.Oauth
+	Logger *logrus.Logger
+
+	mu        sync.RWMutex
+	metadata  OIDCConfiguration
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+
+	// refreshing is set while the configuration is reloaded in the background
+	refreshing int32
+}
+
+func NewOIDC(cfg *config.Oauth, logger *logrus.Logger) (*OIDC, error) {
+	o := OIDC{
+		Cfg:    cfg,
+		Logger: logger,
+	}
+
+	if err := o.refresh(); err != nil {
+		return nil, err
+	}
+
+	return &o, nil
+}
+
+// Metadata returns the discovered OpenID provider configuration
+func (o *OIDC) Metadata() OIDCConfiguration {
+	o.refreshIfStale(false)
+
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	return o.metadata
+}
+
+// Key returns the provider key by ID. The configuration is reloaded in the background if the key is unknown
+// (keys rotation) but not more often than once per minute, so the request with the unknown key is rejected.
+func (o *OIDC) Key(kid string) (*rsa.PublicKey, error) {
+
+	key, found := o.getKey(kid)
+	if !found {
+		o.refreshIfStale(true)
+		return nil, fmt.Errorf("signing key %q not found", kid)
+	}
+
+	return key, nil
+}
+
+func (o *OIDC) getKey(kid string) (*rsa.PublicKey, bool) {
+	o.refreshIfStale(false)
+
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	// the key ID is optional if the provider has a single key
+	if kid == "" && len(o.keys) == 1 {
+		for _, key := range o.keys {
+			return key, true
+		}
+	}
+
+	key, found := o.keys[kid]
+	return key, found
+}
+
+func (o *OIDC) refreshIfStale(keyMissed bool) {
+	o.mu.RLock()
+	age := time.Since(o.fetchedAt)
+	o.mu.RUnlock()
+
+	if age < o.Cfg.OIDC.RefreshInterval && (!keyMissed || age < time.Minute) {
+		return
+	}
+
+	// the requests aren't blocked by the provider, the previous configuration is used until the reload is done
+	if !atomic.CompareAndSwapInt32(&o.refreshing, 0, 1) {
+		return
+	}
+
+	go func() {
+		defer atomic.StoreInt32(&o.refreshing, 0)
+		if err := o.refresh(); err != nil {
+			o.Logger.Errorf("OIDC: can't refresh the provider configuration: %s", err)
+		}
+	}()
+}
+
+func (o *OIDC) refresh() error {
+
+	// prevent concurrent refreshes
+	o.mu.Lock()
+	o.fetchedAt = time.Now()
+	o.mu.Unlock()
+
+	var metadata OIDCConfiguration
+	if err := fetchJSON(strings.TrimSuffix(o.Cfg.OIDC.Issuer, "/")+oidcDiscoveryPath, &metadata); err != nil {
+		return errors.Wrap(err, "openid configuration")
+	}
+
+	// the tokens of the discovered issuer would be accepted instead of the configured one
+	if strings.TrimSuffix(metadata.Issuer, "/") != strings.TrimSuffix(o.Cfg.OIDC.Issuer, "/") {
+		return errors.Errorf("configured issuer %s doesn't match the discovered issuer %s", o.Cfg.OIDC.Issuer, metadata.Issuer)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+
+	if metadata.JwksURI != "" {
+		var jwks struct {
+			Keys []jsonWebKey `json:"keys"`
+		}
+		if err := fetchJSON(metadata.JwksURI, &jwks); err != nil {
+			return errors.Wrap(err, "jwks")
+		}
+
+		for _, jwk := range jwks.Keys {
+			if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+				continue
+			}
+			key, err := parseRSAKey(jwk)
+			if err != nil {
+				o.Logger.Errorf("OIDC: can't parse the key %s: %s", jwk.Kid, err)
+				continue
+			}
+			keys[jwk.Kid] = key
+		}
+	}
+
+	o.mu.Lock()
+	o.metadata = metadata
+	o.keys = keys
+	o.mu.Unlock()
+
+	o.Logger.Debugf("OIDC: loaded provider configuration of %s with %d keys", metadata.Issuer, len(keys))
+
+	return nil
+}
+
+func parseRSAKey(jwk jsonWebKey) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	if err != nil {
+		return nil, err
+	}
+
+	e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}, nil
+}
+
+func fetchJSON(url string, v interface{}) error {
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+
+	res := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(res)
+
+	req.SetRequestURI(url)
+	req.Header.SetMethod(fasthttp.MethodGet)
+
+	if err := fasthttp.DoTimeout(req, res, oidcFetchTimeout); err != nil {
+		return err
+	}
+
+	if res.StatusCode() != fasthttp.StatusOK {
+		return fmt.Errorf("unexpected status code %d from %s", res.StatusCode(), url)
+	}
+
+	return json.Unmarshal(res.Body(), v)
+}
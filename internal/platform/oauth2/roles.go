@@ -0,0 +1,43 @@
+package oauth2
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ValidateRoles checks that the claim with the claimName name contains at least one of the
+// required roles. The claim value could be a space-separated string or an array of strings.
+func ValidateRoles(claims Claims, claimName string, roles []string) error {
+
+	if len(roles) == 0 {
+		return nil
+	}
+
+	var rolesInToken []string
+
+	switch claimValue := claims[claimName].(type) {
+	case string:
+		rolesInToken = strings.Fields(claimValue)
+	case []interface{}:
+		for _, role := range claimValue {
+			if roleStr, ok := role.(string); ok {
+				rolesInToken = append(rolesInToken, roleStr)
+			}
+		}
+	case []string:
+		rolesInToken = claimValue
+	default:
+		return errors.Errorf("roles claim %s not found in the token", claimName)
+	}
+
+	for _, role := range roles {
+		for _, roleInToken := range rolesInToken {
+			if strings.EqualFold(strings.TrimSpace(role), roleInToken) {
+				return nil
+			}
+		}
+	}
+
+	return errors.New("token doesn't contain a necessary role")
+}
@@ -0,0 +1,251 @@
+package passthrough
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wallarm/api-firewall/internal/config"
+	"github.com/wallarm/api-firewall/internal/platform/tlsfp"
+)
+
+// sniffBufferSize is the size of the reads of the client hello
+const sniffBufferSize = 4096
+
+// Stats are the numbers of the connections passed to the upstreams, the connections served by APIFW
+// and the passed connections failed to connect to the upstream
+type Stats struct {
+	Passed int64 `json:"passed"`
+	Served int64 `json:"served"`
+	Failed int64 `json:"failed"`
+}
+
+// totals are the numbers of the connections of all listeners
+var totals Stats
+
+// Totals returns the numbers of the passed, the served and the failed connections
+func Totals() Stats {
+	return Stats{
+		Passed: atomic.LoadInt64(&totals.Passed),
+		Served: atomic.LoadInt64(&totals.Served),
+		Failed: atomic.LoadInt64(&totals.Failed),
+	}
+}
+
+// Routes are the upstream addresses by the server name. The wildcard server name *.example.com
+// matches the subdomains of example.com
+type Routes map[string]string
+
+// ParseRoutes parses the routes in the server_name=host:port format
+func ParseRoutes(routes []string) (Routes, error) {
+	parsed := make(Routes, len(routes))
+	for _, route := range routes {
+		parts := strings.SplitN(route, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("passthrough route %q should be in the server_name=host:port format", route)
+		}
+		if _, _, err := net.SplitHostPort(parts[1]); err != nil {
+			return nil, fmt.Errorf("passthrough route %q: %w", route, err)
+		}
+		parsed[strings.ToLower(parts[0])] = parts[1]
+	}
+	return parsed, nil
+}
+
+// Upstream returns the upstream address of the server name. The exact server name has priority over the wildcard
+func (r Routes) Upstream(serverName string) (string, bool) {
+	serverName = strings.ToLower(strings.TrimSuffix(serverName, "."))
+	if serverName == "" {
+		return "", false
+	}
+
+	if address, ok := r[serverName]; ok {
+		return address, true
+	}
+
+	if i := strings.IndexByte(serverName, '.'); i > 0 {
+		if address, ok := r["*"+serverName[i:]]; ok {
+			return address, true
+		}
+	}
+
+	return "", false
+}
+
+// listener reads the client hello of the accepted connections. The TLS connections of the routed server
+// names are passed to the upstreams as is, the other connections are returned by Accept
+type listener struct {
+	net.Listener
+	cfg    *config.Passthrough
+	routes Routes
+	logger *logrus.Logger
+
+	conns     chan net.Conn
+	errs      chan error
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Listener returns the listener passing the TLS connections of the routes to the upstreams. The connections
+// are sniffed in the separate goroutines, so the slow clients don't delay the accept of the other connections
+func Listener(ln net.Listener, cfg *config.Passthrough, routes Routes, logger *logrus.Logger) net.Listener {
+	l := &listener{
+		Listener: ln,
+		cfg:      cfg,
+		routes:   routes,
+		logger:   logger,
+		conns:    make(chan net.Conn),
+		errs:     make(chan error, 1),
+		done:     make(chan struct{}),
+	}
+
+	go l.acceptLoop()
+
+	return l
+}
+
+func (l *listener) acceptLoop() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			select {
+			case l.errs <- err:
+			case <-l.done:
+			}
+			return
+		}
+
+		go l.route(conn)
+	}
+}
+
+// route passes the connection to the upstream of the server name or to Accept
+func (l *listener) route(conn net.Conn) {
+
+	data, serverName := l.sniff(conn)
+
+	if address, ok := l.routes.Upstream(serverName); ok {
+		atomic.AddInt64(&totals.Passed, 1)
+		l.pass(conn, data, serverName, address)
+		return
+	}
+
+	atomic.AddInt64(&totals.Served, 1)
+
+	select {
+	case l.conns <- &prefixedConn{Conn: conn, prefix: data}:
+	case <-l.done:
+		conn.Close()
+	}
+}
+
+// sniff reads the client hello and returns the read data and the server name. The data of the connections
+// which are not TLS or without the server name are returned with the empty server name
+func (l *listener) sniff(conn net.Conn) ([]byte, string) {
+
+	if err := conn.SetReadDeadline(time.Now().Add(l.cfg.HelloTimeout)); err != nil {
+		return nil, ""
+	}
+	defer conn.SetReadDeadline(time.Time{})
+
+	var data []byte
+	buf := make([]byte, sniffBufferSize)
+	for {
+		n, err := conn.Read(buf)
+		data = append(data, buf[:n]...)
+
+		if n > 0 {
+			serverName, complete, helloErr := tlsfp.ServerName(data)
+			if helloErr != nil || complete {
+				return data, serverName
+			}
+		}
+
+		// the connection errors are returned to the server by the reads of the prefixed connection
+		if err != nil {
+			return data, ""
+		}
+	}
+}
+
+// pass copies the data between the client and the upstream until one of the connections is closed
+func (l *listener) pass(conn net.Conn, data []byte, serverName, address string) {
+	defer conn.Close()
+
+	upstream, err := net.DialTimeout("tcp", address, l.cfg.DialTimeout)
+	if err != nil {
+		atomic.AddInt64(&totals.Failed, 1)
+		l.logger.WithFields(logrus.Fields{
+			"server_name":    serverName,
+			"upstream":       address,
+			"client_address": conn.RemoteAddr(),
+			"error":          err,
+		}).Error("passthrough: connecting to upstream")
+		return
+	}
+	defer upstream.Close()
+
+	if _, err := upstream.Write(data); err != nil {
+		return
+	}
+
+	copied := make(chan struct{})
+	go func() {
+		io.Copy(conn, upstream)
+		// the client connection is closed for reading as well, so the copy to the upstream is completed
+		conn.Close()
+		close(copied)
+	}()
+
+	io.Copy(upstream, conn)
+	upstream.Close()
+	<-copied
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case err := <-l.errs:
+		return nil, err
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *listener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.done)
+	})
+	return l.Listener.Close()
+}
+
+// prefixedConn returns the data read by the sniffing before the data of the connection
+type prefixedConn struct {
+	net.Conn
+	prefix []byte
+}
+
+func (c *prefixedConn) Read(b []byte) (int, error) {
+	if len(c.prefix) > 0 {
+		n := copy(b, c.prefix)
+		c.prefix = c.prefix[n:]
+		return n, nil
+	}
+	return c.Conn.Read(b)
+}
+
+// NetConn returns the underlying connection
+func (c *prefixedConn) NetConn() net.Conn {
+	return c.Conn
+}
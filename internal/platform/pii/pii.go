@@ -0,0 +1,203 @@
+package pii
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/wallarm/api-firewall/internal/config"
+)
+
+const (
+	TypeEmail = "email"
+	TypeCard  = "card"
+	TypeIBAN  = "iban"
+	TypeSSN   = "ssn"
+)
+
+var builtinPatterns = map[string]string{
+	TypeEmail: `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`,
+	TypeCard:  `\b(?:\d[ -]?){12,18}\d\b`,
+	TypeIBAN:  `\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]){11,30}\b`,
+	TypeSSN:   `\b\d{3}-\d{2}-\d{4}\b`,
+}
+
+type pattern struct {
+	name  string
+	re    *regexp.Regexp
+	valid func(match string) bool
+}
+
+// Detector finds PII in the response bodies by the regular expressions. The card numbers
+// and IBANs are additionally validated by the checksums if the checksum validation is enabled
+type Detector struct {
+	patterns    []pattern
+	maxBodySize int
+}
+
+// New creates the detector of the configured builtin types and custom patterns
+func New(cfg *config.PIIDetection) (*Detector, error) {
+
+	d := Detector{maxBodySize: cfg.MaxBodySize}
+
+	for _, name := range cfg.Types {
+		expr, ok := builtinPatterns[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown PII type: %s", name)
+		}
+
+		p := pattern{name: name, re: regexp.MustCompile(expr)}
+		if cfg.Checksum {
+			switch name {
+			case TypeCard:
+				p.valid = luhn
+			case TypeIBAN:
+				p.valid = ibanChecksum
+			}
+		}
+		d.patterns = append(d.patterns, p)
+	}
+
+	names := make([]string, 0, len(cfg.CustomPatterns))
+	for name := range cfg.CustomPatterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		re, err := regexp.Compile(cfg.CustomPatterns[name])
+		if err != nil {
+			return nil, fmt.Errorf("PII pattern %s: %w", name, err)
+		}
+		d.patterns = append(d.patterns, pattern{name: name, re: re})
+	}
+
+	return &d, nil
+}
+
+// Scannable returns true if the body of the content type and encoding is the text
+func Scannable(contentType, contentEncoding string) bool {
+	if contentEncoding != "" && contentEncoding != "identity" {
+		return false
+	}
+
+	contentType = strings.ToLower(contentType)
+	for _, textType := range []string{"text/", "json", "xml", "x-www-form-urlencoded"} {
+		if strings.Contains(contentType, textType) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Scan returns the number of the PII matches by type. Only the beginning of the body
+// is scanned if the body is larger than the configured size
+func (d *Detector) Scan(body []byte) map[string]int {
+
+	if d.maxBodySize > 0 && len(body) > d.maxBodySize {
+		body = body[:d.maxBodySize]
+	}
+
+	var found map[string]int
+	for _, p := range d.patterns {
+		for _, match := range p.re.FindAll(body, -1) {
+			if p.valid != nil && !p.valid(string(match)) {
+				continue
+			}
+			if found == nil {
+				found = make(map[string]int)
+			}
+			found[p.name]++
+		}
+	}
+
+	return found
+}
+
+// luhn validates the card number checksum
+func luhn(number string) bool {
+	var sum, digits int
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c == ' ' || c == '-' {
+			continue
+		}
+		n := int(c - '0')
+		if double {
+			n *= 2
+			if n > 9 {
+				n -= 9
+			}
+		}
+		sum += n
+		digits++
+		double = !double
+	}
+	return digits >= 13 && digits <= 19 && sum%10 == 0
+}
+
+// ibanChecksum validates the IBAN by the ISO 7064 mod 97-10 checksum
+func ibanChecksum(iban string) bool {
+	iban = strings.ReplaceAll(iban, " ", "")
+	if len(iban) < 15 || len(iban) > 34 {
+		return false
+	}
+
+	remainder := 0
+	for _, c := range iban[4:] + iban[:4] {
+		switch {
+		case c >= '0' && c <= '9':
+			remainder = (remainder*10 + int(c-'0')) % 97
+		case c >= 'A' && c <= 'Z':
+			remainder = (remainder*100 + int(c-'A'+10)) % 97
+		default:
+			return false
+		}
+	}
+
+	return remainder == 1
+}
+
+// Report counts the PII matches in the responses by endpoint and type
+type Report struct {
+	mu        sync.Mutex
+	endpoints map[string]map[string]int64
+}
+
+// Detections is the report of the PII found in the responses of all endpoints
+var Detections = &Report{endpoints: make(map[string]map[string]int64)}
+
+// Add counts the PII found in the response of the endpoint
+func (r *Report) Add(endpoint string, found map[string]int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	types, ok := r.endpoints[endpoint]
+	if !ok {
+		types = make(map[string]int64)
+		r.endpoints[endpoint] = types
+	}
+	for name, count := range found {
+		types[name] += int64(count)
+	}
+}
+
+// Snapshot returns the copy of the report
+func (r *Report) Snapshot() map[string]map[string]int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	snapshot := make(map[string]map[string]int64, len(r.endpoints))
+	for endpoint, types := range r.endpoints {
+		snapshot[endpoint] = make(map[string]int64, len(types))
+		for name, count := range types {
+			snapshot[endpoint][name] = count
+		}
+	}
+
+	return snapshot
+}
@@ -0,0 +1,46 @@
+package pools
+
+import (
+	"bytes"
+	"sync"
+)
+
+// BufferPool is the pool of the body buffers. The buffers larger than the max size are left to the garbage
+// collector, so a single large body doesn't keep the memory after the request
+type BufferPool struct {
+	pool    sync.Pool
+	maxSize int
+	stats   counters
+}
+
+// NewBufferPool returns the pool of the buffers of maxSize bytes or smaller
+func NewBufferPool(maxSize int) *BufferPool {
+	p := &BufferPool{maxSize: maxSize}
+	p.pool.New = func() interface{} {
+		p.stats.alloc()
+		return new(bytes.Buffer)
+	}
+	return p
+}
+
+// Get returns the empty buffer
+func (p *BufferPool) Get() *bytes.Buffer {
+	p.stats.get()
+	return p.pool.Get().(*bytes.Buffer)
+}
+
+// Put returns the buffer to the pool. The buffer can't be used after Put
+func (p *BufferPool) Put(buf *bytes.Buffer) {
+	if buf.Cap() > p.maxSize {
+		p.stats.put(true)
+		return
+	}
+	buf.Reset()
+	p.pool.Put(buf)
+	p.stats.put(false)
+}
+
+// Stats returns the numbers of the buffers
+func (p *BufferPool) Stats() Stats {
+	return p.stats.snapshot()
+}
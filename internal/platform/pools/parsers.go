@@ -0,0 +1,99 @@
+package pools
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/valyala/fastjson"
+)
+
+// ParserPool is the pool of the FastJSON parsers. The bounded pool keeps the idle parsers in the shards, so the
+// concurrent requests take and return the parsers through the different channels. The zero value is the
+// unbounded pool
+type ParserPool struct {
+	pool   sync.Pool
+	shards []chan *fastjson.Parser
+	next   uint32
+	stats  counters
+}
+
+// Resize keeps at most size idle parsers in the shards. The zero shards are GOMAXPROCS shards and the zero
+// size is the unbounded pool. The idle parsers of the previous size are dropped.
+// This call is not thread-safe: it should be called before the validation of requests.
+func (p *ParserPool) Resize(size, shards int) {
+	p.shards = nil
+	if size == 0 {
+		return
+	}
+
+	if shards == 0 {
+		shards = runtime.GOMAXPROCS(0)
+	}
+	if shards > size {
+		shards = size
+	}
+
+	p.shards = make([]chan *fastjson.Parser, shards)
+	for i := range p.shards {
+		capacity := size / shards
+		if i < size%shards {
+			capacity++
+		}
+		p.shards[i] = make(chan *fastjson.Parser, capacity)
+	}
+}
+
+// Get returns the parser from the pool or the new parser if the pool is empty
+func (p *ParserPool) Get() *fastjson.Parser {
+	p.stats.get()
+
+	if p.shards == nil {
+		if v := p.pool.Get(); v != nil {
+			return v.(*fastjson.Parser)
+		}
+	} else {
+		first := p.shard()
+		for i := range p.shards {
+			select {
+			case parser := <-p.shards[(first+i)%len(p.shards)]:
+				return parser
+			default:
+			}
+		}
+	}
+
+	p.stats.alloc()
+	return new(fastjson.Parser)
+}
+
+// Put returns the parser to the pool. The parser is dropped if all shards are full
+func (p *ParserPool) Put(parser *fastjson.Parser) {
+	if p.shards == nil {
+		p.pool.Put(parser)
+		p.stats.put(false)
+		return
+	}
+
+	first := p.shard()
+	for i := range p.shards {
+		select {
+		case p.shards[(first+i)%len(p.shards)] <- parser:
+			p.stats.put(false)
+			return
+		default:
+		}
+	}
+
+	p.stats.put(true)
+}
+
+// shard returns the first shard checked by the next call. The calls start from the different shards in turn
+func (p *ParserPool) shard() int {
+	return int(atomic.AddUint32(&p.next, 1) % uint32(len(p.shards)))
+}
+
+// Stats returns the numbers of the parsers
+func (p *ParserPool) Stats() Stats {
+	return p.stats.snapshot()
+}
@@ -0,0 +1,133 @@
+package pools
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wallarm/api-firewall/internal/config"
+)
+
+// minWarnGets is the number of the objects taken from the pool in the interval required to report the contention,
+// so the allocations of the warming pool aren't reported
+const minWarnGets = 100
+
+// Stats are the numbers of the objects taken from the pool, allocated because the pool was empty and not returned
+// to the pool because it was full or the object was too large. InUse is the number of the objects taken and not
+// returned yet and Peak is the largest InUse
+type Stats struct {
+	Gets   int64 `json:"gets"`
+	Allocs int64 `json:"allocs"`
+	Drops  int64 `json:"drops"`
+	InUse  int64 `json:"in_use"`
+	Peak   int64 `json:"peak"`
+}
+
+type counters struct {
+	gets   int64
+	allocs int64
+	drops  int64
+	inUse  int64
+	peak   int64
+}
+
+func (c *counters) get() {
+	atomic.AddInt64(&c.gets, 1)
+	inUse := atomic.AddInt64(&c.inUse, 1)
+	for {
+		peak := atomic.LoadInt64(&c.peak)
+		if inUse <= peak || atomic.CompareAndSwapInt64(&c.peak, peak, inUse) {
+			return
+		}
+	}
+}
+
+func (c *counters) alloc() {
+	atomic.AddInt64(&c.allocs, 1)
+}
+
+func (c *counters) put(dropped bool) {
+	atomic.AddInt64(&c.inUse, -1)
+	if dropped {
+		atomic.AddInt64(&c.drops, 1)
+	}
+}
+
+func (c *counters) snapshot() Stats {
+	return Stats{
+		Gets:   atomic.LoadInt64(&c.gets),
+		Allocs: atomic.LoadInt64(&c.allocs),
+		Drops:  atomic.LoadInt64(&c.drops),
+		InUse:  atomic.LoadInt64(&c.inUse),
+		Peak:   atomic.LoadInt64(&c.peak),
+	}
+}
+
+// Parsers is the pool of the FastJSON parsers of the request and the response bodies
+var Parsers = &ParserPool{}
+
+// Buffers is the pool of the copies of the request and the response bodies
+var Buffers = NewBufferPool(1 << 20)
+
+// Configure sizes the pools.
+// This call is not thread-safe: it should be called before the validation of requests.
+func Configure(cfg *config.Pools) error {
+	if cfg.ParserPoolSize < 0 || cfg.ParserPoolShards < 0 {
+		return fmt.Errorf("invalid size of parser pool: %d parsers in %d shards", cfg.ParserPoolSize, cfg.ParserPoolShards)
+	}
+	if cfg.MaxBufferSize <= 0 {
+		return fmt.Errorf("invalid max size of pooled buffer: %d", cfg.MaxBufferSize)
+	}
+
+	Parsers.Resize(cfg.ParserPoolSize, cfg.ParserPoolShards)
+	Buffers.maxSize = cfg.MaxBufferSize
+
+	return nil
+}
+
+// Totals returns the numbers of the pools
+func Totals() map[string]Stats {
+	return map[string]Stats{
+		"parsers": Parsers.Stats(),
+		"buffers": Buffers.Stats(),
+	}
+}
+
+// Watch reports the contention of the pools every interval until the returned function is called. The pool is
+// contended if more than the threshold of the objects taken from the pool in the interval are allocated
+func Watch(logger *logrus.Logger, interval time.Duration, threshold float64) func() {
+	done := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		last := Totals()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				totals := Totals()
+				for name, stats := range totals {
+					gets := stats.Gets - last[name].Gets
+					allocs := stats.Allocs - last[name].Allocs
+					if gets < minWarnGets || float64(allocs) <= threshold*float64(gets) {
+						continue
+					}
+					logger.WithFields(logrus.Fields{
+						"pool":   name,
+						"gets":   gets,
+						"allocs": allocs,
+						"drops":  stats.Drops - last[name].Drops,
+						"peak":   stats.Peak,
+					}).Warnf("pools: %d of %d %s allocated in the last %s, the pool is too small for the load", allocs, gets, name, interval)
+				}
+				last = totals
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
@@ -0,0 +1,144 @@
+package proxy
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/config"
+)
+
+const (
+	// gradientWindow is the number of the samples of the long-term latency
+	gradientWindow = 100
+	// gradientTolerance is the ratio of the latency to the long-term latency which doesn't decrease the limit
+	gradientTolerance = 1.5
+	// gradientSmoothing is the weight of the new limit
+	gradientSmoothing = 0.2
+)
+
+// ErrConcurrencyLimit is returned when the number of the requests in flight reaches the concurrency limit
+var ErrConcurrencyLimit = errors.New("upstream concurrency limit exceeded")
+
+// adaptivePool limits the number of the clients in use by the limit adjusted by the latency of the upstream.
+// The clients are not returned while the limit is reached, so the load is shed before the upstream is overwhelmed
+type adaptivePool struct {
+	Pool
+	cfg *config.AdaptiveConcurrency
+
+	mu          sync.Mutex
+	limit       float64
+	longLatency float64
+
+	inFlight int64
+	shed     int64
+}
+
+// NewAdaptivePool wraps the pool by the adaptive concurrency limit
+func NewAdaptivePool(pool Pool, cfg *config.AdaptiveConcurrency) (Pool, error) {
+	if cfg.MinLimit <= 0 || cfg.MinLimit > cfg.MaxLimit || cfg.InitialLimit < cfg.MinLimit || cfg.InitialLimit > cfg.MaxLimit {
+		return nil, errInvalidCapacitySetting
+	}
+
+	return &adaptivePool{
+		Pool:  pool,
+		cfg:   cfg,
+		limit: float64(cfg.InitialLimit),
+	}, nil
+}
+
+func (p *adaptivePool) Get() (HTTPClient, error) {
+	p.mu.Lock()
+	if p.inFlight >= int64(p.limit) {
+		p.mu.Unlock()
+		atomic.AddInt64(&p.shed, 1)
+		return nil, ErrConcurrencyLimit
+	}
+	p.inFlight++
+	p.mu.Unlock()
+
+	client, err := p.Pool.Get()
+	if err != nil {
+		p.release()
+		return nil, err
+	}
+
+	return &adaptiveClient{HTTPClient: client, pool: p}, nil
+}
+
+func (p *adaptivePool) Put(client HTTPClient) error {
+	if c, ok := client.(*adaptiveClient); ok {
+		client = c.HTTPClient
+		p.release()
+	}
+	return p.Pool.Put(client)
+}
+
+func (p *adaptivePool) release() {
+	p.mu.Lock()
+	p.inFlight--
+	p.mu.Unlock()
+}
+
+// Stats returns the usage statistics of the pool with the current concurrency limit
+func (p *adaptivePool) Stats() PoolStats {
+	stats := p.Pool.Stats()
+
+	p.mu.Lock()
+	stats.ConcurrencyLimit = int64(p.limit)
+	p.mu.Unlock()
+	stats.Shed = atomic.LoadInt64(&p.shed)
+
+	return stats
+}
+
+// sample adjusts the limit by the latency of the request. The failed requests decrease the limit
+func (p *adaptivePool) sample(latency time.Duration, failed bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	limit := p.limit
+	switch {
+	case failed:
+		limit *= p.cfg.BackoffRatio
+	case p.cfg.Algorithm == config.ConcurrencyAIMD:
+		if latency > p.cfg.LatencyThreshold {
+			limit *= p.cfg.BackoffRatio
+		} else if float64(p.inFlight)*2 >= limit {
+			// the limit is increased only if it's used, otherwise the idle upstream would get the unlimited limit
+			limit++
+		}
+	default:
+		if p.longLatency == 0 {
+			p.longLatency = float64(latency)
+		} else {
+			p.longLatency += (float64(latency) - p.longLatency) / gradientWindow
+		}
+
+		gradient := 1.0
+		if latency > 0 {
+			gradient = math.Max(0.5, math.Min(1, gradientTolerance*p.longLatency/float64(latency)))
+		}
+		// the queue allows the limit to grow while the latency is stable
+		newLimit := limit*gradient + math.Sqrt(limit)
+		limit = limit*(1-gradientSmoothing) + newLimit*gradientSmoothing
+	}
+
+	p.limit = math.Max(float64(p.cfg.MinLimit), math.Min(float64(p.cfg.MaxLimit), limit))
+}
+
+// adaptiveClient measures the latency of the requests to the upstream
+type adaptiveClient struct {
+	HTTPClient
+	pool *adaptivePool
+}
+
+func (c *adaptiveClient) Do(req *fasthttp.Request, resp *fasthttp.Response) error {
+	start := time.Now()
+	err := c.HTTPClient.Do(req, resp)
+	c.pool.sample(time.Since(start), err != nil || resp.StatusCode() == fasthttp.StatusServiceUnavailable)
+	return err
+}
@@ -12,35 +12,99 @@ import (
 	"net"
 	"os"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/valyala/fasthttp"
 	"github.com/wallarm/api-firewall/internal/config"
+	"github.com/wallarm/api-firewall/internal/platform/backendauth"
 )
 
 var (
 	errFactoryNotHelp         = errors.New("factory is not able to fill the pool")
 	errInvalidCapacitySetting = errors.New("invalid capacity settings")
 	errClosed                 = errors.New("err: chan closed")
+	errTooManyConns           = errors.New("too many upstream connections")
 )
 
 type HTTPClient interface {
 	Do(req *fasthttp.Request, resp *fasthttp.Response) error
 }
 
-func factory(hostAddr string, server *config.Server, tlsConfig *tls.Config) (HTTPClient, error) {
+// dialer returns the dial function which connects to the upstream and counts the open connections
+func dialer(hostAddr string, server *config.Server, dialErrors *int64, conns *int64) func(addr string) (net.Conn, error) {
+	return func(addr string) (net.Conn, error) {
+		// the connection is counted before dialing to keep the limit under concurrent dials
+		open := atomic.AddInt64(conns, 1)
+		if server.Upstream.MaxConns > 0 && open > int64(server.Upstream.MaxConns) {
+			atomic.AddInt64(conns, -1)
+			atomic.AddInt64(dialErrors, 1)
+			return nil, errTooManyConns
+		}
+		conn, err := fasthttp.DialTimeout(hostAddr, server.DialTimeout)
+		if err != nil {
+			atomic.AddInt64(conns, -1)
+			atomic.AddInt64(dialErrors, 1)
+			return nil, err
+		}
+		return &countedConn{Conn: conn, conns: conns}, nil
+	}
+}
+
+func factory(hostAddr string, server *config.Server, tlsConfig *tls.Config, dialErrors *int64, conns *int64) (HTTPClient, error) {
 
 	var proxyClient = &fasthttp.Client{
-		Dial: func(addr string) (net.Conn, error) {
-			return fasthttp.DialTimeout(hostAddr, server.DialTimeout)
-		},
-		TLSConfig:       tlsConfig,
-		MaxConnsPerHost: server.MaxConnsPerHost,
-		ReadTimeout:     server.ReadTimeout,
-		WriteTimeout:    server.WriteTimeout,
+		Dial:                dialer(hostAddr, server, dialErrors, conns),
+		TLSConfig:           tlsConfig,
+		MaxConnsPerHost:     server.MaxConnsPerHost,
+		MaxIdleConnDuration: server.Upstream.IdleConnTimeout,
+		MaxConnDuration:     server.Upstream.MaxConnDuration,
+		ReadTimeout:         server.ReadTimeout,
+		WriteTimeout:        server.WriteTimeout,
+	}
+
+	if server.Upstream.DisableKeepAlive {
+		return &closingClient{Client: proxyClient}, nil
 	}
+
 	return proxyClient, nil
 }
 
+// countedConn decrements the number of the open upstream connections when the connection is closed
+type countedConn struct {
+	net.Conn
+	conns  *int64
+	closed int32
+}
+
+func (c *countedConn) Close() error {
+	if atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
+		atomic.AddInt64(c.conns, -1)
+	}
+	return c.Conn.Close()
+}
+
+// authClient sets the credentials of the firewall toward the upstream
+type authClient struct {
+	HTTPClient
+	auth *backendauth.Credentials
+}
+
+func (c *authClient) Do(req *fasthttp.Request, resp *fasthttp.Response) error {
+	c.auth.Apply(req)
+	return c.HTTPClient.Do(req, resp)
+}
+
+// closingClient asks the upstream to close the connection after each request
+type closingClient struct {
+	*fasthttp.Client
+}
+
+func (c *closingClient) Do(req *fasthttp.Request, resp *fasthttp.Response) error {
+	req.SetConnectionClose()
+	return c.Client.Do(req, resp)
+}
+
 type Pool interface {
 	// Get returns a new ReverseProxy from the pool.
 	Get() (HTTPClient, error)
@@ -54,6 +118,28 @@ type Pool interface {
 
 	// Len returns the current number of connections of the pool.
 	Len() int
+
+	// Stats returns the usage statistics of the pool.
+	Stats() PoolStats
+
+	// Resize changes the capacity of the pool.
+	Resize(capacity int) error
+}
+
+// PoolStats contains the usage statistics of the pool
+type PoolStats struct {
+	Capacity      int   `json:"capacity"`
+	Idle          int   `json:"idle"`
+	InUse         int64 `json:"in_use"`
+	Created       int64 `json:"created"`
+	Gets          int64 `json:"gets"`
+	GetWaitTimeNs int64 `json:"get_wait_time_ns"`
+	DialErrors    int64 `json:"dial_errors"`
+	Conns         int64 `json:"conns"`
+
+	// ConcurrencyLimit and Shed are set by the adaptive concurrency limit
+	ConcurrencyLimit int64 `json:"concurrency_limit,omitempty"`
+	Shed             int64 `json:"shed,omitempty"`
 }
 
 // Pool interface impelement based on channel
@@ -73,10 +159,24 @@ type chanPool struct {
 	host   string
 
 	tlsConfig *tls.Config
+
+	// http2 is the client shared by the pool if HTTP/2 is used with the upstream
+	http2 *http2Client
+
+	// auth sets the credentials of the requests to the upstream
+	auth *backendauth.Credentials
+
+	// statistics
+	inUse       int64
+	created     int64
+	gets        int64
+	getWaitTime int64
+	dialErrors  int64
+	conns       int64
 }
 
 // NewChanPool to new a pool with some params
-func NewChanPool(initialCap, maxCap int, hostAddr string, server *config.Server) (Pool, error) {
+func NewChanPool(initialCap, maxCap int, hostAddr string, server *config.Server, auth *backendauth.Credentials) (Pool, error) {
 	if initialCap < 0 || maxCap <= 0 || initialCap > maxCap {
 		return nil, errInvalidCapacitySetting
 	}
@@ -106,6 +206,15 @@ func NewChanPool(initialCap, maxCap int, hostAddr string, server *config.Server)
 		RootCAs:            rootCAs,
 	}
 
+	// the client certificate is presented to the upstream requesting the mTLS
+	if auth != nil && server.BackendAuth.ClientCert != "" {
+		tlsConfig.GetClientCertificate = auth.ClientCertificate
+	}
+
+	if server.Upstream.TLSSessionCacheSize > 0 {
+		tlsConfig.ClientSessionCache = tls.NewLRUClientSessionCache(server.Upstream.TLSSessionCacheSize)
+	}
+
 	// initialize the chanPool
 	pool := &chanPool{
 		mutex:            sync.RWMutex{},
@@ -113,21 +222,45 @@ func NewChanPool(initialCap, maxCap int, hostAddr string, server *config.Server)
 		server:           server,
 		host:             hostAddr,
 		tlsConfig:        tlsConfig,
+		auth:             auth,
+	}
+
+	if server.Upstream.Protocol == config.ProtocolHTTP2 {
+		pool.http2 = newHTTP2Client(hostAddr, server, tlsConfig, &pool.dialErrors, &pool.conns)
 	}
 
 	// create initial connections, if something goes wrong,
 	// just close the pool error out.
 	for i := 0; i < initialCap; i++ {
-		proxy, err := factory(hostAddr, server, tlsConfig)
+		proxy, err := pool.newClient()
 		if err != nil {
 			return nil, errFactoryNotHelp
 		}
+		pool.created++
 		pool.reverseProxyChan <- proxy
 	}
 
 	return pool, nil
 }
 
+// newClient returns the shared HTTP/2 client or creates the new HTTP/1.1 client
+func (p *chanPool) newClient() (HTTPClient, error) {
+
+	var client HTTPClient = p.http2
+	if p.http2 == nil {
+		var err error
+		if client, err = factory(p.host, p.server, p.tlsConfig, &p.dialErrors, &p.conns); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.auth != nil {
+		return &authClient{HTTPClient: client, auth: p.auth}, nil
+	}
+
+	return client, nil
+}
+
 // getConnsAndFactory ... get a copy of chanPool's reverseProxyChan and factory
 func (p *chanPool) getConnsAndFactory() chan HTTPClient {
 	p.mutex.RLock()
@@ -148,29 +281,43 @@ func (p *chanPool) Close() {
 	}
 
 	close(reverseProxyChan)
+
+	if p.http2 != nil {
+		p.http2.transport.CloseIdleConnections()
+	}
 }
 
 // Get a *ReverseProxy from pool, it will get an error while
 // reverseProxyChan is nil or pool has been closed
 func (p *chanPool) Get() (HTTPClient, error) {
 
-	if p.reverseProxyChan == nil {
+	reverseProxyChan := p.getConnsAndFactory()
+	if reverseProxyChan == nil {
 		return nil, errClosed
 	}
 
+	start := time.Now()
+	defer func() {
+		atomic.AddInt64(&p.gets, 1)
+		atomic.AddInt64(&p.getWaitTime, int64(time.Since(start)))
+	}()
+
 	// wrap our connections with out custom net.Conn implementation (wrapConn
 	// method) that puts the connection back to the pool if it's closed.
 	select {
-	case proxy := <-p.reverseProxyChan:
+	case proxy := <-reverseProxyChan:
 		if proxy == nil {
 			return nil, errClosed
 		}
+		atomic.AddInt64(&p.inUse, 1)
 		return proxy, nil
 	default:
-		proxy, err := factory(p.host, p.server, p.tlsConfig)
+		proxy, err := p.newClient()
 		if err != nil {
 			return nil, err
 		}
+		atomic.AddInt64(&p.created, 1)
+		atomic.AddInt64(&p.inUse, 1)
 		return proxy, nil
 	}
 }
@@ -184,6 +331,8 @@ func (p *chanPool) Put(proxy HTTPClient) error {
 	p.mutex.RLock()
 	defer p.mutex.RUnlock()
 
+	atomic.AddInt64(&p.inUse, -1)
+
 	if p.reverseProxyChan == nil {
 		// pool is closed, close passed connection
 		return nil
@@ -204,3 +353,47 @@ func (p *chanPool) Len() int {
 	reverseProxyChan := p.getConnsAndFactory()
 	return len(reverseProxyChan)
 }
+
+// Stats returns the usage statistics of the pool
+func (p *chanPool) Stats() PoolStats {
+	reverseProxyChan := p.getConnsAndFactory()
+	return PoolStats{
+		Capacity:      cap(reverseProxyChan),
+		Idle:          len(reverseProxyChan),
+		InUse:         atomic.LoadInt64(&p.inUse),
+		Created:       atomic.LoadInt64(&p.created),
+		Gets:          atomic.LoadInt64(&p.gets),
+		GetWaitTimeNs: atomic.LoadInt64(&p.getWaitTime),
+		DialErrors:    atomic.LoadInt64(&p.dialErrors),
+		Conns:         atomic.LoadInt64(&p.conns),
+	}
+}
+
+// Resize changes the capacity of the pool. The idle clients exceeding the new capacity are dropped
+func (p *chanPool) Resize(capacity int) error {
+	if capacity <= 0 {
+		return errInvalidCapacitySetting
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.reverseProxyChan == nil {
+		return errClosed
+	}
+
+	// move the idle clients to the resized channel
+	reverseProxyChan := make(chan HTTPClient, capacity)
+loop:
+	for len(reverseProxyChan) < capacity {
+		select {
+		case proxy := <-p.reverseProxyChan:
+			reverseProxyChan <- proxy
+		default:
+			break loop
+		}
+	}
+	p.reverseProxyChan = reverseProxyChan
+
+	return nil
+}
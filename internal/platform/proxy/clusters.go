@@ -0,0 +1,188 @@
+package proxy
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/valyala/fasthttp"
+)
+
+// Route selects the upstream cluster of the operations by the path prefix or by the tag
+type Route struct {
+	Prefix string
+	Tag    string
+	URL    *url.URL
+	// Addr is the host and the port of the upstream
+	Addr string
+}
+
+// ParseRoute parses the route "<path prefix> <URL>" or "tag=<tag> <URL>". The scheme and the host
+// of the URL are used
+func ParseRoute(value string) (Route, error) {
+
+	fields := strings.Fields(value)
+	if len(fields) != 2 {
+		return Route{}, errors.Errorf("upstream route %q: should be the path prefix or the tag and the URL", value)
+	}
+
+	var route Route
+
+	switch {
+	case strings.HasPrefix(fields[0], "/"):
+		route.Prefix = strings.TrimSuffix(fields[0], "/")
+	case strings.HasPrefix(fields[0], "tag="):
+		route.Tag = strings.TrimPrefix(fields[0], "tag=")
+		if route.Tag == "" {
+			return Route{}, errors.Errorf("upstream route %q: empty tag", value)
+		}
+	default:
+		return Route{}, errors.Errorf("upstream route %q: unknown selector %s", value, fields[0])
+	}
+
+	u, err := url.ParseRequestURI(fields[1])
+	if err != nil {
+		return Route{}, errors.Wrapf(err, "upstream route %q", value)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return Route{}, errors.Errorf("upstream route %q: unsupported scheme %s", value, u.Scheme)
+	}
+
+	route.URL = u
+	route.Addr = u.Host
+	if u.Port() == "" {
+		port := "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+		route.Addr = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	return route, nil
+}
+
+// ParseRoutes parses the routes in the configured order
+func ParseRoutes(values []string) ([]Route, error) {
+
+	routes := make([]Route, 0, len(values))
+	for _, value := range values {
+		route, err := ParseRoute(value)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, route)
+	}
+
+	return routes, nil
+}
+
+// Matches returns true if the path is under the prefix or the operation has the tag
+func (r *Route) Matches(path string, tags []string) bool {
+
+	if r.Tag != "" {
+		for _, tag := range tags {
+			if tag == r.Tag {
+				return true
+			}
+		}
+		return false
+	}
+
+	return r.Prefix == "" || path == r.Prefix || strings.HasPrefix(path, r.Prefix+"/")
+}
+
+// Clusters is the pool of the default upstream which holds the pools of the upstream clusters
+// selected by the routes. The routes with the same upstream share the pool
+type Clusters struct {
+	Pool
+	routes []Route
+	pools  []Pool
+}
+
+// NewClusters creates the pools of the upstream clusters of the routes
+func NewClusters(defaultPool Pool, routes []Route, newPool func(route Route) (Pool, error)) (*Clusters, error) {
+
+	c := Clusters{
+		Pool:   defaultPool,
+		routes: routes,
+	}
+
+	pools := make(map[string]Pool)
+	for _, route := range routes {
+		key := route.URL.Scheme + "://" + route.Addr
+		pool, ok := pools[key]
+		if !ok {
+			p, err := newPool(route)
+			if err != nil {
+				c.Close()
+				return nil, errors.Wrapf(err, "upstream %s", key)
+			}
+			pool = &clusterPool{Pool: p, scheme: route.URL.Scheme, host: route.URL.Host}
+			pools[key] = pool
+		}
+		c.pools = append(c.pools, pool)
+	}
+
+	return &c, nil
+}
+
+// Select returns the pool of the first route matching the path or one of the tags of the operation.
+// The default pool is returned if no route matches
+func (c *Clusters) Select(path string, tags []string) Pool {
+	for i := range c.routes {
+		if c.routes[i].Matches(path, tags) {
+			return c.pools[i]
+		}
+	}
+	return c.Pool
+}
+
+// Close closes the pools of the default upstream and the upstream clusters
+func (c *Clusters) Close() {
+	closed := make(map[Pool]struct{})
+	for _, pool := range c.pools {
+		if _, ok := closed[pool]; !ok {
+			pool.Close()
+			closed[pool] = struct{}{}
+		}
+	}
+	if c.Pool != nil {
+		c.Pool.Close()
+	}
+}
+
+// clusterPool returns the clients which send the requests to the upstream cluster
+type clusterPool struct {
+	Pool
+	scheme string
+	host   string
+}
+
+func (p *clusterPool) Get() (HTTPClient, error) {
+	client, err := p.Pool.Get()
+	if err != nil {
+		return nil, err
+	}
+	return &clusterClient{HTTPClient: client, scheme: p.scheme, host: p.host}, nil
+}
+
+func (p *clusterPool) Put(client HTTPClient) error {
+	if c, ok := client.(*clusterClient); ok {
+		client = c.HTTPClient
+	}
+	return p.Pool.Put(client)
+}
+
+// clusterClient replaces the scheme and the host of the request URI set for the default upstream
+type clusterClient struct {
+	HTTPClient
+	scheme string
+	host   string
+}
+
+func (c *clusterClient) Do(req *fasthttp.Request, resp *fasthttp.Response) error {
+	req.URI().SetScheme(c.scheme)
+	req.URI().SetHost(c.host)
+	return c.HTTPClient.Do(req, resp)
+}
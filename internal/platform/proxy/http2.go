@@ -0,0 +1,124 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+
+	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/config"
+)
+
+// hopHeaders are the connection-specific headers which are not forwarded by HTTP/2
+var hopHeaders = map[string]struct{}{
+	"Connection":          {},
+	"Keep-Alive":          {},
+	"Proxy-Connection":    {},
+	"Transfer-Encoding":   {},
+	"Upgrade":             {},
+	"Te":                  {},
+	"Host":                {},
+	"Content-Length":      {},
+	"Proxy-Authenticate":  {},
+	"Proxy-Authorization": {},
+}
+
+// http2Client sends the requests by the net/http transport which negotiates HTTP/2 with the upstream by ALPN.
+// The client is shared by the pool, so the requests are multiplexed over the same connections
+type http2Client struct {
+	transport *http.Transport
+	client    *http.Client
+}
+
+func newHTTP2Client(hostAddr string, server *config.Server, tlsConfig *tls.Config, dialErrors *int64, conns *int64) *http2Client {
+
+	dial := dialer(hostAddr, server, dialErrors, conns)
+
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dial(addr)
+		},
+		TLSClientConfig:       tlsConfig.Clone(),
+		ForceAttemptHTTP2:     true,
+		DisableKeepAlives:     server.Upstream.DisableKeepAlive,
+		DisableCompression:    true,
+		MaxConnsPerHost:       server.MaxConnsPerHost,
+		MaxIdleConnsPerHost:   server.MaxConnsPerHost,
+		IdleConnTimeout:       server.Upstream.IdleConnTimeout,
+		ResponseHeaderTimeout: server.ReadTimeout,
+	}
+
+	return &http2Client{
+		transport: transport,
+		client: &http.Client{
+			Transport: transport,
+			// the redirects are returned to the client as is
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// Do sends the request to the upstream and fills the response
+func (c *http2Client) Do(req *fasthttp.Request, resp *fasthttp.Response) error {
+
+	httpReq, err := http.NewRequest(string(req.Header.Method()), req.URI().String(), bytes.NewReader(req.Body()))
+	if err != nil {
+		return err
+	}
+
+	req.Header.VisitAll(func(k, v []byte) {
+		name := textproto.CanonicalMIMEHeaderKey(string(k))
+		if _, ok := hopHeaders[name]; ok {
+			// gRPC requires the trailers, so TE is forwarded with the only value allowed by HTTP/2
+			if name != "Te" || !bytes.EqualFold(v, []byte("trailers")) {
+				return
+			}
+		}
+		httpReq.Header.Add(name, string(v))
+	})
+	httpReq.Host = string(req.Host())
+
+	httpResp, err := c.client.Do(httpReq)
+	if err != nil {
+		// the dial errors are returned as is to be handled like the errors of the HTTP/1.1 client
+		if urlErr, ok := err.(*url.Error); ok {
+			return urlErr.Err
+		}
+		return err
+	}
+	defer httpResp.Body.Close()
+
+	body, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return err
+	}
+
+	resp.Reset()
+	resp.SetStatusCode(httpResp.StatusCode)
+	for name, values := range httpResp.Header {
+		if _, ok := hopHeaders[name]; ok {
+			continue
+		}
+		for _, value := range values {
+			resp.Header.Add(name, value)
+		}
+	}
+	resp.SetBody(body)
+
+	// the trailers are available after the body is read
+	for name, values := range httpResp.Trailer {
+		resp.Header.AddTrailer(name)
+		for _, value := range values {
+			resp.Header.Add(name, value)
+		}
+	}
+
+	return nil
+}
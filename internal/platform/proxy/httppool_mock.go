@@ -112,6 +112,20 @@ func (mr *MockPoolMockRecorder) Len() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Len", reflect.TypeOf((*MockPool)(nil).Len))
 }
 
+// Resize mocks base method.
+func (m *MockPool) Resize(capacity int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Resize", capacity)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Resize indicates an expected call of Resize.
+func (mr *MockPoolMockRecorder) Resize(capacity interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Resize", reflect.TypeOf((*MockPool)(nil).Resize), capacity)
+}
+
 // Put mocks base method.
 func (m *MockPool) Put(arg0 HTTPClient) error {
 	m.ctrl.T.Helper()
@@ -125,3 +139,17 @@ func (mr *MockPoolMockRecorder) Put(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Put", reflect.TypeOf((*MockPool)(nil).Put), arg0)
 }
+
+// Stats mocks base method.
+func (m *MockPool) Stats() PoolStats {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Stats")
+	ret0, _ := ret[0].(PoolStats)
+	return ret0
+}
+
+// Stats indicates an expected call of Stats.
+func (mr *MockPoolMockRecorder) Stats() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stats", reflect.TypeOf((*MockPool)(nil).Stats))
+}
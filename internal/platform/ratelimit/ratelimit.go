@@ -0,0 +1,180 @@
+package ratelimit
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+const (
+	KeyIP     = "ip"
+	KeyGlobal = "global"
+
+	// idle limiters of the clients are removed after this period
+	clientIdleTimeout = 10 * time.Minute
+)
+
+var ErrInvalidPolicy = errors.New("rate limit policy must set requests_per_second or requests_per_minute")
+
+// scale multiplies the limits of all limiters. It is changed by the scheduled windows
+var scale = struct {
+	sync.RWMutex
+	value float64
+}{value: 1}
+
+// SetScale multiplies the limits of all limiters by the factor. The zero factor restores the configured limits
+func SetScale(factor float64) {
+	if factor <= 0 {
+		factor = 1
+	}
+
+	scale.Lock()
+	scale.value = factor
+	scale.Unlock()
+}
+
+// scaled returns the limit multiplied by the current scale
+func scaled(limit rate.Limit) rate.Limit {
+	scale.RLock()
+	defer scale.RUnlock()
+
+	return limit * rate.Limit(scale.value)
+}
+
+// Policy is the rate limit of the operation set by the x-wallarm-ratelimit extension
+type Policy struct {
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	RequestsPerMinute float64 `json:"requests_per_minute"`
+	Burst             int     `json:"burst"`
+	Key               string  `json:"key"`
+}
+
+type client struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// Limiter is the token bucket rate limiter shared by all requests (global key)
+// or separate for each client IP address (ip key, default)
+type Limiter struct {
+	limit rate.Limit
+	burst int
+	key   string
+
+	mu        sync.Mutex
+	global    *rate.Limiter
+	clients   map[string]*client
+	lastSweep time.Time
+
+	redis     *redis.Client
+	keyPrefix string
+	logger    *logrus.Logger
+
+	// sharedDown is set while the shared state is not available, so only the changes of the state are logged
+	sharedDown int32
+}
+
+// New creates the limiter of the policy
+func New(policy Policy) (*Limiter, error) {
+	var limit rate.Limit
+	switch {
+	case policy.RequestsPerSecond > 0:
+		limit = rate.Limit(policy.RequestsPerSecond)
+	case policy.RequestsPerMinute > 0:
+		limit = rate.Limit(policy.RequestsPerMinute / 60)
+	default:
+		return nil, ErrInvalidPolicy
+	}
+
+	burst := policy.Burst
+	if burst <= 0 {
+		burst = int(math.Max(1, math.Ceil(float64(limit))))
+	}
+
+	l := Limiter{
+		limit:     limit,
+		burst:     burst,
+		key:       policy.Key,
+		clients:   make(map[string]*client),
+		lastSweep: time.Now(),
+	}
+
+	switch policy.Key {
+	case KeyGlobal:
+		l.global = rate.NewLimiter(limit, burst)
+	case "", KeyIP:
+		l.key = KeyIP
+	default:
+		return nil, errors.New("unsupported rate limit key: " + policy.Key)
+	}
+
+	return &l, nil
+}
+
+// Key returns the kind of the limiter key: ip or global
+func (l *Limiter) Key() string {
+	return l.key
+}
+
+// Allow reports whether the request of the client may happen now
+func (l *Limiter) Allow(clientKey string) bool {
+	if l.redis != nil {
+		allowed, err := l.allowShared(clientKey)
+		if err == nil {
+			if atomic.CompareAndSwapInt32(&l.sharedDown, 1, 0) {
+				l.logger.Infof("rate limit: shared state is available again")
+			}
+			return allowed
+		}
+		// the local state is used if the shared state is not available
+		if atomic.CompareAndSwapInt32(&l.sharedDown, 0, 1) {
+			l.logger.Warnf("rate limit: shared state is not available, falling back to the local state: %s", err)
+		}
+	}
+
+	now := time.Now()
+	limit := scaled(l.limit)
+
+	if l.global != nil {
+		if l.global.Limit() != limit {
+			l.global.SetLimitAt(now, limit)
+		}
+		return l.global.AllowN(now, 1)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	c, ok := l.clients[clientKey]
+	if !ok {
+		c = &client{limiter: rate.NewLimiter(limit, l.burst)}
+		l.clients[clientKey] = c
+	}
+	c.lastSeen = now
+
+	if c.limiter.Limit() != limit {
+		c.limiter.SetLimitAt(now, limit)
+	}
+
+	if now.Sub(l.lastSweep) > clientIdleTimeout {
+		for key, c := range l.clients {
+			if now.Sub(c.lastSeen) > clientIdleTimeout {
+				delete(l.clients, key)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	return c.limiter.AllowN(now, 1)
+}
+
+// RetryAfter returns the period after which the next request is allowed by the empty bucket
+func (l *Limiter) RetryAfter() time.Duration {
+	return time.Duration(float64(time.Second) / float64(scaled(l.limit)))
+}
@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+)
+
+// sharedTimeout limits the time of the shared limiter check
+const sharedTimeout = 100 * time.Millisecond
+
+// gcraScript implements the generic cell rate algorithm. The theoretical arrival time of the next
+// request is stored in the key in microseconds of the Redis server clock, so the limit doesn't depend
+// on the clocks of the APIFW instances. ARGV[1] is the emission interval and ARGV[2] is the burst
+var gcraScript = redis.NewScript(`
+redis.replicate_commands()
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+local emission = tonumber(ARGV[1])
+local tolerance = emission * tonumber(ARGV[2])
+local tat = tonumber(redis.call('GET', KEYS[1]) or now)
+if tat < now then
+	tat = now
+end
+local newTat = tat + emission
+if newTat - now > tolerance then
+	return 0
+end
+redis.call('SET', KEYS[1], string.format('%d', newTat), 'PX', math.ceil((newTat - now) / 1000))
+return 1
+`)
+
+// Shared makes the limiter share the state by the Redis server with the limiters of other APIFW
+// instances. The keys of the buckets start with the key prefix. The limiter falls back to the local
+// state if the Redis server is not available
+func (l *Limiter) Shared(client *redis.Client, keyPrefix string, logger *logrus.Logger) *Limiter {
+	l.redis = client
+	l.keyPrefix = keyPrefix
+	l.logger = logger
+	return l
+}
+
+// allowShared checks the bucket of the client stored in the Redis server
+func (l *Limiter) allowShared(clientKey string) (bool, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), sharedTimeout)
+	defer cancel()
+
+	key := l.keyPrefix + ":" + KeyGlobal
+	if l.key == KeyIP {
+		key = l.keyPrefix + ":" + clientKey
+	}
+
+	emission := int64(float64(time.Second/time.Microsecond) / float64(scaled(l.limit)))
+	if emission < 1 {
+		emission = 1
+	}
+
+	allowed, err := gcraScript.Run(ctx, l.redis, []string{key}, emission, l.burst).Int()
+	if err != nil {
+		return false, err
+	}
+
+	return allowed == 1, nil
+}
@@ -0,0 +1,164 @@
+package replay
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Envelope is the request blocked by the request validation. The redacted headers are not stored
+// and the body is truncated to the max body size
+type Envelope struct {
+	ID        string              `json:"id"`
+	RequestID string              `json:"request_id"`
+	Time      time.Time           `json:"time"`
+	Operation string              `json:"operation"`
+	Method    string              `json:"method"`
+	URI       string              `json:"uri"`
+	Headers   map[string][]string `json:"headers"`
+	Body      []byte              `json:"body"`
+	Truncated bool                `json:"truncated"`
+	Reason    string              `json:"reason"`
+}
+
+// Store keeps the last blocked requests. The oldest request is removed when the store is full
+type Store struct {
+	mu          sync.Mutex
+	capacity    int
+	maxBodySize int
+	redact      map[string]struct{}
+	seq         uint64
+	envelopes   []Envelope
+}
+
+// Denied is the store of the requests blocked by the request validation. The requests are not stored
+// until the store is configured
+var Denied = &Store{}
+
+// Configure sets the capacity of the store, the max size of the stored body and the headers which are not stored.
+// The stored requests over the capacity are removed
+func (s *Store) Configure(capacity, maxBodySize int, redactHeaders []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.capacity = capacity
+	s.maxBodySize = maxBodySize
+	s.redact = make(map[string]struct{}, len(redactHeaders))
+	for _, header := range redactHeaders {
+		s.redact[strings.ToLower(header)] = struct{}{}
+	}
+
+	if len(s.envelopes) > capacity {
+		s.envelopes = append([]Envelope(nil), s.envelopes[len(s.envelopes)-capacity:]...)
+	}
+}
+
+// Add stores the blocked request
+func (s *Store) Add(ctx *fasthttp.RequestCtx, operation, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.capacity <= 0 {
+		return
+	}
+
+	s.seq++
+
+	envelope := Envelope{
+		ID:        strconv.FormatUint(s.seq, 10),
+		RequestID: fmt.Sprintf("#%016X", ctx.ID()),
+		Time:      time.Now(),
+		Operation: operation,
+		Method:    string(ctx.Method()),
+		URI:       string(ctx.RequestURI()),
+		Headers:   make(map[string][]string),
+		Reason:    reason,
+	}
+
+	ctx.Request.Header.VisitAll(func(k, v []byte) {
+		name := string(k)
+		if _, ok := s.redact[strings.ToLower(name)]; ok {
+			return
+		}
+		envelope.Headers[name] = append(envelope.Headers[name], string(v))
+	})
+
+	body := ctx.Request.Body()
+	if s.maxBodySize > 0 && len(body) > s.maxBodySize {
+		body = body[:s.maxBodySize]
+		envelope.Truncated = true
+	}
+	envelope.Body = append([]byte(nil), body...)
+
+	if len(s.envelopes) >= s.capacity {
+		s.envelopes = append(s.envelopes[:0], s.envelopes[len(s.envelopes)-s.capacity+1:]...)
+	}
+	s.envelopes = append(s.envelopes, envelope)
+}
+
+// List returns the stored requests from the oldest to the newest
+func (s *Store) List() []Envelope {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Envelope{}, s.envelopes...)
+}
+
+// Get returns the stored requests with the IDs. All stored requests are returned if the IDs are empty
+func (s *Store) Get(ids []string) []Envelope {
+	if len(ids) == 0 {
+		return s.List()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	selected := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		selected[id] = struct{}{}
+	}
+
+	var envelopes []Envelope
+	for _, envelope := range s.envelopes {
+		if _, ok := selected[envelope.ID]; ok {
+			envelopes = append(envelopes, envelope)
+		}
+	}
+
+	return envelopes
+}
+
+// Remove removes the stored requests with the IDs
+func (s *Store) Remove(ids []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	selected := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		selected[id] = struct{}{}
+	}
+
+	envelopes := s.envelopes[:0]
+	for _, envelope := range s.envelopes {
+		if _, ok := selected[envelope.ID]; !ok {
+			envelopes = append(envelopes, envelope)
+		}
+	}
+	s.envelopes = envelopes
+}
+
+// Request builds the request from the envelope
+func (e *Envelope) Request(req *fasthttp.Request) {
+	req.Header.SetMethod(e.Method)
+	req.SetRequestURI(e.URI)
+	for name, values := range e.Headers {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	req.SetBody(e.Body)
+}
@@ -0,0 +1,230 @@
+package responsediff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"sort"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/config"
+)
+
+// Stats is the number of the compared responses
+type Stats struct {
+	Compared  int64 `json:"compared"`
+	Different int64 `json:"different"`
+	Errors    int64 `json:"errors"`
+	Skipped   int64 `json:"skipped"`
+}
+
+// Comparer sends the copies of the proxied requests to the comparison upstream and logs
+// the differences between the responses. The primary response is never changed
+type Comparer struct {
+	cfg     *config.ResponseDiff
+	logger  *logrus.Logger
+	url     *url.URL
+	client  *fasthttp.Client
+	ignored map[string]struct{}
+	slots   chan struct{}
+}
+
+// totals counts the responses compared by all comparers
+var totals Stats
+
+// New creates the comparer of the responses of the comparison upstream
+func New(cfg *config.ResponseDiff, logger *logrus.Logger) (*Comparer, error) {
+
+	comparisonUrl, err := url.ParseRequestURI(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("comparison upstream url: %w", err)
+	}
+
+	c := Comparer{
+		cfg:     cfg,
+		logger:  logger,
+		url:     comparisonUrl,
+		client:  &fasthttp.Client{ReadTimeout: cfg.Timeout, WriteTimeout: cfg.Timeout, NoDefaultUserAgentHeader: true},
+		ignored: make(map[string]struct{}, len(cfg.IgnoreFields)),
+		slots:   make(chan struct{}, cfg.MaxConcurrent),
+	}
+
+	for _, field := range cfg.IgnoreFields {
+		c.ignored[field] = struct{}{}
+	}
+
+	return &c, nil
+}
+
+// Sampled returns true if the request is selected for the comparison
+func (c *Comparer) Sampled() bool {
+	return c.cfg.Percentage >= 100 || rand.Float64()*100 < c.cfg.Percentage
+}
+
+// Compare sends the request to the comparison upstream in the background and compares the response
+// with the primary one. The request is released by the comparer. The comparison is skipped if
+// the number of the running comparisons reaches the limit
+func (c *Comparer) Compare(requestID uint64, req *fasthttp.Request, primary *fasthttp.Response) {
+
+	select {
+	case c.slots <- struct{}{}:
+	default:
+		atomic.AddInt64(&totals.Skipped, 1)
+		fasthttp.ReleaseRequest(req)
+		return
+	}
+
+	primaryStatus := primary.StatusCode()
+	primaryBody := append([]byte(nil), primary.Body()...)
+
+	go func() {
+		defer func() { <-c.slots }()
+		defer fasthttp.ReleaseRequest(req)
+
+		res := fasthttp.AcquireResponse()
+		defer fasthttp.ReleaseResponse(res)
+
+		req.URI().SetScheme(c.url.Scheme)
+		req.URI().SetHost(c.url.Host)
+		req.SetHost(c.url.Host)
+
+		if err := c.client.DoTimeout(req, res, c.cfg.Timeout); err != nil {
+			atomic.AddInt64(&totals.Errors, 1)
+			c.logger.WithFields(logrus.Fields{
+				"error":      err,
+				"request_id": fmt.Sprintf("#%016X", requestID),
+			}).Error("response diff: comparison upstream request")
+			return
+		}
+
+		atomic.AddInt64(&totals.Compared, 1)
+
+		diffs := Diff(primaryStatus, primaryBody, res.StatusCode(), res.Body(), c.ignored, c.cfg.MaxDiffs)
+		if len(diffs) == 0 {
+			return
+		}
+
+		atomic.AddInt64(&totals.Different, 1)
+		c.logger.WithFields(logrus.Fields{
+			"request_id": fmt.Sprintf("#%016X", requestID),
+			"method":     string(req.Header.Method()),
+			"path":       string(req.URI().Path()),
+			"diffs":      diffs,
+		}).Warning("response diff: responses of the primary and the comparison upstreams differ")
+	}()
+}
+
+// Totals returns the number of the responses compared by all comparers
+func Totals() Stats {
+	return Stats{
+		Compared:  atomic.LoadInt64(&totals.Compared),
+		Different: atomic.LoadInt64(&totals.Different),
+		Errors:    atomic.LoadInt64(&totals.Errors),
+		Skipped:   atomic.LoadInt64(&totals.Skipped),
+	}
+}
+
+// Diff returns the structural differences between the primary and the comparison responses.
+// JSON bodies are compared by the fields (the ignored fields are set by the paths like $.meta.time),
+// other bodies are compared as is. At most maxDiffs differences are returned if maxDiffs is positive
+func Diff(primaryStatus int, primaryBody []byte, status int, body []byte, ignored map[string]struct{}, maxDiffs int) []string {
+
+	var diffs []string
+	if primaryStatus != status {
+		diffs = append(diffs, fmt.Sprintf("status: %d != %d", primaryStatus, status))
+	}
+
+	var primaryValue, value interface{}
+	if json.Unmarshal(primaryBody, &primaryValue) != nil || json.Unmarshal(body, &value) != nil {
+		if !bytes.Equal(primaryBody, body) {
+			diffs = append(diffs, "body: not equal")
+		}
+		return diffs
+	}
+
+	diffs = diffValues("$", primaryValue, value, ignored, diffs)
+	if maxDiffs > 0 && len(diffs) > maxDiffs {
+		diffs = diffs[:maxDiffs]
+	}
+
+	return diffs
+}
+
+func diffValues(path string, primary, value interface{}, ignored map[string]struct{}, diffs []string) []string {
+
+	if _, ok := ignored[path]; ok {
+		return diffs
+	}
+
+	if typeName(primary) != typeName(value) {
+		return append(diffs, fmt.Sprintf("%s: %s != %s", path, typeName(primary), typeName(value)))
+	}
+
+	switch primary := primary.(type) {
+	case map[string]interface{}:
+		object := value.(map[string]interface{})
+
+		keys := make([]string, 0, len(primary)+len(object))
+		for key := range primary {
+			keys = append(keys, key)
+		}
+		for key := range object {
+			if _, ok := primary[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			keyPath := path + "." + key
+			if _, ok := ignored[keyPath]; ok {
+				continue
+			}
+			primaryField, inPrimary := primary[key]
+			field, inComparison := object[key]
+			switch {
+			case !inComparison:
+				diffs = append(diffs, keyPath+": missing in comparison")
+			case !inPrimary:
+				diffs = append(diffs, keyPath+": missing in primary")
+			default:
+				diffs = diffValues(keyPath, primaryField, field, ignored, diffs)
+			}
+		}
+	case []interface{}:
+		array := value.([]interface{})
+		if len(primary) != len(array) {
+			diffs = append(diffs, fmt.Sprintf("%s: length %d != %d", path, len(primary), len(array)))
+		}
+		for i := 0; i < len(primary) && i < len(array); i++ {
+			diffs = diffValues(fmt.Sprintf("%s[%d]", path, i), primary[i], array[i], ignored, diffs)
+		}
+	default:
+		if primary != value {
+			diffs = append(diffs, path+": value differs")
+		}
+	}
+
+	return diffs
+}
+
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
@@ -0,0 +1,236 @@
+package revocation
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/karlseguin/ccache/v2"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/config"
+	"golang.org/x/crypto/ocsp"
+)
+
+const (
+	PolicyFailOpen   = "FAIL_OPEN"
+	PolicyFailClosed = "FAIL_CLOSED"
+)
+
+var (
+	// ErrRevoked is returned if the certificate is revoked
+	ErrRevoked = errors.New("certificate is revoked")
+
+	// errUnknown is returned by the CRL check if no CRL of the issuer is loaded
+	errUnknown = errors.New("revocation status is unknown")
+)
+
+// Checker checks the revocation status of the client certificates by the CRL files and by the OCSP responders
+// of the certificates. The OCSP responses are cached until the next update of the response
+type Checker struct {
+	cfg    *config.Revocation
+	logger *logrus.Logger
+	cache  *ccache.Cache
+
+	mu   sync.RWMutex
+	crls []*x509.RevocationList
+}
+
+// New returns nil if neither the OCSP check nor the CRL files are configured
+func New(cfg *config.Revocation, logger *logrus.Logger) (*Checker, error) {
+
+	if !cfg.OCSP && len(cfg.CRLFiles) == 0 {
+		return nil, nil
+	}
+
+	c := Checker{
+		cfg:    cfg,
+		logger: logger,
+		cache:  ccache.New(ccache.Configure()),
+	}
+
+	if err := c.LoadCRLs(); err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// LoadCRLs loads the PEM or DER encoded CRL files. The loaded CRLs are kept if any file can't be loaded
+func (c *Checker) LoadCRLs() error {
+
+	var crls []*x509.RevocationList
+
+	for _, file := range c.cfg.CRLFiles {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return errors.Wrap(err, "loading CRL")
+		}
+
+		if block, _ := pem.Decode(data); block != nil {
+			data = block.Bytes
+		}
+
+		crl, err := x509.ParseRevocationList(data)
+		if err != nil {
+			return errors.Wrapf(err, "parsing CRL %s", file)
+		}
+		crls = append(crls, crl)
+	}
+
+	c.mu.Lock()
+	c.crls = crls
+	c.mu.Unlock()
+
+	return nil
+}
+
+// Run reloads the CRL files by the reload interval until the process is stopped
+func (c *Checker) Run() {
+	for {
+		time.Sleep(c.cfg.CRLReloadInterval)
+		if err := c.LoadCRLs(); err != nil {
+			c.logger.Errorf("Revocation: %s: the loaded CRLs are kept", err.Error())
+		}
+	}
+}
+
+// Check checks the revocation status of the leaf certificate of the verified chain. The CRLs are checked
+// first and the OCSP responder is requested if no CRL of the issuer is loaded. The error is returned if the
+// certificate is revoked or the status can't be checked and the failure policy is FAIL_CLOSED
+func (c *Checker) Check(chain []*x509.Certificate) error {
+
+	err := c.check(chain)
+	if err == nil || errors.Is(err, ErrRevoked) {
+		return err
+	}
+
+	if c.cfg.FailurePolicy == PolicyFailOpen {
+		c.logger.WithFields(logrus.Fields{
+			"error":               err,
+			"client_cert_subject": chain[0].Subject.String(),
+		}).Warning("client certificate revocation status is not checked")
+		return nil
+	}
+
+	return err
+}
+
+func (c *Checker) check(chain []*x509.Certificate) error {
+
+	if len(chain) < 2 {
+		return errors.New("the issuer of the certificate is not in the verified chain")
+	}
+
+	cert, issuer := chain[0], chain[1]
+
+	err := c.checkCRL(cert, issuer)
+	if err != errUnknown || !c.cfg.OCSP {
+		return err
+	}
+
+	return c.checkOCSP(cert, issuer)
+}
+
+func (c *Checker) checkCRL(cert, issuer *x509.Certificate) error {
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, crl := range c.crls {
+		if !bytes.Equal(crl.RawIssuer, issuer.RawSubject) {
+			continue
+		}
+
+		if err := crl.CheckSignatureFrom(issuer); err != nil {
+			return errors.Wrap(err, "CRL signature")
+		}
+
+		if !crl.NextUpdate.IsZero() && time.Now().After(crl.NextUpdate) {
+			return fmt.Errorf("CRL of %s is expired at %s", issuer.Subject, crl.NextUpdate)
+		}
+
+		for _, revoked := range crl.RevokedCertificates {
+			if revoked.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+				return ErrRevoked
+			}
+		}
+
+		return nil
+	}
+
+	return errUnknown
+}
+
+func (c *Checker) checkOCSP(cert, issuer *x509.Certificate) error {
+
+	issuerHash := sha256.Sum256(issuer.Raw)
+	key := fmt.Sprintf("%x:%s", issuerHash, cert.SerialNumber)
+
+	if item := c.cache.Get(key); item != nil && !item.Expired() {
+		if item.Value().(int) == ocsp.Revoked {
+			return ErrRevoked
+		}
+		return nil
+	}
+
+	if len(cert.OCSPServer) == 0 {
+		return errors.New("the certificate has no OCSP responder")
+	}
+
+	ocspRequest, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return errors.Wrap(err, "OCSP request")
+	}
+
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+
+	res := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(res)
+
+	req.SetRequestURI(cert.OCSPServer[0])
+	req.Header.SetMethod(fasthttp.MethodPost)
+	req.Header.SetContentType("application/ocsp-request")
+	req.SetBody(ocspRequest)
+
+	if err := fasthttp.DoTimeout(req, res, c.cfg.OCSPTimeout); err != nil {
+		return errors.Wrap(err, "OCSP request")
+	}
+
+	if res.StatusCode() != fasthttp.StatusOK {
+		return fmt.Errorf("unexpected status code %d from the OCSP responder", res.StatusCode())
+	}
+
+	ocspResponse, err := ocsp.ParseResponseForCert(res.Body(), cert, issuer)
+	if err != nil {
+		return errors.Wrap(err, "OCSP response")
+	}
+
+	if ocspResponse.Status == ocsp.Unknown {
+		return errUnknown
+	}
+
+	// the response is cached until the next update but not longer than the cache TTL
+	ttl := c.cfg.CacheTTL
+	if !ocspResponse.NextUpdate.IsZero() {
+		if untilNext := time.Until(ocspResponse.NextUpdate); untilNext < ttl {
+			ttl = untilNext
+		}
+	}
+	if ttl > 0 {
+		c.cache.Set(key, ocspResponse.Status, ttl)
+	}
+
+	if ocspResponse.Status == ocsp.Revoked {
+		return ErrRevoked
+	}
+
+	return nil
+}
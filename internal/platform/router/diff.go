@@ -0,0 +1,102 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+)
+
+// SpecDiff describes the changes of the enforced operations and schemas
+// between two API Specs
+type SpecDiff struct {
+	AddedOperations   []string `json:"added_operations"`
+	RemovedOperations []string `json:"removed_operations"`
+	ChangedOperations []string `json:"changed_operations"`
+	AddedSchemas      []string `json:"added_schemas"`
+	RemovedSchemas    []string `json:"removed_schemas"`
+	ChangedSchemas    []string `json:"changed_schemas"`
+}
+
+// IsEmpty returns true if the API Specs enforce the same operations and schemas
+func (d *SpecDiff) IsEmpty() bool {
+	return len(d.AddedOperations) == 0 && len(d.RemovedOperations) == 0 && len(d.ChangedOperations) == 0 &&
+		len(d.AddedSchemas) == 0 && len(d.RemovedSchemas) == 0 && len(d.ChangedSchemas) == 0
+}
+
+// Diff compares operations and component schemas of the old and the new routers
+func Diff(oldRouter, newRouter *Router) *SpecDiff {
+	diff := SpecDiff{}
+
+	diff.AddedOperations, diff.RemovedOperations, diff.ChangedOperations = diffItems(operations(oldRouter), operations(newRouter))
+	diff.AddedSchemas, diff.RemovedSchemas, diff.ChangedSchemas = diffItems(schemas(oldRouter), schemas(newRouter))
+
+	return &diff
+}
+
+// operations returns JSON representation of each operation (including common parameters) by "METHOD path"
+func operations(r *Router) map[string][]byte {
+	items := make(map[string][]byte)
+	if r == nil {
+		return items
+	}
+
+	for _, route := range r.Routes {
+		value, err := json.Marshal(struct {
+			Operation  interface{} `json:"operation"`
+			Parameters interface{} `json:"parameters"`
+		}{
+			Operation:  route.Route.Operation,
+			Parameters: route.Route.PathItem.Parameters,
+		})
+		if err != nil {
+			continue
+		}
+		items[route.Method+" "+route.Path] = value
+	}
+
+	return items
+}
+
+// schemas returns JSON representation of each component schema by name
+func schemas(r *Router) map[string][]byte {
+	items := make(map[string][]byte)
+	if r == nil || r.Spec == nil {
+		return items
+	}
+
+	for name, schema := range r.Spec.Components.Schemas {
+		value, err := json.Marshal(schema)
+		if err != nil {
+			continue
+		}
+		items[name] = value
+	}
+
+	return items
+}
+
+func diffItems(oldItems, newItems map[string][]byte) (added, removed, changed []string) {
+	added, removed, changed = []string{}, []string{}, []string{}
+
+	for name, newValue := range newItems {
+		oldValue, ok := oldItems[name]
+		switch {
+		case !ok:
+			added = append(added, name)
+		case !bytes.Equal(oldValue, newValue):
+			changed = append(changed, name)
+		}
+	}
+
+	for name := range oldItems {
+		if _, ok := newItems[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+
+	return
+}
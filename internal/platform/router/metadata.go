@@ -0,0 +1,37 @@
+package router
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// SpecMetadata describes the enforced API Spec
+type SpecMetadata struct {
+	Title      string `json:"title"`
+	Version    string `json:"version"`
+	SHA256     string `json:"sha256"`
+	Operations int    `json:"operations"`
+}
+
+// Metadata returns the title and the version of the API Spec, the hash of its
+// JSON representation and the number of the enforced operations
+func (r *Router) Metadata() SpecMetadata {
+	metadata := SpecMetadata{Operations: len(r.Routes)}
+
+	if r.Spec == nil {
+		return metadata
+	}
+
+	if r.Spec.Info != nil {
+		metadata.Title = r.Spec.Info.Title
+		metadata.Version = r.Spec.Info.Version
+	}
+
+	if data, err := json.Marshal(r.Spec); err == nil {
+		hash := sha256.Sum256(data)
+		metadata.SHA256 = hex.EncodeToString(hash[:])
+	}
+
+	return metadata
+}
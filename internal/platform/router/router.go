@@ -2,6 +2,7 @@ package router
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"strings"
 
@@ -12,6 +13,7 @@ import (
 // Router helps link http.Request.s and an OpenAPIv3 spec
 type Router struct {
 	Routes []Route
+	Spec   *openapi3.T
 }
 
 type Route struct {
@@ -28,7 +30,7 @@ func NewRouter(doc *openapi3.T) (*Router, error) {
 	if err := doc.Validate(context.Background()); err != nil {
 		return nil, fmt.Errorf("validating OpenAPI failed: %v", err)
 	}
-	var router Router
+	router := Router{Spec: doc}
 
 	for path, pathItem := range doc.Paths {
 		for method, operation := range pathItem.Operations() {
@@ -49,3 +51,26 @@ func NewRouter(doc *openapi3.T) (*Router, error) {
 	}
 	return &router, nil
 }
+
+// GetExtension decodes the value of the OpenAPI extension (x-...) into v. It returns
+// false if the extension is not defined.
+func GetExtension(extensions map[string]interface{}, name string, v interface{}) (bool, error) {
+	value, ok := extensions[name]
+	if !ok {
+		return false, nil
+	}
+
+	raw, ok := value.(json.RawMessage)
+	if !ok {
+		var err error
+		if raw, err = json.Marshal(value); err != nil {
+			return true, err
+		}
+	}
+
+	if err := json.Unmarshal(raw, v); err != nil {
+		return true, fmt.Errorf("invalid value of the %s extension: %v", name, err)
+	}
+
+	return true, nil
+}
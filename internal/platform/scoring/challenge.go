@@ -0,0 +1,75 @@
+package scoring
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// SignClearance returns the value of the clearance cookie issued by the challenge provider to the client which
+// passed the challenge: "<expiration unix time>.<hex HMAC-SHA256 of the expiration time and the client address>".
+// The empty address is used if the clearance is not bound to the client address
+func SignClearance(secret, address string, expires time.Time) string {
+	value := strconv.FormatInt(expires.Unix(), 10)
+	return value + "." + clearanceMAC(secret, value, address)
+}
+
+func clearanceMAC(secret, expires, address string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(expires + "." + address))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Cleared returns true if the request has the valid clearance cookie of the challenge provider
+func (s *Scorer) Cleared(ctx *fasthttp.RequestCtx) bool {
+
+	challenge := s.cfg.Challenge
+	if challenge.Secret == "" {
+		return false
+	}
+
+	cookie := string(ctx.Request.Header.Cookie(challenge.CookieName))
+	expires, signature, ok := strings.Cut(cookie, ".")
+	if !ok {
+		return false
+	}
+
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return false
+	}
+
+	address := ""
+	if challenge.BindAddress {
+		address = ctx.RemoteIP().String()
+	}
+
+	return hmac.Equal([]byte(signature), []byte(clearanceMAC(challenge.Secret, expires, address)))
+}
+
+// ChallengeURL returns the URL of the challenge provider with the URI of the request to return to
+// after the challenge is passed. It returns the empty string if the provider is not configured
+func (s *Scorer) ChallengeURL(ctx *fasthttp.RequestCtx) string {
+
+	challenge := s.cfg.Challenge
+	if challenge.URL == "" {
+		return ""
+	}
+
+	u, err := url.Parse(challenge.URL)
+	if err != nil {
+		return ""
+	}
+
+	query := u.Query()
+	query.Set(challenge.ReturnParam, string(ctx.Request.URI().RequestURI()))
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
@@ -0,0 +1,72 @@
+package scoring
+
+import (
+	"bytes"
+	"regexp"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	AnomalyMissingUserAgent      = "missing-user-agent"
+	AnomalyMissingAccept         = "missing-accept"
+	AnomalyMissingHost           = "missing-host"
+	AnomalyAutomationUserAgent   = "automation-user-agent"
+	AnomalyBrowserHeadersMissing = "browser-headers-missing"
+	AnomalyBrowserHTTP10         = "browser-http-1.0"
+	AnomalyToolBrowserAccept     = "tool-with-browser-accept"
+)
+
+var (
+	// browserUserAgent matches the user agents of the common browsers
+	browserUserAgent = regexp.MustCompile(`^Mozilla/5\.0 .*(Chrome|Firefox|Safari|Edg)/`)
+	// automationUserAgent matches the headless browsers and the automation frameworks
+	automationUserAgent = regexp.MustCompile(`(?i)(HeadlessChrome|PhantomJS|Selenium|puppeteer|playwright)`)
+	// toolUserAgent matches the HTTP libraries and the command line tools
+	toolUserAgent = regexp.MustCompile(`(?i)^(curl|wget|python-requests|python-urllib|Go-http-client|okhttp|libwww-perl|Java|Apache-HttpClient|axios|node-fetch|Scrapy)\b`)
+)
+
+// headerAnomalies returns the inconsistencies of the request headers typical for the bots: the missing standard
+// headers, the browser user agent without the headers sent by the browsers or over HTTP/1.0, the automation
+// frameworks and the HTTP libraries pretending to be browsers by the Accept header
+func headerAnomalies(header *fasthttp.RequestHeader) []string {
+
+	var anomalies []string
+
+	userAgent := header.UserAgent()
+	accept := header.Peek(fasthttp.HeaderAccept)
+
+	if len(userAgent) == 0 {
+		anomalies = append(anomalies, AnomalyMissingUserAgent)
+	}
+
+	if len(accept) == 0 {
+		anomalies = append(anomalies, AnomalyMissingAccept)
+	}
+
+	// the Host header is required by HTTP/1.1
+	if header.IsHTTP11() && len(header.Host()) == 0 {
+		anomalies = append(anomalies, AnomalyMissingHost)
+	}
+
+	if automationUserAgent.Match(userAgent) {
+		anomalies = append(anomalies, AnomalyAutomationUserAgent)
+	}
+
+	if browserUserAgent.Match(userAgent) {
+		// the browsers always send the preferred languages and the supported encodings
+		if len(header.Peek(fasthttp.HeaderAcceptLanguage)) == 0 || len(header.Peek(fasthttp.HeaderAcceptEncoding)) == 0 {
+			anomalies = append(anomalies, AnomalyBrowserHeadersMissing)
+		}
+		if !header.IsHTTP11() {
+			anomalies = append(anomalies, AnomalyBrowserHTTP10)
+		}
+	}
+
+	// the tools accept any content, the Accept header of the browser navigation is copied by the scrapers
+	if toolUserAgent.Match(userAgent) && bytes.Contains(accept, []byte("text/html")) && bytes.Contains(accept, []byte("application/xhtml+xml")) {
+		anomalies = append(anomalies, AnomalyToolBrowserAccept)
+	}
+
+	return anomalies
+}
@@ -0,0 +1,150 @@
+package scoring
+
+import (
+	"net/url"
+	"regexp"
+	"sync/atomic"
+
+	"github.com/karlseguin/ccache/v2"
+	"github.com/pkg/errors"
+	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/config"
+)
+
+const (
+	SignalSchema    = "schema"
+	SignalHeuristic = "heuristic"
+	SignalVelocity  = "velocity"
+	SignalHeaders   = "headers"
+
+	ActionPass      = "pass"
+	ActionLog       = "log"
+	ActionChallenge = "challenge"
+	ActionBlock     = "block"
+
+	// maxInspectedBody is the number of the first bytes of the body matched by the heuristics
+	maxInspectedBody = 64 * 1024
+)
+
+// defaultHeuristics are the patterns of the common injections
+var defaultHeuristics = []string{
+	`(?i)\bunion\b[\s(]+(all\s+)?select\b`,
+	`(?i)\b(or|and)\s+['"]?\d+['"]?\s*=\s*['"]?\d+`,
+	`(?i)<\s*script\b`,
+	`(?i)\bjavascript\s*:`,
+	`\.\./`,
+	`(?i)\$\{\s*jndi\s*:`,
+}
+
+// Signal is the weak signal of the anomaly. The score of the request is the sum of the weights of the signals
+type Signal struct {
+	Name    string   `json:"name"`
+	Weight  int      `json:"weight"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// Scorer collects the heuristic and the velocity signals of the requests and selects the action by the score
+type Scorer struct {
+	cfg        *config.Scoring
+	heuristics []*regexp.Regexp
+	requests   *ccache.Cache
+}
+
+// New compiles the heuristic patterns. It returns nil if the scoring mode is disabled
+func New(cfg *config.Scoring) (*Scorer, error) {
+
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	s := Scorer{
+		cfg:      cfg,
+		requests: ccache.New(ccache.Configure()),
+	}
+
+	// the clients redirected to the challenge provider would be challenged again without the clearance
+	if cfg.Challenge.URL != "" {
+		if _, err := url.Parse(cfg.Challenge.URL); err != nil {
+			return nil, errors.Wrap(err, "scoring challenge URL")
+		}
+		if cfg.Challenge.Secret == "" {
+			return nil, errors.New("scoring challenge: the clearance secret is required by the challenge URL")
+		}
+	}
+
+	for _, pattern := range append(append([]string{}, defaultHeuristics...), cfg.HeuristicPatterns...) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "scoring heuristic pattern %q", pattern)
+		}
+		s.heuristics = append(s.heuristics, re)
+	}
+
+	return &s, nil
+}
+
+// Signals returns the heuristic signal if the decoded query or the body matches one of the patterns,
+// the velocity signal if the client exceeds the number of the requests in the window and the headers
+// signal weighted by the number of the header anomalies
+func (s *Scorer) Signals(ctx *fasthttp.RequestCtx) []Signal {
+
+	var signals []Signal
+
+	if s.cfg.HeuristicWeight > 0 {
+		query, err := url.QueryUnescape(string(ctx.URI().QueryString()))
+		if err != nil {
+			query = string(ctx.URI().QueryString())
+		}
+
+		body := ctx.Request.Body()
+		if len(body) > maxInspectedBody {
+			body = body[:maxInspectedBody]
+		}
+
+		for _, re := range s.heuristics {
+			if re.MatchString(query) || re.Match(body) {
+				signals = append(signals, Signal{Name: SignalHeuristic, Weight: s.cfg.HeuristicWeight})
+				break
+			}
+		}
+	}
+
+	if s.cfg.VelocityWeight > 0 && s.cfg.VelocityLimit > 0 {
+		item, err := s.requests.Fetch(ctx.RemoteIP().String(), s.cfg.VelocityWindow, func() (interface{}, error) {
+			return new(int64), nil
+		})
+		if err == nil && atomic.AddInt64(item.Value().(*int64), 1) > int64(s.cfg.VelocityLimit) {
+			signals = append(signals, Signal{Name: SignalVelocity, Weight: s.cfg.VelocityWeight})
+		}
+	}
+
+	if s.cfg.HeaderConsistencyWeight > 0 {
+		if anomalies := headerAnomalies(&ctx.Request.Header); len(anomalies) > 0 {
+			signals = append(signals, Signal{Name: SignalHeaders, Weight: s.cfg.HeaderConsistencyWeight * len(anomalies), Reasons: anomalies})
+		}
+	}
+
+	return signals
+}
+
+// Score returns the sum of the weights of the signals
+func Score(signals []Signal) int {
+	score := 0
+	for _, signal := range signals {
+		score += signal.Weight
+	}
+	return score
+}
+
+// Action returns the action of the highest threshold reached by the score. The zero threshold is not used
+func (s *Scorer) Action(score int) string {
+	switch {
+	case s.cfg.BlockThreshold > 0 && score >= s.cfg.BlockThreshold:
+		return ActionBlock
+	case s.cfg.ChallengeThreshold > 0 && score >= s.cfg.ChallengeThreshold:
+		return ActionChallenge
+	case s.cfg.LogThreshold > 0 && score >= s.cfg.LogThreshold:
+		return ActionLog
+	}
+	return ActionPass
+}
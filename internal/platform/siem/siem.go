@@ -0,0 +1,209 @@
+package siem
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	vendor  = "Wallarm"
+	product = "API Firewall"
+
+	// eventLog is the event class of the log entries which are not the security events
+	eventLog = "log"
+)
+
+// securityEvents are the event classes of the log messages of the security events. The messages are matched
+// by the prefix, so the reasons of the blocked requests ("request blocked: ...") are the same event class
+var securityEvents = []struct {
+	prefix string
+	class  string
+	name   string
+}{
+	{"request blocked", "request-blocked", "Request blocked"},
+	{"request validation error", "request-validation", "Request validation error"},
+	{"response validation error", "response-validation", "Response validation error"},
+	{"response headers validation error", "response-validation", "Response validation error"},
+	{"response status validation error", "response-validation", "Response validation error"},
+	{"Shadow API detected", "shadow-api", "Shadow API detected"},
+	{"denylist", "denylist", "Denied token"},
+	{"honeypot route requested", "honeypot", "Honeypot route requested"},
+	{"client banned", "client-banned", "Client banned"},
+	{"anomaly score threshold reached", "anomaly-score", "Anomaly score threshold reached"},
+	{"request smuggling attempt", "request-smuggling", "Request smuggling attempt"},
+	{"access denied by tag policy", "access-denied", "Access denied"},
+	{"operation is not allowed for the consumer", "access-denied", "Access denied"},
+	{"client certificate", "client-certificate", "Client certificate rejected"},
+	{"PII detected in response", "pii", "PII detected in response"},
+}
+
+// classify returns the event class and the name of the log entry. The other entries are the log event class
+// named by the message
+func classify(message string) (string, string) {
+	for _, event := range securityEvents {
+		if strings.HasPrefix(message, event.prefix) {
+			return event.class, event.name
+		}
+	}
+	return eventLog, message
+}
+
+// severity returns the severity of the level in the 0-10 scale
+func severity(level logrus.Level) int {
+	switch level {
+	case logrus.PanicLevel, logrus.FatalLevel:
+		return 10
+	case logrus.ErrorLevel:
+		return 7
+	case logrus.WarnLevel:
+		return 5
+	case logrus.InfoLevel:
+		return 3
+	}
+	return 1
+}
+
+// field is the extension of the event
+type field struct {
+	key   string
+	value string
+}
+
+// fields maps the fields of the log entry to the keys of the format. The client address is split into the
+// address and the port keys. The unmapped fields are added with the keys without the characters except
+// the letters and the digits
+func fields(entry *logrus.Entry, keys map[string]string, srcKey, srcPortKey string) []field {
+
+	names := make([]string, 0, len(entry.Data))
+	for name := range entry.Data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make([]field, 0, len(names)+1)
+	for _, name := range names {
+		value := fmt.Sprint(entry.Data[name])
+
+		if name == "client_address" {
+			if host, port, err := net.SplitHostPort(value); err == nil {
+				result = append(result, field{srcKey, host}, field{srcPortKey, port})
+				continue
+			}
+			result = append(result, field{srcKey, value})
+			continue
+		}
+
+		key, ok := keys[name]
+		if !ok {
+			key = strings.Map(func(r rune) rune {
+				if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+					return r
+				}
+				return -1
+			}, name)
+		}
+		if key == "" {
+			continue
+		}
+		result = append(result, field{key, value})
+	}
+
+	return result
+}
+
+// CEFFormatter formats the log entries in the ArcSight Common Event Format
+type CEFFormatter struct {
+	Version string
+}
+
+// cefKeys are the CEF keys of the log entry fields
+var cefKeys = map[string]string{
+	"request_id": "externalId",
+	"method":     "requestMethod",
+	"path":       "request",
+	"uri":        "request",
+	"consumer":   "suser",
+	"reason":     "reason",
+	"error":      "reason",
+	"operation":  "cs1",
+}
+
+// cefHeaderEscaper escapes the backslashes and the pipes in the header fields
+var cefHeaderEscaper = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ")
+
+// cefValueEscaper escapes the backslashes, the equal signs and the new lines in the extension values
+var cefValueEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`)
+
+// Format returns the CEF:0 event of the log entry
+func (f *CEFFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+
+	class, name := classify(entry.Message)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "CEF:0|%s|%s|%s|%s|%s|%d|", vendor, product, cefHeaderEscaper.Replace(f.Version),
+		cefHeaderEscaper.Replace(class), cefHeaderEscaper.Replace(name), severity(entry.Level))
+
+	fmt.Fprintf(&b, "rt=%d msg=%s", entry.Time.UnixMilli(), cefValueEscaper.Replace(entry.Message))
+
+	for _, field := range fields(entry, cefKeys, "src", "spt") {
+		if field.key == "cs1" {
+			b.WriteString(" cs1Label=operation")
+		}
+		b.WriteString(" " + field.key + "=" + cefValueEscaper.Replace(field.value))
+	}
+
+	b.WriteByte('\n')
+
+	return b.Bytes(), nil
+}
+
+// LEEFFormatter formats the log entries in the QRadar Log Event Extended Format
+type LEEFFormatter struct {
+	Version string
+}
+
+// leefKeys are the LEEF keys of the log entry fields
+var leefKeys = map[string]string{
+	"request_id": "externalId",
+	"method":     "method",
+	"path":       "url",
+	"uri":        "url",
+	"consumer":   "usrName",
+	"reason":     "reason",
+	"error":      "reason",
+	"operation":  "operation",
+}
+
+// leefHeaderEscaper escapes the backslashes and the pipes in the header fields
+var leefHeaderEscaper = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ")
+
+// leefValueEscaper replaces the tabs which delimit the attributes and the new lines in the attribute values
+var leefValueEscaper = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ")
+
+// Format returns the LEEF:1.0 event of the log entry with the tab delimited attributes
+func (f *LEEFFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+
+	class, _ := classify(entry.Message)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "LEEF:1.0|%s|%s|%s|%s|", vendor, product, leefHeaderEscaper.Replace(f.Version), leefHeaderEscaper.Replace(class))
+
+	b.WriteString("devTime=" + strconv.FormatInt(entry.Time.UnixMilli(), 10))
+	b.WriteString("\tsev=" + strconv.Itoa(severity(entry.Level)))
+	b.WriteString("\tcat=" + class)
+	b.WriteString("\tmsg=" + leefValueEscaper.Replace(entry.Message))
+
+	for _, field := range fields(entry, leefKeys, "src", "srcPort") {
+		b.WriteString("\t" + field.key + "=" + leefValueEscaper.Replace(field.value))
+	}
+
+	b.WriteByte('\n')
+
+	return b.Bytes(), nil
+}
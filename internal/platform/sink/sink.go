@@ -0,0 +1,310 @@
+package sink
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/config"
+	"github.com/wallarm/api-firewall/internal/platform/geoip"
+	"github.com/wallarm/api-firewall/internal/platform/useragent"
+	"github.com/wallarm/api-firewall/internal/platform/web"
+)
+
+const (
+	TypeClickHouse    = "CLICKHOUSE"
+	TypeElasticsearch = "ELASTICSEARCH"
+)
+
+// Record is the verdict of the request stored by the sink. The location columns of the client (country, city,
+// asn and as_org) are omitted if the GeoIP databases are not loaded
+type Record struct {
+	Time                   time.Time `json:"time"`
+	RequestID              string    `json:"request_id"`
+	ClientAddress          string    `json:"client_address"`
+	Method                 string    `json:"method"`
+	Path                   string    `json:"path"`
+	StatusCode             int       `json:"status_code"`
+	Operation              string    `json:"operation"`
+	Decision               string    `json:"decision"`
+	Rule                   string    `json:"rule"`
+	Reason                 string    `json:"reason"`
+	Subject                string    `json:"subject"`
+	Score                  int       `json:"score"`
+	RoutingTime            float64   `json:"routing_time_ms"`
+	RequestValidationTime  float64   `json:"request_validation_time_ms"`
+	UpstreamTime           float64   `json:"upstream_time_ms"`
+	ResponseValidationTime float64   `json:"response_validation_time_ms"`
+	Device                 string    `json:"device"`
+	Browser                string    `json:"browser"`
+	OS                     string    `json:"os"`
+
+	geoip.Location
+}
+
+// Stats are the numbers of the stored records. The records are dropped when the queue is full
+// and failed when the batch is not written after the retries
+type Stats struct {
+	Queued  int64 `json:"queued"`
+	Written int64 `json:"written"`
+	Dropped int64 `json:"dropped"`
+	Failed  int64 `json:"failed"`
+	Batches int64 `json:"batches"`
+}
+
+// Writer writes the records to ClickHouse or Elasticsearch in the background
+type Writer struct {
+	mu     sync.RWMutex
+	cfg    *config.EventSink
+	logger *logrus.Logger
+	client *fasthttp.Client
+	uri    string
+	queue  chan Record
+	done   chan struct{}
+
+	stats Stats
+}
+
+// Default is the writer of the verdicts of all handlers. The verdicts are not stored until the writer is started
+var Default = &Writer{}
+
+// Start starts writing the records to the storage. The started writer should be stopped
+func (w *Writer) Start(cfg *config.EventSink, logger *logrus.Logger) error {
+
+	storageUrl, err := url.ParseRequestURI(cfg.URL)
+	if err != nil {
+		return fmt.Errorf("event sink url: %w", err)
+	}
+
+	// the batches are inserted by the query of the ClickHouse HTTP interface or by the Elasticsearch bulk API
+	switch cfg.Type {
+	case TypeClickHouse:
+		query := storageUrl.Query()
+		query.Set("query", fmt.Sprintf("INSERT INTO %s FORMAT JSONEachRow", cfg.Table))
+		query.Set("date_time_input_format", "best_effort")
+		storageUrl.RawQuery = query.Encode()
+	case TypeElasticsearch:
+		storageUrl.Path = strings.TrimSuffix(storageUrl.Path, "/") + "/_bulk"
+	default:
+		return fmt.Errorf("unsupported event sink type: %s", cfg.Type)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.cfg = cfg
+	w.logger = logger
+	w.client = &fasthttp.Client{ReadTimeout: cfg.Timeout, WriteTimeout: cfg.Timeout, NoDefaultUserAgentHeader: true}
+	w.uri = storageUrl.String()
+	w.queue = make(chan Record, cfg.QueueSize)
+	w.done = make(chan struct{})
+
+	go w.run(w.queue, w.done)
+
+	return nil
+}
+
+// Stop writes the queued records and stops the writer
+func (w *Writer) Stop() {
+	w.mu.Lock()
+	queue, done := w.queue, w.done
+	w.queue = nil
+	w.mu.Unlock()
+
+	if queue == nil {
+		return
+	}
+
+	close(queue)
+	<-done
+}
+
+// Stats returns the numbers of the stored records
+func (w *Writer) Stats() Stats {
+	return Stats{
+		Queued:  atomic.LoadInt64(&w.stats.Queued),
+		Written: atomic.LoadInt64(&w.stats.Written),
+		Dropped: atomic.LoadInt64(&w.stats.Dropped),
+		Failed:  atomic.LoadInt64(&w.stats.Failed),
+		Batches: atomic.LoadInt64(&w.stats.Batches),
+	}
+}
+
+// Write queues the verdict of the handled request. The record is dropped if the queue is full
+func (w *Writer) Write(ctx *fasthttp.RequestCtx) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if w.queue == nil {
+		return
+	}
+
+	verdict := web.GetVerdict(ctx)
+	if verdict == nil {
+		return
+	}
+
+	client := useragent.FromCtx(ctx)
+
+	record := Record{
+		Time:                   ctx.Time(),
+		RequestID:              fmt.Sprintf("#%016X", ctx.ID()),
+		ClientAddress:          ctx.RemoteIP().String(),
+		Method:                 string(ctx.Method()),
+		Path:                   string(ctx.Path()),
+		StatusCode:             ctx.Response.StatusCode(),
+		Operation:              verdict.Operation,
+		Decision:               verdict.Decision,
+		Rule:                   verdict.Rule,
+		Reason:                 verdict.Reason,
+		Subject:                verdict.Subject,
+		Score:                  verdict.Score,
+		RoutingTime:            milliseconds(verdict.RoutingTime),
+		RequestValidationTime:  milliseconds(verdict.RequestValidationTime),
+		UpstreamTime:           milliseconds(verdict.UpstreamTime),
+		ResponseValidationTime: milliseconds(verdict.ResponseValidationTime),
+		Device:                 client.Device,
+		Browser:                client.Browser,
+		OS:                     client.OS,
+		Location:               geoip.Default.Lookup(ctx.RemoteIP()),
+	}
+
+	select {
+	case w.queue <- record:
+		atomic.AddInt64(&w.stats.Queued, 1)
+	default:
+		atomic.AddInt64(&w.stats.Dropped, 1)
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// run collects the records into the batches. The batch is written when it is full or after the flush interval
+func (w *Writer) run(queue chan Record, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(w.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Record, 0, w.cfg.BatchSize)
+	for {
+		select {
+		case record, ok := <-queue:
+			if !ok {
+				w.write(batch)
+				return
+			}
+			batch = append(batch, record)
+			if len(batch) >= w.cfg.BatchSize {
+				w.write(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			w.write(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// encode returns the body of the batch: the JSON rows for ClickHouse or the index actions
+// with the documents for Elasticsearch
+func (w *Writer) encode(batch []Record) ([]byte, error) {
+
+	action, err := json.Marshal(map[string]map[string]string{"index": {"_index": w.cfg.Index}})
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	for _, record := range batch {
+		if w.cfg.Type == TypeElasticsearch {
+			b.Write(action)
+			b.WriteByte('\n')
+		}
+		if err := encoder.Encode(record); err != nil {
+			return nil, err
+		}
+	}
+
+	return b.Bytes(), nil
+}
+
+// bulkResponse is the response of the Elasticsearch bulk API. The errors field is true if some documents are not indexed
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+}
+
+// write sends the batch to the storage. The batch is retried with the exponential backoff
+func (w *Writer) write(batch []Record) {
+	if len(batch) == 0 {
+		return
+	}
+
+	body, err := w.encode(batch)
+	if err != nil {
+		atomic.AddInt64(&w.stats.Failed, int64(len(batch)))
+		w.logger.WithFields(logrus.Fields{"error": err}).Error("event sink: encoding records")
+		return
+	}
+
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	res := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(res)
+
+	backoff := 100 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		req.SetRequestURI(w.uri)
+		req.Header.SetMethod(fasthttp.MethodPost)
+		req.Header.SetContentType("application/x-ndjson")
+		if w.cfg.Username != "" {
+			req.URI().SetUsername(w.cfg.Username)
+			req.URI().SetPassword(w.cfg.Password)
+		}
+		req.SetBody(body)
+
+		err = w.client.DoTimeout(req, res, w.cfg.Timeout)
+		if err == nil && res.StatusCode() < fasthttp.StatusMultipleChoices {
+			break
+		}
+		if err == nil {
+			err = fmt.Errorf("unexpected status code %d: %s", res.StatusCode(), res.Body())
+		}
+
+		if attempt >= w.cfg.MaxRetries {
+			atomic.AddInt64(&w.stats.Failed, int64(len(batch)))
+			w.logger.WithFields(logrus.Fields{
+				"error":   err,
+				"records": len(batch),
+			}).Error("event sink: writing records")
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	// the documents rejected by Elasticsearch are not retried, so the indexed documents are not duplicated
+	if w.cfg.Type == TypeElasticsearch {
+		var bulk bulkResponse
+		if err := json.Unmarshal(res.Body(), &bulk); err == nil && bulk.Errors {
+			atomic.AddInt64(&w.stats.Failed, int64(len(batch)))
+			w.logger.WithFields(logrus.Fields{
+				"records": len(batch),
+			}).Error("event sink: some records are rejected by the bulk API")
+			return
+		}
+	}
+
+	atomic.AddInt64(&w.stats.Written, int64(len(batch)))
+	atomic.AddInt64(&w.stats.Batches, 1)
+}
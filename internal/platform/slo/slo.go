@@ -0,0 +1,157 @@
+package slo
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrInvalidPolicy = errors.New("upstream SLO policy must set the positive threshold_ms and the objective between 0 and 100")
+
+// Policy is the upstream response time objective of the operation set by the x-wallarm-upstream-slo extension:
+// the objective percentage of the upstream responses should be faster than the threshold
+type Policy struct {
+	ThresholdMs int64   `json:"threshold_ms"`
+	Objective   float64 `json:"objective"`
+}
+
+// Alert is the event of the violated objective in the window
+type Alert struct {
+	Operation string
+	Threshold time.Duration
+	Objective float64
+	Requests  int64
+	Slow      int64
+}
+
+// Compliance returns the percentage of the requests faster than the threshold in the window
+func (a *Alert) Compliance() float64 {
+	return float64(a.Requests-a.Slow) * 100 / float64(a.Requests)
+}
+
+// Stats are the counters of the operation
+type Stats struct {
+	ThresholdMs int64   `json:"threshold_ms"`
+	Objective   float64 `json:"objective"`
+	Requests    int64   `json:"requests"`
+	Slow        int64   `json:"slow"`
+	Alerts      int64   `json:"alerts"`
+	Violated    bool    `json:"violated"`
+}
+
+// Tracker tracks the upstream response times of the operation in the fixed windows. The alert is raised
+// once per window when the window has the minimal number of requests and the objective is violated
+type Tracker struct {
+	operation   string
+	threshold   time.Duration
+	objective   float64
+	window      time.Duration
+	minRequests int64
+
+	mu             sync.Mutex
+	windowStart    time.Time
+	windowRequests int64
+	windowSlow     int64
+	alerted        bool
+
+	requests int64
+	slow     int64
+	alerts   int64
+}
+
+// trackers contains the trackers of the operations. The trackers of the reloaded API Spec replace the old ones
+var trackers = struct {
+	mu         sync.Mutex
+	operations map[string]*Tracker
+}{operations: make(map[string]*Tracker)}
+
+// New creates the tracker of the operation policy and registers it in the metrics
+func New(operation string, policy Policy, window time.Duration, minRequests int) (*Tracker, error) {
+	if policy.ThresholdMs <= 0 || policy.Objective <= 0 || policy.Objective > 100 {
+		return nil, ErrInvalidPolicy
+	}
+
+	t := &Tracker{
+		operation:   operation,
+		threshold:   time.Duration(policy.ThresholdMs) * time.Millisecond,
+		objective:   policy.Objective,
+		window:      window,
+		minRequests: int64(minRequests),
+		windowStart: time.Now(),
+	}
+
+	trackers.mu.Lock()
+	trackers.operations[operation] = t
+	trackers.mu.Unlock()
+
+	return t, nil
+}
+
+// Observe records the upstream response time. It returns true if the response is slower than the threshold
+// and the alert if the objective of the current window is violated by the response
+func (t *Tracker) Observe(upstreamTime time.Duration) (bool, *Alert) {
+	slow := upstreamTime > t.threshold
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if now := time.Now(); now.Sub(t.windowStart) >= t.window {
+		t.windowStart = now
+		t.windowRequests, t.windowSlow = 0, 0
+		t.alerted = false
+	}
+
+	t.requests++
+	t.windowRequests++
+	if slow {
+		t.slow++
+		t.windowSlow++
+	}
+
+	if t.alerted || t.windowRequests < t.minRequests {
+		return slow, nil
+	}
+
+	// the objective is violated when the share of the slow requests exceeds the error budget
+	if float64(t.windowSlow)*100 <= float64(t.windowRequests)*(100-t.objective) {
+		return slow, nil
+	}
+
+	t.alerted = true
+	t.alerts++
+
+	return slow, &Alert{
+		Operation: t.operation,
+		Threshold: t.threshold,
+		Objective: t.objective,
+		Requests:  t.windowRequests,
+		Slow:      t.windowSlow,
+	}
+}
+
+func (t *Tracker) stats() Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return Stats{
+		ThresholdMs: t.threshold.Milliseconds(),
+		Objective:   t.objective,
+		Requests:    t.requests,
+		Slow:        t.slow,
+		Alerts:      t.alerts,
+		Violated:    t.alerted && time.Since(t.windowStart) < t.window,
+	}
+}
+
+// Snapshot returns the counters of the operations
+func Snapshot() map[string]Stats {
+	trackers.mu.Lock()
+	defer trackers.mu.Unlock()
+
+	snapshot := make(map[string]Stats, len(trackers.operations))
+	for operation, t := range trackers.operations {
+		snapshot[operation] = t.stats()
+	}
+
+	return snapshot
+}
@@ -0,0 +1,173 @@
+package soap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"strings"
+)
+
+// version returns the envelope namespace of the SOAP version of the content type
+func version(contentType string) (string, map[string]string, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", nil, fmt.Errorf("soap: invalid content type: %w", err)
+	}
+
+	switch mediaType {
+	case contentTypeSOAP11:
+		return nsSOAP11, params, nil
+	case contentTypeSOAP12:
+		return nsSOAP12, params, nil
+	}
+
+	return "", nil, fmt.Errorf("soap: unsupported content type %q", mediaType)
+}
+
+// envelopeBody parses the envelope of the SOAP version and returns the elements of the body
+func (s *Service) envelopeBody(ns string, body []byte) ([]*node, error) {
+	root, err := parseXML(body, s.maxDepth)
+	if err != nil {
+		return nil, err
+	}
+
+	if root.name.Space != ns || root.name.Local != "Envelope" {
+		return nil, fmt.Errorf("soap: the root element should be the Envelope of %s", ns)
+	}
+
+	var soapBody *node
+	for i, child := range root.children {
+		switch {
+		case child.name.Space == ns && child.name.Local == "Header" && i == 0:
+		case child.name.Space == ns && child.name.Local == "Body" && soapBody == nil:
+			soapBody = child
+		default:
+			return nil, fmt.Errorf("soap: unexpected element %s of the Envelope", child.name.Local)
+		}
+	}
+
+	if soapBody == nil {
+		return nil, fmt.Errorf("soap: the Envelope without Body")
+	}
+	if len(soapBody.children) == 0 && strings.TrimSpace(soapBody.text) != "" {
+		return nil, fmt.Errorf("soap: Body has the text content")
+	}
+
+	return soapBody.children, nil
+}
+
+// validateParts validates the elements of the body by the message parts
+func (s *Service) validateParts(parts []xml.Name, elements []*node) error {
+	if len(elements) != len(parts) {
+		return fmt.Errorf("soap: Body should contain %d element(s), got %d", len(parts), len(elements))
+	}
+
+	for i, part := range parts {
+		if elements[i].name != part {
+			return fmt.Errorf("soap: expected %s, got %s", formatName(part), formatName(elements[i].name))
+		}
+		if err := s.schema.validateElement(s.schema.elements[part], elements[i]); err != nil {
+			return fmt.Errorf("soap: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// ValidateRequest validates the SOAP envelope of the request and returns the operation selected by the SOAP action
+// or by the body element if the action is empty. The operation is returned along with the error if the body is invalid
+func (s *Service) ValidateRequest(contentType, soapAction string, body []byte) (*Operation, error) {
+	ns, params, err := version(contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	// SOAP 1.2 moves the action to the parameter of the content type
+	action := strings.Trim(strings.TrimSpace(soapAction), `"`)
+	if ns == nsSOAP12 && params["action"] != "" {
+		action = params["action"]
+	}
+
+	elements, err := s.envelopeBody(ns, body)
+	if err != nil {
+		return nil, err
+	}
+
+	var op *Operation
+	if action != "" {
+		if op = s.actions[action]; op == nil {
+			return nil, ErrUnknownAction
+		}
+	} else {
+		for _, candidate := range s.operations {
+			if len(elements) > 0 && len(candidate.input) > 0 && candidate.input[0] == elements[0].name {
+				op = candidate
+				break
+			}
+		}
+		if op == nil {
+			return nil, ErrUnknownOperation
+		}
+	}
+
+	// the action doesn't select the operation different from the body
+	return op, s.validateParts(op.input, elements)
+}
+
+// ValidateResponse validates the SOAP envelope of the response by the output of the operation. The faults are not validated
+func (s *Service) ValidateResponse(op *Operation, contentType string, body []byte) error {
+	ns, _, err := version(contentType)
+	if err != nil {
+		return err
+	}
+
+	elements, err := s.envelopeBody(ns, body)
+	if err != nil {
+		return err
+	}
+
+	if len(elements) == 1 && elements[0].name.Space == ns && elements[0].name.Local == "Fault" {
+		return nil
+	}
+
+	return s.validateParts(op.output, elements)
+}
+
+// Fault returns the content type and the SOAP fault of the version of the content type. The sender
+// of the fault is the server for the invalid responses and the client for the invalid requests
+func Fault(contentType string, server bool, reason string) (string, []byte) {
+	ns, _, err := version(contentType)
+	if err != nil {
+		ns = nsSOAP11
+	}
+
+	var escaped bytes.Buffer
+	xml.EscapeText(&escaped, []byte(reason))
+
+	var body bytes.Buffer
+	body.WriteString(`<?xml version="1.0" encoding="UTF-8"?>`)
+	body.WriteString(`<soap:Envelope xmlns:soap="` + ns + `"><soap:Body><soap:Fault>`)
+
+	if ns == nsSOAP12 {
+		code := "soap:Sender"
+		if server {
+			code = "soap:Receiver"
+		}
+		body.WriteString(`<soap:Code><soap:Value>` + code + `</soap:Value></soap:Code>`)
+		body.WriteString(`<soap:Reason><soap:Text xml:lang="en">` + escaped.String() + `</soap:Text></soap:Reason>`)
+	} else {
+		code := "soap:Client"
+		if server {
+			code = "soap:Server"
+		}
+		body.WriteString(`<faultcode>` + code + `</faultcode><faultstring>` + escaped.String() + `</faultstring>`)
+	}
+
+	body.WriteString(`</soap:Fault></soap:Body></soap:Envelope>`)
+
+	if ns == nsSOAP12 {
+		return contentTypeSOAP12 + "; charset=utf-8", body.Bytes()
+	}
+	return contentTypeSOAP11 + "; charset=utf-8", body.Bytes()
+}
@@ -0,0 +1,955 @@
+package soap
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	nsXSD = "http://www.w3.org/2001/XMLSchema"
+	nsXSI = "http://www.w3.org/2001/XMLSchema-instance"
+
+	// unbounded is the maxOccurs of the unbounded particles
+	unbounded = -1
+)
+
+// element is the declaration of the element. The type is either the inline type or the reference to the named type
+type element struct {
+	name      xml.Name
+	ref       xml.Name
+	typeName  xml.Name
+	inline    *typeDef
+	minOccurs int
+	maxOccurs int
+	nillable  bool
+}
+
+// attribute is the declaration of the attribute of the complex type
+type attribute struct {
+	name     string
+	typeName xml.Name
+	inline   *typeDef
+	required bool
+}
+
+// group is the content model of the complex type: sequence, choice or all
+type group struct {
+	kind      string
+	particles []particle
+	minOccurs int
+	maxOccurs int
+}
+
+// particle is the element, the nested group or the wildcard of the content model
+type particle struct {
+	element *element
+	group   *group
+	any     *group
+}
+
+// typeDef is the simple or the complex type. The complex type extends the content of the base type
+type typeDef struct {
+	name    xml.Name
+	complex bool
+
+	// simple types
+	base         xml.Name
+	enumeration  []string
+	patterns     []*regexp.Regexp
+	minLength    int
+	maxLength    int
+	minInclusive *float64
+	maxInclusive *float64
+
+	// complex types
+	extends      xml.Name
+	content      *group
+	attributes   []attribute
+	anyAttribute bool
+	simpleBase   xml.Name
+	mixed        bool
+}
+
+// schema is the set of the XSD declarations of the WSDL types
+type schema struct {
+	elements map[xml.Name]*element
+	types    map[xml.Name]*typeDef
+}
+
+func newSchema() *schema {
+	return &schema{
+		elements: make(map[xml.Name]*element),
+		types:    make(map[xml.Name]*typeDef),
+	}
+}
+
+// add parses the declarations of the xsd:schema element
+func (s *schema) add(n *node) error {
+	targetNamespace, _ := n.attr("targetNamespace")
+	form, _ := n.attr("elementFormDefault")
+	p := schemaParser{targetNamespace: targetNamespace, qualified: form == "qualified"}
+
+	for _, child := range n.children {
+		if child.name.Space != nsXSD {
+			continue
+		}
+
+		switch child.name.Local {
+		case "element":
+			el, err := p.element(child, true)
+			if err != nil {
+				return err
+			}
+			s.elements[el.name] = el
+		case "complexType", "simpleType":
+			name, _ := child.attr("name")
+			t, err := p.typeDef(child)
+			if err != nil {
+				return err
+			}
+			t.name = xml.Name{Space: targetNamespace, Local: name}
+			s.types[t.name] = t
+		case "import", "include":
+			if location, ok := child.attr("schemaLocation"); ok {
+				return fmt.Errorf("xsd: external schema %q is not supported", location)
+			}
+		}
+	}
+
+	return nil
+}
+
+// check returns the error if the references of the declarations can't be resolved
+func (s *schema) check() error {
+	checked := make(map[*typeDef]struct{})
+
+	var checkType func(t *typeDef) error
+	var checkGroup func(g *group) error
+	var checkElement func(el *element) error
+
+	checkTypeName := func(name xml.Name) error {
+		if name.Local == "" {
+			return nil
+		}
+		if name.Space == nsXSD {
+			if _, ok := builtinTypes[name.Local]; !ok {
+				return fmt.Errorf("xsd: unsupported built-in type %s", name.Local)
+			}
+			return nil
+		}
+		t, ok := s.types[name]
+		if !ok {
+			return fmt.Errorf("xsd: type %s is not declared", formatName(name))
+		}
+		return checkType(t)
+	}
+
+	checkType = func(t *typeDef) error {
+		if _, ok := checked[t]; ok {
+			return nil
+		}
+		checked[t] = struct{}{}
+
+		for _, name := range []xml.Name{t.base, t.extends, t.simpleBase} {
+			if err := checkTypeName(name); err != nil {
+				return err
+			}
+		}
+		for _, attr := range t.attributes {
+			if attr.inline != nil {
+				if err := checkType(attr.inline); err != nil {
+					return err
+				}
+			}
+			if err := checkTypeName(attr.typeName); err != nil {
+				return err
+			}
+		}
+		if t.content != nil {
+			return checkGroup(t.content)
+		}
+		return nil
+	}
+
+	checkGroup = func(g *group) error {
+		for _, p := range g.particles {
+			switch {
+			case p.element != nil:
+				if err := checkElement(p.element); err != nil {
+					return err
+				}
+			case p.group != nil:
+				if err := checkGroup(p.group); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	checkElement = func(el *element) error {
+		if el.ref.Local != "" {
+			if _, ok := s.elements[el.ref]; !ok {
+				return fmt.Errorf("xsd: element %s is not declared", formatName(el.ref))
+			}
+			return nil
+		}
+		if el.inline != nil {
+			return checkType(el.inline)
+		}
+		return checkTypeName(el.typeName)
+	}
+
+	for _, el := range s.elements {
+		if err := checkElement(el); err != nil {
+			return err
+		}
+	}
+	for _, t := range s.types {
+		if err := checkType(t); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type schemaParser struct {
+	targetNamespace string
+	qualified       bool
+}
+
+func occurs(n *node) (int, int, error) {
+	minOccurs, maxOccurs := 1, 1
+
+	if value, ok := n.attr("minOccurs"); ok {
+		v, err := strconv.Atoi(value)
+		if err != nil || v < 0 {
+			return 0, 0, fmt.Errorf("xsd: invalid minOccurs %q", value)
+		}
+		minOccurs = v
+	}
+
+	if value, ok := n.attr("maxOccurs"); ok {
+		if value == "unbounded" {
+			maxOccurs = unbounded
+		} else {
+			v, err := strconv.Atoi(value)
+			if err != nil || v < 0 {
+				return 0, 0, fmt.Errorf("xsd: invalid maxOccurs %q", value)
+			}
+			maxOccurs = v
+		}
+	}
+
+	return minOccurs, maxOccurs, nil
+}
+
+func (p *schemaParser) element(n *node, global bool) (*element, error) {
+	el := &element{}
+
+	var err error
+	el.minOccurs, el.maxOccurs, err = occurs(n)
+	if err != nil {
+		return nil, err
+	}
+
+	if ref, ok := n.attr("ref"); ok {
+		if el.ref, err = n.qname(ref); err != nil {
+			return nil, err
+		}
+		return el, nil
+	}
+
+	name, ok := n.attr("name")
+	if !ok {
+		return nil, fmt.Errorf("xsd: element without name")
+	}
+
+	el.name = xml.Name{Local: name}
+	form, _ := n.attr("form")
+	if global || form == "qualified" || (p.qualified && form != "unqualified") {
+		el.name.Space = p.targetNamespace
+	}
+
+	nillable, _ := n.attr("nillable")
+	el.nillable = nillable == "true"
+
+	if typeName, ok := n.attr("type"); ok {
+		if el.typeName, err = n.qname(typeName); err != nil {
+			return nil, err
+		}
+		return el, nil
+	}
+
+	for _, child := range n.children {
+		if child.name.Space == nsXSD && (child.name.Local == "complexType" || child.name.Local == "simpleType") {
+			if el.inline, err = p.typeDef(child); err != nil {
+				return nil, err
+			}
+			return el, nil
+		}
+	}
+
+	// the element without the type is xsd:anyType
+	el.typeName = xml.Name{Space: nsXSD, Local: "anyType"}
+	return el, nil
+}
+
+func (p *schemaParser) typeDef(n *node) (*typeDef, error) {
+	t := &typeDef{complex: n.name.Local == "complexType", minLength: -1, maxLength: -1}
+
+	mixed, _ := n.attr("mixed")
+	t.mixed = mixed == "true"
+
+	if err := p.typeContent(t, n); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// typeContent parses the content of the type. The extensions and the restrictions are parsed recursively
+func (p *schemaParser) typeContent(t *typeDef, n *node) error {
+	for _, child := range n.children {
+		if child.name.Space != nsXSD {
+			continue
+		}
+
+		var err error
+
+		switch child.name.Local {
+		case "sequence", "choice", "all":
+			t.content, err = p.group(child)
+		case "attribute":
+			err = p.attribute(t, child)
+		case "anyAttribute":
+			t.anyAttribute = true
+		case "complexContent":
+			err = p.typeContent(t, child)
+		case "simpleContent":
+			for _, derivation := range child.children {
+				if derivation.name.Space != nsXSD {
+					continue
+				}
+				base, _ := derivation.attr("base")
+				if t.simpleBase, err = derivation.qname(base); err != nil {
+					return err
+				}
+				if err := p.typeContent(t, derivation); err != nil {
+					return err
+				}
+			}
+		case "extension":
+			base, _ := child.attr("base")
+			if t.extends, err = child.qname(base); err != nil {
+				return err
+			}
+			err = p.typeContent(t, child)
+		case "restriction":
+			base, _ := child.attr("base")
+			if t.complex {
+				// the restricted complex type declares the whole content
+				err = p.typeContent(t, child)
+				break
+			}
+			if t.base, err = child.qname(base); err != nil {
+				return err
+			}
+			err = p.facets(t, child)
+		case "list", "union":
+			// the lists and the unions are validated as the strings
+			t.base = xml.Name{Space: nsXSD, Local: "string"}
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *schemaParser) facets(t *typeDef, n *node) error {
+	for _, facet := range n.children {
+		if facet.name.Space != nsXSD {
+			continue
+		}
+
+		value, _ := facet.attr("value")
+
+		switch facet.name.Local {
+		case "enumeration":
+			t.enumeration = append(t.enumeration, value)
+		case "pattern":
+			// the XSD pattern matches the whole value
+			re, err := regexp.Compile("^(?:" + value + ")$")
+			if err != nil {
+				return fmt.Errorf("xsd: invalid pattern %q: %w", value, err)
+			}
+			t.patterns = append(t.patterns, re)
+		case "length", "minLength", "maxLength":
+			v, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("xsd: invalid %s %q", facet.name.Local, value)
+			}
+			if facet.name.Local != "maxLength" {
+				t.minLength = v
+			}
+			if facet.name.Local != "minLength" {
+				t.maxLength = v
+			}
+		case "minInclusive", "maxInclusive":
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("xsd: invalid %s %q", facet.name.Local, value)
+			}
+			if facet.name.Local == "minInclusive" {
+				t.minInclusive = &v
+			} else {
+				t.maxInclusive = &v
+			}
+		}
+	}
+
+	return nil
+}
+
+func (p *schemaParser) attribute(t *typeDef, n *node) error {
+	name, ok := n.attr("name")
+	if !ok {
+		// the references to the global attributes are not validated
+		t.anyAttribute = true
+		return nil
+	}
+
+	attr := attribute{name: name}
+	use, _ := n.attr("use")
+	attr.required = use == "required"
+
+	var err error
+	if typeName, ok := n.attr("type"); ok {
+		if attr.typeName, err = n.qname(typeName); err != nil {
+			return err
+		}
+	}
+
+	for _, child := range n.children {
+		if child.name.Space == nsXSD && child.name.Local == "simpleType" {
+			if attr.inline, err = p.typeDef(child); err != nil {
+				return err
+			}
+		}
+	}
+
+	t.attributes = append(t.attributes, attr)
+	return nil
+}
+
+func (p *schemaParser) group(n *node) (*group, error) {
+	g := &group{kind: n.name.Local}
+
+	var err error
+	g.minOccurs, g.maxOccurs, err = occurs(n)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, child := range n.children {
+		if child.name.Space != nsXSD {
+			continue
+		}
+
+		switch child.name.Local {
+		case "element":
+			el, err := p.element(child, false)
+			if err != nil {
+				return nil, err
+			}
+			g.particles = append(g.particles, particle{element: el})
+		case "sequence", "choice":
+			nested, err := p.group(child)
+			if err != nil {
+				return nil, err
+			}
+			g.particles = append(g.particles, particle{group: nested})
+		case "any":
+			wildcard := &group{kind: "any"}
+			if wildcard.minOccurs, wildcard.maxOccurs, err = occurs(child); err != nil {
+				return nil, err
+			}
+			g.particles = append(g.particles, particle{any: wildcard})
+		}
+	}
+
+	return g, nil
+}
+
+// validateElement validates the element of the document by the declaration
+func (s *schema) validateElement(el *element, n *node) error {
+	if el.ref.Local != "" {
+		el = s.elements[el.ref]
+	}
+
+	if nilValue, ok := xsiAttr(n, "nil"); ok && (nilValue == "true" || nilValue == "1") {
+		if !el.nillable {
+			return fmt.Errorf("element %s is not nillable", n.name.Local)
+		}
+		if len(n.children) > 0 || strings.TrimSpace(n.text) != "" {
+			return fmt.Errorf("nil element %s has the content", n.name.Local)
+		}
+		return nil
+	}
+
+	t := el.inline
+	if t == nil {
+		if el.typeName.Space == nsXSD {
+			if el.typeName.Local == "anyType" {
+				return nil
+			}
+			return s.validateSimple(el.typeName, nil, n)
+		}
+		t = s.types[el.typeName]
+	}
+
+	if t.complex {
+		return s.validateComplex(t, n)
+	}
+	return s.validateSimple(xml.Name{}, t, n)
+}
+
+func xsiAttr(n *node, name string) (string, bool) {
+	for _, attr := range n.attrs {
+		if attr.Name.Space == nsXSI && attr.Name.Local == name {
+			return attr.Value, true
+		}
+	}
+	return "", false
+}
+
+// validateSimple validates the text of the element by the built-in or the simple type
+func (s *schema) validateSimple(name xml.Name, t *typeDef, n *node) error {
+	if len(n.children) > 0 {
+		return fmt.Errorf("element %s of the simple type has child elements", n.name.Local)
+	}
+
+	if err := s.validateValue(name, t, n.text); err != nil {
+		return fmt.Errorf("element %s: %w", n.name.Local, err)
+	}
+	return nil
+}
+
+// validateValue validates the value by the built-in type or by the simple type and its base types
+func (s *schema) validateValue(name xml.Name, t *typeDef, value string) error {
+	if t == nil {
+		if name.Space == nsXSD || name.Local == "" {
+			if check, ok := builtinTypes[name.Local]; ok && check != nil {
+				return check(strings.TrimSpace(value))
+			}
+			return nil
+		}
+		t = s.types[name]
+	}
+
+	if t.complex {
+		return s.validateValue(t.simpleBase, nil, value)
+	}
+
+	// the whitespaces are collapsed by the derived types of the built-in types except string
+	collapsed := strings.TrimSpace(value)
+	if t.base.Space == nsXSD && t.base.Local == "string" {
+		collapsed = value
+	}
+
+	if len(t.enumeration) > 0 {
+		found := false
+		for _, v := range t.enumeration {
+			if v == collapsed {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("value %q is not one of the allowed values", value)
+		}
+	}
+
+	for _, re := range t.patterns {
+		if !re.MatchString(collapsed) {
+			return fmt.Errorf("value %q doesn't match the pattern", value)
+		}
+	}
+
+	length := len([]rune(collapsed))
+	if t.minLength >= 0 && length < t.minLength {
+		return fmt.Errorf("value is shorter than %d", t.minLength)
+	}
+	if t.maxLength >= 0 && length > t.maxLength {
+		return fmt.Errorf("value is longer than %d", t.maxLength)
+	}
+
+	if t.minInclusive != nil || t.maxInclusive != nil {
+		v, err := strconv.ParseFloat(collapsed, 64)
+		if err != nil {
+			return fmt.Errorf("value %q is not a number", value)
+		}
+		if t.minInclusive != nil && v < *t.minInclusive {
+			return fmt.Errorf("value %s is less than %v", collapsed, *t.minInclusive)
+		}
+		if t.maxInclusive != nil && v > *t.maxInclusive {
+			return fmt.Errorf("value %s is greater than %v", collapsed, *t.maxInclusive)
+		}
+	}
+
+	return s.validateValue(t.base, nil, value)
+}
+
+// validateComplex validates the attributes and the child elements of the element by the complex type
+func (s *schema) validateComplex(t *typeDef, n *node) error {
+
+	// the content of the extended types precedes the content of the extension
+	var types []*typeDef
+	for current := t; current != nil; {
+		types = append([]*typeDef{current}, types...)
+		if current.extends.Local == "" || current.extends.Space == nsXSD {
+			break
+		}
+		current = s.types[current.extends]
+	}
+
+	if err := s.validateAttributes(types, n); err != nil {
+		return err
+	}
+
+	if t.simpleBase.Local != "" {
+		return s.validateSimple(xml.Name{}, t, n)
+	}
+
+	if !t.mixed && strings.TrimSpace(n.text) != "" {
+		return fmt.Errorf("element %s has the text content", n.name.Local)
+	}
+
+	i := 0
+	for _, current := range types {
+		if current.content == nil {
+			continue
+		}
+		next, err := s.match(current.content, n.children, i)
+		if err != nil {
+			return fmt.Errorf("element %s: %w", n.name.Local, err)
+		}
+		i = next
+	}
+
+	if i < len(n.children) {
+		return fmt.Errorf("element %s: unexpected element %s", n.name.Local, n.children[i].name.Local)
+	}
+
+	return nil
+}
+
+func (s *schema) validateAttributes(types []*typeDef, n *node) error {
+	anyAttribute := false
+	declared := make(map[string]attribute)
+	for _, t := range types {
+		anyAttribute = anyAttribute || t.anyAttribute
+		for _, attr := range t.attributes {
+			declared[attr.name] = attr
+		}
+	}
+
+	for _, attr := range n.attrs {
+		// the attributes of the namespaces like xsi:type are not validated
+		if attr.Name.Space != "" {
+			continue
+		}
+
+		decl, ok := declared[attr.Name.Local]
+		if !ok {
+			if anyAttribute {
+				continue
+			}
+			return fmt.Errorf("element %s: attribute %s is not allowed", n.name.Local, attr.Name.Local)
+		}
+
+		if err := s.validateValue(decl.typeName, decl.inline, attr.Value); err != nil {
+			return fmt.Errorf("element %s: attribute %s: %w", n.name.Local, attr.Name.Local, err)
+		}
+	}
+
+	for name, decl := range declared {
+		if _, ok := n.attr(name); decl.required && !ok {
+			return fmt.Errorf("element %s: attribute %s is required", n.name.Local, name)
+		}
+	}
+
+	return nil
+}
+
+// match matches the child elements starting with the index by the content model and returns the index
+// of the first element not matched. The elements are matched greedily without backtracking
+func (s *schema) match(g *group, children []*node, i int) (int, error) {
+	count := 0
+
+	for g.maxOccurs == unbounded || count < g.maxOccurs {
+		next, matched, err := s.matchOnce(g, children, i)
+		if err != nil {
+			// the optional repetitions are not matched
+			if count >= g.minOccurs && next == i {
+				break
+			}
+			return i, err
+		}
+		if !matched || next == i {
+			break
+		}
+		i = next
+		count++
+	}
+
+	if count < g.minOccurs {
+		// the group of the optional particles matches the empty content
+		if _, matched, err := s.matchOnce(g, children, i); err == nil && !matched {
+			return i, nil
+		}
+		return i, fmt.Errorf("expected %s", g.expected())
+	}
+
+	return i, nil
+}
+
+// matchOnce matches the single repetition of the group. The repetition isn't matched
+// if no elements are consumed
+func (s *schema) matchOnce(g *group, children []*node, i int) (int, bool, error) {
+	start := i
+
+	switch g.kind {
+	case "sequence":
+		for _, p := range g.particles {
+			next, err := s.matchParticle(p, children, i)
+			if err != nil {
+				return start, false, err
+			}
+			i = next
+		}
+	case "choice":
+		for _, p := range g.particles {
+			next, err := s.matchParticle(p, children, i)
+			if err == nil && next > i {
+				return next, true, nil
+			}
+		}
+		for _, p := range g.particles {
+			if next, err := s.matchParticle(p, children, i); err == nil && next == i {
+				// the optional particle matches the empty content
+				return i, false, nil
+			}
+		}
+		return i, false, fmt.Errorf("expected %s", g.expected())
+	case "all":
+		matched := make(map[*element]bool)
+		for i < len(children) {
+			var found *element
+			for _, p := range g.particles {
+				if p.element != nil && !matched[p.element] && s.elementName(p.element) == children[i].name {
+					found = p.element
+					break
+				}
+			}
+			if found == nil {
+				break
+			}
+			if err := s.validateElement(found, children[i]); err != nil {
+				return start, false, err
+			}
+			matched[found] = true
+			i++
+		}
+		for _, p := range g.particles {
+			if p.element != nil && !matched[p.element] && p.element.minOccurs > 0 {
+				return start, false, fmt.Errorf("expected %s", s.elementName(p.element).Local)
+			}
+		}
+	}
+
+	return i, i > start, nil
+}
+
+func (s *schema) matchParticle(p particle, children []*node, i int) (int, error) {
+	switch {
+	case p.group != nil:
+		return s.match(p.group, children, i)
+	case p.any != nil:
+		count := 0
+		for i < len(children) && (p.any.maxOccurs == unbounded || count < p.any.maxOccurs) {
+			i++
+			count++
+		}
+		if count < p.any.minOccurs {
+			return i, fmt.Errorf("expected any element")
+		}
+		return i, nil
+	}
+
+	el := p.element
+	name := s.elementName(el)
+
+	count := 0
+	for i < len(children) && children[i].name == name && (el.maxOccurs == unbounded || count < el.maxOccurs) {
+		if err := s.validateElement(el, children[i]); err != nil {
+			return i, err
+		}
+		i++
+		count++
+	}
+
+	if count < el.minOccurs {
+		if i < len(children) {
+			return i, fmt.Errorf("expected %s, got %s", name.Local, children[i].name.Local)
+		}
+		return i, fmt.Errorf("expected %s", name.Local)
+	}
+
+	return i, nil
+}
+
+func (s *schema) elementName(el *element) xml.Name {
+	if el.ref.Local != "" {
+		return el.ref
+	}
+	return el.name
+}
+
+// expected returns the names of the elements expected by the group
+func (g *group) expected() string {
+	var names []string
+	for _, p := range g.particles {
+		switch {
+		case p.element != nil && p.element.ref.Local != "":
+			names = append(names, p.element.ref.Local)
+		case p.element != nil:
+			names = append(names, p.element.name.Local)
+		case p.group != nil:
+			names = append(names, p.group.expected())
+		}
+	}
+	return strings.Join(names, " or ")
+}
+
+// builtinTypes are the supported XSD built-in types. The values of the types without the check are not validated
+var builtinTypes = map[string]func(value string) error{
+	"anyType":            nil,
+	"anySimpleType":      nil,
+	"string":             nil,
+	"normalizedString":   nil,
+	"token":              nil,
+	"language":           nil,
+	"Name":               nil,
+	"NCName":             nil,
+	"ID":                 nil,
+	"IDREF":              nil,
+	"QName":              nil,
+	"anyURI":             nil,
+	"duration":           nil,
+	"boolean":            checkBoolean,
+	"decimal":            checkDecimal,
+	"float":              checkFloat,
+	"double":             checkFloat,
+	"integer":            checkInteger(math.MinInt64, math.MaxInt64),
+	"long":               checkInteger(math.MinInt64, math.MaxInt64),
+	"int":                checkInteger(math.MinInt32, math.MaxInt32),
+	"short":              checkInteger(math.MinInt16, math.MaxInt16),
+	"byte":               checkInteger(math.MinInt8, math.MaxInt8),
+	"nonNegativeInteger": checkInteger(0, math.MaxInt64),
+	"positiveInteger":    checkInteger(1, math.MaxInt64),
+	"nonPositiveInteger": checkInteger(math.MinInt64, 0),
+	"negativeInteger":    checkInteger(math.MinInt64, -1),
+	"unsignedLong":       checkUnsigned(math.MaxUint64),
+	"unsignedInt":        checkUnsigned(math.MaxUint32),
+	"unsignedShort":      checkUnsigned(math.MaxUint16),
+	"unsignedByte":       checkUnsigned(math.MaxUint8),
+	"date":               checkTime("2006-01-02", "2006-01-02Z07:00"),
+	"time":               checkTime("15:04:05", "15:04:05Z07:00", "15:04:05.999999999", "15:04:05.999999999Z07:00"),
+	"dateTime":           checkTime("2006-01-02T15:04:05", "2006-01-02T15:04:05.999999999", time.RFC3339Nano),
+	"base64Binary":       checkBase64,
+	"hexBinary":          checkHex,
+}
+
+func checkBoolean(value string) error {
+	switch value {
+	case "true", "false", "1", "0":
+		return nil
+	}
+	return fmt.Errorf("value %q is not a boolean", value)
+}
+
+var decimalRe = regexp.MustCompile(`^[+-]?(\d+(\.\d*)?|\.\d+)$`)
+
+func checkDecimal(value string) error {
+	if !decimalRe.MatchString(value) {
+		return fmt.Errorf("value %q is not a decimal", value)
+	}
+	return nil
+}
+
+func checkFloat(value string) error {
+	switch value {
+	case "INF", "-INF", "NaN":
+		return nil
+	}
+	if _, err := strconv.ParseFloat(value, 64); err != nil || strings.ContainsAny(value, "xXpP_") {
+		return fmt.Errorf("value %q is not a number", value)
+	}
+	return nil
+}
+
+func checkInteger(min, max int64) func(value string) error {
+	return func(value string) error {
+		v, err := strconv.ParseInt(strings.TrimPrefix(value, "+"), 10, 64)
+		if err != nil || v < min || v > max {
+			return fmt.Errorf("value %q is not an integer in the range [%d, %d]", value, min, max)
+		}
+		return nil
+	}
+}
+
+func checkUnsigned(max uint64) func(value string) error {
+	return func(value string) error {
+		v, err := strconv.ParseUint(strings.TrimPrefix(value, "+"), 10, 64)
+		if err != nil || v > max {
+			return fmt.Errorf("value %q is not an unsigned integer up to %d", value, max)
+		}
+		return nil
+	}
+}
+
+func checkTime(layouts ...string) func(value string) error {
+	return func(value string) error {
+		for _, layout := range layouts {
+			if _, err := time.Parse(layout, value); err == nil {
+				return nil
+			}
+		}
+		return fmt.Errorf("value %q is not in the format %s", value, layouts[0])
+	}
+}
+
+func checkBase64(value string) error {
+	if _, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(value), "")); err != nil {
+		return fmt.Errorf("value is not base64 encoded")
+	}
+	return nil
+}
+
+func checkHex(value string) error {
+	if _, err := hex.DecodeString(value); err != nil {
+		return fmt.Errorf("value is not hex encoded")
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+package soap
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/wallarm/api-firewall/internal/config"
+)
+
+const (
+	nsWSDL       = "http://schemas.xmlsoap.org/wsdl/"
+	nsWSDLSOAP11 = "http://schemas.xmlsoap.org/wsdl/soap/"
+	nsWSDLSOAP12 = "http://schemas.xmlsoap.org/wsdl/soap12/"
+
+	nsSOAP11 = "http://schemas.xmlsoap.org/soap/envelope/"
+	nsSOAP12 = "http://www.w3.org/2003/05/soap-envelope"
+
+	contentTypeSOAP11 = "text/xml"
+	contentTypeSOAP12 = "application/soap+xml"
+)
+
+var (
+	// ErrUnknownAction is returned when the SOAP action doesn't match the operations of the WSDL
+	ErrUnknownAction = errors.New("soap: unknown SOAP action")
+	// ErrUnknownOperation is returned when the body element doesn't match the operations of the WSDL
+	ErrUnknownOperation = errors.New("soap: body doesn't match the operations")
+)
+
+// Operation is the operation of the SOAP binding
+type Operation struct {
+	Name   string
+	Action string
+	input  []xml.Name
+	output []xml.Name
+}
+
+// Service validates the SOAP envelopes by the operations of the WSDL and by the XSD of the WSDL types
+type Service struct {
+	// Path is the path of the SOAP endpoint
+	Path       string
+	operations []*Operation
+	actions    map[string]*Operation
+	schema     *schema
+	maxDepth   int
+}
+
+// New loads the WSDL file. It returns nil if the WSDL file is not configured
+func New(cfg *config.SOAP, maxDepth int) (*Service, error) {
+
+	if cfg.WSDLFile == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(cfg.WSDLFile)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := parseWSDL(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", cfg.WSDLFile, err)
+	}
+
+	if cfg.Path != "" {
+		s.Path = cfg.Path
+	}
+	if s.Path == "" {
+		s.Path = "/"
+	}
+	s.maxDepth = maxDepth
+
+	return s, nil
+}
+
+// parseWSDL parses the WSDL 1.1 document. Only the document/literal SOAP bindings are supported
+func parseWSDL(data []byte) (*Service, error) {
+	root, err := parseXML(data, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if root.name.Space != nsWSDL || root.name.Local != "definitions" {
+		return nil, errors.New("wsdl: the root element should be wsdl:definitions")
+	}
+
+	s := &Service{actions: make(map[string]*Operation), schema: newSchema()}
+
+	targetNamespace, _ := root.attr("targetNamespace")
+	qualified := func(n *node) xml.Name {
+		name, _ := n.attr("name")
+		return xml.Name{Space: targetNamespace, Local: name}
+	}
+
+	if types := root.element(nsWSDL, "types"); types != nil {
+		for _, schemaNode := range types.elements(nsXSD, "schema") {
+			if err := s.schema.add(schemaNode); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := s.schema.check(); err != nil {
+		return nil, err
+	}
+
+	// the elements of the message parts
+	messages := make(map[xml.Name][]xml.Name)
+	for _, message := range root.elements(nsWSDL, "message") {
+		var parts []xml.Name
+		for _, part := range message.elements(nsWSDL, "part") {
+			elementName, ok := part.attr("element")
+			if !ok {
+				return nil, fmt.Errorf("wsdl: message %s: part without element: only document/literal is supported", qualified(message).Local)
+			}
+			name, err := part.qname(elementName)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := s.schema.elements[name]; !ok {
+				return nil, fmt.Errorf("wsdl: message %s: element %s is not declared", qualified(message).Local, formatName(name))
+			}
+			parts = append(parts, name)
+		}
+		messages[qualified(message)] = parts
+	}
+
+	messageParts := func(n *node) ([]xml.Name, error) {
+		if n == nil {
+			return nil, nil
+		}
+		value, _ := n.attr("message")
+		name, err := n.qname(value)
+		if err != nil {
+			return nil, err
+		}
+		parts, ok := messages[name]
+		if !ok {
+			return nil, fmt.Errorf("wsdl: message %s is not declared", formatName(name))
+		}
+		return parts, nil
+	}
+
+	// the input and the output elements of the operations of the port types
+	portTypes := make(map[xml.Name]map[string]*Operation)
+	for _, portType := range root.elements(nsWSDL, "portType") {
+		operations := make(map[string]*Operation)
+		for _, operation := range portType.elements(nsWSDL, "operation") {
+			input, err := messageParts(operation.element(nsWSDL, "input"))
+			if err != nil {
+				return nil, err
+			}
+			output, err := messageParts(operation.element(nsWSDL, "output"))
+			if err != nil {
+				return nil, err
+			}
+
+			name, _ := operation.attr("name")
+			operations[name] = &Operation{Name: name, input: input, output: output}
+		}
+		portTypes[qualified(portType)] = operations
+	}
+
+	for _, binding := range root.elements(nsWSDL, "binding") {
+		soapBinding := binding.element(nsWSDLSOAP11, "binding")
+		bindingNS := nsWSDLSOAP11
+		if soapBinding == nil {
+			soapBinding = binding.element(nsWSDLSOAP12, "binding")
+			bindingNS = nsWSDLSOAP12
+		}
+		if soapBinding == nil {
+			// HTTP bindings are not supported
+			continue
+		}
+
+		style, _ := soapBinding.attr("style")
+
+		portTypeValue, _ := binding.attr("type")
+		portTypeName, err := binding.qname(portTypeValue)
+		if err != nil {
+			return nil, err
+		}
+		portOperations, ok := portTypes[portTypeName]
+		if !ok {
+			return nil, fmt.Errorf("wsdl: port type %s is not declared", formatName(portTypeName))
+		}
+
+		for _, operation := range binding.elements(nsWSDL, "operation") {
+			name, _ := operation.attr("name")
+
+			portOperation, ok := portOperations[name]
+			if !ok {
+				return nil, fmt.Errorf("wsdl: operation %s is not declared in port type %s", name, portTypeName.Local)
+			}
+
+			op := &Operation{Name: name, input: portOperation.input, output: portOperation.output}
+
+			operationStyle := style
+			if soapOperation := operation.element(bindingNS, "operation"); soapOperation != nil {
+				op.Action, _ = soapOperation.attr("soapAction")
+				if value, ok := soapOperation.attr("style"); ok {
+					operationStyle = value
+				}
+			}
+			if operationStyle == "rpc" {
+				return nil, fmt.Errorf("wsdl: operation %s: rpc style is not supported", name)
+			}
+
+			s.operations = append(s.operations, op)
+			if op.Action != "" {
+				s.actions[op.Action] = op
+			}
+		}
+	}
+
+	if len(s.operations) == 0 {
+		return nil, errors.New("wsdl: no SOAP operations")
+	}
+
+	// the path of the endpoint is the path of the first SOAP address
+	for _, service := range root.elements(nsWSDL, "service") {
+		for _, port := range service.elements(nsWSDL, "port") {
+			address := port.element(nsWSDLSOAP11, "address")
+			if address == nil {
+				address = port.element(nsWSDLSOAP12, "address")
+			}
+			if address == nil {
+				continue
+			}
+			location, _ := address.attr("location")
+			if u, err := url.Parse(location); err == nil && s.Path == "" {
+				s.Path = u.Path
+			}
+		}
+	}
+
+	return s, nil
+}
@@ -0,0 +1,147 @@
+package soap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrDirective is returned for the documents with DTD, as the entities are not allowed by SOAP
+var ErrDirective = errors.New("xml: DTD is not allowed")
+
+// node is the element of the parsed XML document. The names of the elements and the attributes
+// are resolved to the namespaces, the prefixes in scope are kept to resolve the QName values
+type node struct {
+	name     xml.Name
+	attrs    []xml.Attr
+	children []*node
+	text     string
+	prefixes map[string]string
+}
+
+// parseXML parses the XML document to the tree of the elements. The document deeper than maxDepth is rejected
+func parseXML(data []byte, maxDepth int) (*node, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = true
+
+	var root *node
+	var stack []*node
+	var text strings.Builder
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if maxDepth > 0 && len(stack) >= maxDepth {
+				return nil, fmt.Errorf("xml: depth exceeds the limit of %d", maxDepth)
+			}
+
+			n := &node{name: t.Name, prefixes: make(map[string]string)}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				for prefix, space := range parent.prefixes {
+					n.prefixes[prefix] = space
+				}
+				parent.children = append(parent.children, n)
+			} else {
+				if root != nil {
+					return nil, errors.New("xml: multiple root elements")
+				}
+				root = n
+			}
+
+			for _, attr := range t.Attr {
+				switch {
+				case attr.Name.Space == "xmlns":
+					n.prefixes[attr.Name.Local] = attr.Value
+				case attr.Name.Space == "" && attr.Name.Local == "xmlns":
+					n.prefixes[""] = attr.Value
+				default:
+					n.attrs = append(n.attrs, attr)
+				}
+			}
+
+			stack = append(stack, n)
+			text.Reset()
+		case xml.EndElement:
+			n := stack[len(stack)-1]
+			if len(n.children) == 0 {
+				n.text = text.String()
+			}
+			stack = stack[:len(stack)-1]
+			text.Reset()
+		case xml.CharData:
+			text.Write(t)
+		case xml.Directive:
+			return nil, ErrDirective
+		}
+	}
+
+	if root == nil {
+		return nil, errors.New("xml: empty document")
+	}
+
+	return root, nil
+}
+
+// attr returns the value of the attribute without the namespace
+func (n *node) attr(name string) (string, bool) {
+	for _, attr := range n.attrs {
+		if attr.Name.Space == "" && attr.Name.Local == name {
+			return attr.Value, true
+		}
+	}
+	return "", false
+}
+
+// qname resolves the QName value by the prefixes in scope of the element
+func (n *node) qname(value string) (xml.Name, error) {
+	prefix, local, found := strings.Cut(strings.TrimSpace(value), ":")
+	if !found {
+		return xml.Name{Space: n.prefixes[""], Local: prefix}, nil
+	}
+
+	space, ok := n.prefixes[prefix]
+	if !ok {
+		return xml.Name{}, fmt.Errorf("xml: undeclared prefix %q of %q", prefix, value)
+	}
+	return xml.Name{Space: space, Local: local}, nil
+}
+
+// elements returns the child elements with the name in the namespace
+func (n *node) elements(space, local string) []*node {
+	var elements []*node
+	for _, child := range n.children {
+		if child.name.Space == space && child.name.Local == local {
+			elements = append(elements, child)
+		}
+	}
+	return elements
+}
+
+// element returns the first child element with the name in the namespace
+func (n *node) element(space, local string) *node {
+	for _, child := range n.children {
+		if child.name.Space == space && child.name.Local == local {
+			return child
+		}
+	}
+	return nil
+}
+
+func formatName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return "{" + name.Space + "}" + name.Local
+}
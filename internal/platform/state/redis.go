@@ -0,0 +1,58 @@
+package state
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/wallarm/api-firewall/internal/config"
+)
+
+const (
+	BackendLocal = "LOCAL"
+	BackendRedis = "REDIS"
+)
+
+var ErrRedisNotConfigured = errors.New("redis address is not configured")
+
+var (
+	mu      sync.Mutex
+	clients = make(map[config.Redis]*redis.Client)
+)
+
+// Redis returns the client of the Redis server. The clients are shared by the handlers
+// created on the API Spec reloads, so the connection pool is not recreated
+func Redis(cfg *config.Redis) (*redis.Client, error) {
+
+	if cfg.Addr == "" {
+		return nil, ErrRedisNotConfigured
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if client, ok := clients[*cfg]; ok {
+		return client, nil
+	}
+
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Addr,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+	clients[*cfg] = client
+
+	return client, nil
+}
+
+// Key returns the Redis key with the configured prefix
+func Key(cfg *config.Redis, parts ...string) string {
+	key := cfg.KeyPrefix
+	for i, part := range parts {
+		if i > 0 {
+			key += ":"
+		}
+		key += part
+	}
+	return key
+}
@@ -0,0 +1,118 @@
+package systemd
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// listenFdsStart is the first file descriptor passed by systemd
+	listenFdsStart = 3
+
+	StateReady     = "READY=1"
+	StateReloading = "RELOADING=1"
+	StateStopping  = "STOPPING=1"
+	StateWatchdog  = "WATCHDOG=1"
+)
+
+// Listeners returns the listeners of the sockets passed by systemd socket activation
+// keyed by the names set by the FileDescriptorName option of the socket units.
+// The sockets without names are keyed by the index of the file descriptor ("0", "1", ...).
+// The function returns nil if the process is not socket activated
+func Listeners() (map[string]net.Listener, error) {
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+
+	nfds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || nfds <= 0 {
+		return nil, nil
+	}
+
+	var names []string
+	if fdNames := os.Getenv("LISTEN_FDNAMES"); fdNames != "" {
+		names = strings.Split(fdNames, ":")
+	}
+
+	listeners := make(map[string]net.Listener, nfds)
+	for i := 0; i < nfds; i++ {
+		fd := listenFdsStart + i
+		syscall.CloseOnExec(fd)
+
+		name := strconv.Itoa(i)
+		if i < len(names) && names[i] != "" && names[i] != "unknown" {
+			name = names[i]
+		}
+
+		file := os.NewFile(uintptr(fd), name)
+		ln, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		listeners[name] = ln
+	}
+
+	return listeners, nil
+}
+
+// Notify sends the state to the service manager by the socket set in NOTIFY_SOCKET.
+// The function returns false if the notification socket is not set
+func Notify(state string) (bool, error) {
+	socketAddr := &net.UnixAddr{
+		Name: os.Getenv("NOTIFY_SOCKET"),
+		Net:  "unixgram",
+	}
+
+	if socketAddr.Name == "" {
+		return false, nil
+	}
+
+	// abstract socket
+	if strings.HasPrefix(socketAddr.Name, "@") {
+		socketAddr.Name = "\x00" + socketAddr.Name[1:]
+	}
+
+	conn, err := net.DialUnix(socketAddr.Net, nil, socketAddr)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	if _, err = conn.Write([]byte(state)); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// WatchdogInterval returns the interval of the watchdog keep-alive notifications (the half of WATCHDOG_USEC).
+// The function returns zero if the watchdog is not enabled for the process
+func WatchdogInterval() (time.Duration, error) {
+	usec := os.Getenv("WATCHDOG_USEC")
+	if usec == "" {
+		return 0, nil
+	}
+
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, nil
+	}
+
+	value, err := strconv.Atoi(usec)
+	if err != nil || value <= 0 {
+		return 0, errors.New("invalid WATCHDOG_USEC value: " + usec)
+	}
+
+	return time.Duration(value) * time.Microsecond / 2, nil
+}
@@ -0,0 +1,464 @@
+package tlsfp
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	recordTypeHandshake  = 22
+	handshakeClientHello = 1
+
+	extensionServerName          = 0x0000
+	extensionSupportedGroups     = 0x000a
+	extensionECPointFormats      = 0x000b
+	extensionSignatureAlgorithms = 0x000d
+	extensionALPN                = 0x0010
+	extensionSupportedVersions   = 0x002b
+
+	// maxClientHelloSize limits the bytes captured by the connection before the client hello is parsed
+	maxClientHelloSize = 1 << 16
+)
+
+var (
+	errMalformed = errors.New("tlsfp: malformed client hello")
+
+	// ErrNotTLS is returned when the data of the connection is not the TLS handshake
+	ErrNotTLS = errors.New("tlsfp: not a TLS handshake")
+)
+
+// Fingerprint contains the JA3 and JA4 fingerprints of the TLS client hello
+type Fingerprint struct {
+	// JA3 is the JA3 string: version,ciphers,extensions,curves,point formats
+	JA3 string
+	// JA3Hash is the MD5 hash of the JA3 string
+	JA3Hash string
+	JA4     string
+}
+
+// clientHello contains the fields of the client hello used by the fingerprints
+type clientHello struct {
+	version             uint16
+	ciphers             []uint16
+	extensions          []uint16
+	curves              []uint16
+	pointFormats        []uint8
+	signatureAlgorithms []uint16
+	supportedVersions   []uint16
+	alpn                []string
+	serverName          bool
+	sni                 string
+}
+
+// grease returns true if the value is reserved by GREASE (RFC 8701)
+func grease(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+// reader reads the fields of the handshake message
+type reader []byte
+
+func (r *reader) u8() (uint8, bool) {
+	if len(*r) < 1 {
+		return 0, false
+	}
+	v := (*r)[0]
+	*r = (*r)[1:]
+	return v, true
+}
+
+func (r *reader) u16() (uint16, bool) {
+	if len(*r) < 2 {
+		return 0, false
+	}
+	v := binary.BigEndian.Uint16(*r)
+	*r = (*r)[2:]
+	return v, true
+}
+
+func (r *reader) bytes(n int) (reader, bool) {
+	if len(*r) < n {
+		return nil, false
+	}
+	v := (*r)[:n]
+	*r = (*r)[n:]
+	return v, true
+}
+
+// vector reads the vector with the length prefix of 1 or 2 bytes
+func (r *reader) vector(prefix int) (reader, bool) {
+	var n int
+	if prefix == 1 {
+		l, ok := r.u8()
+		if !ok {
+			return nil, false
+		}
+		n = int(l)
+	} else {
+		l, ok := r.u16()
+		if !ok {
+			return nil, false
+		}
+		n = int(l)
+	}
+	return r.bytes(n)
+}
+
+func (r reader) u16s() []uint16 {
+	values := make([]uint16, 0, len(r)/2)
+	for len(r) >= 2 {
+		v, _ := r.u16()
+		values = append(values, v)
+	}
+	return values
+}
+
+// parseClientHello parses the body of the client hello handshake message
+func parseClientHello(body []byte) (*clientHello, error) {
+	r := reader(body)
+	hello := clientHello{}
+
+	var ok bool
+	if hello.version, ok = r.u16(); !ok {
+		return nil, errMalformed
+	}
+	// random and session id
+	if _, ok = r.bytes(32); !ok {
+		return nil, errMalformed
+	}
+	if _, ok = r.vector(1); !ok {
+		return nil, errMalformed
+	}
+
+	ciphers, ok := r.vector(2)
+	if !ok {
+		return nil, errMalformed
+	}
+	hello.ciphers = ciphers.u16s()
+
+	if _, ok = r.vector(1); !ok {
+		return nil, errMalformed
+	}
+
+	// the client hello without extensions
+	if len(r) == 0 {
+		return &hello, nil
+	}
+
+	extensions, ok := r.vector(2)
+	if !ok {
+		return nil, errMalformed
+	}
+
+	for len(extensions) > 0 {
+		extType, ok := extensions.u16()
+		if !ok {
+			return nil, errMalformed
+		}
+		data, ok := extensions.vector(2)
+		if !ok {
+			return nil, errMalformed
+		}
+		hello.extensions = append(hello.extensions, extType)
+
+		switch extType {
+		case extensionServerName:
+			hello.serverName = true
+			// the host name is the first entry of the server name list
+			names, _ := data.vector(2)
+			if nameType, ok := names.u8(); ok && nameType == 0 {
+				name, _ := names.vector(2)
+				hello.sni = string(name)
+			}
+		case extensionSupportedGroups:
+			groups, _ := data.vector(2)
+			hello.curves = groups.u16s()
+		case extensionECPointFormats:
+			formats, _ := data.vector(1)
+			hello.pointFormats = formats
+		case extensionSignatureAlgorithms:
+			algorithms, _ := data.vector(2)
+			hello.signatureAlgorithms = algorithms.u16s()
+		case extensionSupportedVersions:
+			versions, _ := data.vector(1)
+			hello.supportedVersions = versions.u16s()
+		case extensionALPN:
+			protocols, _ := data.vector(2)
+			for len(protocols) > 0 {
+				protocol, ok := protocols.vector(1)
+				if !ok {
+					break
+				}
+				hello.alpn = append(hello.alpn, string(protocol))
+			}
+		}
+	}
+
+	return &hello, nil
+}
+
+// joinDecimal joins the values except GREASE by the dash
+func joinDecimal(values []uint16) string {
+	parts := make([]string, 0, len(values))
+	for _, v := range values {
+		if !grease(v) {
+			parts = append(parts, strconv.Itoa(int(v)))
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// ja3 returns the JA3 string of the client hello
+func (h *clientHello) ja3() string {
+	formats := make([]string, 0, len(h.pointFormats))
+	for _, f := range h.pointFormats {
+		formats = append(formats, strconv.Itoa(int(f)))
+	}
+
+	return fmt.Sprintf("%d,%s,%s,%s,%s", h.version, joinDecimal(h.ciphers), joinDecimal(h.extensions), joinDecimal(h.curves), strings.Join(formats, "-"))
+}
+
+// hashHex returns the first 12 characters of the SHA256 of the values in the hex format joined by the comma
+func hashHex(values []uint16, suffix []uint16) string {
+	if len(values) == 0 {
+		return "000000000000"
+	}
+
+	format := func(values []uint16) string {
+		parts := make([]string, 0, len(values))
+		for _, v := range values {
+			parts = append(parts, fmt.Sprintf("%04x", v))
+		}
+		return strings.Join(parts, ",")
+	}
+
+	s := format(values)
+	if len(suffix) > 0 {
+		s += "_" + format(suffix)
+	}
+
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// ja4 returns the JA4 fingerprint of the client hello of the TCP connection
+func (h *clientHello) ja4() string {
+	version := h.version
+	for _, v := range h.supportedVersions {
+		if !grease(v) && v > version {
+			version = v
+		}
+	}
+
+	var versionCode string
+	switch version {
+	case 0x0304:
+		versionCode = "13"
+	case 0x0303:
+		versionCode = "12"
+	case 0x0302:
+		versionCode = "11"
+	case 0x0301:
+		versionCode = "10"
+	case 0x0300:
+		versionCode = "s3"
+	default:
+		versionCode = "00"
+	}
+
+	sni := "i"
+	if h.serverName {
+		sni = "d"
+	}
+
+	var ciphers, extensions, hashedExtensions []uint16
+	for _, c := range h.ciphers {
+		if !grease(c) {
+			ciphers = append(ciphers, c)
+		}
+	}
+	for _, e := range h.extensions {
+		if grease(e) {
+			continue
+		}
+		extensions = append(extensions, e)
+		if e != extensionServerName && e != extensionALPN {
+			hashedExtensions = append(hashedExtensions, e)
+		}
+	}
+
+	alpn := "00"
+	if len(h.alpn) > 0 && len(h.alpn[0]) > 0 {
+		first := h.alpn[0]
+		alpn = string(first[0]) + string(first[len(first)-1])
+	}
+
+	sort.Slice(ciphers, func(i, j int) bool { return ciphers[i] < ciphers[j] })
+	sort.Slice(hashedExtensions, func(i, j int) bool { return hashedExtensions[i] < hashedExtensions[j] })
+
+	var signatureAlgorithms []uint16
+	for _, a := range h.signatureAlgorithms {
+		if !grease(a) {
+			signatureAlgorithms = append(signatureAlgorithms, a)
+		}
+	}
+
+	return fmt.Sprintf("t%s%s%02d%02d%s_%s_%s", versionCode, sni, min(len(ciphers), 99), min(len(extensions), 99), alpn,
+		hashHex(ciphers, nil), hashHex(hashedExtensions, signatureAlgorithms))
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// newFingerprint returns the fingerprints of the client hello
+func newFingerprint(hello *clientHello) *Fingerprint {
+	ja3 := hello.ja3()
+	sum := md5.Sum([]byte(ja3))
+
+	return &Fingerprint{
+		JA3:     ja3,
+		JA3Hash: hex.EncodeToString(sum[:]),
+		JA4:     hello.ja4(),
+	}
+}
+
+// Listener captures the client hello of the accepted connections. The listener should be wrapped by the TLS listener
+func Listener(ln net.Listener) net.Listener {
+	return &listener{Listener: ln}
+}
+
+type listener struct {
+	net.Listener
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{Conn: conn}, nil
+}
+
+// Conn computes the fingerprints of the client hello read from the connection. The connection is served
+// by the single goroutine, so the fingerprint is read after the TLS handshake without the synchronization
+type Conn struct {
+	net.Conn
+	captured    []byte
+	done        bool
+	fingerprint *Fingerprint
+}
+
+func (c *Conn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 && !c.done {
+		c.capture(b[:n])
+	}
+	return n, err
+}
+
+// capture collects the handshake records until the client hello is complete
+func (c *Conn) capture(data []byte) {
+	c.captured = append(c.captured, data...)
+
+	body, complete, err := clientHelloBody(c.captured)
+	switch {
+	case err != nil:
+		c.stop()
+	case complete:
+		if hello, err := parseClientHello(body); err == nil {
+			c.fingerprint = newFingerprint(hello)
+		}
+		c.stop()
+	}
+}
+
+// clientHelloBody returns the body of the client hello handshake message assembled from the TLS records.
+// It returns false if the records don't contain the complete client hello yet
+func clientHelloBody(records []byte) ([]byte, bool, error) {
+	var handshake []byte
+	for len(records) >= 5 {
+		if records[0] != recordTypeHandshake {
+			return nil, false, ErrNotTLS
+		}
+		length := int(binary.BigEndian.Uint16(records[3:5]))
+		if len(records) < 5+length {
+			break
+		}
+		handshake = append(handshake, records[5:5+length]...)
+		records = records[5+length:]
+	}
+
+	if len(records) > 0 && records[0] != recordTypeHandshake {
+		return nil, false, ErrNotTLS
+	}
+
+	if len(handshake) >= 4 {
+		if handshake[0] != handshakeClientHello {
+			return nil, false, errMalformed
+		}
+		length := int(handshake[1])<<16 | int(handshake[2])<<8 | int(handshake[3])
+		if len(handshake) >= 4+length {
+			return handshake[4 : 4+length], true, nil
+		}
+	}
+
+	if len(handshake)+len(records) > maxClientHelloSize {
+		return nil, false, errMalformed
+	}
+
+	return nil, false, nil
+}
+
+// ServerName returns the server name (SNI) of the client hello read from the connection. It returns false
+// if the data doesn't contain the complete client hello yet and ErrNotTLS if the data is not the TLS handshake
+func ServerName(data []byte) (string, bool, error) {
+	body, complete, err := clientHelloBody(data)
+	if err != nil || !complete {
+		return "", complete, err
+	}
+
+	hello, err := parseClientHello(body)
+	if err != nil {
+		return "", false, err
+	}
+
+	return hello.sni, true, nil
+}
+
+func (c *Conn) stop() {
+	c.done = true
+	c.captured = nil
+}
+
+// NetConn returns the underlying connection
+func (c *Conn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// FromConn returns the fingerprint of the connection. The TLS connection and the other connections wrapping
+// the connection are unwrapped by the NetConn method. It returns nil if the client hello is not captured
+func FromConn(conn net.Conn) *Fingerprint {
+	for conn != nil {
+		switch c := conn.(type) {
+		case *Conn:
+			return c.fingerprint
+		case interface{ NetConn() net.Conn }:
+			conn = c.NetConn()
+		default:
+			return nil
+		}
+	}
+	return nil
+}
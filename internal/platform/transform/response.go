@@ -0,0 +1,131 @@
+package transform
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fastjson"
+	"github.com/wallarm/api-firewall/internal/platform/pools"
+)
+
+// ResponseRules are the transformations of the response applied after the validation. The status code
+// is remapped first, then the JSON body is unwrapped, the fields are renamed and the body is wrapped.
+// The fields are addressed by the JSON pointers
+type ResponseRules struct {
+	Status map[string]int `json:"status"`
+	Unwrap string         `json:"unwrap"`
+	Rename []FieldRename  `json:"rename"`
+	Wrap   string         `json:"wrap"`
+}
+
+// FieldRename moves the field of the JSON body
+type FieldRename struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Validate checks the rules
+func (r *ResponseRules) Validate() error {
+
+	for from, to := range r.Status {
+		code, err := strconv.Atoi(from)
+		if err != nil || code < 100 || code > 599 {
+			return errors.Errorf("status: invalid status code %q", from)
+		}
+		if to < 100 || to > 599 {
+			return errors.Errorf("status: invalid status code %d", to)
+		}
+	}
+
+	if r.Unwrap != "" && !strings.HasPrefix(r.Unwrap, "/") {
+		return errors.Errorf("unwrap: invalid JSON pointer %q", r.Unwrap)
+	}
+
+	for _, rename := range r.Rename {
+		if !strings.HasPrefix(rename.From, "/") || !strings.HasPrefix(rename.To, "/") {
+			return errors.Errorf("rename: invalid JSON pointer %q or %q", rename.From, rename.To)
+		}
+	}
+
+	return nil
+}
+
+// Apply transforms the response. The body is transformed if it is not compressed JSON
+func (r *ResponseRules) Apply(resp *fasthttp.Response) error {
+
+	if to, ok := r.Status[strconv.Itoa(resp.StatusCode())]; ok {
+		resp.SetStatusCode(to)
+	}
+
+	if r.Unwrap == "" && len(r.Rename) == 0 && r.Wrap == "" {
+		return nil
+	}
+
+	if encoding := resp.Header.Peek(fasthttp.HeaderContentEncoding); len(encoding) > 0 && string(encoding) != "identity" {
+		return nil
+	}
+
+	contentType := strings.TrimSpace(strings.Split(string(resp.Header.ContentType()), ";")[0])
+	if contentType != "application/json" && !strings.HasSuffix(contentType, "+json") {
+		return nil
+	}
+
+	parser := pools.Parsers.Get()
+	defer pools.Parsers.Put(parser)
+
+	body, err := parser.ParseBytes(resp.Body())
+	if err != nil {
+		return errors.Wrap(err, "parsing response body")
+	}
+
+	if r.Unwrap != "" {
+		if body = body.Get(pointer(r.Unwrap)...); body == nil {
+			return errors.Errorf("unwrap: field %s not found", r.Unwrap)
+		}
+	}
+
+	for _, rename := range r.Rename {
+		from := pointer(rename.From)
+		value := body.Get(from...)
+		if value == nil {
+			continue
+		}
+
+		to := pointer(rename.To)
+		parent := body.Get(to[:len(to)-1]...)
+		if parent == nil || parent.Type() != fastjson.TypeObject {
+			return errors.Errorf("rename: parent of %s is not an object", rename.To)
+		}
+
+		// the source is deleted before the value is set to support renaming in the same object
+		body.Get(from[:len(from)-1]...).Del(from[len(from)-1])
+		parent.Set(to[len(to)-1], value)
+	}
+
+	if r.Wrap != "" {
+		var arena fastjson.Arena
+		envelope := arena.NewObject()
+		envelope.Set(r.Wrap, body)
+		body = envelope
+	}
+
+	resp.SetBody(body.MarshalTo(nil))
+
+	return nil
+}
+
+// pointer returns the keys of the JSON pointer
+func pointer(p string) []string {
+	if p == "" || p == "/" {
+		return nil
+	}
+
+	keys := strings.Split(strings.TrimPrefix(p, "/"), "/")
+	for i, key := range keys {
+		keys[i] = strings.ReplaceAll(strings.ReplaceAll(key, "~1", "/"), "~0", "~")
+	}
+
+	return keys
+}
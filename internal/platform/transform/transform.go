@@ -0,0 +1,238 @@
+package transform
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/pkg/errors"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fastjson"
+	"github.com/wallarm/api-firewall/internal/platform/pools"
+)
+
+const (
+	InQuery  = "query"
+	InHeader = "header"
+)
+
+// Rules are the transformations of the request applied after the validation. The parameters are renamed
+// first, then the query parameters are moved to the headers and the missing optional parameters and
+// properties of the JSON body are filled with the defaults of the schemas
+type Rules struct {
+	Defaults      bool            `json:"defaults"`
+	Rename        []Rename        `json:"rename"`
+	QueryToHeader []QueryToHeader `json:"query_to_header"`
+}
+
+// Rename renames the legacy query parameter or header
+type Rename struct {
+	In   string `json:"in"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// QueryToHeader moves the query parameter to the header
+type QueryToHeader struct {
+	Query  string `json:"query"`
+	Header string `json:"header"`
+}
+
+// Validate checks the rules
+func (r *Rules) Validate() error {
+
+	for _, rename := range r.Rename {
+		if rename.In != InQuery && rename.In != InHeader {
+			return errors.Errorf("rename %s: unsupported location %q", rename.From, rename.In)
+		}
+		if rename.From == "" || rename.To == "" {
+			return errors.New("rename: empty parameter name")
+		}
+	}
+
+	for _, move := range r.QueryToHeader {
+		if move.Query == "" || move.Header == "" {
+			return errors.New("query_to_header: empty parameter name")
+		}
+	}
+
+	return nil
+}
+
+// Apply transforms the request of the operation
+func (r *Rules) Apply(req *fasthttp.Request, route *routers.Route) error {
+
+	args := req.URI().QueryArgs()
+	queryChanged := false
+
+	for _, rename := range r.Rename {
+		switch rename.In {
+		case InQuery:
+			values := args.PeekMulti(rename.From)
+			if len(values) == 0 {
+				continue
+			}
+			for _, value := range values {
+				args.AddBytesV(rename.To, append([]byte(nil), value...))
+			}
+			args.Del(rename.From)
+			queryChanged = true
+		case InHeader:
+			value := req.Header.Peek(rename.From)
+			if value == nil {
+				continue
+			}
+			req.Header.SetBytesV(rename.To, append([]byte(nil), value...))
+			req.Header.Del(rename.From)
+		}
+	}
+
+	for _, move := range r.QueryToHeader {
+		value := args.Peek(move.Query)
+		if value == nil {
+			continue
+		}
+		req.Header.SetBytesV(move.Header, append([]byte(nil), value...))
+		args.Del(move.Query)
+		queryChanged = true
+	}
+
+	if r.Defaults && route != nil && route.Operation != nil {
+		parameters := append(openapi3.Parameters{}, route.PathItem.Parameters...)
+		parameters = append(parameters, route.Operation.Parameters...)
+
+		for _, parameter := range parameters {
+			p := parameter.Value
+			if p == nil || p.Schema == nil || p.Schema.Value == nil || p.Schema.Value.Default == nil {
+				continue
+			}
+
+			value, ok := defaultString(p.Schema.Value.Default)
+			if !ok {
+				continue
+			}
+
+			switch p.In {
+			case openapi3.ParameterInQuery:
+				if !args.Has(p.Name) {
+					args.Add(p.Name, value)
+					queryChanged = true
+				}
+			case openapi3.ParameterInHeader:
+				if req.Header.Peek(p.Name) == nil {
+					req.Header.Set(p.Name, value)
+				}
+			}
+		}
+
+		if err := fillBody(req, route.Operation); err != nil {
+			return err
+		}
+	}
+
+	if queryChanged {
+		req.URI().SetQueryStringBytes(args.QueryString())
+	}
+
+	return nil
+}
+
+// defaultString returns the default value of the parameter. The arrays and the objects are not supported
+func defaultString(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
+
+// fillBody sets the missing properties of the JSON body to the defaults of the schema
+func fillBody(req *fasthttp.Request, operation *openapi3.Operation) error {
+
+	if operation.RequestBody == nil || operation.RequestBody.Value == nil || len(req.Body()) == 0 {
+		return nil
+	}
+
+	contentType := strings.TrimSpace(strings.Split(string(req.Header.ContentType()), ";")[0])
+	if contentType != "application/json" && !strings.HasSuffix(contentType, "+json") {
+		return nil
+	}
+
+	mediaType := operation.RequestBody.Value.GetMediaType(contentType)
+	if mediaType == nil {
+		mediaType = operation.RequestBody.Value.GetMediaType("application/json")
+	}
+	if mediaType == nil || mediaType.Schema == nil || mediaType.Schema.Value == nil {
+		return nil
+	}
+
+	parser := pools.Parsers.Get()
+	defer pools.Parsers.Put(parser)
+
+	body, err := parser.ParseBytes(req.Body())
+	if err != nil {
+		return errors.Wrap(err, "parsing request body")
+	}
+
+	changed, err := fill(mediaType.Schema.Value, body)
+	if err != nil {
+		return err
+	}
+
+	if changed {
+		req.SetBody(body.MarshalTo(nil))
+	}
+
+	return nil
+}
+
+// fill sets the missing properties of the object and the nested objects to the defaults of the schema
+func fill(schema *openapi3.Schema, value *fastjson.Value) (bool, error) {
+
+	object, err := value.Object()
+	if err != nil {
+		return false, nil
+	}
+
+	changed := false
+
+	for name, property := range schema.Properties {
+		if property.Value == nil {
+			continue
+		}
+
+		current := object.Get(name)
+		if current != nil {
+			nested, err := fill(property.Value, current)
+			if err != nil {
+				return false, err
+			}
+			changed = changed || nested
+			continue
+		}
+
+		if property.Value.Default == nil {
+			continue
+		}
+
+		data, err := json.Marshal(property.Value.Default)
+		if err != nil {
+			return false, errors.Wrapf(err, "default of %s", name)
+		}
+		defaultValue, err := fastjson.ParseBytes(data)
+		if err != nil {
+			return false, errors.Wrapf(err, "default of %s", name)
+		}
+
+		object.Set(name, defaultValue)
+		changed = true
+	}
+
+	return changed, nil
+}
@@ -0,0 +1,218 @@
+package useragent
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/valyala/fasthttp"
+)
+
+// The device types of the clients
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+	DeviceTool    = "tool"
+	DeviceUnknown = "unknown"
+)
+
+// clientKey is the key of the parsed client in the user values of the request context
+const clientKey = "apifw.useragent"
+
+// Client is the browser, the OS and the device type parsed from the User-Agent header
+type Client struct {
+	Browser        string `json:"browser,omitempty"`
+	BrowserVersion string `json:"browser_version,omitempty"`
+	OS             string `json:"os,omitempty"`
+	Device         string `json:"device"`
+}
+
+// rule matches the product token of the User-Agent. The first submatch of the pattern is the version
+type rule struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+var (
+	// botPattern matches the crawlers and the monitoring agents. The first submatch is the name of the bot
+	botPattern = regexp.MustCompile(`(?i)([a-z][\w\-.]*(?:bot|crawler|spider|slurp))(?:/([\d.]+))?|(facebookexternalhit|headlesschrome)(?:/([\d.]+))?`)
+
+	// tools are the HTTP libraries and the command line clients
+	tools = []rule{
+		{"curl", regexp.MustCompile(`^curl/([\d.]+)`)},
+		{"Wget", regexp.MustCompile(`^Wget/([\d.]+)`)},
+		{"python-requests", regexp.MustCompile(`^python-requests/([\d.]+)`)},
+		{"Python-urllib", regexp.MustCompile(`^Python-urllib/([\d.]+)`)},
+		{"aiohttp", regexp.MustCompile(`aiohttp/([\d.]+)`)},
+		{"Go-http-client", regexp.MustCompile(`^Go-http-client/([\d.]+)`)},
+		{"okhttp", regexp.MustCompile(`^okhttp/([\d.]+)`)},
+		{"Apache-HttpClient", regexp.MustCompile(`^Apache-HttpClient/([\d.]+)`)},
+		{"Java", regexp.MustCompile(`^Java/([\d._]+)`)},
+		{"PostmanRuntime", regexp.MustCompile(`^PostmanRuntime/([\d.]+)`)},
+		{"insomnia", regexp.MustCompile(`^insomnia/([\d.]+)`)},
+		{"HTTPie", regexp.MustCompile(`^HTTPie/([\d.]+)`)},
+		{"axios", regexp.MustCompile(`^axios/([\d.]+)`)},
+		{"node-fetch", regexp.MustCompile(`^node-fetch/([\d.]+)`)},
+		{"libwww-perl", regexp.MustCompile(`^libwww-perl/([\d.]+)`)},
+	}
+
+	// browsers are checked in order: the Chromium based browsers contain the Chrome and the Safari tokens
+	browsers = []rule{
+		{"Edge", regexp.MustCompile(`Edg(?:e|A|iOS)?/([\d.]+)`)},
+		{"Opera", regexp.MustCompile(`(?:OPR|Opera)/([\d.]+)`)},
+		{"Samsung Internet", regexp.MustCompile(`SamsungBrowser/([\d.]+)`)},
+		{"Yandex", regexp.MustCompile(`YaBrowser/([\d.]+)`)},
+		{"Firefox", regexp.MustCompile(`(?:Firefox|FxiOS)/([\d.]+)`)},
+		{"Chrome", regexp.MustCompile(`(?:Chrome|CriOS)/([\d.]+)`)},
+		{"Safari", regexp.MustCompile(`Version/([\d.]+).*Safari/`)},
+		{"Internet Explorer", regexp.MustCompile(`MSIE ([\d.]+)|Trident/.*rv:([\d.]+)`)},
+	}
+
+	systems = []rule{
+		{"Windows Phone", regexp.MustCompile(`Windows Phone(?: OS)? ([\d.]+)`)},
+		{"Windows", regexp.MustCompile(`Windows NT ([\d.]+)`)},
+		{"iOS", regexp.MustCompile(`(?:iPhone|CPU) OS ([\d_]+)`)},
+		{"Android", regexp.MustCompile(`Android ([\d.]+)`)},
+		{"macOS", regexp.MustCompile(`Mac OS X ([\d_.]+)`)},
+		{"Chrome OS", regexp.MustCompile(`CrOS \S+ ([\d.]+)`)},
+		{"Linux", regexp.MustCompile(`Linux()`)},
+	}
+
+	// windowsVersions are the marketing names of the Windows NT versions
+	windowsVersions = map[string]string{
+		"10.0": "10",
+		"6.3":  "8.1",
+		"6.2":  "8",
+		"6.1":  "7",
+		"6.0":  "Vista",
+		"5.1":  "XP",
+	}
+)
+
+// match returns the name and the version of the first matched rule
+func match(rules []rule, ua string) (string, string, bool) {
+	for _, r := range rules {
+		if m := r.pattern.FindStringSubmatch(ua); m != nil {
+			for _, version := range m[1:] {
+				if version != "" {
+					return r.name, version, true
+				}
+			}
+			return r.name, "", true
+		}
+	}
+	return "", "", false
+}
+
+// Parse returns the client of the User-Agent header value
+func Parse(ua string) Client {
+
+	ua = strings.TrimSpace(ua)
+	if ua == "" {
+		return Client{Device: DeviceUnknown}
+	}
+
+	var client Client
+
+	if name, version, ok := match(systems, ua); ok {
+		client.OS = name
+		switch name {
+		case "Windows":
+			if marketing, ok := windowsVersions[version]; ok {
+				version = marketing
+			}
+		case "iOS", "macOS":
+			version = strings.ReplaceAll(version, "_", ".")
+		}
+		if version != "" {
+			client.OS += " " + version
+		}
+	}
+
+	if m := botPattern.FindStringSubmatch(ua); m != nil {
+		client.Device = DeviceBot
+		client.Browser, client.BrowserVersion = m[1], m[2]
+		if client.Browser == "" {
+			client.Browser, client.BrowserVersion = m[3], m[4]
+		}
+		return client
+	}
+
+	if name, version, ok := match(tools, ua); ok {
+		client.Device = DeviceTool
+		client.Browser, client.BrowserVersion = name, version
+		return client
+	}
+
+	client.Browser, client.BrowserVersion, _ = match(browsers, ua)
+
+	switch {
+	case strings.Contains(ua, "iPad") || strings.Contains(ua, "Tablet") ||
+		strings.Contains(ua, "Android") && !strings.Contains(ua, "Mobile"):
+		client.Device = DeviceTablet
+	case strings.Contains(ua, "Mobi") || strings.Contains(ua, "iPhone") || strings.Contains(ua, "Windows Phone"):
+		client.Device = DeviceMobile
+	case client.Browser != "" || client.OS != "":
+		client.Device = DeviceDesktop
+	default:
+		client.Device = DeviceUnknown
+	}
+
+	return client
+}
+
+// FromCtx returns the client of the request. The User-Agent header is parsed once per request
+func FromCtx(ctx *fasthttp.RequestCtx) Client {
+	if client, ok := ctx.UserValue(clientKey).(Client); ok {
+		return client
+	}
+
+	client := Parse(string(ctx.Request.Header.UserAgent()))
+	ctx.SetUserValue(clientKey, client)
+
+	return client
+}
+
+// Stats are the numbers of the requests and the blocked requests of the device type
+type Stats struct {
+	Requests int64 `json:"requests"`
+	Blocked  int64 `json:"blocked"`
+}
+
+var totals = struct {
+	mu      sync.Mutex
+	devices map[string]*Stats
+}{devices: make(map[string]*Stats)}
+
+// Observe counts the request by the device type of the client
+func Observe(ctx *fasthttp.RequestCtx, blocked bool) {
+	device := FromCtx(ctx).Device
+
+	totals.mu.Lock()
+	defer totals.mu.Unlock()
+
+	stats, ok := totals.devices[device]
+	if !ok {
+		stats = &Stats{}
+		totals.devices[device] = stats
+	}
+	stats.Requests++
+	if blocked {
+		stats.Blocked++
+	}
+}
+
+// Totals returns the copy of the counters by the device type
+func Totals() map[string]Stats {
+	totals.mu.Lock()
+	defer totals.mu.Unlock()
+
+	snapshot := make(map[string]Stats, len(totals.devices))
+	for device, stats := range totals.devices {
+		snapshot[device] = *stats
+	}
+
+	return snapshot
+}
@@ -0,0 +1,81 @@
+package validator
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3filter"
+)
+
+// ErrNotAcceptable is returned when none of the media ranges of the Accept header matches
+// the content types of the successful responses of the operation
+var ErrNotAcceptable = errors.New("none of the accepted media types can be served")
+
+// ValidateAccept checks that the Accept header of the request matches one of the content types
+// declared by the 2XX and the default responses of the operation. The requests without the Accept header
+// and the operations without the declared content types are not checked.
+//
+// The function returns RequestError with ErrNotAcceptable cause.
+func ValidateAccept(input *openapi3filter.RequestValidationInput) error {
+	route := input.Route
+	if route == nil || route.Operation == nil {
+		return nil
+	}
+
+	accept := input.Request.Header.Values("Accept")
+	if len(accept) == 0 {
+		return nil
+	}
+
+	var declared []string
+	for status, response := range route.Operation.Responses {
+		if response.Value == nil || !(status == "default" || strings.HasPrefix(status, "2")) {
+			continue
+		}
+		for contentType := range response.Value.Content {
+			declared = append(declared, contentType)
+		}
+	}
+
+	if len(declared) == 0 {
+		return nil
+	}
+
+	for _, mediaRange := range strings.Split(strings.Join(accept, ","), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+		if err != nil {
+			continue
+		}
+		if q, ok := params["q"]; ok {
+			if weight, err := strconv.ParseFloat(q, 64); err == nil && weight == 0 {
+				continue
+			}
+		}
+		for _, contentType := range declared {
+			if mediaTypeMatches(mediaType, parseMediaType(strings.ToLower(contentType))) {
+				return nil
+			}
+		}
+	}
+
+	return &openapi3filter.RequestError{
+		Input:  input,
+		Reason: fmt.Sprintf("%s: %q", ErrNotAcceptable, strings.Join(accept, ",")),
+		Err:    ErrNotAcceptable,
+	}
+}
+
+// mediaTypeMatches returns true if the media types are equal or one of them is the wildcard matching the other
+func mediaTypeMatches(a, b string) bool {
+	if a == "*/*" || b == "*/*" || a == b {
+		return true
+	}
+
+	aType, aSubtype, _ := strings.Cut(a, "/")
+	bType, bSubtype, _ := strings.Cut(b, "/")
+
+	return aType == bType && (aSubtype == "*" || bSubtype == "*")
+}
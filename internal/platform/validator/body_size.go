@@ -0,0 +1,162 @@
+package validator
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+const (
+	// maxSchemaDepth is the max nesting depth of the schema which size is derived (the recursive schemas are unbounded)
+	maxSchemaDepth = 32
+
+	// maxEscapedCharSize is the max size of the JSON encoded string character (\uXXXX)
+	maxEscapedCharSize = 6
+
+	// maxNumberSize is the max size of the JSON encoded number
+	maxNumberSize = 32
+)
+
+// ErrBodyTooLarge is returned if the body size exceeds the limit of the operation
+var ErrBodyTooLarge = errors.New("body is too large")
+
+// BodyLimits are the max sizes in bytes of the request body and of the response bodies by status code. Zero value disables the limit
+type BodyLimits struct {
+	Request   int64
+	Responses map[string]int64
+}
+
+// Response returns the limit of the response body by the status code, by the range of the status codes (2XX) or the default limit
+func (l BodyLimits) Response(status int) int64 {
+	code := strconv.Itoa(status)
+	for _, key := range []string{code, code[:1] + "XX", "default"} {
+		if limit, ok := l.Responses[key]; ok {
+			return limit
+		}
+	}
+	return 0
+}
+
+// MaxBodySize returns the max size of the compact JSON body derived from the maxLength, maxItems and enum
+// constraints of the schemas. It returns false if any media type is not JSON or any schema is not bounded
+func MaxBodySize(content openapi3.Content) (int64, bool) {
+
+	if len(content) == 0 {
+		return 0, false
+	}
+
+	var maxSize int64
+	for mediaType, media := range content {
+		if !isJSONMediaType(mediaType) || media == nil || media.Schema == nil {
+			return 0, false
+		}
+		size, ok := maxJSONSize(media.Schema.Value, 0)
+		if !ok {
+			return 0, false
+		}
+		if size > maxSize {
+			maxSize = size
+		}
+	}
+
+	return maxSize, true
+}
+
+func isJSONMediaType(mediaType string) bool {
+	mediaType = strings.TrimSpace(strings.Split(mediaType, ";")[0])
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+func maxJSONSize(schema *openapi3.Schema, depth int) (int64, bool) {
+
+	if schema == nil || depth > maxSchemaDepth {
+		return 0, false
+	}
+
+	if len(schema.Enum) > 0 {
+		var maxSize int64
+		for _, value := range schema.Enum {
+			data, err := json.Marshal(value)
+			if err != nil {
+				return 0, false
+			}
+			if int64(len(data)) > maxSize {
+				maxSize = int64(len(data))
+			}
+		}
+		return maxSize, true
+	}
+
+	// the value satisfies all schemas, so the smallest bounded schema limits the size
+	if len(schema.AllOf) > 0 {
+		var minSize int64 = -1
+		for _, s := range schema.AllOf {
+			if size, ok := maxJSONSize(s.Value, depth+1); ok && (minSize < 0 || size < minSize) {
+				minSize = size
+			}
+		}
+		if minSize >= 0 {
+			return minSize, true
+		}
+	}
+
+	alternatives := make(openapi3.SchemaRefs, 0, len(schema.OneOf)+len(schema.AnyOf))
+	alternatives = append(append(alternatives, schema.OneOf...), schema.AnyOf...)
+	if len(alternatives) > 0 {
+		var maxSize int64
+		for _, s := range alternatives {
+			size, ok := maxJSONSize(s.Value, depth+1)
+			if !ok {
+				return 0, false
+			}
+			if size > maxSize {
+				maxSize = size
+			}
+		}
+		return maxSize, true
+	}
+
+	var size int64
+	var ok bool
+
+	switch schema.Type {
+	case openapi3.TypeString:
+		if schema.MaxLength != nil {
+			size, ok = 2+int64(*schema.MaxLength)*maxEscapedCharSize, true
+		}
+	case openapi3.TypeInteger, openapi3.TypeNumber:
+		size, ok = maxNumberSize, true
+	case openapi3.TypeBoolean:
+		size, ok = int64(len("false")), true
+	case openapi3.TypeArray:
+		if schema.MaxItems != nil && schema.Items != nil {
+			var itemSize int64
+			if itemSize, ok = maxJSONSize(schema.Items.Value, depth+1); ok {
+				size = 2 + int64(*schema.MaxItems)*(itemSize+1)
+			}
+		}
+	case openapi3.TypeObject:
+		// the additional properties are not bounded
+		if schema.AdditionalPropertiesAllowed == nil || *schema.AdditionalPropertiesAllowed || schema.AdditionalProperties != nil {
+			return 0, false
+		}
+		size, ok = 2, true
+		for name, property := range schema.Properties {
+			propertySize, propertyOk := maxJSONSize(property.Value, depth+1)
+			if !propertyOk {
+				return 0, false
+			}
+			// "name":value,
+			size += 2 + int64(len(name))*maxEscapedCharSize + 1 + propertySize + 1
+		}
+	}
+
+	if ok && schema.Nullable && size < int64(len("null")) {
+		size = int64(len("null"))
+	}
+
+	return size, ok
+}
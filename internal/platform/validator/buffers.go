@@ -0,0 +1,68 @@
+package validator
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/wallarm/api-firewall/internal/platform/pools"
+)
+
+func acquireBuffer() *bytes.Buffer {
+	return pools.Buffers.Get()
+}
+
+func releaseBuffer(buf *bytes.Buffer) {
+	pools.Buffers.Put(buf)
+}
+
+// pooledBody is the body read into the pooled buffer. The buffer is returned to the pool when the body is closed,
+// so the body can't be read after Close
+type pooledBody struct {
+	*bytes.Reader
+	buf *bytes.Buffer
+}
+
+// readBody reads the body into the pooled buffer
+func readBody(body io.Reader) (*pooledBody, error) {
+	buf := acquireBuffer()
+	if _, err := buf.ReadFrom(body); err != nil {
+		releaseBuffer(buf)
+		return nil, err
+	}
+
+	return &pooledBody{Reader: bytes.NewReader(buf.Bytes()), buf: buf}, nil
+}
+
+// Bytes returns the content of the body. The slice is valid until the body is closed
+func (b *pooledBody) Bytes() []byte {
+	if b.buf == nil {
+		return nil
+	}
+	return b.buf.Bytes()
+}
+
+// Close returns the buffer to the pool
+func (b *pooledBody) Close() error {
+	if b.buf != nil {
+		b.Reader.Reset(nil)
+		releaseBuffer(b.buf)
+		b.buf = nil
+	}
+	return nil
+}
+
+// readAll returns the content of the body. The content of the in-memory buffer is returned without copying,
+// other bodies are read into the pooled buffer. The content is valid until the release function is called
+func readAll(body io.Reader) ([]byte, func(), error) {
+	if buf, ok := body.(*bytes.Buffer); ok {
+		return buf.Next(buf.Len()), func() {}, nil
+	}
+
+	buf := acquireBuffer()
+	if _, err := buf.ReadFrom(body); err != nil {
+		releaseBuffer(buf)
+		return nil, nil, err
+	}
+
+	return buf.Bytes(), func() { releaseBuffer(buf) }, nil
+}
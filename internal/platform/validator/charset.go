@@ -0,0 +1,140 @@
+package validator
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+const (
+	charsetUTF8        = "utf-8"
+	charsetASCII       = "us-ascii"
+	charsetLatin1      = "iso-8859-1"
+	charsetWindows1252 = "windows-1252"
+)
+
+// charsetAliases are the common names of the charsets
+var charsetAliases = map[string]string{
+	"utf8":       charsetUTF8,
+	"ascii":      charsetASCII,
+	"latin1":     charsetLatin1,
+	"l1":         charsetLatin1,
+	"iso8859-1":  charsetLatin1,
+	"iso_8859-1": charsetLatin1,
+	"cp1252":     charsetWindows1252,
+}
+
+// windows1252 contains the code points of the 0x80-0x9F bytes of windows-1252. The other bytes match ISO-8859-1
+var windows1252 = [32]rune{
+	'€', utf8.RuneError, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', utf8.RuneError, 'Ž', utf8.RuneError,
+	utf8.RuneError, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', utf8.RuneError, 'ž', 'Ÿ',
+}
+
+// responseCharsets contains the charsets allowed in the responses and the transcoding option
+var responseCharsets = struct {
+	allowed   map[string]struct{}
+	transcode bool
+}{}
+
+// SetResponseCharsets sets the charsets allowed in the Content-Type of the responses and enables the transcoding
+// of the ISO-8859-1 and windows-1252 bodies to UTF-8 before the validation. The charsets declared in the media
+// types of the spec take precedence over the allowed charsets.
+// This call is not thread-safe: it should be called before the validation of requests.
+func SetResponseCharsets(allowed []string, transcode bool) {
+	responseCharsets.allowed = nil
+	if len(allowed) > 0 {
+		responseCharsets.allowed = make(map[string]struct{}, len(allowed))
+		for _, charset := range allowed {
+			responseCharsets.allowed[normalizeCharset(charset)] = struct{}{}
+		}
+	}
+	responseCharsets.transcode = transcode
+}
+
+// normalizeCharset returns the lowercased name of the charset resolving the aliases
+func normalizeCharset(charset string) string {
+	charset = strings.ToLower(strings.TrimSpace(charset))
+	if name, ok := charsetAliases[charset]; ok {
+		return name
+	}
+	return charset
+}
+
+// contentCharset returns the normalized charset parameter of the content type
+func contentCharset(contentType string) string {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return normalizeCharset(params["charset"])
+}
+
+// declaredCharset returns the charset parameter of the media type declared in the content
+func declaredCharset(content openapi3.Content, mediaType *openapi3.MediaType) string {
+	for name, declared := range content {
+		if declared == mediaType {
+			return contentCharset(name)
+		}
+	}
+	return ""
+}
+
+// checkResponseCharset checks the charset of the response Content-Type by the charset of the declared media type
+// or by the allowed charsets. The response without the charset parameter is not checked
+func checkResponseCharset(content openapi3.Content, mediaType *openapi3.MediaType, contentType string) error {
+	charset := contentCharset(contentType)
+	if charset == "" {
+		return nil
+	}
+
+	if expected := declaredCharset(content, mediaType); expected != "" {
+		if charset != expected {
+			return fmt.Errorf("response charset %q doesn't match the declared charset %q", charset, expected)
+		}
+		return nil
+	}
+
+	if responseCharsets.allowed != nil {
+		if _, ok := responseCharsets.allowed[charset]; !ok {
+			return fmt.Errorf("response charset %q is not allowed", charset)
+		}
+	}
+
+	return nil
+}
+
+// decodeCharset checks that the UTF-8 body is valid and transcodes the body of the legacy charset to UTF-8
+// if the transcoding is enabled. The bodies of the other charsets are returned as is
+func decodeCharset(data []byte, contentType string) ([]byte, error) {
+	switch charset := contentCharset(contentType); charset {
+	case charsetUTF8:
+		if !utf8.Valid(data) {
+			return nil, fmt.Errorf("response body is not valid UTF-8")
+		}
+	case charsetASCII:
+		for _, b := range data {
+			if b >= utf8.RuneSelf {
+				return nil, fmt.Errorf("response body is not valid US-ASCII")
+			}
+		}
+	case charsetLatin1, charsetWindows1252:
+		if !responseCharsets.transcode {
+			return data, nil
+		}
+
+		transcoded := make([]byte, 0, len(data)+len(data)/4)
+		for _, b := range data {
+			r := rune(b)
+			if charset == charsetWindows1252 && b >= 0x80 && b <= 0x9F {
+				r = windows1252[b-0x80]
+			}
+			transcoded = utf8.AppendRune(transcoded, r)
+		}
+		return transcoded, nil
+	}
+
+	return data, nil
+}
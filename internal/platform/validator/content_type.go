@@ -0,0 +1,203 @@
+package validator
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+)
+
+// ErrContentTypeNotAllowed is returned when the Content-Type of the message body is not declared in the spec
+var ErrContentTypeNotAllowed = errors.New("Content-Type is not allowed")
+
+const (
+	// ContentTypeMatchingStrict matches the declared media types exactly or by the type/* and */* ranges
+	ContentTypeMatchingStrict = "STRICT"
+	// ContentTypeMatchingLenient matches the media types case-insensitively and by the structured syntax suffixes
+	ContentTypeMatchingLenient = "LENIENT"
+)
+
+// contentTypeMatching is the mode of the matching of the Content-Type with the media types declared in the spec
+var contentTypeMatching = ContentTypeMatchingLenient
+
+// suffixMediaTypes are the media types of the structured syntax suffixes (RFC 6839)
+var suffixMediaTypes = map[string]string{
+	"json": "application/json",
+	"xml":  "application/xml",
+	"cbor": "application/cbor",
+	"yaml": "application/yaml",
+}
+
+// SetContentTypeMatching sets the mode of the matching of the Content-Type with the declared media types.
+// In the LENIENT mode the case and the whitespaces are ignored and the media type with the structured
+// syntax suffix (application/vnd.api+json) matches the declared application/*+json and application/json media types.
+// This call is not thread-safe: it should be called before the validation of requests.
+func SetContentTypeMatching(mode string) error {
+	switch mode {
+	case ContentTypeMatchingStrict, ContentTypeMatchingLenient:
+	default:
+		return fmt.Errorf("invalid content type matching mode: %q", mode)
+	}
+
+	contentTypeMatching = mode
+	return nil
+}
+
+// normalizeMediaType returns the lowercased media type without the parameters
+func normalizeMediaType(contentType string) string {
+	return strings.ToLower(strings.TrimSpace(parseMediaType(contentType)))
+}
+
+// suffixMediaType returns the media type of the structured syntax suffix of the media type.
+// The empty string is returned if the media type has no known suffix
+func suffixMediaType(mediaType string) string {
+	i := strings.LastIndexByte(mediaType, '+')
+	if i < 0 {
+		return ""
+	}
+	return suffixMediaTypes[mediaType[i+1:]]
+}
+
+// MatchContent returns the declared media type of the content matching the Content-Type. In the LENIENT mode
+// the media types are matched from the most specific to the least specific: the exact media type,
+// the type/*+suffix range, the media type of the suffix, the type/* range and */*
+func MatchContent(content openapi3.Content, contentType string) *openapi3.MediaType {
+	if contentTypeMatching == ContentTypeMatchingStrict {
+		return content.Get(contentType)
+	}
+
+	if mediaType := content[contentType]; mediaType != nil {
+		return mediaType
+	}
+
+	declared := make(map[string]*openapi3.MediaType, len(content))
+	for name, mediaType := range content {
+		declared[normalizeMediaType(name)] = mediaType
+	}
+
+	mediaType := normalizeMediaType(contentType)
+	if mediaType == "" {
+		return declared["*/*"]
+	}
+
+	mainType, subType, ok := strings.Cut(mediaType, "/")
+	if !ok {
+		return nil
+	}
+
+	candidates := []string{mediaType}
+	if i := strings.LastIndexByte(subType, '+'); i >= 0 {
+		candidates = append(candidates, mainType+"/*"+subType[i:])
+		if suffixType := suffixMediaType(mediaType); suffixType != "" {
+			candidates = append(candidates, suffixType)
+		}
+	}
+	candidates = append(candidates, mainType+"/*", "*/*")
+
+	for _, candidate := range candidates {
+		if v := declared[candidate]; v != nil {
+			return v
+		}
+	}
+
+	return nil
+}
+
+// ValidateRequestContentType checks that the request with the body has the Content-Type
+// declared in the request body of the operation. Unlike the request body validation
+// the request is rejected if the operation has no request body content or the Content-Type is missing.
+//
+// The function returns RequestError with ErrContentTypeNotAllowed cause.
+func ValidateRequestContentType(input *openapi3filter.RequestValidationInput) error {
+	if input.Request.ContentLength == 0 {
+		return nil
+	}
+
+	var requestBody *openapi3.RequestBody
+	var content openapi3.Content
+	if input.Route != nil && input.Route.Operation != nil && input.Route.Operation.RequestBody != nil {
+		requestBody = input.Route.Operation.RequestBody.Value
+		if requestBody != nil {
+			content = requestBody.Content
+		}
+	}
+
+	contentType := input.Request.Header.Get(headerCT)
+	if !contentTypeAllowed(content, contentType) {
+		return &openapi3filter.RequestError{
+			Input:       input,
+			RequestBody: requestBody,
+			Reason:      fmt.Sprintf("%s: %q", ErrContentTypeNotAllowed, contentType),
+			Err:         ErrContentTypeNotAllowed,
+		}
+	}
+
+	return nil
+}
+
+// ValidateResponseContentType checks that the response with the body has the Content-Type
+// declared in the documented response of the status code. The responses with undocumented
+// status codes are left to the response validation.
+//
+// The function returns ResponseError with ErrContentTypeNotAllowed cause.
+func ValidateResponseContentType(input *openapi3filter.ResponseValidationInput, bodyLength int) error {
+	if bodyLength == 0 || input.RequestValidationInput.Request.Method == "HEAD" {
+		return nil
+	}
+
+	route := input.RequestValidationInput.Route
+	if route == nil || route.Operation == nil {
+		return nil
+	}
+
+	responseRef := route.Operation.Responses.Get(input.Status)
+	if responseRef == nil {
+		responseRef = route.Operation.Responses.Default()
+	}
+	if responseRef == nil || responseRef.Value == nil {
+		return nil
+	}
+
+	contentType := input.Header.Get(headerCT)
+	if !contentTypeAllowed(responseRef.Value.Content, contentType) {
+		return &openapi3filter.ResponseError{
+			Input:  input,
+			Reason: fmt.Sprintf("response %s: %q", ErrContentTypeNotAllowed, contentType),
+			Err:    ErrContentTypeNotAllowed,
+		}
+	}
+
+	return nil
+}
+
+// contentTypeAllowed returns true if the media type matches one of the declared media types
+// exactly or by the type/* and */* ranges. The parameters of the media types are ignored.
+// In the LENIENT mode the media types are matched by MatchContent
+func contentTypeAllowed(content openapi3.Content, contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	if contentTypeMatching == ContentTypeMatchingLenient {
+		return MatchContent(content, contentType) != nil
+	}
+
+	for declared := range content {
+		declaredType, _, err := mime.ParseMediaType(declared)
+		if err != nil {
+			continue
+		}
+		switch {
+		case declaredType == mediaType, declaredType == "*/*":
+			return true
+		case strings.HasSuffix(declaredType, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(declaredType, "*")):
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,79 @@
+package validator
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+)
+
+// ErrUndocumentedHeader is returned when the request contains the header which is not documented in the spec
+var ErrUndocumentedHeader = errors.New("undocumented header")
+
+// DocumentedHeaders returns the canonical names of the header parameters of the route,
+// the headers of the apiKey security schemes and the additionally allowed headers
+func DocumentedHeaders(route *routers.Route, allowed []string) map[string]struct{} {
+	headers := make(map[string]struct{})
+
+	for _, name := range allowed {
+		if name = strings.TrimSpace(name); name != "" {
+			headers[http.CanonicalHeaderKey(name)] = struct{}{}
+		}
+	}
+
+	var params openapi3.Parameters
+	params = append(params, route.PathItem.Parameters...)
+	if route.Operation != nil {
+		params = append(params, route.Operation.Parameters...)
+	}
+	for _, param := range params {
+		if param.Value != nil && param.Value.In == openapi3.ParameterInHeader {
+			headers[http.CanonicalHeaderKey(param.Value.Name)] = struct{}{}
+		}
+	}
+
+	if route.Spec != nil {
+		for _, scheme := range route.Spec.Components.SecuritySchemes {
+			if scheme.Value != nil && scheme.Value.Type == "apiKey" && scheme.Value.In == openapi3.ParameterInHeader {
+				headers[http.CanonicalHeaderKey(scheme.Value.Name)] = struct{}{}
+			}
+		}
+	}
+
+	return headers
+}
+
+// ValidateUndocumentedHeaders checks that the request doesn't contain the headers with the prefix
+// which are not in the list of the documented headers.
+//
+// The function returns RequestError with ErrUndocumentedHeader cause for the first undocumented header.
+func ValidateUndocumentedHeaders(input *openapi3filter.RequestValidationInput, prefix string, documented map[string]struct{}) error {
+	prefix = strings.ToLower(prefix)
+
+	names := make([]string, 0, len(input.Request.Header))
+	for name := range input.Request.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !strings.HasPrefix(strings.ToLower(name), prefix) {
+			continue
+		}
+		if _, ok := documented[http.CanonicalHeaderKey(name)]; ok {
+			continue
+		}
+		return &openapi3filter.RequestError{
+			Input:     input,
+			Parameter: &openapi3.Parameter{Name: name, In: openapi3.ParameterInHeader},
+			Reason:    ErrUndocumentedHeader.Error(),
+			Err:       ErrUndocumentedHeader,
+		}
+	}
+
+	return nil
+}
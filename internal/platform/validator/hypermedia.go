@@ -0,0 +1,365 @@
+package validator
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/valyala/fastjson"
+)
+
+const (
+	mediaTypeJSONAPI = "application/vnd.api+json"
+	mediaTypeHAL     = "application/hal+json"
+)
+
+// jsonAPITopLevelMembers are the members of the JSON:API top-level object
+var jsonAPITopLevelMembers = map[string]bool{
+	"data":     true,
+	"errors":   true,
+	"meta":     true,
+	"jsonapi":  true,
+	"links":    true,
+	"included": true,
+}
+
+// jsonAPIResourceMembers are the members of the JSON:API resource object
+var jsonAPIResourceMembers = map[string]bool{
+	"type":          true,
+	"id":            true,
+	"lid":           true,
+	"attributes":    true,
+	"relationships": true,
+	"links":         true,
+	"meta":          true,
+}
+
+// jsonAPIBodyDecoder decodes the JSON:API document and checks the structure of the top-level object, the resource
+// objects and the relationships. The attributes of the resources are validated by the schema of the operation
+func jsonAPIBodyDecoder(body io.Reader, header http.Header, schema *openapi3.SchemaRef, encFn EncodingFn, jsonParser *fastjson.Parser) (interface{}, error) {
+	value, err := jsonBodyDecoder(body, header, schema, encFn, jsonParser)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkJSONAPIDocument(value.(*fastjson.Value)); err != nil {
+		return nil, &ParseError{Kind: KindInvalidFormat, Reason: "JSON:API document: " + err.Error()}
+	}
+
+	return value, nil
+}
+
+// jsonAPIMember returns true if the member is defined by the specification. The members of the extensions
+// (with the namespace) and the @-members are ignored
+func jsonAPIMember(name string, members map[string]bool) bool {
+	return members[name] || strings.Contains(name, ":") || strings.HasPrefix(name, "@")
+}
+
+func checkJSONAPIDocument(doc *fastjson.Value) error {
+	obj, err := doc.Object()
+	if err != nil {
+		return fmt.Errorf("the top-level value should be an object")
+	}
+
+	var unknown string
+	obj.Visit(func(key []byte, v *fastjson.Value) {
+		if unknown == "" && !jsonAPIMember(string(key), jsonAPITopLevelMembers) {
+			unknown = string(key)
+		}
+	})
+	if unknown != "" {
+		return fmt.Errorf("unknown top-level member %q", unknown)
+	}
+
+	data, errors, meta := obj.Get("data"), obj.Get("errors"), obj.Get("meta")
+
+	switch {
+	case data == nil && errors == nil && meta == nil:
+		return fmt.Errorf("the document should contain at least one of data, errors and meta")
+	case data != nil && errors != nil:
+		return fmt.Errorf("data and errors should not coexist")
+	case obj.Get("included") != nil && data == nil:
+		return fmt.Errorf("included requires data")
+	}
+
+	if data != nil {
+		// the primary resource of the request creating the resource may be without id
+		if err := checkJSONAPIData(data, "data", false); err != nil {
+			return err
+		}
+	}
+
+	if errors != nil {
+		items, err := errors.Array()
+		if err != nil {
+			return fmt.Errorf("errors should be an array")
+		}
+		for i, item := range items {
+			if item.Type() != fastjson.TypeObject {
+				return fmt.Errorf("errors[%d] should be an object", i)
+			}
+		}
+	}
+
+	if included := obj.Get("included"); included != nil {
+		items, err := included.Array()
+		if err != nil {
+			return fmt.Errorf("included should be an array")
+		}
+		for i, item := range items {
+			if err := checkJSONAPIResource(item, fmt.Sprintf("included[%d]", i), true); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, name := range []string{"meta", "jsonapi", "links"} {
+		if v := obj.Get(name); v != nil && v.Type() != fastjson.TypeObject {
+			return fmt.Errorf("%s should be an object", name)
+		}
+	}
+
+	return nil
+}
+
+// checkJSONAPIData checks the primary data: null, the resource object or the array of the resource objects
+func checkJSONAPIData(data *fastjson.Value, path string, idRequired bool) error {
+	switch data.Type() {
+	case fastjson.TypeNull:
+		return nil
+	case fastjson.TypeArray:
+		for i, item := range data.GetArray() {
+			if err := checkJSONAPIResource(item, fmt.Sprintf("%s[%d]", path, i), idRequired); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return checkJSONAPIResource(data, path, idRequired)
+}
+
+func checkJSONAPIResource(resource *fastjson.Value, path string, idRequired bool) error {
+	obj, err := resource.Object()
+	if err != nil {
+		return fmt.Errorf("%s should be a resource object", path)
+	}
+
+	var unknown string
+	obj.Visit(func(key []byte, v *fastjson.Value) {
+		if unknown == "" && !jsonAPIMember(string(key), jsonAPIResourceMembers) {
+			unknown = string(key)
+		}
+	})
+	if unknown != "" {
+		return fmt.Errorf("%s: unknown member %q", path, unknown)
+	}
+
+	if err := checkJSONAPIIdentity(obj, path, idRequired); err != nil {
+		return err
+	}
+
+	attributes, relationships := obj.Get("attributes"), obj.Get("relationships")
+
+	// the fields of the resource share the namespace with type and id
+	fields := make(map[string]bool)
+	for _, member := range []struct {
+		name  string
+		value *fastjson.Value
+	}{{"attributes", attributes}, {"relationships", relationships}} {
+		if member.value == nil {
+			continue
+		}
+
+		fieldsObj, err := member.value.Object()
+		if err != nil {
+			return fmt.Errorf("%s.%s should be an object", path, member.name)
+		}
+
+		var fieldErr error
+		fieldsObj.Visit(func(key []byte, v *fastjson.Value) {
+			if fieldErr != nil {
+				return
+			}
+			field := string(key)
+			switch {
+			case field == "type" || field == "id":
+				fieldErr = fmt.Errorf("%s.%s: field %q is reserved", path, member.name, field)
+			case fields[field]:
+				fieldErr = fmt.Errorf("%s: field %q is both the attribute and the relationship", path, field)
+			case member.name == "relationships":
+				fieldErr = checkJSONAPIRelationship(v, fmt.Sprintf("%s.relationships.%s", path, field))
+			}
+			fields[field] = true
+		})
+		if fieldErr != nil {
+			return fieldErr
+		}
+	}
+
+	for _, name := range []string{"links", "meta"} {
+		if v := obj.Get(name); v != nil && v.Type() != fastjson.TypeObject {
+			return fmt.Errorf("%s.%s should be an object", path, name)
+		}
+	}
+
+	return nil
+}
+
+// checkJSONAPIIdentity checks the type and the id of the resource. The local id (lid) identifies the resource
+// which is not created yet
+func checkJSONAPIIdentity(obj *fastjson.Object, path string, idRequired bool) error {
+	if v := obj.Get("type"); v == nil || v.Type() != fastjson.TypeString || len(v.GetStringBytes()) == 0 {
+		return fmt.Errorf("%s.type should be a non-empty string", path)
+	}
+
+	id, lid := obj.Get("id"), obj.Get("lid")
+	if id != nil && id.Type() != fastjson.TypeString {
+		return fmt.Errorf("%s.id should be a string", path)
+	}
+	if lid != nil && lid.Type() != fastjson.TypeString {
+		return fmt.Errorf("%s.lid should be a string", path)
+	}
+	if idRequired && id == nil && lid == nil {
+		return fmt.Errorf("%s.id is required", path)
+	}
+
+	return nil
+}
+
+// checkJSONAPIRelationship checks the relationship object and the resource linkage
+func checkJSONAPIRelationship(relationship *fastjson.Value, path string) error {
+	obj, err := relationship.Object()
+	if err != nil {
+		return fmt.Errorf("%s should be an object", path)
+	}
+
+	data := obj.Get("data")
+	if data == nil && obj.Get("links") == nil && obj.Get("meta") == nil {
+		return fmt.Errorf("%s should contain at least one of links, data and meta", path)
+	}
+
+	if data == nil || data.Type() == fastjson.TypeNull {
+		return nil
+	}
+
+	identifiers := []*fastjson.Value{data}
+	if data.Type() == fastjson.TypeArray {
+		identifiers = data.GetArray()
+	}
+
+	for i, identifier := range identifiers {
+		identifierObj, err := identifier.Object()
+		if err != nil {
+			return fmt.Errorf("%s.data should contain the resource identifiers", path)
+		}
+		if err := checkJSONAPIIdentity(identifierObj, fmt.Sprintf("%s.data[%d]", path, i), true); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// halBodyDecoder decodes the HAL document and checks the links and the embedded resources.
+// The properties of the resources are validated by the schema of the operation
+func halBodyDecoder(body io.Reader, header http.Header, schema *openapi3.SchemaRef, encFn EncodingFn, jsonParser *fastjson.Parser) (interface{}, error) {
+	value, err := jsonBodyDecoder(body, header, schema, encFn, jsonParser)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkHALResource(value.(*fastjson.Value), "resource"); err != nil {
+		return nil, &ParseError{Kind: KindInvalidFormat, Reason: "HAL document: " + err.Error()}
+	}
+
+	return value, nil
+}
+
+func checkHALResource(resource *fastjson.Value, path string) error {
+	obj, err := resource.Object()
+	if err != nil {
+		return fmt.Errorf("%s should be an object", path)
+	}
+
+	if links := obj.Get("_links"); links != nil {
+		linksObj, err := links.Object()
+		if err != nil {
+			return fmt.Errorf("%s._links should be an object", path)
+		}
+
+		var linkErr error
+		linksObj.Visit(func(key []byte, v *fastjson.Value) {
+			if linkErr != nil {
+				return
+			}
+			relation := fmt.Sprintf("%s._links.%s", path, key)
+			if v.Type() != fastjson.TypeArray {
+				linkErr = checkHALLink(v, relation)
+				return
+			}
+			for i, link := range v.GetArray() {
+				if linkErr = checkHALLink(link, fmt.Sprintf("%s[%d]", relation, i)); linkErr != nil {
+					return
+				}
+			}
+		})
+		if linkErr != nil {
+			return linkErr
+		}
+	}
+
+	if embedded := obj.Get("_embedded"); embedded != nil {
+		embeddedObj, err := embedded.Object()
+		if err != nil {
+			return fmt.Errorf("%s._embedded should be an object", path)
+		}
+
+		var resourceErr error
+		embeddedObj.Visit(func(key []byte, v *fastjson.Value) {
+			if resourceErr != nil {
+				return
+			}
+			relation := fmt.Sprintf("%s._embedded.%s", path, key)
+			if v.Type() != fastjson.TypeArray {
+				resourceErr = checkHALResource(v, relation)
+				return
+			}
+			for i, item := range v.GetArray() {
+				if resourceErr = checkHALResource(item, fmt.Sprintf("%s[%d]", relation, i)); resourceErr != nil {
+					return
+				}
+			}
+		})
+		if resourceErr != nil {
+			return resourceErr
+		}
+	}
+
+	return nil
+}
+
+// checkHALLink checks that the link object contains href and the properties of the expected types
+func checkHALLink(link *fastjson.Value, path string) error {
+	obj, err := link.Object()
+	if err != nil {
+		return fmt.Errorf("%s should be a link object", path)
+	}
+
+	if href := obj.Get("href"); href == nil || href.Type() != fastjson.TypeString {
+		return fmt.Errorf("%s.href should be a string", path)
+	}
+
+	if templated := obj.Get("templated"); templated != nil && templated.Type() != fastjson.TypeTrue && templated.Type() != fastjson.TypeFalse {
+		return fmt.Errorf("%s.templated should be a boolean", path)
+	}
+
+	for _, name := range []string{"type", "deprecation", "name", "profile", "title", "hreflang"} {
+		if v := obj.Get(name); v != nil && v.Type() != fastjson.TypeString {
+			return fmt.Errorf("%s.%s should be a string", path, name)
+		}
+	}
+
+	return nil
+}
@@ -1,9 +1,11 @@
 package validator
 
 import (
+	"fmt"
 	"github.com/valyala/fastjson"
 	"reflect"
 	"strings"
+	"time"
 )
 
 func parseMediaType(contentType string) string {
@@ -43,7 +45,59 @@ func convertToMap(v *fastjson.Value) interface{} {
 		return string(v.GetStringBytes())
 	case fastjson.TypeTrue, fastjson.TypeFalse:
 		return v.GetBool()
+	case fastjson.TypeNumber:
+		return convertNumber(v)
 	default:
 		return nil
 	}
 }
+
+// genericValue converts the decoded value to the types used by the schema validation:
+// map[string]interface{}, []interface{}, string, float64, bool and nil
+func genericValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = genericValue(value)
+		}
+		return v
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = genericValue(value)
+		}
+		return m
+	case []interface{}:
+		for i, value := range v {
+			v[i] = genericValue(value)
+		}
+		return v
+	case []byte:
+		return string(v)
+	case int:
+		return float64(v)
+	case int8:
+		return float64(v)
+	case int16:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint:
+		return float64(v)
+	case uint8:
+		return float64(v)
+	case uint16:
+		return float64(v)
+	case uint32:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	return v
+}
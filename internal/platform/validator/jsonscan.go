@@ -0,0 +1,298 @@
+package validator
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// jsonPrefilter enables the structural scan of the JSON bodies before the parsing
+var jsonPrefilter bool
+
+// PrefilterStats are the numbers of the JSON bodies scanned by the pre-filter and of the bodies rejected
+// by the pre-filter without the parsing
+type PrefilterStats struct {
+	Scanned  int64 `json:"scanned"`
+	Rejected int64 `json:"rejected"`
+}
+
+var prefilterTotals PrefilterStats
+
+// PrefilterTotals returns the numbers of the JSON bodies checked by the pre-filter
+func PrefilterTotals() PrefilterStats {
+	return PrefilterStats{
+		Scanned:  atomic.LoadInt64(&prefilterTotals.Scanned),
+		Rejected: atomic.LoadInt64(&prefilterTotals.Rejected),
+	}
+}
+
+// SetJSONPrefilter enables the single pass scan of the JSON bodies which checks the structural limits
+// and the duplicate keys without building the parsed value. The bodies exceeding the limits or with the
+// broken structure are rejected before they are parsed and the parsed values are not walked again.
+// This call is not thread-safe: it should be called before the validation of requests.
+func SetJSONPrefilter(enabled bool) {
+	jsonPrefilter = enabled
+}
+
+// scanFrame is the object or the array opened in the scanned JSON
+type scanFrame struct {
+	object bool
+	items  int
+	keys   map[string]struct{}
+}
+
+// jsonScanner checks the limits of the JSON document in one pass over the bytes
+type jsonScanner struct {
+	data  []byte
+	pos   int
+	stack []scanFrame
+	keys  int
+}
+
+// scanJSON returns ParseError if the JSON document exceeds the limits, has the duplicate key or the broken structure.
+// The literals are not checked: the document passed the scan is checked by the parser
+func scanJSON(data []byte) error {
+	atomic.AddInt64(&prefilterTotals.Scanned, 1)
+
+	s := jsonScanner{data: data}
+	if reason := s.scan(); reason != "" {
+		atomic.AddInt64(&prefilterTotals.Rejected, 1)
+		return &ParseError{Kind: KindInvalidFormat, Reason: reason}
+	}
+
+	return nil
+}
+
+func (s *jsonScanner) skipSpace() {
+	for s.pos < len(s.data) {
+		switch s.data[s.pos] {
+		case ' ', '\t', '\n', '\r':
+			s.pos++
+		default:
+			return
+		}
+	}
+}
+
+// scan returns the reason of the rejection or the empty string
+func (s *jsonScanner) scan() string {
+	for {
+		// the value is expected
+		s.skipSpace()
+		if s.pos >= len(s.data) {
+			return "unexpected end of JSON"
+		}
+
+		switch c := s.data[s.pos]; c {
+		case '{', '[':
+			if jsonLimits.maxDepth > 0 && len(s.stack)+1 > jsonLimits.maxDepth {
+				return fmt.Sprintf("JSON nesting depth exceeds %d", jsonLimits.maxDepth)
+			}
+			s.stack = append(s.stack, scanFrame{object: c == '{'})
+			s.pos++
+
+			s.skipSpace()
+			if s.pos < len(s.data) && (c == '{' && s.data[s.pos] == '}' || c == '[' && s.data[s.pos] == ']') {
+				s.stack = s.stack[:len(s.stack)-1]
+				s.pos++
+				break
+			}
+
+			if reason := s.member(); reason != "" {
+				return reason
+			}
+			continue
+		case '"':
+			length, _, reason := s.scanString()
+			if reason != "" {
+				return reason
+			}
+			if jsonLimits.maxStringLength > 0 && length > jsonLimits.maxStringLength {
+				return fmt.Sprintf("JSON string length exceeds %d", jsonLimits.maxStringLength)
+			}
+		default:
+			start := s.pos
+			for s.pos < len(s.data) && isLiteralByte(s.data[s.pos]) {
+				s.pos++
+			}
+			if s.pos == start {
+				return fmt.Sprintf("unexpected character %q in JSON at offset %d", c, s.pos)
+			}
+		}
+
+		// the value is completed: the next member or the end of the container is expected
+		for {
+			s.skipSpace()
+			if len(s.stack) == 0 {
+				if s.pos != len(s.data) {
+					return fmt.Sprintf("unexpected data after JSON value at offset %d", s.pos)
+				}
+				return ""
+			}
+			if s.pos >= len(s.data) {
+				return "unexpected end of JSON"
+			}
+
+			top := &s.stack[len(s.stack)-1]
+			c := s.data[s.pos]
+			if c == ',' {
+				s.pos++
+				if reason := s.member(); reason != "" {
+					return reason
+				}
+				break
+			}
+			if top.object && c == '}' || !top.object && c == ']' {
+				s.stack = s.stack[:len(s.stack)-1]
+				s.pos++
+				continue
+			}
+			return fmt.Sprintf("unexpected character %q in JSON at offset %d", c, s.pos)
+		}
+	}
+}
+
+// member counts the item of the array or scans the key of the object and the colon after it
+func (s *jsonScanner) member() string {
+	top := &s.stack[len(s.stack)-1]
+
+	if !top.object {
+		top.items++
+		if jsonLimits.maxArrayLength > 0 && top.items > jsonLimits.maxArrayLength {
+			return fmt.Sprintf("JSON array length exceeds %d", jsonLimits.maxArrayLength)
+		}
+		return ""
+	}
+
+	s.skipSpace()
+	if s.pos >= len(s.data) || s.data[s.pos] != '"' {
+		return fmt.Sprintf("object key is expected in JSON at offset %d", s.pos)
+	}
+
+	start := s.pos
+	length, escaped, reason := s.scanString()
+	if reason != "" {
+		return reason
+	}
+
+	s.keys++
+	if jsonLimits.maxKeys > 0 && s.keys > jsonLimits.maxKeys {
+		return fmt.Sprintf("JSON keys number exceeds %d", jsonLimits.maxKeys)
+	}
+	if jsonLimits.maxStringLength > 0 && length > jsonLimits.maxStringLength {
+		return fmt.Sprintf("JSON string length exceeds %d", jsonLimits.maxStringLength)
+	}
+
+	if jsonLimits.rejectDuplicateKeys {
+		key := string(s.data[start+1 : s.pos-1])
+		// the escaped keys are compared unescaped
+		if escaped {
+			if err := json.Unmarshal(s.data[start:s.pos], &key); err != nil {
+				return fmt.Sprintf("invalid object key in JSON at offset %d", start)
+			}
+		}
+		if top.keys == nil {
+			top.keys = make(map[string]struct{})
+		}
+		if _, ok := top.keys[key]; ok {
+			return fmt.Sprintf("JSON object has the duplicate key %q", key)
+		}
+		top.keys[key] = struct{}{}
+	}
+
+	s.skipSpace()
+	if s.pos >= len(s.data) || s.data[s.pos] != ':' {
+		return fmt.Sprintf("colon is expected in JSON at offset %d", s.pos)
+	}
+	s.pos++
+
+	return ""
+}
+
+// scanString skips the string at the position and returns the length of the unescaped string and true
+// if the string contains the escape sequences. The invalid escape sequences are counted as is
+func (s *jsonScanner) scanString() (int, bool, string) {
+	start := s.pos
+	length := 0
+	escaped := false
+
+	for i := s.pos + 1; i < len(s.data); {
+		switch c := s.data[i]; c {
+		case '"':
+			s.pos = i + 1
+			return length, escaped, ""
+		case '\\':
+			escaped = true
+			if i+1 >= len(s.data) {
+				i++
+				continue
+			}
+			switch s.data[i+1] {
+			case '"', '\\', '/', 'b', 'f', 'n', 'r', 't':
+				length++
+				i += 2
+			case 'u':
+				r, ok := hexRune(s.data, i+2)
+				if !ok {
+					length += 2
+					i += 2
+					break
+				}
+				i += 6
+				if r >= 0xD800 && r < 0xDC00 {
+					if i+1 < len(s.data) && s.data[i] == '\\' && s.data[i+1] == 'u' {
+						if low, ok := hexRune(s.data, i+2); ok && low >= 0xDC00 && low < 0xE000 {
+							length += 4
+							i += 6
+							break
+						}
+					}
+					length += 6
+					break
+				}
+				if r >= 0xDC00 && r < 0xE000 {
+					length += 6
+					break
+				}
+				length += utf8.RuneLen(r)
+			default:
+				length += 2
+				i += 2
+			}
+		default:
+			length++
+			i++
+		}
+	}
+
+	return 0, false, fmt.Sprintf("unterminated string in JSON at offset %d", start)
+}
+
+// hexRune returns the code point of the 4 hex digits at the position
+func hexRune(data []byte, pos int) (rune, bool) {
+	if pos+4 > len(data) {
+		return 0, false
+	}
+
+	var r rune
+	for _, c := range data[pos : pos+4] {
+		switch {
+		case c >= '0' && c <= '9':
+			r = r<<4 | rune(c-'0')
+		case c >= 'a' && c <= 'f':
+			r = r<<4 | rune(c-'a'+10)
+		case c >= 'A' && c <= 'F':
+			r = r<<4 | rune(c-'A'+10)
+		default:
+			return 0, false
+		}
+	}
+
+	return r, true
+}
+
+// isLiteralByte returns true for the bytes of the numbers and the true, false and null literals
+func isLiteralByte(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c == '-' || c == '+' || c == '.' || c == 'E'
+}
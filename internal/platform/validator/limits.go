@@ -0,0 +1,217 @@
+package validator
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/valyala/fastjson"
+)
+
+const (
+	defaultMaxBodySize  = 10 * 1024 * 1024
+	defaultMaxBodyDepth = 64
+
+	// minMaxBodyDepth is the min nesting depth supported by the CBOR decoder
+	minMaxBodyDepth = 4
+)
+
+// decoderLimits contains the limits of the YAML, CBOR and MessagePack bodies
+var decoderLimits = struct {
+	maxSize  int64
+	maxDepth int
+}{
+	maxSize:  defaultMaxBodySize,
+	maxDepth: defaultMaxBodyDepth,
+}
+
+// SetDecoderLimits sets the max size in bytes and the max nesting depth of the YAML, CBOR and MessagePack bodies.
+// This call is not thread-safe: it should be called before the validation of requests.
+func SetDecoderLimits(maxSize int64, maxDepth int) error {
+	if maxSize <= 0 {
+		return fmt.Errorf("invalid max body size: %d", maxSize)
+	}
+	if maxDepth < minMaxBodyDepth {
+		return fmt.Errorf("invalid max body depth: %d (min %d)", maxDepth, minMaxBodyDepth)
+	}
+
+	decoderLimits.maxSize = maxSize
+	decoderLimits.maxDepth = maxDepth
+	return nil
+}
+
+// jsonLimits contains the structural limits of the JSON bodies. Zero value disables the limit
+var jsonLimits struct {
+	maxDepth        int
+	maxKeys         int
+	maxArrayLength  int
+	maxStringLength int
+
+	rejectDuplicateKeys bool
+}
+
+// SetJSONLimits sets the max nesting depth, the max total number of object keys, the max array length
+// and the max string length of the JSON bodies. Zero value disables the limit.
+// This call is not thread-safe: it should be called before the validation of requests.
+func SetJSONLimits(maxDepth, maxKeys, maxArrayLength, maxStringLength int) error {
+	for name, value := range map[string]int{
+		"depth":         maxDepth,
+		"keys":          maxKeys,
+		"array length":  maxArrayLength,
+		"string length": maxStringLength,
+	} {
+		if value < 0 {
+			return fmt.Errorf("invalid max JSON %s: %d", name, value)
+		}
+	}
+
+	jsonLimits.maxDepth = maxDepth
+	jsonLimits.maxKeys = maxKeys
+	jsonLimits.maxArrayLength = maxArrayLength
+	jsonLimits.maxStringLength = maxStringLength
+	return nil
+}
+
+// SetRejectDuplicateKeys enables the rejection of the JSON bodies with the duplicate keys in an object.
+// The backends may pick the other value of the duplicate key than the validated one.
+// This call is not thread-safe: it should be called before the validation of requests.
+func SetRejectDuplicateKeys(reject bool) {
+	jsonLimits.rejectDuplicateKeys = reject
+}
+
+// checkJSONLimits walks the parsed JSON value and returns ParseError as soon as any limit is exceeded
+// or the duplicate key is found
+func checkJSONLimits(v *fastjson.Value) error {
+	if jsonLimits.maxDepth == 0 && jsonLimits.maxKeys == 0 && jsonLimits.maxArrayLength == 0 && jsonLimits.maxStringLength == 0 &&
+		!jsonLimits.rejectDuplicateKeys {
+		return nil
+	}
+
+	keys := 0
+	var reason string
+
+	var walk func(v *fastjson.Value, depth int)
+	walk = func(v *fastjson.Value, depth int) {
+		if reason != "" {
+			return
+		}
+
+		switch v.Type() {
+		case fastjson.TypeObject, fastjson.TypeArray:
+			if jsonLimits.maxDepth > 0 && depth > jsonLimits.maxDepth {
+				reason = fmt.Sprintf("JSON nesting depth exceeds %d", jsonLimits.maxDepth)
+				return
+			}
+		}
+
+		switch v.Type() {
+		case fastjson.TypeObject:
+			obj, _ := v.Object()
+			keys += obj.Len()
+			if jsonLimits.maxKeys > 0 && keys > jsonLimits.maxKeys {
+				reason = fmt.Sprintf("JSON keys number exceeds %d", jsonLimits.maxKeys)
+				return
+			}
+			if jsonLimits.rejectDuplicateKeys {
+				if key, ok := duplicateKey(obj); ok {
+					reason = fmt.Sprintf("JSON object has the duplicate key %q", key)
+					return
+				}
+			}
+			obj.Visit(func(key []byte, value *fastjson.Value) {
+				if jsonLimits.maxStringLength > 0 && len(key) > jsonLimits.maxStringLength && reason == "" {
+					reason = fmt.Sprintf("JSON string length exceeds %d", jsonLimits.maxStringLength)
+				}
+				walk(value, depth+1)
+			})
+		case fastjson.TypeArray:
+			items, _ := v.Array()
+			if jsonLimits.maxArrayLength > 0 && len(items) > jsonLimits.maxArrayLength {
+				reason = fmt.Sprintf("JSON array length exceeds %d", jsonLimits.maxArrayLength)
+				return
+			}
+			for _, item := range items {
+				walk(item, depth+1)
+			}
+		case fastjson.TypeString:
+			if jsonLimits.maxStringLength > 0 && len(v.GetStringBytes()) > jsonLimits.maxStringLength {
+				reason = fmt.Sprintf("JSON string length exceeds %d", jsonLimits.maxStringLength)
+			}
+		}
+	}
+
+	walk(v, 1)
+
+	if reason != "" {
+		return &ParseError{Kind: KindInvalidFormat, Reason: reason}
+	}
+	return nil
+}
+
+// duplicateKey returns the first key found twice in the object
+func duplicateKey(obj *fastjson.Object) (string, bool) {
+	if obj.Len() < 2 {
+		return "", false
+	}
+
+	var duplicate string
+	var found bool
+	keys := make(map[string]struct{}, obj.Len())
+	obj.Visit(func(key []byte, _ *fastjson.Value) {
+		if found {
+			return
+		}
+		if _, ok := keys[string(key)]; ok {
+			duplicate, found = string(key), true
+			return
+		}
+		keys[string(key)] = struct{}{}
+	})
+
+	return duplicate, found
+}
+
+// readLimitedBody reads the body and returns ParseError if the body size exceeds the limit
+func readLimitedBody(body io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(body, decoderLimits.maxSize+1))
+	if err != nil {
+		return nil, &ParseError{Kind: KindInvalidFormat, Cause: err}
+	}
+
+	if int64(len(data)) > decoderLimits.maxSize {
+		return nil, &ParseError{Kind: KindInvalidFormat, Reason: fmt.Sprintf("body size exceeds %d bytes", decoderLimits.maxSize)}
+	}
+
+	return data, nil
+}
+
+// valueDepth returns the nesting depth of the decoded value. The walk stops
+// as soon as the depth exceeds the limit
+func valueDepth(v interface{}, depth int) int {
+	if depth > decoderLimits.maxDepth {
+		return depth
+	}
+
+	maxDepth := depth
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, value := range v {
+			if d := valueDepth(value, depth+1); d > maxDepth {
+				maxDepth = d
+			}
+		}
+	case map[interface{}]interface{}:
+		for _, value := range v {
+			if d := valueDepth(value, depth+1); d > maxDepth {
+				maxDepth = d
+			}
+		}
+	case []interface{}:
+		for _, value := range v {
+			if d := valueDepth(value, depth+1); d > maxDepth {
+				maxDepth = d
+			}
+		}
+	}
+
+	return maxDepth
+}
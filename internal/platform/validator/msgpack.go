@@ -0,0 +1,121 @@
+package validator
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// msgpackDepth checks the nesting depth of the first MessagePack value of the data without decoding it,
+// so the recursive decoder doesn't overflow the stack on the deeply nested body. The scan keeps the number
+// of the remaining items of each open array and map
+func msgpackDepth(data []byte, maxDepth int) error {
+	remaining := make([]uint64, 0, 8)
+
+	for pos := 0; ; {
+		if pos >= len(data) {
+			return &ParseError{Kind: KindInvalidFormat, Reason: "unexpected end of MessagePack data"}
+		}
+
+		if len(remaining) > 0 {
+			remaining[len(remaining)-1]--
+		}
+
+		b := data[pos]
+		pos++
+
+		// the items of the containers and the length of the scalars
+		var items uint64
+		var size int
+		switch {
+		case b <= 0x7f || b >= 0xe0 || b == 0xc0 || b == 0xc2 || b == 0xc3:
+		case b&0xf0 == 0x80:
+			items = uint64(b&0x0f) * 2
+		case b&0xf0 == 0x90:
+			items = uint64(b & 0x0f)
+		case b&0xe0 == 0xa0:
+			size = int(b & 0x1f)
+		default:
+			n, width, ok := msgpackHeader(b)
+			if !ok {
+				return &ParseError{Kind: KindInvalidFormat, Reason: fmt.Sprintf("invalid MessagePack type 0x%02x", b)}
+			}
+			if width > 0 {
+				if pos+width > len(data) {
+					return &ParseError{Kind: KindInvalidFormat, Reason: "unexpected end of MessagePack data"}
+				}
+				n = msgpackUint(data[pos : pos+width])
+				pos += width
+			}
+
+			switch b {
+			case 0xdc, 0xdd:
+				items = n
+			case 0xde, 0xdf:
+				items = n * 2
+			case 0xc7, 0xc8, 0xc9:
+				// the extension type follows the length
+				n++
+				fallthrough
+			default:
+				if n > uint64(len(data)-pos) {
+					return &ParseError{Kind: KindInvalidFormat, Reason: "unexpected end of MessagePack data"}
+				}
+				size = int(n)
+			}
+		}
+
+		if pos+size > len(data) {
+			return &ParseError{Kind: KindInvalidFormat, Reason: "unexpected end of MessagePack data"}
+		}
+		pos += size
+
+		if items > 0 {
+			remaining = append(remaining, items)
+			if len(remaining) > maxDepth {
+				return &ParseError{Kind: KindInvalidFormat, Reason: fmt.Sprintf("nesting depth exceeds %d levels", maxDepth)}
+			}
+		}
+
+		for len(remaining) > 0 && remaining[len(remaining)-1] == 0 {
+			remaining = remaining[:len(remaining)-1]
+		}
+		if len(remaining) == 0 {
+			return nil
+		}
+	}
+}
+
+// msgpackHeader returns the fixed length of the type or the width of its length field
+func msgpackHeader(b byte) (n uint64, width int, ok bool) {
+	switch b {
+	case 0xcc, 0xd0:
+		return 1, 0, true
+	case 0xcd, 0xd1:
+		return 2, 0, true
+	case 0xca, 0xce, 0xd2:
+		return 4, 0, true
+	case 0xcb, 0xcf, 0xd3:
+		return 8, 0, true
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		// the fixext type and 1, 2, 4, 8 or 16 bytes of the data
+		return 1 + 1<<(b-0xd4), 0, true
+	case 0xc4, 0xc7, 0xd9:
+		return 0, 1, true
+	case 0xc5, 0xc8, 0xda, 0xdc, 0xde:
+		return 0, 2, true
+	case 0xc6, 0xc9, 0xdb, 0xdd, 0xdf:
+		return 0, 4, true
+	}
+	return 0, 0, false
+}
+
+func msgpackUint(b []byte) uint64 {
+	switch len(b) {
+	case 1:
+		return uint64(b[0])
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b))
+	default:
+		return uint64(binary.BigEndian.Uint32(b))
+	}
+}
@@ -0,0 +1,146 @@
+package validator
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+
+	"github.com/valyala/fastjson"
+)
+
+const (
+	// BigIntegersFloat converts the big integers to float64 like the other numbers
+	BigIntegersFloat = "FLOAT"
+	// BigIntegersString validates the big integers as the strings of the literal digits
+	BigIntegersString = "STRING"
+	// BigIntegersReject rejects the bodies with the big integers
+	BigIntegersReject = "REJECT"
+
+	// maxSafeInteger is the max integer represented by float64 exactly along with its neighbours
+	maxSafeInteger = 1<<53 - 1
+)
+
+// jsonNumbers contains the options of the decoding of the JSON numbers
+var jsonNumbers = struct {
+	bigIntegers         string
+	rejectPrecisionLoss bool
+}{
+	bigIntegers: BigIntegersFloat,
+}
+
+// SetJSONNumbers sets the handling of the integers out of the safe range (±(2^53-1)) and enables the rejection
+// of the numbers which can't be converted to float64 without the loss of precision.
+// This call is not thread-safe: it should be called before the validation of requests.
+func SetJSONNumbers(bigIntegers string, rejectPrecisionLoss bool) error {
+	switch bigIntegers {
+	case BigIntegersFloat, BigIntegersString, BigIntegersReject:
+	default:
+		return fmt.Errorf("invalid big integers mode: %q", bigIntegers)
+	}
+
+	jsonNumbers.bigIntegers = bigIntegers
+	jsonNumbers.rejectPrecisionLoss = rejectPrecisionLoss
+	return nil
+}
+
+// checkJSONNumbers walks the parsed JSON value and returns ParseError for the first number rejected by the options
+func checkJSONNumbers(v *fastjson.Value) error {
+	if jsonNumbers.bigIntegers != BigIntegersReject && !jsonNumbers.rejectPrecisionLoss {
+		return nil
+	}
+
+	var reason string
+
+	var walk func(v *fastjson.Value)
+	walk = func(v *fastjson.Value) {
+		if reason != "" {
+			return
+		}
+
+		switch v.Type() {
+		case fastjson.TypeObject:
+			v.GetObject().Visit(func(key []byte, value *fastjson.Value) {
+				walk(value)
+			})
+		case fastjson.TypeArray:
+			for _, item := range v.GetArray() {
+				walk(item)
+			}
+		case fastjson.TypeNumber:
+			literal := v.String()
+			if jsonNumbers.bigIntegers == BigIntegersReject && isBigInteger(literal) {
+				reason = fmt.Sprintf("JSON integer %s exceeds the safe range", literal)
+				return
+			}
+			if jsonNumbers.rejectPrecisionLoss && losesPrecision(literal, v.GetFloat64()) {
+				reason = fmt.Sprintf("JSON number %s can't be represented without the loss of precision", literal)
+			}
+		}
+	}
+
+	walk(v)
+
+	if reason != "" {
+		return &ParseError{Kind: KindInvalidFormat, Reason: reason}
+	}
+	return nil
+}
+
+// convertNumber returns the float64 value of the number or the literal of the big integer in the STRING mode
+func convertNumber(v *fastjson.Value) interface{} {
+	if jsonNumbers.bigIntegers == BigIntegersString {
+		if literal := v.String(); isBigInteger(literal) {
+			return literal
+		}
+	}
+	return v.GetFloat64()
+}
+
+// isBigInteger returns true if the literal is the integer out of the safe range
+func isBigInteger(literal string) bool {
+	for i := 0; i < len(literal); i++ {
+		switch literal[i] {
+		case '.', 'e', 'E':
+			return false
+		}
+	}
+
+	n, err := strconv.ParseInt(literal, 10, 64)
+	if err != nil {
+		// the integer overflows int64
+		return true
+	}
+
+	return n > maxSafeInteger || n < -maxSafeInteger
+}
+
+// losesPrecision returns true if the decimal value of the literal differs from the value of the float
+func losesPrecision(literal string, f float64) bool {
+	if math.IsInf(f, 0) {
+		return true
+	}
+
+	// the underflow to zero is checked without the exact value, as the exponent of the literal may be huge
+	if f == 0 {
+		for i := 0; i < len(literal) && literal[i] != 'e' && literal[i] != 'E'; i++ {
+			if literal[i] >= '1' && literal[i] <= '9' {
+				return true
+			}
+		}
+		return false
+	}
+
+	shortest := strconv.FormatFloat(f, 'g', -1, 64)
+	if shortest == literal {
+		return false
+	}
+
+	exact, ok := new(big.Rat).SetString(literal)
+	if !ok {
+		return true
+	}
+	converted, _ := new(big.Rat).SetString(shortest)
+
+	return exact.Cmp(converted) != 0
+}
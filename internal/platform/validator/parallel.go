@@ -0,0 +1,73 @@
+package validator
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// parallelValidation contains the budget of the goroutines validating the request bodies concurrently
+// with the security requirements and the parameters. The nil workers disable the parallel validation
+var parallelValidation struct {
+	workers     chan struct{}
+	minBodySize int64
+}
+
+// ParallelStats are the numbers of the request bodies validated concurrently with the parameters and
+// of the large bodies validated sequentially because all workers were busy
+type ParallelStats struct {
+	Parallel  int64 `json:"parallel"`
+	Exhausted int64 `json:"exhausted"`
+}
+
+var parallelTotals ParallelStats
+
+// ParallelTotals returns the numbers of the parallel validations
+func ParallelTotals() ParallelStats {
+	return ParallelStats{
+		Parallel:  atomic.LoadInt64(&parallelTotals.Parallel),
+		Exhausted: atomic.LoadInt64(&parallelTotals.Exhausted),
+	}
+}
+
+// SetParallelValidation enables the validation of the request bodies of minBodySize bytes or larger in the separate
+// goroutines concurrently with the parameters once the security requirements are met. The number of the simultaneous goroutines
+// is limited by the workers. The bodies are validated sequentially if all workers are busy. Zero workers disable the
+// parallel validation.
+// This call is not thread-safe: it should be called before the validation of requests.
+func SetParallelValidation(workers int, minBodySize int64) error {
+	if workers < 0 {
+		return fmt.Errorf("invalid number of parallel validation workers: %d", workers)
+	}
+	if minBodySize < 0 {
+		return fmt.Errorf("invalid min body size of parallel validation: %d", minBodySize)
+	}
+
+	parallelValidation.workers = nil
+	if workers > 0 {
+		parallelValidation.workers = make(chan struct{}, workers)
+	}
+	parallelValidation.minBodySize = minBodySize
+
+	return nil
+}
+
+// acquireWorker returns true if the body of the size should be validated in the separate goroutine and the worker
+// is available. The acquired worker should be released by releaseWorker after the body is validated
+func acquireWorker(size int64) bool {
+	if parallelValidation.workers == nil || size < parallelValidation.minBodySize {
+		return false
+	}
+
+	select {
+	case parallelValidation.workers <- struct{}{}:
+		atomic.AddInt64(&parallelTotals.Parallel, 1)
+		return true
+	default:
+		atomic.AddInt64(&parallelTotals.Exhausted, 1)
+		return false
+	}
+}
+
+func releaseWorker() {
+	<-parallelValidation.workers
+}
@@ -0,0 +1,25 @@
+package validator
+
+import (
+	"strings"
+)
+
+// IsPassthrough returns true if the content type matches one of the media ranges like application/octet-stream
+// or video/*. The bodies of such responses are proxied as is, as the schema validation of the binary data is meaningless
+func IsPassthrough(contentType string, mediaRanges []string) bool {
+	if contentType == "" || len(mediaRanges) == 0 {
+		return false
+	}
+
+	mediaType := strings.TrimSpace(parseMediaType(strings.ToLower(contentType)))
+	for _, mediaRange := range mediaRanges {
+		if mediaRange = strings.ToLower(strings.TrimSpace(mediaRange)); mediaRange == "" {
+			continue
+		}
+		if mediaTypeMatches(mediaRange, mediaType) {
+			return true
+		}
+	}
+
+	return false
+}
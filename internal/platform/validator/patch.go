@@ -0,0 +1,146 @@
+package validator
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/valyala/fastjson"
+)
+
+const (
+	mediaTypeJSONPatch  = "application/json-patch+json"
+	mediaTypeMergePatch = "application/merge-patch+json"
+)
+
+// jsonPatchValueOps are the JSON Patch (RFC 6902) operations with the value member
+var jsonPatchValueOps = map[string]bool{
+	"add":     true,
+	"replace": true,
+	"test":    true,
+	"remove":  false,
+	"move":    false,
+	"copy":    false,
+}
+
+// jsonPatchBodyDecoder decodes the JSON Patch document and checks that it is the array of the operations
+// with the members required by the operation types
+func jsonPatchBodyDecoder(body io.Reader, header http.Header, schema *openapi3.SchemaRef, encFn EncodingFn, jsonParser *fastjson.Parser) (interface{}, error) {
+	value, err := jsonBodyDecoder(body, header, schema, encFn, jsonParser)
+	if err != nil {
+		return nil, err
+	}
+
+	operations, err := value.(*fastjson.Value).Array()
+	if err != nil {
+		return nil, &ParseError{Kind: KindInvalidFormat, Reason: "JSON Patch document should be an array"}
+	}
+
+	for i, operation := range operations {
+		if operation.Type() != fastjson.TypeObject {
+			return nil, &ParseError{Kind: KindInvalidFormat, Reason: fmt.Sprintf("JSON Patch operation %d should be an object", i)}
+		}
+
+		op := string(operation.GetStringBytes("op"))
+		withValue, ok := jsonPatchValueOps[op]
+		if !ok {
+			return nil, &ParseError{Kind: KindInvalidFormat, Reason: fmt.Sprintf("JSON Patch operation %d: unknown op %q", i, op)}
+		}
+
+		if !isJSONPointer(operation.Get("path")) {
+			return nil, &ParseError{Kind: KindInvalidFormat, Reason: fmt.Sprintf("JSON Patch operation %d: path should be a JSON pointer", i)}
+		}
+
+		if withValue && operation.Get("value") == nil {
+			return nil, &ParseError{Kind: KindInvalidFormat, Reason: fmt.Sprintf("JSON Patch operation %d: %s requires value", i, op)}
+		}
+
+		if (op == "move" || op == "copy") && !isJSONPointer(operation.Get("from")) {
+			return nil, &ParseError{Kind: KindInvalidFormat, Reason: fmt.Sprintf("JSON Patch operation %d: from should be a JSON pointer", i)}
+		}
+	}
+
+	return value, nil
+}
+
+// isJSONPointer returns true if the value is the JSON pointer string
+func isJSONPointer(value *fastjson.Value) bool {
+	if value == nil || value.Type() != fastjson.TypeString {
+		return false
+	}
+	pointer := string(value.GetStringBytes())
+	return pointer == "" || strings.HasPrefix(pointer, "/")
+}
+
+// mergePatchSchemas caches the schemas of the JSON Merge Patch documents by the target schemas
+var mergePatchSchemas sync.Map
+
+// mergePatchSchema returns the schema of the JSON Merge Patch (RFC 7396) document of the target schema.
+// All properties are optional, nullable (null removes the property) and have no defaults
+func mergePatchSchema(target *openapi3.Schema) *openapi3.Schema {
+	if schema, ok := mergePatchSchemas.Load(target); ok {
+		return schema.(*openapi3.Schema)
+	}
+
+	schema := relaxSchema(target, make(map[*openapi3.Schema]*openapi3.Schema))
+	mergePatchSchemas.Store(target, schema)
+
+	return schema
+}
+
+func relaxSchema(target *openapi3.Schema, visited map[*openapi3.Schema]*openapi3.Schema) *openapi3.Schema {
+	if target == nil {
+		return nil
+	}
+	if schema, ok := visited[target]; ok {
+		return schema
+	}
+
+	schema := *target
+	visited[target] = &schema
+
+	// the arrays are replaced as a whole, so the items keep the target schema
+	if schema.Type != openapi3.TypeArray {
+		schema.Required = nil
+		schema.MinProps = 0
+	}
+	schema.Nullable = true
+	schema.Default = nil
+
+	relaxRef := func(ref *openapi3.SchemaRef) *openapi3.SchemaRef {
+		if ref == nil || ref.Value == nil || schema.Type == openapi3.TypeArray {
+			return ref
+		}
+		return &openapi3.SchemaRef{Value: relaxSchema(ref.Value, visited)}
+	}
+
+	if len(target.Properties) > 0 {
+		schema.Properties = make(openapi3.Schemas, len(target.Properties))
+		for name, property := range target.Properties {
+			schema.Properties[name] = relaxRef(property)
+		}
+	}
+	if target.AdditionalProperties != nil {
+		schema.AdditionalProperties = relaxRef(target.AdditionalProperties)
+	}
+
+	relaxRefs := func(refs openapi3.SchemaRefs) openapi3.SchemaRefs {
+		if len(refs) == 0 {
+			return refs
+		}
+		relaxed := make(openapi3.SchemaRefs, len(refs))
+		for i, ref := range refs {
+			relaxed[i] = relaxRef(ref)
+		}
+		return relaxed
+	}
+
+	schema.AllOf = relaxRefs(target.AllOf)
+	schema.AnyOf = relaxRefs(target.AnyOf)
+	schema.OneOf = relaxRefs(target.OneOf)
+
+	return &schema
+}
@@ -0,0 +1,230 @@
+package validator
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/valyala/fastjson"
+	"github.com/wallarm/api-firewall/internal/platform/router"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// xProtobufMessage is the schema extension which contains the full name of the protobuf message
+const xProtobufMessage = "x-protobuf-message"
+
+// protoFiles contains the protobuf messages descriptors used to decode the protobuf bodies
+var protoFiles *protoregistry.Files
+
+// LoadProtobufDescriptors loads the protobuf descriptors from the FileDescriptorSet file
+// (protoc --include_imports --descriptor_set_out=<file>).
+// This call is not thread-safe: it should be called before the validation of requests.
+func LoadProtobufDescriptors(fileName string) error {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+
+	var descriptorSet descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &descriptorSet); err != nil {
+		return err
+	}
+
+	files, err := protodesc.NewFiles(&descriptorSet)
+	if err != nil {
+		return err
+	}
+
+	protoFiles = files
+	return nil
+}
+
+// protobufBodyDecoder decodes the protobuf message. The message type is defined by the
+// x-protobuf-message schema extension or by the messageType parameter of the Content-Type header
+func protobufBodyDecoder(body io.Reader, header http.Header, schema *openapi3.SchemaRef, encFn EncodingFn, jsonParser *fastjson.Parser) (interface{}, error) {
+	if protoFiles == nil {
+		return nil, &ParseError{Kind: KindUnsupportedFormat, Reason: "protobuf descriptors are not loaded"}
+	}
+
+	var messageType string
+	if schema != nil && schema.Value != nil {
+		if _, err := router.GetExtension(schema.Value.Extensions, xProtobufMessage, &messageType); err != nil {
+			return nil, &ParseError{Kind: KindOther, Cause: err}
+		}
+	}
+
+	if messageType == "" {
+		if _, params, err := mime.ParseMediaType(header.Get(headerCT)); err == nil {
+			messageType = params["messagetype"]
+		}
+	}
+
+	if messageType == "" {
+		return nil, &ParseError{Kind: KindOther, Reason: "protobuf message type is not defined"}
+	}
+
+	desc, err := protoFiles.FindDescriptorByName(protoreflect.FullName(messageType))
+	if err != nil {
+		return nil, &ParseError{Kind: KindOther, Reason: fmt.Sprintf("protobuf message type %q", messageType), Cause: err}
+	}
+
+	messageDesc, ok := desc.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, &ParseError{Kind: KindOther, Reason: fmt.Sprintf("%q is not a protobuf message type", messageType)}
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, &ParseError{Kind: KindInvalidFormat, Cause: err}
+	}
+
+	message := dynamicpb.NewMessage(messageDesc)
+	if err := proto.Unmarshal(data, message); err != nil {
+		return nil, &ParseError{Kind: KindInvalidFormat, Cause: err}
+	}
+
+	return protoMessageValue(message), nil
+}
+
+// protoMessageValue converts the protobuf message to the generic value. Fields
+// without presence are set to the default values
+func protoMessageValue(message protoreflect.Message) map[string]interface{} {
+	obj := make(map[string]interface{})
+
+	fields := message.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		if field.HasPresence() && !message.Has(field) {
+			continue
+		}
+
+		value := message.Get(field)
+
+		switch {
+		case field.IsList():
+			list := value.List()
+			items := make([]interface{}, 0, list.Len())
+			for j := 0; j < list.Len(); j++ {
+				items = append(items, protoScalarValue(field, list.Get(j)))
+			}
+			obj[string(field.Name())] = items
+		case field.IsMap():
+			entries := make(map[string]interface{})
+			value.Map().Range(func(key protoreflect.MapKey, v protoreflect.Value) bool {
+				entries[key.String()] = protoScalarValue(field.MapValue(), v)
+				return true
+			})
+			obj[string(field.Name())] = entries
+		default:
+			obj[string(field.Name())] = protoScalarValue(field, value)
+		}
+	}
+
+	return obj
+}
+
+func protoScalarValue(field protoreflect.FieldDescriptor, value protoreflect.Value) interface{} {
+	switch field.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return protoMessageValue(value.Message())
+	case protoreflect.EnumKind:
+		if enumValue := field.Enum().Values().ByNumber(value.Enum()); enumValue != nil {
+			return string(enumValue.Name())
+		}
+		return float64(value.Enum())
+	case protoreflect.BoolKind:
+		return value.Bool()
+	case protoreflect.StringKind:
+		return value.String()
+	case protoreflect.BytesKind:
+		return base64.StdEncoding.EncodeToString(value.Bytes())
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return float64(value.Int())
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind, protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return float64(value.Uint())
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return value.Float()
+	}
+	return nil
+}
+
+// ProtobufMethods returns the methods of the services of the loaded protobuf descriptors
+func ProtobufMethods() []protoreflect.MethodDescriptor {
+	if protoFiles == nil {
+		return nil
+	}
+
+	var methods []protoreflect.MethodDescriptor
+	protoFiles.RangeFiles(func(file protoreflect.FileDescriptor) bool {
+		services := file.Services()
+		for i := 0; i < services.Len(); i++ {
+			serviceMethods := services.Get(i).Methods()
+			for j := 0; j < serviceMethods.Len(); j++ {
+				methods = append(methods, serviceMethods.Get(j))
+			}
+		}
+		return true
+	})
+
+	return methods
+}
+
+// ValidateProtobufMessage decodes the message by the descriptor. The unknown fields are not allowed,
+// as the fields with the wire types different from the descriptor are decoded as the unknown fields
+func ValidateProtobufMessage(desc protoreflect.MessageDescriptor, data []byte) error {
+	message := dynamicpb.NewMessage(desc)
+	if err := proto.Unmarshal(data, message); err != nil {
+		return &ParseError{Kind: KindInvalidFormat, Cause: err}
+	}
+
+	if name := unknownFields(message); name != "" {
+		return &ParseError{Kind: KindInvalidFormat, Reason: fmt.Sprintf("protobuf message %s contains unknown fields", name)}
+	}
+
+	return nil
+}
+
+// unknownFields returns the full name of the first message containing the unknown fields
+func unknownFields(message protoreflect.Message) protoreflect.FullName {
+	if len(message.GetUnknown()) > 0 {
+		return message.Descriptor().FullName()
+	}
+
+	var name protoreflect.FullName
+	message.Range(func(field protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		if field.Kind() != protoreflect.MessageKind && field.Kind() != protoreflect.GroupKind {
+			return true
+		}
+
+		switch {
+		case field.IsList():
+			list := value.List()
+			for i := 0; i < list.Len() && name == ""; i++ {
+				name = unknownFields(list.Get(i).Message())
+			}
+		case field.IsMap():
+			if field.MapValue().Kind() == protoreflect.MessageKind {
+				value.Map().Range(func(key protoreflect.MapKey, v protoreflect.Value) bool {
+					name = unknownFields(v.Message())
+					return name == ""
+				})
+			}
+		default:
+			name = unknownFields(value.Message())
+		}
+
+		return name == ""
+	})
+
+	return name
+}
@@ -7,7 +7,6 @@ import (
 	"github.com/getkin/kin-openapi/openapi3filter"
 	"github.com/valyala/fastjson"
 	"io"
-	"io/ioutil"
 	"mime"
 	"mime/multipart"
 	"net/http"
@@ -16,6 +15,8 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
 	"gopkg.in/yaml.v3"
 
 	"github.com/getkin/kin-openapi/openapi3"
@@ -503,14 +504,9 @@ func (d *urlValuesDecoder) DecodeArray(param string, sm *openapi3.SerializationM
 		return nil, ok, nil
 	}
 	if !sm.Explode {
-		var delim string
-		switch sm.Style {
-		case "form":
-			delim = ","
-		case "spaceDelimited":
-			delim = " "
-		case "pipeDelimited":
-			delim = "|"
+		delim, err := queryDelimiter(sm)
+		if err != nil {
+			return nil, ok, err
 		}
 		values = strings.Split(values[0], delim)
 	}
@@ -518,9 +514,39 @@ func (d *urlValuesDecoder) DecodeArray(param string, sm *openapi3.SerializationM
 	return val, ok, err
 }
 
+// queryDelimiter returns the delimiter of the array items and the object properties
+// for the query parameter serialized without explode
+func queryDelimiter(sm *openapi3.SerializationMethod) (string, error) {
+	switch sm.Style {
+	case "form":
+		return ",", nil
+	case "spaceDelimited":
+		return " ", nil
+	case "pipeDelimited":
+		return "|", nil
+	}
+	return "", invalidSerializationMethodErr(sm)
+}
+
 func (d *urlValuesDecoder) DecodeObject(param string, sm *openapi3.SerializationMethod, schema *openapi3.SchemaRef) (map[string]interface{}, bool, error) {
 	var propsFn func(url.Values) (map[string]string, error)
 	switch sm.Style {
+	case "spaceDelimited", "pipeDelimited":
+		if sm.Explode {
+			return nil, false, invalidSerializationMethodErr(sm)
+		}
+		propsFn = func(params url.Values) (map[string]string, error) {
+			values := params[param]
+			if len(values) == 0 {
+				// HTTP request does not contain a value of the target query parameter.
+				return nil, nil
+			}
+			delim, err := queryDelimiter(sm)
+			if err != nil {
+				return nil, err
+			}
+			return propsFromString(values[0], delim, delim)
+		}
 	case "form":
 		propsFn = func(params url.Values) (map[string]string, error) {
 			if len(params) == 0 {
@@ -544,8 +570,9 @@ func (d *urlValuesDecoder) DecodeObject(param string, sm *openapi3.Serialization
 	case "deepObject":
 		propsFn = func(params url.Values) (map[string]string, error) {
 			props := make(map[string]string)
+			deepObjectKey := regexp.MustCompile(fmt.Sprintf("^%s\\[(.+?)\\]$", regexp.QuoteMeta(param)))
 			for key, values := range params {
-				groups := regexp.MustCompile(fmt.Sprintf("%s\\[(.+?)\\]", param)).FindAllStringSubmatch(key, -1)
+				groups := deepObjectKey.FindAllStringSubmatch(key, -1)
 				if len(groups) == 0 {
 					// A query parameter's name does not match the required format, so skip it.
 					continue
@@ -613,7 +640,8 @@ func (d *headerParamDecoder) DecodeArray(param string, sm *openapi3.Serializatio
 		return nil, ok, nil
 	}
 
-	val, err := parseArray(strings.Split(raw[0], ","), schema)
+	// the list can be sent in the several header lines
+	val, err := parseArray(splitTrim(strings.Join(raw, ","), ","), schema)
 	return val, ok, err
 }
 
@@ -631,7 +659,7 @@ func (d *headerParamDecoder) DecodeObject(param string, sm *openapi3.Serializati
 		// HTTP request does not contain a corresponding header.
 		return nil, ok, nil
 	}
-	props, err := propsFromString(raw[0], ",", valueDelim)
+	props, err := propsFromString(strings.Join(splitTrim(strings.Join(raw, ","), ","), ","), ",", valueDelim)
 	if err != nil {
 		return nil, ok, err
 	}
@@ -663,8 +691,10 @@ func (d *cookieParamDecoder) DecodePrimitive(param string, sm *openapi3.Serializ
 	return val, found, err
 }
 
+// Cookie can't be repeated, so arrays and objects are always serialized as the comma-separated
+// list regardless of explode (which is true by default for the form style)
 func (d *cookieParamDecoder) DecodeArray(param string, sm *openapi3.SerializationMethod, schema *openapi3.SchemaRef) ([]interface{}, bool, error) {
-	if sm.Style != "form" || sm.Explode {
+	if sm.Style != "form" {
 		return nil, false, invalidSerializationMethodErr(sm)
 	}
 
@@ -682,7 +712,7 @@ func (d *cookieParamDecoder) DecodeArray(param string, sm *openapi3.Serializatio
 }
 
 func (d *cookieParamDecoder) DecodeObject(param string, sm *openapi3.SerializationMethod, schema *openapi3.SchemaRef) (map[string]interface{}, bool, error) {
-	if sm.Style != "form" || sm.Explode {
+	if sm.Style != "form" {
 		return nil, false, invalidSerializationMethodErr(sm)
 	}
 
@@ -747,21 +777,49 @@ func propsFromString(src, propDelim, valueDelim string) (map[string]string, erro
 // makeObject returns an object that contains properties from props.
 // A value of every property is parsed as a primitive value.
 // The function returns an error when an error happened while parse object's properties.
+// Properties which are not present in props are omitted, so the required properties are checked by the schema.
 func makeObject(props map[string]string, schema *openapi3.SchemaRef) (map[string]interface{}, error) {
 	obj := make(map[string]interface{})
 	for propName, propSchema := range schema.Value.Properties {
-		value, err := parsePrimitive(props[propName], propSchema)
+		raw, ok := props[propName]
+		if !ok {
+			continue
+		}
+
+		var value interface{}
+		var err error
+
+		switch propSchema.Value.Type {
+		case "array":
+			value, err = parseArray(strings.Split(raw, ","), propSchema)
+		case "object":
+			err = &ParseError{Kind: KindUnsupportedFormat, Value: raw, Reason: "nested objects are not supported"}
+		default:
+			value, err = parsePrimitive(raw, propSchema)
+		}
+
 		if err != nil {
 			if v, ok := err.(*ParseError); ok {
 				return nil, &ParseError{path: []interface{}{propName}, Cause: v}
 			}
 			return nil, fmt.Errorf("property %q: %s", propName, err)
 		}
-		obj[propName] = value
+		if value != nil {
+			obj[propName] = value
+		}
 	}
 	return obj, nil
 }
 
+// splitTrim splits the list and trims the optional whitespaces around the items
+func splitTrim(src, delim string) []string {
+	items := strings.Split(src, delim)
+	for i := range items {
+		items[i] = strings.TrimSpace(items[i])
+	}
+	return items
+}
+
 // parseArray returns an array that contains items from a raw array.
 // Every item is parsed as a primitive value.
 // The function returns an error when an error happened while parse array's items.
@@ -883,6 +941,13 @@ func decodeBody(body io.Reader, header http.Header, schema *openapi3.SchemaRef,
 	}
 	mediaType := parseMediaType(contentType)
 	decoder, ok := bodyDecoders[mediaType]
+	if !ok && contentTypeMatching == ContentTypeMatchingLenient {
+		// the media type with the structured syntax suffix is decoded by the decoder of the suffix
+		mediaType = normalizeMediaType(contentType)
+		if decoder, ok = bodyDecoders[mediaType]; !ok {
+			decoder, ok = bodyDecoders[suffixMediaType(mediaType)]
+		}
+	}
 	if !ok {
 		return "", nil, &ParseError{
 			Kind:   KindUnsupportedFormat,
@@ -901,43 +966,116 @@ func init() {
 	RegisterBodyDecoder("application/json", jsonBodyDecoder)
 	RegisterBodyDecoder("application/x-yaml", yamlBodyDecoder)
 	RegisterBodyDecoder("application/yaml", yamlBodyDecoder)
+	RegisterBodyDecoder("application/cbor", cborBodyDecoder)
 	RegisterBodyDecoder("application/problem+json", jsonBodyDecoder)
+	RegisterBodyDecoder(mediaTypeJSONPatch, jsonPatchBodyDecoder)
+	RegisterBodyDecoder(mediaTypeMergePatch, jsonBodyDecoder)
+	RegisterBodyDecoder(mediaTypeJSONAPI, jsonAPIBodyDecoder)
+	RegisterBodyDecoder(mediaTypeHAL, halBodyDecoder)
 	RegisterBodyDecoder("application/x-www-form-urlencoded", urlencodedBodyDecoder)
 	RegisterBodyDecoder("multipart/form-data", multipartBodyDecoder)
 	RegisterBodyDecoder("application/octet-stream", FileBodyDecoder)
+	RegisterBodyDecoder("application/msgpack", msgpackBodyDecoder)
+	RegisterBodyDecoder("application/x-msgpack", msgpackBodyDecoder)
+	RegisterBodyDecoder("application/protobuf", protobufBodyDecoder)
+	RegisterBodyDecoder("application/x-protobuf", protobufBodyDecoder)
 }
 
 func plainBodyDecoder(body io.Reader, header http.Header, schema *openapi3.SchemaRef, encFn EncodingFn, jsonParser *fastjson.Parser) (interface{}, error) {
-	data, err := ioutil.ReadAll(body)
+	data, release, err := readAll(body)
 	if err != nil {
 		return nil, &ParseError{Kind: KindInvalidFormat, Cause: err}
 	}
+	defer release()
 	return string(data), nil
 }
 
 func jsonBodyDecoder(body io.Reader, header http.Header, schema *openapi3.SchemaRef, encFn EncodingFn, jsonParser *fastjson.Parser) (interface{}, error) {
-	var data []byte
-	var err error
-
-	data, err = io.ReadAll(body)
+	// the parser copies the data, so the buffer is released after parsing
+	data, release, err := readAll(body)
 	if err != nil {
 		return nil, &ParseError{Kind: KindInvalidFormat, Cause: err}
 	}
+	defer release()
+
+	// the pre-filter rejects the body exceeding the limits before it's parsed
+	if jsonPrefilter {
+		if err := scanJSON(data); err != nil {
+			return nil, err
+		}
+	}
 
 	parsedDoc, err := jsonParser.ParseBytes(data)
 	if err != nil {
 		return nil, &ParseError{Kind: KindInvalidFormat, Cause: err}
 	}
 
+	if !jsonPrefilter {
+		if err := checkJSONLimits(parsedDoc); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := checkJSONNumbers(parsedDoc); err != nil {
+		return nil, err
+	}
+
 	return parsedDoc, nil
 }
 
 func yamlBodyDecoder(body io.Reader, header http.Header, schema *openapi3.SchemaRef, encFn EncodingFn, jsonParser *fastjson.Parser) (interface{}, error) {
+	data, err := readLimitedBody(body)
+	if err != nil {
+		return nil, err
+	}
+
 	var value interface{}
-	if err := yaml.NewDecoder(body).Decode(&value); err != nil {
+	if err := yaml.Unmarshal(data, &value); err != nil {
 		return nil, &ParseError{Kind: KindInvalidFormat, Cause: err}
 	}
-	return value, nil
+
+	if valueDepth(value, 0) > decoderLimits.maxDepth {
+		return nil, &ParseError{Kind: KindInvalidFormat, Reason: fmt.Sprintf("nesting depth exceeds %d levels", decoderLimits.maxDepth)}
+	}
+
+	return genericValue(value), nil
+}
+
+func cborBodyDecoder(body io.Reader, header http.Header, schema *openapi3.SchemaRef, encFn EncodingFn, jsonParser *fastjson.Parser) (interface{}, error) {
+	data, err := readLimitedBody(body)
+	if err != nil {
+		return nil, err
+	}
+
+	decMode, err := cbor.DecOptions{MaxNestedLevels: decoderLimits.maxDepth}.DecMode()
+	if err != nil {
+		return nil, &ParseError{Kind: KindOther, Cause: err}
+	}
+
+	var value interface{}
+	if err := decMode.Unmarshal(data, &value); err != nil {
+		return nil, &ParseError{Kind: KindInvalidFormat, Cause: err}
+	}
+
+	return genericValue(value), nil
+}
+
+func msgpackBodyDecoder(body io.Reader, header http.Header, schema *openapi3.SchemaRef, encFn EncodingFn, jsonParser *fastjson.Parser) (interface{}, error) {
+	data, err := readLimitedBody(body)
+	if err != nil {
+		return nil, err
+	}
+
+	// the depth is checked before the decoding: the decoder recurses into the nested values
+	if err := msgpackDepth(data, decoderLimits.maxDepth); err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	if err := msgpack.Unmarshal(data, &value); err != nil {
+		return nil, &ParseError{Kind: KindInvalidFormat, Cause: err}
+	}
+	return genericValue(value), nil
 }
 
 func urlencodedBodyDecoder(body io.Reader, header http.Header, schema *openapi3.SchemaRef, encFn EncodingFn, jsonParser *fastjson.Parser) (interface{}, error) {
@@ -960,11 +1098,12 @@ func urlencodedBodyDecoder(body io.Reader, header http.Header, schema *openapi3.
 	}
 
 	// Parse form.
-	b, err := ioutil.ReadAll(body)
+	b, release, err := readAll(body)
 	if err != nil {
 		return nil, err
 	}
 	values, err := url.ParseQuery(string(b))
+	release()
 	if err != nil {
 		return nil, err
 	}
@@ -1088,9 +1227,10 @@ func multipartBodyDecoder(body io.Reader, header http.Header, schema *openapi3.S
 
 // FileBodyDecoder is a body decoder that decodes a file body to a string.
 func FileBodyDecoder(body io.Reader, header http.Header, schema *openapi3.SchemaRef, encFn EncodingFn, jsonParser *fastjson.Parser) (interface{}, error) {
-	data, err := ioutil.ReadAll(body)
+	data, release, err := readAll(body)
 	if err != nil {
 		return nil, err
 	}
+	defer release()
 	return string(data), nil
 }
@@ -7,6 +7,9 @@ import (
 
 func encodeBody(body interface{}, mediaType string) ([]byte, error) {
 	encoder, ok := bodyEncoders[mediaType]
+	if !ok && contentTypeMatching == ContentTypeMatchingLenient {
+		encoder, ok = bodyEncoders[suffixMediaType(mediaType)]
+	}
 	if !ok {
 		return nil, &ParseError{
 			Kind:   KindUnsupportedFormat,
@@ -0,0 +1,37 @@
+package validator
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/getkin/kin-openapi/openapi3filter"
+)
+
+// ErrStatusNotDocumented is returned when the status code of the response is not documented for the operation
+var ErrStatusNotDocumented = errors.New("response status code is not documented")
+
+// ValidateResponseStatus checks that the status code of the response is documented for the operation
+// exactly, by the range (2XX) or by the default response.
+//
+// The function returns ResponseError with ErrStatusNotDocumented cause.
+func ValidateResponseStatus(input *openapi3filter.ResponseValidationInput) error {
+	route := input.RequestValidationInput.Route
+	if route == nil || route.Operation == nil {
+		return nil
+	}
+
+	responses := route.Operation.Responses
+	if responses.Get(input.Status) != nil || responses.Default() != nil {
+		return nil
+	}
+	if _, ok := responses[strconv.Itoa(input.Status/100)+"XX"]; ok {
+		return nil
+	}
+
+	return &openapi3filter.ResponseError{
+		Input:  input,
+		Reason: fmt.Sprintf("%s: %d", ErrStatusNotDocumented, input.Status),
+		Err:    ErrStatusNotDocumented,
+	}
+}
@@ -20,37 +20,99 @@ const prefixInvalidCT = "header Content-Type has unexpected value"
 // Note: One can tune the behavior of uniqueItems: true verification
 // by registering a custom function with openapi3.RegisterArrayUniqueItemsChecker
 func ValidateRequest(ctx context.Context, input *openapi3filter.RequestValidationInput, jsonParser *fastjson.Parser) error {
-	var (
-		err error
-		me  openapi3.MultiError
-	)
-
 	options := input.Options
 	if options == nil {
 		options = openapi3filter.DefaultOptions
 	}
+
+	requestBody := input.Route.Operation.RequestBody
+	validateBody := requestBody != nil && !options.ExcludeRequestBody
+
+	// the security requirements are checked first, so the body of the unauthenticated request isn't validated
+	me, err := validateSecurityRequirements(ctx, input, options)
+	if err != nil {
+		return err
+	}
+
+	// the large body of the authenticated request is validated concurrently with the parameters if a worker is available
+	var bodyResult chan error
+	if validateBody && len(me) == 0 && acquireWorker(input.Request.ContentLength) {
+		bodyResult = make(chan error, 1)
+		go func() {
+			err := ValidateRequestBody(ctx, input, requestBody.Value, jsonParser)
+			// the worker is released before the result is received, so the budget is not exceeded by the next request
+			releaseWorker()
+			bodyResult <- err
+		}()
+	}
+
+	parametersErrs, err := validateRequestParameters(ctx, input, options)
+	me = append(me, parametersErrs...)
+
+	var bodyErr error
+	switch {
+	case bodyResult != nil:
+		// the goroutine reads the request, so it is awaited even if the parameters are invalid
+		bodyErr = <-bodyResult
+	case validateBody && err == nil:
+		bodyErr = ValidateRequestBody(ctx, input, requestBody.Value, jsonParser)
+	}
+
+	// the errors of the parameters are returned first as in the sequential validation
+	if err != nil {
+		return err
+	}
+
+	if bodyErr != nil {
+		if !options.MultiError {
+			return bodyErr
+		}
+		me = append(me, bodyErr)
+	}
+
+	if len(me) > 0 {
+		return me
+	}
+
+	return nil
+}
+
+// validateSecurityRequirements validates the security requirements of the request. It returns
+// the error if the multiple errors are not enabled by the options or the collected error otherwise
+func validateSecurityRequirements(ctx context.Context, input *openapi3filter.RequestValidationInput, options *openapi3filter.Options) (openapi3.MultiError, error) {
 	route := input.Route
-	operation := route.Operation
-	operationParameters := operation.Parameters
-	pathItemParameters := route.PathItem.Parameters
 
 	// Security
-	security := operation.Security
+	security := route.Operation.Security
 	// If there aren't any security requirements for the operation
 	if security == nil {
 		// Use the global security requirements.
 		security = &route.Spec.Security
 	}
-	if security != nil {
-		if err = openapi3filter.ValidateSecurityRequirements(ctx, input, *security); err != nil && !options.MultiError {
-			return err
-		}
 
-		if err != nil {
-			me = append(me, err)
+	if err := openapi3filter.ValidateSecurityRequirements(ctx, input, *security); err != nil {
+		if !options.MultiError {
+			return nil, err
 		}
+		return openapi3.MultiError{err}, nil
 	}
 
+	return nil, nil
+}
+
+// validateRequestParameters validates the parameters of the request. It returns the first
+// error if the multiple errors are not enabled by the options or the collected errors otherwise
+func validateRequestParameters(ctx context.Context, input *openapi3filter.RequestValidationInput, options *openapi3filter.Options) (openapi3.MultiError, error) {
+	var (
+		err error
+		me  openapi3.MultiError
+	)
+
+	route := input.Route
+	operation := route.Operation
+	operationParameters := operation.Parameters
+	pathItemParameters := route.PathItem.Parameters
+
 	// For each parameter of the PathItem
 	for _, parameterRef := range pathItemParameters {
 		parameter := parameterRef.Value
@@ -60,8 +122,8 @@ func ValidateRequest(ctx context.Context, input *openapi3filter.RequestValidatio
 			}
 		}
 
-		if err = openapi3filter.ValidateParameter(ctx, input, parameter); err != nil && !options.MultiError {
-			return err
+		if err = ValidateParameter(ctx, input, parameter); err != nil && !options.MultiError {
+			return nil, err
 		}
 
 		if err != nil {
@@ -71,8 +133,8 @@ func ValidateRequest(ctx context.Context, input *openapi3filter.RequestValidatio
 
 	// For each parameter of the Operation
 	for _, parameter := range operationParameters {
-		if err = openapi3filter.ValidateParameter(ctx, input, parameter.Value); err != nil && !options.MultiError {
-			return err
+		if err = ValidateParameter(ctx, input, parameter.Value); err != nil && !options.MultiError {
+			return nil, err
 		}
 
 		if err != nil {
@@ -80,22 +142,69 @@ func ValidateRequest(ctx context.Context, input *openapi3filter.RequestValidatio
 		}
 	}
 
-	// RequestBody
-	requestBody := operation.RequestBody
-	if requestBody != nil && !options.ExcludeRequestBody {
-		if err = ValidateRequestBody(ctx, input, requestBody.Value, jsonParser); err != nil && !options.MultiError {
-			return err
-		}
+	return me, nil
+}
 
-		if err != nil {
-			me = append(me, err)
+// ValidateParameter validates a parameter's value by JSON schema.
+// The parameter value is decoded according to its style and explode settings.
+//
+// The function returns RequestError with a ParseError cause when unable to parse a value.
+// The function returns RequestError with ErrInvalidRequired cause when a value of a required parameter is not defined.
+// The function returns RequestError with ErrInvalidEmptyValue cause when an empty value is not allowed.
+// The function returns RequestError with a openapi3.SchemaError cause when a value is invalid by JSON schema.
+func ValidateParameter(ctx context.Context, input *openapi3filter.RequestValidationInput, parameter *openapi3.Parameter) error {
+	if parameter.Schema == nil && parameter.Content == nil {
+		// We have no schema for the parameter. Assume that everything passes
+		// a schema-less check, but this could also be an error. The OpenAPI
+		// validation allows this to happen.
+		return nil
+	}
+
+	options := input.Options
+	if options == nil {
+		options = openapi3filter.DefaultOptions
+	}
+
+	var value interface{}
+	var err error
+	var found bool
+	var schema *openapi3.Schema
+
+	// Validation will ensure that we either have content or schema.
+	if parameter.Content != nil {
+		if value, schema, found, err = decodeContentParameter(parameter, input); err != nil {
+			return &openapi3filter.RequestError{Input: input, Parameter: parameter, Err: err}
 		}
+	} else {
+		if value, found, err = decodeStyledParameter(parameter, input); err != nil {
+			return &openapi3filter.RequestError{Input: input, Parameter: parameter, Err: err}
+		}
+		schema = parameter.Schema.Value
 	}
 
-	if len(me) > 0 {
-		return me
+	// Validate a parameter's value and presence.
+	if parameter.Required && !found {
+		return &openapi3filter.RequestError{Input: input, Parameter: parameter, Reason: openapi3filter.ErrInvalidRequired.Error(), Err: openapi3filter.ErrInvalidRequired}
+	}
+
+	if isNilValue(value) {
+		if !parameter.AllowEmptyValue && found {
+			return &openapi3filter.RequestError{Input: input, Parameter: parameter, Reason: openapi3filter.ErrInvalidEmptyValue.Error(), Err: openapi3filter.ErrInvalidEmptyValue}
+		}
+		return nil
+	}
+	if schema == nil {
+		// A parameter's schema is not defined so skip validation of a parameter's value.
+		return nil
 	}
 
+	var opts []openapi3.SchemaValidationOption
+	if options.MultiError {
+		opts = append(opts, openapi3.MultiErrors())
+	}
+	if err = schema.VisitJSON(value, opts...); err != nil {
+		return &openapi3filter.RequestError{Input: input, Parameter: parameter, Err: err}
+	}
 	return nil
 }
 
@@ -116,8 +225,8 @@ func ValidateRequestBody(ctx context.Context, input *openapi3filter.RequestValid
 
 	if req.Body != http.NoBody && req.Body != nil {
 		defer req.Body.Close()
-		var err error
-		if data, err = io.ReadAll(req.Body); err != nil {
+		body, err := readBody(req.Body)
+		if err != nil {
 			return &openapi3filter.RequestError{
 				Input:       input,
 				RequestBody: requestBody,
@@ -125,8 +234,9 @@ func ValidateRequestBody(ctx context.Context, input *openapi3filter.RequestValid
 				Err:         err,
 			}
 		}
-		// Put the data back into the input
-		req.Body = io.NopCloser(bytes.NewReader(data))
+		data = body.Bytes()
+		// Put the data back into the input. The buffer is reused after the body is closed
+		req.Body = body
 	}
 
 	if len(data) == 0 {
@@ -143,7 +253,7 @@ func ValidateRequestBody(ctx context.Context, input *openapi3filter.RequestValid
 	}
 
 	inputMIME := req.Header.Get(headerCT)
-	contentType := requestBody.Content.Get(inputMIME)
+	contentType := MatchContent(requestBody.Content, inputMIME)
 	if contentType == nil {
 		return &openapi3filter.RequestError{
 			Input:       input,
@@ -158,7 +268,7 @@ func ValidateRequestBody(ctx context.Context, input *openapi3filter.RequestValid
 	}
 
 	encFn := func(name string) *openapi3.Encoding { return contentType.Encoding[name] }
-	mediaType, value, err := decodeBody(bytes.NewReader(data), req.Header, contentType.Schema, encFn, jsonParser)
+	mediaType, value, err := decodeBody(bytes.NewBuffer(data), req.Header, contentType.Schema, encFn, jsonParser)
 	if err != nil {
 		return &openapi3filter.RequestError{
 			Input:       input,
@@ -176,14 +286,23 @@ func ValidateRequestBody(ctx context.Context, input *openapi3filter.RequestValid
 		opts = append(opts, openapi3.MultiErrors())
 	}
 
-	// prepare map[string]interface{} structure for json validation
-	fastjsonValue, ok := value.(*fastjson.Value)
-	if ok {
+	// the merge patch is validated by the subset of the target schema
+	schema := contentType.Schema.Value
+	if mediaType == mediaTypeMergePatch {
+		schema = mergePatchSchema(schema)
+	}
+
+	// the valid JSON is validated without the conversion. The other values are converted to
+	// the map[string]interface{} structure to apply the defaults and to report the errors
+	if fastjsonValue, ok := value.(*fastjson.Value); ok {
+		if visitFastJSON(schema, fastjsonValue) {
+			return nil
+		}
 		value = convertToMap(fastjsonValue)
 	}
 
 	// Validate JSON with the schema
-	if err := contentType.Schema.Value.VisitJSON(value, opts...); err != nil {
+	if err := schema.VisitJSON(value, opts...); err != nil {
 		return &openapi3filter.RequestError{
 			Input:       input,
 			RequestBody: requestBody,
@@ -203,6 +322,7 @@ func ValidateRequestBody(ctx context.Context, input *openapi3filter.RequestValid
 			}
 		}
 		// Put the data back into the input
+		req.Body.Close()
 		req.Body = io.NopCloser(bytes.NewReader(data))
 	}
 
@@ -3,10 +3,11 @@ package validator
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"github.com/valyala/fastjson"
-	"io"
 	"net/http"
+	"sort"
 
 	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/getkin/kin-openapi/openapi3filter"
@@ -74,7 +75,7 @@ func ValidateResponse(ctx context.Context, input *openapi3filter.ResponseValidat
 	}
 
 	inputMIME := input.Header.Get(headerCT)
-	contentType := content.Get(inputMIME)
+	contentType := MatchContent(content, inputMIME)
 	if contentType == nil {
 		return &openapi3filter.ResponseError{
 			Input:  input,
@@ -82,6 +83,13 @@ func ValidateResponse(ctx context.Context, input *openapi3filter.ResponseValidat
 		}
 	}
 
+	if err := checkResponseCharset(content, contentType, inputMIME); err != nil {
+		return &openapi3filter.ResponseError{
+			Input:  input,
+			Reason: err.Error(),
+		}
+	}
+
 	if contentType.Schema == nil {
 		// An operation does not contains a validation schema for responses with this status code.
 		return nil
@@ -99,7 +107,7 @@ func ValidateResponse(ctx context.Context, input *openapi3filter.ResponseValidat
 	defer body.Close()
 
 	// Read all
-	data, err := io.ReadAll(body)
+	pooled, err := readBody(body)
 	if err != nil {
 		return &openapi3filter.ResponseError{
 			Input:  input,
@@ -107,9 +115,19 @@ func ValidateResponse(ctx context.Context, input *openapi3filter.ResponseValidat
 			Err:    err,
 		}
 	}
+	data := pooled.Bytes()
 
-	// Put the data back into the response.
-	input.SetBodyBytes(data)
+	// Put the data back into the response. The buffer is reused after the body is closed
+	input.Body = pooled
+
+	// the JSON of the legacy charsets is parsed after the transcoding to UTF-8
+	if data, err = decodeCharset(data, inputMIME); err != nil {
+		return &openapi3filter.ResponseError{
+			Input:  input,
+			Reason: "invalid response body encoding",
+			Err:    err,
+		}
+	}
 
 	encFn := func(name string) *openapi3.Encoding { return contentType.Encoding[name] }
 	_, value, err := decodeBody(bytes.NewBuffer(data), input.Header, contentType.Schema, encFn, jsonParser)
@@ -127,9 +145,12 @@ func ValidateResponse(ctx context.Context, input *openapi3filter.ResponseValidat
 		opts = append(opts, openapi3.MultiErrors())
 	}
 
-	// prepare map[string]interface{} structure for json validation
-	fastjsonValue, ok := value.(*fastjson.Value)
-	if ok {
+	// the valid JSON is validated without the conversion. The other values are converted to
+	// the map[string]interface{} structure to report the errors
+	if fastjsonValue, ok := value.(*fastjson.Value); ok {
+		if visitFastJSON(contentType.Schema.Value, fastjsonValue) {
+			return nil
+		}
 		value = convertToMap(fastjsonValue)
 	}
 
@@ -143,3 +164,66 @@ func ValidateResponse(ctx context.Context, input *openapi3filter.ResponseValidat
 	}
 	return nil
 }
+
+// ValidateResponseHeaders validates the headers of the response documented in the spec
+// for the status code of the response. The Content-Type header is ignored as required by the spec.
+//
+// The function returns ResponseError with ErrInvalidRequired cause when a required header is missing.
+// The function returns ResponseError with a ParseError or openapi3.SchemaError cause when a header value is invalid.
+func ValidateResponseHeaders(ctx context.Context, input *openapi3filter.ResponseValidationInput) error {
+	route := input.RequestValidationInput.Route
+	if route == nil || route.Operation == nil {
+		return nil
+	}
+
+	responseRef := route.Operation.Responses.Get(input.Status)
+	if responseRef == nil {
+		responseRef = route.Operation.Responses.Default()
+	}
+	if responseRef == nil || responseRef.Value == nil || len(responseRef.Value.Headers) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(responseRef.Value.Headers))
+	for name := range responseRef.Value.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// the response headers are decoded as the request header parameters
+	headersInput := &openapi3filter.RequestValidationInput{
+		Request: &http.Request{Header: input.Header},
+		Options: input.Options,
+	}
+
+	for _, name := range names {
+		headerRef := responseRef.Value.Headers[name]
+		if headerRef == nil || headerRef.Value == nil || http.CanonicalHeaderKey(name) == headerCT {
+			continue
+		}
+
+		param := headerRef.Value.Parameter
+		param.Name = name
+		param.In = openapi3.ParameterInHeader
+
+		if err := ValidateParameter(ctx, headersInput, &param); err != nil {
+			var requestError *openapi3filter.RequestError
+			if errors.As(err, &requestError) {
+				err = requestError.Err
+			}
+
+			reason := fmt.Sprintf("response header %s doesn't match the schema", name)
+			if errors.Is(err, openapi3filter.ErrInvalidRequired) {
+				reason = fmt.Sprintf("response header %s is missing", name)
+			}
+
+			return &openapi3filter.ResponseError{
+				Input:  input,
+				Reason: reason,
+				Err:    err,
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package validator
+
+import (
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/valyala/fastjson"
+)
+
+// visitFastJSON returns true if the parsed JSON value is valid by the schema. The objects and the arrays are
+// walked without the conversion to the maps and the slices, the scalars are validated by the schema. It returns
+// false if the value is invalid or the schema of the object or the array uses the keywords not supported by the
+// visitor (the enum, the set operations, the unique items and the defaults of the missing properties), so the
+// converted value is validated by the schema again to apply the defaults and to report the same errors.
+// The objects are visited as in the request: the missing read-only properties are not required
+func visitFastJSON(schema *openapi3.Schema, v *fastjson.Value) bool {
+	switch v.Type() {
+	case fastjson.TypeObject:
+		if schema.IsEmpty() {
+			return true
+		}
+		if !containerSupported(schema) || schema.Type != "" && schema.Type != openapi3.TypeObject {
+			return false
+		}
+		return visitFastJSONObject(schema, v.GetObject())
+	case fastjson.TypeArray:
+		if schema.IsEmpty() {
+			return true
+		}
+		if !containerSupported(schema) || schema.Type != "" && schema.Type != openapi3.TypeArray {
+			return false
+		}
+		return visitFastJSONArray(schema, v.GetArray())
+	}
+
+	// the scalar values are converted as in the conversion of the whole value
+	return schema.VisitJSON(convertToMap(v)) == nil
+}
+
+// containerSupported returns false if the schema of the object or the array uses the set operations
+func containerSupported(schema *openapi3.Schema) bool {
+	return len(schema.Enum) == 0 && schema.Not == nil && len(schema.OneOf) == 0 && len(schema.AnyOf) == 0 && len(schema.AllOf) == 0
+}
+
+func visitFastJSONObject(schema *openapi3.Schema, obj *fastjson.Object) bool {
+
+	// the defaults of the missing properties are set by the schema validation
+	for name, ref := range schema.Properties {
+		if ref.Value == nil {
+			return false
+		}
+		if ref.Value.Default != nil {
+			if value := obj.Get(name); value == nil || value.Type() == fastjson.TypeNull {
+				return false
+			}
+		}
+	}
+
+	// the duplicate keys are counted once as in the converted map
+	if schema.MinProps != 0 || schema.MaxProps != nil {
+		keys := make(map[string]struct{}, obj.Len())
+		obj.Visit(func(key []byte, _ *fastjson.Value) {
+			keys[string(key)] = struct{}{}
+		})
+		if uint64(len(keys)) < schema.MinProps || schema.MaxProps != nil && uint64(len(keys)) > *schema.MaxProps {
+			return false
+		}
+	}
+
+	var additionalProperties *openapi3.Schema
+	if ref := schema.AdditionalProperties; ref != nil {
+		additionalProperties = ref.Value
+	}
+	allowed := schema.AdditionalPropertiesAllowed
+
+	valid := true
+	obj.Visit(func(key []byte, value *fastjson.Value) {
+		if !valid {
+			return
+		}
+
+		if ref := schema.Properties[string(key)]; ref != nil {
+			valid = visitFastJSON(ref.Value, value)
+			return
+		}
+
+		switch {
+		case additionalProperties != nil:
+			valid = visitFastJSON(additionalProperties, value)
+		case allowed != nil && !*allowed:
+			valid = false
+		}
+	})
+	if !valid {
+		return false
+	}
+
+	for _, name := range schema.Required {
+		if obj.Get(name) == nil {
+			if ref := schema.Properties[name]; ref != nil && ref.Value.ReadOnly {
+				continue
+			}
+			return false
+		}
+	}
+
+	return true
+}
+
+func visitFastJSONArray(schema *openapi3.Schema, items []*fastjson.Value) bool {
+
+	// the unique items are compared by the checker of the converted values
+	if schema.UniqueItems {
+		return false
+	}
+
+	length := uint64(len(items))
+	if length < schema.MinItems || schema.MaxItems != nil && length > *schema.MaxItems {
+		return false
+	}
+
+	if ref := schema.Items; ref != nil {
+		if ref.Value == nil {
+			return false
+		}
+		for _, item := range items {
+			if !visitFastJSON(ref.Value, item) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,62 @@
+package verdict
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid verdict signature")
+	ErrExpiredSignature = errors.New("expired verdict signature")
+)
+
+// Sign returns the value of the verdict signature header: the timestamp, the request ID and the HMAC-SHA256
+// of them and the signed fields (method, request URI, verdict and validation status) keyed by the shared secret
+func Sign(secret []byte, timestamp time.Time, requestID string, fields ...string) string {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	return fmt.Sprintf("t=%s,id=%s,v1=%s", ts, requestID, mac(secret, ts, requestID, fields))
+}
+
+// Verify checks the verdict signature header value. The signature older than maxAge is rejected if maxAge is set
+func Verify(secret []byte, signature string, maxAge time.Duration, fields ...string) error {
+	var ts, requestID, sig string
+
+	for _, part := range strings.Split(signature, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			ts = value
+		case "id":
+			requestID = value
+		case "v1":
+			sig = value
+		}
+	}
+
+	timestamp, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || sig == "" {
+		return ErrInvalidSignature
+	}
+
+	if !hmac.Equal([]byte(sig), []byte(mac(secret, ts, requestID, fields))) {
+		return ErrInvalidSignature
+	}
+
+	if maxAge > 0 && time.Since(time.Unix(timestamp, 0)) > maxAge {
+		return ErrExpiredSignature
+	}
+
+	return nil
+}
+
+func mac(secret []byte, ts, requestID string, fields []string) string {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(ts + "\n" + requestID + "\n" + strings.Join(fields, "\n")))
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,115 @@
+package verdictcache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/karlseguin/ccache/v2"
+	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/config"
+)
+
+// Entry is the cached verdict of the request failed the validation
+type Entry struct {
+	Rule    string
+	Reason  string
+	Subject string
+	Error   string
+}
+
+// Stats are the numbers of the requests blocked by the cached verdicts (hits), of the validated
+// requests (misses) and of the cached verdicts
+type Stats struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+	Stored int64 `json:"stored"`
+}
+
+var totals Stats
+
+// Totals returns the numbers of the cache lookups of all operations
+func Totals() Stats {
+	return Stats{
+		Hits:   atomic.LoadInt64(&totals.Hits),
+		Misses: atomic.LoadInt64(&totals.Misses),
+		Stored: atomic.LoadInt64(&totals.Stored),
+	}
+}
+
+// Cache keeps the negative verdicts for the TTL keyed by the operation, the fingerprint of the validated
+// parts of the request (the method, the URI and the headers except the ignored ones) and the body hash
+type Cache struct {
+	cache  *ccache.Cache
+	ttl    time.Duration
+	ignore map[string]struct{}
+}
+
+// New creates the cache of the negative verdicts. It returns nil if the TTL is not set
+func New(cfg *config.VerdictCache) *Cache {
+	if cfg.TTL <= 0 {
+		return nil
+	}
+
+	ignore := make(map[string]struct{}, len(cfg.IgnoreHeaders))
+	for _, header := range cfg.IgnoreHeaders {
+		ignore[strings.ToLower(header)] = struct{}{}
+	}
+
+	return &Cache{
+		cache:  ccache.New(ccache.Configure().MaxSize(cfg.MaxEntries)),
+		ttl:    cfg.TTL,
+		ignore: ignore,
+	}
+}
+
+// Key returns the cache key of the request of the operation
+func (c *Cache) Key(ctx *fasthttp.RequestCtx, operation string) string {
+
+	var headers [][]byte
+	ctx.Request.Header.VisitAll(func(k, v []byte) {
+		name := bytes.ToLower(k)
+		if _, ok := c.ignore[string(name)]; ok {
+			return
+		}
+		header := append(name, ':')
+		headers = append(headers, append(header, v...))
+	})
+	sort.Slice(headers, func(i, j int) bool {
+		return bytes.Compare(headers[i], headers[j]) < 0
+	})
+
+	fingerprint := sha256.New()
+	fingerprint.Write(ctx.Method())
+	fingerprint.Write([]byte{0})
+	fingerprint.Write(ctx.RequestURI())
+	for _, header := range headers {
+		fingerprint.Write([]byte{0})
+		fingerprint.Write(header)
+	}
+
+	bodyHash := sha256.Sum256(ctx.Request.Body())
+
+	return operation + "|" + hex.EncodeToString(fingerprint.Sum(nil)) + "|" + hex.EncodeToString(bodyHash[:])
+}
+
+// Get returns the cached verdict of the key or nil if the verdict is not cached or expired
+func (c *Cache) Get(key string) *Entry {
+	if item := c.cache.Get(key); item != nil && !item.Expired() {
+		atomic.AddInt64(&totals.Hits, 1)
+		return item.Value().(*Entry)
+	}
+
+	atomic.AddInt64(&totals.Misses, 1)
+	return nil
+}
+
+// Set caches the verdict of the key for the TTL
+func (c *Cache) Set(key string, entry *Entry) {
+	c.cache.Set(key, entry, c.ttl)
+	atomic.AddInt64(&totals.Stored, 1)
+}
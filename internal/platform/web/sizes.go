@@ -0,0 +1,129 @@
+package web
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/valyala/fasthttp"
+)
+
+// sizeBuckets are the upper bounds of the body size buckets in bytes
+var sizeBuckets = []int64{0, 1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20, 16 << 20}
+
+// Bucket is the number of the bodies not larger than LE bytes. The last bucket is +Inf
+type Bucket struct {
+	LE    string `json:"le"`
+	Count int64  `json:"count"`
+}
+
+// SizeHistogram is the distribution of the body sizes. The buckets are cumulative
+type SizeHistogram struct {
+	Count   int64    `json:"count"`
+	Sum     int64    `json:"sum"`
+	Max     int64    `json:"max"`
+	Buckets []Bucket `json:"buckets"`
+}
+
+// OperationSizes are the distributions of the request and the response body sizes of the operation
+type OperationSizes struct {
+	Request  SizeHistogram `json:"request"`
+	Response SizeHistogram `json:"response"`
+}
+
+type operationCounts struct {
+	request  sizeCounts
+	response sizeCounts
+}
+
+type sizeCounts struct {
+	count   int64
+	sum     int64
+	max     int64
+	buckets []int64
+}
+
+func (c *sizeCounts) add(size int64) {
+	c.count++
+	c.sum += size
+	if size > c.max {
+		c.max = size
+	}
+
+	i := 0
+	for i < len(sizeBuckets) && size > sizeBuckets[i] {
+		i++
+	}
+	c.buckets[i]++
+}
+
+func (c *sizeCounts) histogram() SizeHistogram {
+	h := SizeHistogram{
+		Count:   c.count,
+		Sum:     c.sum,
+		Max:     c.max,
+		Buckets: make([]Bucket, 0, len(c.buckets)),
+	}
+
+	var cumulative int64
+	for i, count := range c.buckets {
+		cumulative += count
+		le := "+Inf"
+		if i < len(sizeBuckets) {
+			le = strconv.FormatInt(sizeBuckets[i], 10)
+		}
+		h.Buckets = append(h.Buckets, Bucket{LE: le, Count: cumulative})
+	}
+
+	return h
+}
+
+// BodySizeReport collects the body sizes of the requests and the responses by operation
+type BodySizeReport struct {
+	mu         sync.Mutex
+	operations map[string]*operationCounts
+}
+
+// BodySizes is the report of the body sizes of all operations
+var BodySizes = &BodySizeReport{operations: make(map[string]*operationCounts)}
+
+// add records the body sizes of the request handled by the validation handler
+func (r *BodySizeReport) add(ctx *fasthttp.RequestCtx) {
+	verdict := GetVerdict(ctx)
+	if verdict == nil || verdict.Operation == "" {
+		return
+	}
+
+	requestSize := int64(len(ctx.Request.Body()))
+	responseSize := int64(len(ctx.Response.Body()))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	counts, ok := r.operations[verdict.Operation]
+	if !ok {
+		counts = &operationCounts{
+			request:  sizeCounts{buckets: make([]int64, len(sizeBuckets)+1)},
+			response: sizeCounts{buckets: make([]int64, len(sizeBuckets)+1)},
+		}
+		r.operations[verdict.Operation] = counts
+	}
+
+	counts.request.add(requestSize)
+	counts.response.add(responseSize)
+}
+
+// Snapshot returns the distributions of the body sizes by operation
+func (r *BodySizeReport) Snapshot() map[string]OperationSizes {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	snapshot := make(map[string]OperationSizes, len(r.operations))
+	for operation, counts := range r.operations {
+		snapshot[operation] = OperationSizes{
+			Request:  counts.request.histogram(),
+			Response: counts.response.histogram(),
+		}
+	}
+
+	return snapshot
+}
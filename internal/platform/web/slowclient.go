@@ -0,0 +1,79 @@
+package web
+
+import (
+	"net"
+	"time"
+)
+
+// BodyReadTimeout returns the timeout of reading the request body of the content length. The minimum transfer
+// rate (bytes per second) shortens the timeout of the body of the known length, so the slow clients are
+// disconnected before the read timeout. The body of the unknown length is read by the read timeout
+func BodyReadTimeout(contentLength int, readTimeout time.Duration, minRate int, grace time.Duration) time.Duration {
+	if minRate <= 0 || contentLength < 0 {
+		return readTimeout
+	}
+
+	timeout := grace + time.Duration(contentLength)*time.Second/time.Duration(minRate)
+	if readTimeout > 0 && readTimeout < timeout {
+		return readTimeout
+	}
+
+	return timeout
+}
+
+// MinRateListener wraps the accepted connections by the minimum transfer rate (bytes per second) of the writes,
+// so the clients reading the responses slowly are disconnected before the write timeout
+func MinRateListener(ln net.Listener, minRate int, grace time.Duration) net.Listener {
+	return &minRateListener{Listener: ln, minRate: minRate, grace: grace}
+}
+
+type minRateListener struct {
+	net.Listener
+	minRate int
+	grace   time.Duration
+}
+
+func (l *minRateListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &minRateConn{Conn: conn, minRate: l.minRate, grace: l.grace}, nil
+}
+
+// minRateConn sets the write deadline of each write by the size of the written data. The deadline set
+// by the server is kept if it's earlier. The connection is served by the single goroutine
+type minRateConn struct {
+	net.Conn
+	minRate       int
+	grace         time.Duration
+	writeDeadline time.Time
+}
+
+func (c *minRateConn) SetDeadline(t time.Time) error {
+	c.writeDeadline = t
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *minRateConn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline = t
+	return c.Conn.SetWriteDeadline(t)
+}
+
+func (c *minRateConn) Write(b []byte) (int, error) {
+	deadline := time.Now().Add(c.grace + time.Duration(len(b))*time.Second/time.Duration(c.minRate))
+	if !c.writeDeadline.IsZero() && c.writeDeadline.Before(deadline) {
+		deadline = c.writeDeadline
+	}
+
+	if err := c.Conn.SetWriteDeadline(deadline); err != nil {
+		return 0, err
+	}
+
+	return c.Conn.Write(b)
+}
+
+// NetConn returns the underlying connection
+func (c *minRateConn) NetConn() net.Conn {
+	return c.Conn
+}
@@ -0,0 +1,106 @@
+package web
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"github.com/wallarm/api-firewall/internal/platform/useragent"
+)
+
+// verdictKey is the key of the verdict in the user values of the request context
+const verdictKey = "apifw.verdict"
+
+// Verdict is the decision made on the request by the validation handler. The verdict is stored
+// in the request context, so the middlewares and the plugins use the decision, the rule and the
+// durations without parsing the validation errors again
+type Verdict struct {
+	Decision  string `json:"decision"`
+	Rule      string `json:"rule,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	Subject   string `json:"subject,omitempty"`
+	Operation string `json:"operation,omitempty"`
+	Score     int    `json:"score,omitempty"`
+
+	RoutingTime            time.Duration `json:"routing_time"`
+	RequestValidationTime  time.Duration `json:"request_validation_time"`
+	UpstreamTime           time.Duration `json:"upstream_time"`
+	ResponseValidationTime time.Duration `json:"response_validation_time"`
+}
+
+// ValidationStatus returns the value of the APIFW-Validation-Status header in the format
+// rule:reason:subject. It returns nil if the verdict has no rule
+func (v *Verdict) ValidationStatus() *string {
+	if v.Rule == "" {
+		return nil
+	}
+
+	value := v.Rule + ": " + v.Reason
+	if v.Subject != "" {
+		value = v.Rule + ":" + v.Reason + ":" + v.Subject
+	}
+
+	return &value
+}
+
+// ServerTiming returns the value of the Server-Timing header with the time spent in the routing
+// and the middlewares, the request validation, the upstream and the response validation in milliseconds
+func (v *Verdict) ServerTiming() string {
+	return fmt.Sprintf("routing;dur=%.3f, request-validation;dur=%.3f, upstream;dur=%.3f, response-validation;dur=%.3f",
+		milliseconds(v.RoutingTime), milliseconds(v.RequestValidationTime), milliseconds(v.UpstreamTime), milliseconds(v.ResponseValidationTime))
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// SetVerdict stores the verdict in the request context
+func SetVerdict(ctx *fasthttp.RequestCtx, verdict *Verdict) {
+	ctx.SetUserValue(verdictKey, verdict)
+}
+
+// GetVerdict returns the verdict of the request. It returns nil if the request is not handled by the validation handler
+func GetVerdict(ctx *fasthttp.RequestCtx) *Verdict {
+	verdict, _ := ctx.UserValue(verdictKey).(*Verdict)
+	return verdict
+}
+
+// VerdictCounts counts the verdicts by decision
+type VerdictCounts struct {
+	mu        sync.Mutex
+	decisions map[string]int64
+}
+
+// Verdicts counts the verdicts of all requests
+var Verdicts = &VerdictCounts{decisions: make(map[string]int64)}
+
+func (c *VerdictCounts) add(ctx *fasthttp.RequestCtx) {
+	verdict := GetVerdict(ctx)
+	if verdict == nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.decisions[verdict.Decision]++
+	c.mu.Unlock()
+}
+
+// observeClient counts the request of the client by the device type parsed from the User-Agent header
+func observeClient(ctx *fasthttp.RequestCtx) {
+	verdict := GetVerdict(ctx)
+	useragent.Observe(ctx, verdict != nil && verdict.Decision == VerdictBlocked)
+}
+
+// Snapshot returns the copy of the counters
+func (c *VerdictCounts) Snapshot() map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	snapshot := make(map[string]int64, len(c.decisions))
+	for decision, count := range c.decisions {
+		snapshot[decision] = count
+	}
+
+	return snapshot
+}
@@ -3,6 +3,7 @@ package web
 import (
 	"fmt"
 	"os"
+	"strings"
 	"syscall"
 
 	"github.com/fasthttp/router"
@@ -13,10 +14,32 @@ import (
 
 const (
 	ValidationStatus = "APIFW-Validation-Status"
+	TimingHeader     = "Server-Timing"
+
+	VerdictHeader          = "X-APIFW-Verdict"
+	VerdictSignatureHeader = "X-APIFW-Verdict-Signature"
+
+	VerdictPassed  = "passed"
+	VerdictFailed  = "failed"
+	VerdictSkipped = "skipped"
+	VerdictBlocked = "blocked"
 
 	ValidationDisable = "DISABLE"
 	ValidationBlock   = "BLOCK"
 	ValidationLog     = "LOG_ONLY"
+
+	ClientAuthNone     = "NONE"
+	ClientAuthOptional = "OPTIONAL"
+	ClientAuthRequire  = "REQUIRE"
+
+	MethodOverrideAllow = "ALLOW"
+	MethodOverrideBlock = "BLOCK"
+	MethodOverrideApply = "APPLY"
+
+	ParameterPollutionAllow     = "ALLOW"
+	ParameterPollutionBlock     = "BLOCK"
+	ParameterPollutionKeepFirst = "KEEP_FIRST"
+	ParameterPollutionKeepLast  = "KEEP_LAST"
 )
 
 // A Handler is a type that handles an http request within our own little mini
@@ -32,6 +55,12 @@ type App struct {
 	shutdown chan os.Signal
 	cfg      *config.APIFWConfiguration
 	mw       []Middleware
+	paths    map[string][]string
+	static   map[string]fasthttp.RequestHandler
+
+	// ValidationModes returns the request and the response validation modes of the requests
+	// which are not found in the routes. The configured modes are used by default
+	ValidationModes func() (string, string)
 }
 
 func (a *App) SetDefaultBehavior(handler Handler, mw ...Middleware) {
@@ -44,7 +73,7 @@ func (a *App) SetDefaultBehavior(handler Handler, mw ...Middleware) {
 	customHandler := func(ctx *fasthttp.RequestCtx) {
 
 		// Block request if it's not found in the route
-		if a.cfg.RequestValidation == ValidationBlock || a.cfg.ResponseValidation == ValidationBlock {
+		if requestValidation, responseValidation := a.ValidationModes(); requestValidation == ValidationBlock || responseValidation == ValidationBlock {
 			a.Log.WithFields(logrus.Fields{
 				"request_id":     fmt.Sprintf("#%016X", ctx.ID()),
 				"method":         fmt.Sprintf("%s", ctx.Request.Header.Method()),
@@ -60,6 +89,9 @@ func (a *App) SetDefaultBehavior(handler Handler, mw ...Middleware) {
 			return
 		}
 
+		Verdicts.add(ctx)
+		observeClient(ctx)
+		BodySizes.add(ctx)
 	}
 
 	//Set NOT FOUND behavior
@@ -67,6 +99,28 @@ func (a *App) SetDefaultBehavior(handler Handler, mw ...Middleware) {
 
 	// Set Method Not Allowed behavior
 	a.Router.MethodNotAllowed = customHandler
+
+	if a.cfg.RespondMethodNotAllowed {
+		a.Router.MethodNotAllowed = func(ctx *fasthttp.RequestCtx) {
+
+			// Respond by 405 with the Allow header set by the router from the methods of the path in the spec
+			if requestValidation, responseValidation := a.ValidationModes(); requestValidation == ValidationBlock || responseValidation == ValidationBlock {
+				allow := string(ctx.Response.Header.Peek(fasthttp.HeaderAllow))
+				a.Log.WithFields(logrus.Fields{
+					"request_id":     fmt.Sprintf("#%016X", ctx.ID()),
+					"method":         fmt.Sprintf("%s", ctx.Request.Header.Method()),
+					"path":           fmt.Sprintf("%s", ctx.Path()),
+					"allow":          allow,
+					"client_address": ctx.RemoteAddr(),
+				}).Info("request blocked: method not allowed")
+				ctx.Error("", fasthttp.StatusMethodNotAllowed)
+				ctx.Response.Header.Set(fasthttp.HeaderAllow, allow)
+				return
+			}
+
+			customHandler(ctx)
+		}
+	}
 }
 
 // NewApp creates an App value that handle a set of routes for the application.
@@ -77,6 +131,12 @@ func NewApp(shutdown chan os.Signal, cfg *config.APIFWConfiguration, logger *log
 		mw:       mw,
 		Log:      logger,
 		cfg:      cfg,
+		paths:    make(map[string][]string),
+		static:   make(map[string]fasthttp.RequestHandler),
+	}
+
+	app.ValidationModes = func() (string, string) {
+		return cfg.RequestValidation, cfg.ResponseValidation
 	}
 
 	return &app
@@ -99,10 +159,130 @@ func (a *App) Handle(method string, path string, handler Handler, mw ...Middlewa
 			a.SignalShutdown()
 			return
 		}
+
+		Verdicts.add(ctx)
+		observeClient(ctx)
+		BodySizes.add(ctx)
 	}
 
 	// Add this handler for the specified verb and route.
 	a.Router.Handle(method, path, h)
+	a.paths[method] = append(a.paths[method], path)
+	if !strings.Contains(path, "{") {
+		a.static[method+" "+path] = h
+	}
+}
+
+// RouterHandler returns the router handler wrapped by the middleware which is executed before routing.
+func (a *App) RouterHandler(mw ...Middleware) fasthttp.RequestHandler {
+	handler := wrapMiddleware(mw, func(ctx *fasthttp.RequestCtx) error {
+		if h := a.staticRoute(ctx); h != nil {
+			h(ctx)
+			return nil
+		}
+		if h := a.lookup(ctx); h != nil {
+			h(ctx)
+			return nil
+		}
+		a.Router.Handler(ctx)
+		return nil
+	})
+
+	return func(ctx *fasthttp.RequestCtx) {
+		if err := handler(ctx); err != nil {
+			a.SignalShutdown()
+		}
+	}
+}
+
+// staticRoute returns the handler of the route without path parameters, so the router is skipped for the hot paths
+func (a *App) staticRoute(ctx *fasthttp.RequestCtx) fasthttp.RequestHandler {
+	return a.static[string(ctx.Method())+" "+string(ctx.Path())]
+}
+
+// lookup returns the handler of the route matched by the relaxed route matching rules
+// if the request path doesn't match any route exactly. The request path itself is not changed.
+func (a *App) lookup(ctx *fasthttp.RequestCtx) fasthttp.RequestHandler {
+	opts := a.cfg.RouteMatching
+	if !opts.IgnoreTrailingSlash && !opts.CaseInsensitive && !opts.CollapseSlashes {
+		return nil
+	}
+
+	method := string(ctx.Method())
+	path := string(ctx.Path())
+
+	// exact match is handled by the router
+	if h, _ := a.Router.Lookup(method, path, ctx); h != nil {
+		return nil
+	}
+
+	if opts.CollapseSlashes {
+		for strings.Contains(path, "//") {
+			path = strings.ReplaceAll(path, "//", "/")
+		}
+	}
+
+	candidates := []string{path}
+	if opts.IgnoreTrailingSlash && len(path) > 1 {
+		if strings.HasSuffix(path, "/") {
+			candidates = append(candidates, strings.TrimRight(path, "/"))
+		} else {
+			candidates = append(candidates, path+"/")
+		}
+	}
+
+	for _, candidate := range candidates {
+		if opts.CaseInsensitive {
+			candidate = a.caseInsensitivePath(method, candidate)
+		}
+		if h, _ := a.Router.Lookup(method, candidate, ctx); h != nil {
+			return h
+		}
+	}
+
+	return nil
+}
+
+// caseInsensitivePath returns the path with the static segments taken from the first route
+// which static segments are equal to the path segments under Unicode case-folding
+func (a *App) caseInsensitivePath(method, path string) string {
+	segments := strings.Split(path, "/")
+
+	for _, route := range a.paths[method] {
+		routeSegments := strings.Split(route, "/")
+		if len(routeSegments) != len(segments) {
+			continue
+		}
+
+		matched := true
+		for i, segment := range routeSegments {
+			if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+				if segments[i] == "" {
+					matched = false
+					break
+				}
+				continue
+			}
+			if !strings.EqualFold(segment, segments[i]) {
+				matched = false
+				break
+			}
+		}
+
+		if matched {
+			canonical := make([]string, len(segments))
+			for i, segment := range routeSegments {
+				if strings.HasPrefix(segment, "{") {
+					canonical[i] = segments[i]
+				} else {
+					canonical[i] = segment
+				}
+			}
+			return strings.Join(canonical, "/")
+		}
+	}
+
+	return path
 }
 
 // SignalShutdown is used to gracefully shutdown the app when an integrity
@@ -0,0 +1,11 @@
+
+
+
+test.proto
+apifw.test"B
+User
+email (	Remail
+age (Rage
+tags (	Rtags25
+Users,
+Create.apifw.test.User.apifw.test.Userbproto3
\ No newline at end of file